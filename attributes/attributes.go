@@ -0,0 +1,236 @@
+// Package attributes reads .gitattributes files and works out which
+// attributes apply to each path in the working tree.
+//
+// Each line of an attributes file is a pattern followed by attributes, which
+// may be set ("text"), unset ("-text"), given a value ("eol=crlf") or made
+// unspecified again ("!text"). Patterns without a slash match a file's name
+// at any depth below the directory holding the attributes file; others match
+// its path relative to that directory. Later lines, files in deeper
+// directories, and .git/info/attributes take precedence.
+package attributes
+
+import (
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/tpbowden/jit/pathspec"
+)
+
+// FileName is the name of the attributes file read from each directory.
+const FileName = ".gitattributes"
+
+// The states an attribute can have other than a value of its own.
+const (
+	Set   = "set"
+	Unset = "unset"
+)
+
+// Attributes maps the name of each attribute specified for a path to its
+// state: Set, Unset, or the value it was given. Unspecified attributes are
+// missing.
+type Attributes map[string]string
+
+// IsSet reports whether an attribute is set.
+func (a Attributes) IsSet(name string) bool {
+	return a[name] == Set
+}
+
+// IsUnset reports whether an attribute is unset.
+func (a Attributes) IsUnset(name string) bool {
+	return a[name] == Unset
+}
+
+// assignment is one attribute on a line. An empty value makes the attribute
+// unspecified.
+type assignment struct {
+	name  string
+	value string
+}
+
+type rule struct {
+	pattern     string
+	basename    bool
+	assignments []assignment
+}
+
+// builtinMacros holds the attributes each built-in macro attribute expands
+// to. The only one is binary.
+var builtinMacros = map[string][]assignment{
+	"binary": {{"diff", Unset}, {"merge", Unset}, {"text", Unset}},
+}
+
+// parseLine reads one line of an attributes file, returning false for blank
+// lines, comments and lines that cannot be used. Macro definitions are
+// returned with their name in macro.
+func parseLine(line string) (r rule, macro string, ok bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return r, "", false
+	}
+	var fields []string
+	if strings.HasPrefix(line, `"`) {
+		end := 1
+		for end < len(line) && line[end] != '"' {
+			if line[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(line) {
+			return r, "", false
+		}
+		pattern, err := strconv.Unquote(line[:end+1])
+		if err != nil {
+			return r, "", false
+		}
+		fields = append([]string{pattern}, strings.Fields(line[end+1:])...)
+	} else {
+		fields = strings.Fields(line)
+	}
+
+	r.pattern = fields[0]
+	if strings.HasPrefix(r.pattern, "[attr]") {
+		macro = strings.TrimPrefix(r.pattern, "[attr]")
+	} else if strings.HasPrefix(r.pattern, "!") {
+		// Negative patterns are not allowed in attributes files.
+		return r, "", false
+	}
+	r.basename = !strings.Contains(r.pattern, "/")
+	r.pattern = strings.TrimPrefix(r.pattern, "/")
+	for _, field := range fields[1:] {
+		switch {
+		case strings.HasPrefix(field, "-"):
+			r.assignments = append(r.assignments, assignment{field[1:], Unset})
+		case strings.HasPrefix(field, "!"):
+			r.assignments = append(r.assignments, assignment{field[1:], ""})
+		case strings.Contains(field, "="):
+			parts := strings.SplitN(field, "=", 2)
+			r.assignments = append(r.assignments, assignment{parts[0], parts[1]})
+		default:
+			r.assignments = append(r.assignments, assignment{field, Set})
+		}
+	}
+	return r, macro, true
+}
+
+// matches reports whether the rule applies to a path relative to the
+// directory its attributes file is in.
+func (r rule) matches(relative string) bool {
+	if r.basename {
+		return pathspec.Wildmatch(r.pattern, path.Base(relative), true)
+	}
+	return pathspec.Wildmatch(r.pattern, relative, true)
+}
+
+// Checker looks up the attributes of paths in a working tree, reading the
+// attributes file in each directory the first time it is needed.
+type Checker struct {
+	read   func(path string) ([]byte, error)
+	info   []rule
+	macros map[string][]assignment
+	dirs   map[string][]rule
+}
+
+// NewChecker creates a Checker that reads attributes files with read, which
+// is given slash-separated paths relative to the top of the working tree.
+// info holds the contents of .git/info/attributes, if any.
+func NewChecker(info []byte, read func(path string) ([]byte, error)) *Checker {
+	c := &Checker{read: read, macros: map[string][]assignment{}, dirs: map[string][]rule{}}
+	for name, expansion := range builtinMacros {
+		c.macros[name] = expansion
+	}
+	c.info = c.parse(info)
+	return c
+}
+
+func (c *Checker) parse(data []byte) []rule {
+	rules := []rule{}
+	for _, line := range strings.Split(string(data), "\n") {
+		r, macro, ok := parseLine(line)
+		if !ok {
+			continue
+		}
+		if macro != "" {
+			c.macros[macro] = r.assignments
+			continue
+		}
+		rules = append(rules, r)
+	}
+	return rules
+}
+
+// rules returns the rules from the attributes file in a directory, where ""
+// is the top of the working tree.
+func (c *Checker) rules(dir string) ([]rule, error) {
+	if rules, loaded := c.dirs[dir]; loaded {
+		return rules, nil
+	}
+	data, err := c.read(path.Join(dir, FileName))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	c.dirs[dir] = c.parse(data)
+	return c.dirs[dir], nil
+}
+
+// Forget drops the cached rules for the directory holding an attributes
+// file, so they are read again after it is written.
+func (c *Checker) Forget(file string) {
+	dir := path.Dir(file)
+	if dir == "." {
+		dir = ""
+	}
+	delete(c.dirs, dir)
+}
+
+// Check returns the attributes of a slash-separated path relative to the top
+// of the working tree.
+func (c *Checker) Check(file string) (Attributes, error) {
+	dirs := []string{""}
+	for i, char := range file {
+		if char == '/' {
+			dirs = append(dirs, file[:i])
+		}
+	}
+
+	result := Attributes{}
+	for _, dir := range dirs {
+		rules, err := c.rules(dir)
+		if err != nil {
+			return nil, err
+		}
+		relative := file
+		if dir != "" {
+			relative = file[len(dir)+1:]
+		}
+		c.apply(result, rules, relative)
+	}
+	c.apply(result, c.info, file)
+	return result, nil
+}
+
+func (c *Checker) apply(result Attributes, rules []rule, relative string) {
+	for _, r := range rules {
+		if r.matches(relative) {
+			c.assign(result, r.assignments, 0)
+		}
+	}
+}
+
+// assign applies assignments in order, expanding set macros into the
+// attributes they stand for. depth stops macros that refer to each other
+// from recursing forever.
+func (c *Checker) assign(result Attributes, assignments []assignment, depth int) {
+	for _, a := range assignments {
+		if expansion, isMacro := c.macros[a.name]; isMacro && a.value == Set && depth < 8 {
+			c.assign(result, expansion, depth+1)
+		}
+		if a.value == "" {
+			delete(result, a.name)
+		} else {
+			result[a.name] = a.value
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package attributes_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tpbowden/jit/attributes"
+	"github.com/tpbowden/jit/config"
+)
+
+func checker(files map[string]string, info string) *attributes.Checker {
+	return attributes.NewChecker([]byte(info), func(path string) ([]byte, error) {
+		if data, exists := files[path]; exists {
+			return []byte(data), nil
+		}
+		return nil, os.ErrNotExist
+	})
+}
+
+func TestCheckerAppliesRulesInPrecedenceOrder(t *testing.T) {
+	c := checker(map[string]string{
+		".gitattributes":     "# comment\n*.txt text eol=lf\n*.png binary\n/top.md -text\n[attr]docs text diff\n",
+		"sub/.gitattributes": "*.txt eol=crlf !diff\nnested/*.c filter=indent\n\"with space.txt\" -text\n",
+	}, "*.png diff\n")
+
+	cases := []struct {
+		path string
+		want attributes.Attributes
+	}{
+		{"a.txt", attributes.Attributes{"text": attributes.Set, "eol": "lf"}},
+		{"sub/a.txt", attributes.Attributes{"text": attributes.Set, "eol": "crlf"}},
+		{"sub/with space.txt", attributes.Attributes{"text": attributes.Unset, "eol": "crlf"}},
+		{"sub/nested/x.c", attributes.Attributes{"filter": "indent"}},
+		{"sub/other/nested/x.c", attributes.Attributes{}},
+		{"top.md", attributes.Attributes{"text": attributes.Unset}},
+		{"sub/top.md", attributes.Attributes{}},
+		{"img/a.png", attributes.Attributes{
+			"binary": attributes.Set,
+			"diff":   attributes.Set,
+			"merge":  attributes.Unset,
+			"text":   attributes.Unset,
+		}},
+	}
+	for _, tc := range cases {
+		got, err := c.Check(tc.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(tc.want) {
+			t.Fatalf("Unexpected attributes for %s: %v", tc.path, got)
+		}
+		for name, value := range tc.want {
+			if got[name] != value {
+				t.Fatalf("Unexpected attributes for %s: %v", tc.path, got)
+			}
+		}
+	}
+}
+
+func TestFilterConvertsLineEndingsAndRunsDrivers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jit_attributes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	gitDir := filepath.Join(dir, ".git")
+	if err := os.MkdirAll(gitDir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	attrs := "*.txt text\n*.bat eol=crlf\n*.up filter=upper\n*.strict filter=missing\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, ".gitattributes"), []byte(attrs), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.New(filepath.Join(gitDir, "config"))
+	if err := cfg.Open(); err != nil {
+		t.Fatal(err)
+	}
+	for key, value := range map[string]string{
+		"filter.upper.clean":      "tr a-z A-Z",
+		"filter.upper.smudge":     "tr A-Z a-z",
+		"filter.missing.required": "true",
+	} {
+		if err := cfg.Set(key, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	filter := attributes.NewFilter(dir, gitDir, cfg)
+
+	steps := []struct {
+		path, input, want string
+		clean             bool
+	}{
+		{"a.txt", "one\r\ntwo\r\n", "one\ntwo\n", true},
+		{"a.txt", "one\ntwo\n", "one\ntwo\n", false},
+		{"b.bat", "one\ntwo\r\n", "one\r\ntwo\r\n", false},
+		{"c.dat", "one\r\n", "one\r\n", true},
+		{"d.up", "shout\n", "SHOUT\n", true},
+		{"d.up", "WHISPER\n", "whisper\n", false},
+	}
+	for _, step := range steps {
+		convert := filter.Smudge
+		if step.clean {
+			convert = filter.Clean
+		}
+		got, err := convert(step.path, []byte(step.input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != step.want {
+			t.Fatalf("Converted %s %q to %q, expected %q", step.path, step.input, got, step.want)
+		}
+	}
+
+	if _, err := filter.Clean("e.strict", []byte("data")); err == nil {
+		t.Fatal("Expected an error")
+	} else if _, ok := err.(*attributes.FilterFailed); !ok {
+		t.Fatalf("Expected FilterFailed, got %v", err)
+	}
+}
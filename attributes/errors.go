@@ -0,0 +1,15 @@
+package attributes
+
+import "fmt"
+
+// FilterFailed is returned when a required filter driver fails, or has no
+// command set for converting a file.
+type FilterFailed struct {
+	Path      string
+	Driver    string
+	Direction string
+}
+
+func (e *FilterFailed) Error() string {
+	return fmt.Sprintf("%s: %s filter '%s' failed", e.Path, e.Direction, e.Driver)
+}
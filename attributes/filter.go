@@ -0,0 +1,212 @@
+package attributes
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/tpbowden/jit/config"
+)
+
+// Driver converts the contents of files whose filter attribute names it:
+// Clean when they are stored and Smudge when they are checked out.
+type Driver interface {
+	Clean(path string, data []byte) ([]byte, error)
+	Smudge(path string, data []byte) ([]byte, error)
+}
+
+// Filter converts files between the form kept in the working tree and the
+// form stored in the database, as their attributes and the config say. Text
+// files have their line endings normalised to LF when stored and converted
+// to the configured ending on checkout, and files with a filter attribute
+// are passed through its driver. Drivers are the clean and smudge commands
+// set as filter.<name>.clean and filter.<name>.smudge in config, or ones
+// built in with SetDriver.
+type Filter struct {
+	dir     string
+	gitDir  string
+	config  *config.Config
+	drivers map[string]Driver
+
+	mu      sync.Mutex
+	checker *Checker
+}
+
+// NewFilter creates a Filter for the working tree at dir, whose git
+// directory is gitDir. Attributes files are read when first needed.
+func NewFilter(dir, gitDir string, cfg *config.Config) *Filter {
+	return &Filter{dir: dir, gitDir: gitDir, config: cfg, drivers: map[string]Driver{}}
+}
+
+// SetDriver builds in the driver for a filter name, used for files whose
+// filter has no commands set in config.
+func (f *Filter) SetDriver(name string, driver Driver) {
+	f.drivers[name] = driver
+}
+
+// Check returns the attributes of a path relative to the top of the working
+// tree.
+func (f *Filter) Check(file string) (Attributes, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.checker == nil {
+		info, err := ioutil.ReadFile(filepath.Join(f.gitDir, "info", "attributes"))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		f.checker = NewChecker(info, func(name string) ([]byte, error) {
+			return ioutil.ReadFile(filepath.Join(f.dir, filepath.FromSlash(name)))
+		})
+	}
+	return f.checker.Check(filepath.ToSlash(file))
+}
+
+// eolMode is how a file's line endings are converted.
+type eolMode struct {
+	// text is set if line endings are converted at all, and auto if only
+	// when the file does not look binary.
+	text bool
+	auto bool
+	// crlf is set if files are checked out with CRLF endings.
+	crlf bool
+}
+
+func (f *Filter) eolMode(attrs Attributes) eolMode {
+	autocrlf, _ := f.config.Get("core.autocrlf")
+	autocrlf = strings.ToLower(autocrlf)
+	mode := eolMode{}
+	switch attrs["eol"] {
+	case "crlf":
+		mode.crlf = true
+	case "lf":
+	default:
+		coreEOL, _ := f.config.Get("core.eol")
+		mode.crlf = autocrlf == "true" || strings.ToLower(coreEOL) == "crlf"
+	}
+
+	switch text, specified := attrs["text"]; {
+	case text == Unset:
+	case text == Set:
+		mode.text = true
+	case text == "auto":
+		mode.text, mode.auto = true, true
+	case attrs["eol"] == "crlf" || attrs["eol"] == "lf":
+		mode.text = true
+	case !specified && (autocrlf == "true" || autocrlf == "input"):
+		mode.text, mode.auto = true, true
+	}
+	return mode
+}
+
+func looksBinary(data []byte) bool {
+	if len(data) > 8000 {
+		data = data[:8000]
+	}
+	return bytes.IndexByte(data, 0) != -1
+}
+
+// Clean converts the contents of a file in the working tree into the form to
+// store, running its filter driver and then normalising its line endings.
+func (f *Filter) Clean(file string, data []byte) ([]byte, error) {
+	attrs, err := f.Check(file)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = f.runDriver(attrs, file, data, "clean"); err != nil {
+		return nil, err
+	}
+	if mode := f.eolMode(attrs); mode.text && !(mode.auto && looksBinary(data)) {
+		data = bytes.Replace(data, []byte("\r\n"), []byte("\n"), -1)
+	}
+	return data, nil
+}
+
+// Smudge converts stored contents into the form to write to the working
+// tree, converting line endings and then running its filter driver.
+func (f *Filter) Smudge(file string, data []byte) ([]byte, error) {
+	attrs, err := f.Check(file)
+	if err != nil {
+		return nil, err
+	}
+	if mode := f.eolMode(attrs); mode.text && mode.crlf && !(mode.auto && looksBinary(data)) {
+		data = toCRLF(data)
+	}
+	if data, err = f.runDriver(attrs, file, data, "smudge"); err != nil {
+		return nil, err
+	}
+	if path.Base(filepath.ToSlash(file)) == FileName {
+		f.mu.Lock()
+		f.checker.Forget(filepath.ToSlash(file))
+		f.mu.Unlock()
+	}
+	return data, nil
+}
+
+// toCRLF turns each LF not already preceded by a CR into CRLF.
+func toCRLF(data []byte) []byte {
+	var result bytes.Buffer
+	for i, char := range data {
+		if char == '\n' && (i == 0 || data[i-1] != '\r') {
+			result.WriteByte('\r')
+		}
+		result.WriteByte(char)
+	}
+	return result.Bytes()
+}
+
+// runDriver passes data through the clean or smudge side of the driver named
+// by a file's filter attribute. A command that fails, or a driver that is
+// not set up, leaves the data as it was unless filter.<name>.required is
+// set.
+func (f *Filter) runDriver(attrs Attributes, file string, data []byte, direction string) ([]byte, error) {
+	name := attrs["filter"]
+	if name == "" || name == Set || name == Unset {
+		return data, nil
+	}
+	required, err := f.config.GetBool("filter."+name+".required", false)
+	if err != nil {
+		return nil, err
+	}
+
+	if command, exists := f.config.Get("filter." + name + "." + direction); exists {
+		output, err := f.runCommand(command, file, data)
+		if err != nil {
+			if required {
+				return nil, &FilterFailed{Path: file, Driver: name, Direction: direction}
+			}
+			return data, nil
+		}
+		return output, nil
+	}
+	if driver, builtin := f.drivers[name]; builtin {
+		if direction == "clean" {
+			return driver.Clean(file, data)
+		}
+		return driver.Smudge(file, data)
+	}
+	if required {
+		return nil, &FilterFailed{Path: file, Driver: name, Direction: direction}
+	}
+	return data, nil
+}
+
+// runCommand runs a filter command through the shell from the top of the
+// working tree, with %f replaced by the quoted path of the file, feeding it
+// data and returning what it prints.
+func (f *Filter) runCommand(command, file string, data []byte) ([]byte, error) {
+	quoted := "'" + strings.Replace(filepath.ToSlash(file), "'", `'\''`, -1) + "'"
+	cmd := exec.Command("sh", "-c", strings.Replace(command, "%f", quoted, -1))
+	cmd.Dir = f.dir
+	cmd.Stdin = bytes.NewReader(data)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	if err := cmd.Run(); err != nil {
+		return nil, err
+	}
+	return output.Bytes(), nil
+}
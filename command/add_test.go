@@ -12,10 +12,12 @@ import (
 )
 
 type TestHelper struct {
-	path string
-	t    *testing.T
-	repo *repository.Repository
-	cmd  *command.Command
+	path   string
+	t      *testing.T
+	repo   *repository.Repository
+	cmd    *command.Command
+	stdout *strings.Builder
+	stderr *strings.Builder
 }
 
 func NewTestHelper(test *testing.T) *TestHelper {
@@ -36,13 +38,113 @@ func NewTestHelper(test *testing.T) *TestHelper {
 		Stdin:  strings.NewReader(""),
 	}
 	return &TestHelper{
-		path: path,
-		repo: repo,
-		t:    test,
-		cmd:  cmd,
+		path:   path,
+		repo:   repo,
+		t:      test,
+		cmd:    cmd,
+		stdout: &stdout,
+		stderr: &stderr,
+	}
+}
+
+func (h *TestHelper) cleanup() {
+	os.RemoveAll(h.path)
+}
+
+func (h *TestHelper) writeFile(name, contents string) {
+	path := filepath.Join(h.path, name)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		h.t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		h.t.Fatal(err)
+	}
+}
+
+func (h *TestHelper) readFile(name string) string {
+	data, err := ioutil.ReadFile(filepath.Join(h.path, name))
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	return string(data)
+}
+
+func (h *TestHelper) jit(args ...string) int {
+	h.stdout.Reset()
+	h.stderr.Reset()
+	h.cmd.Args = append([]string{"jit"}, args...)
+	status, err := h.cmd.Execute()
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	return status
+}
+
+func (h *TestHelper) commit(message string) {
+	if status := h.jit("commit", "-m", message); status != 0 {
+		h.t.Fatalf("Commit failed: %s", h.stderr.String())
+	}
+}
+
+func (h *TestHelper) assertIndex(expected map[string]string) {
+	h.repo.Index.Clear()
+	if err := h.repo.Index.Load(); err != nil {
+		h.t.Fatal(err)
+	}
+	entries := h.repo.Index.Entries()
+	if len(entries) != len(expected) {
+		h.t.Fatalf("Expected %d index entries, got %d", len(expected), len(entries))
+	}
+	for _, entry := range entries {
+		blob, err := h.repo.Database.Load(entry.OID())
+		if err != nil {
+			h.t.Fatal(err)
+		}
+		if contents, ok := expected[entry.Path()]; !ok || contents != string(blob.Data()) {
+			h.t.Errorf("Unexpected index entry %s: %q", entry.Path(), blob.Data())
+		}
 	}
 }
 
 func TestAddingAFileToTheIndex(t *testing.T) {
 	helper := NewTestHelper(t)
+	defer helper.cleanup()
+
+	helper.jit("init")
+	helper.writeFile("hello.txt", "hello")
+	if status := helper.jit("add", "hello.txt"); status != 0 {
+		t.Fatalf("Expected add to succeed, got %d", status)
+	}
+
+	helper.assertIndex(map[string]string{"hello.txt": "hello"})
+}
+
+func TestAddingAndListingFilesWithPathspecs(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.cleanup()
+
+	helper.jit("init")
+	helper.writeFile("README.md", "readme")
+	helper.writeFile("docs/guide.md", "guide")
+	helper.writeFile("docs/notes.txt", "notes")
+	helper.writeFile("src/main.go", "main")
+	helper.writeFile("src/util/util.go", "util")
+
+	if status := helper.jit("add", "*.md", ":(glob)src/*.go"); status != 0 {
+		t.Fatalf("Expected add to succeed: %s", helper.stderr.String())
+	}
+	helper.assertIndex(map[string]string{"README.md": "readme", "docs/guide.md": "guide", "src/main.go": "main"})
+
+	if status := helper.jit("add", "*.rb"); status != 128 || !strings.Contains(helper.stderr.String(), "pathspec '*.rb' did not match any files") {
+		t.Fatalf("Expected an unmatched pathspec to fail, got %d: %s", status, helper.stderr.String())
+	}
+
+	helper.jit("ls-files", "-o", ":!src")
+	if out := helper.stdout.String(); out != "docs/notes.txt\n" {
+		t.Fatalf("Unexpected untracked files %q", out)
+	}
+	helper.jit("ls-files", ":(icase)DOCS", ":/src/main.go")
+	if out := helper.stdout.String(); out != "docs/guide.md\nsrc/main.go\n" {
+		t.Fatalf("Unexpected cached files %q", out)
+	}
 }
@@ -0,0 +1,181 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+
+	"github.com/tpbowden/jit/jit"
+)
+
+const bisectUsage = "usage: jit bisect [start [<bad> [<good>...]] | (bad|good|skip) [<rev>...] | reset [<commit>] | log | replay <logfile> | run <cmd>...]"
+
+func (c *Command) cmdBisect() (int, error) {
+	if len(c.Args) < 3 {
+		fmt.Fprintln(c.Stderr, bisectUsage)
+		return 129, nil
+	}
+	subcommand, args := c.Args[2], c.Args[3:]
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+	switch {
+	case subcommand == "bad" && len(args) > 1:
+		fmt.Fprintln(c.Stderr, "error: 'jit bisect bad' can take only one argument.")
+		return 129, nil
+	case subcommand == "reset" && len(args) > 1, subcommand == "log" && len(args) > 0,
+		subcommand == "replay" && len(args) != 1, subcommand == "run" && len(args) == 0:
+		fmt.Fprintln(c.Stderr, bisectUsage)
+		return 129, nil
+	}
+
+	repo, status, err := c.open()
+	if repo == nil {
+		return status, err
+	}
+
+	var result *jit.BisectResult
+	switch subcommand {
+	case "start":
+		options := jit.BisectOptions{}
+		if len(args) > 0 {
+			options.Bad, options.Good = args[0], args[1:]
+		}
+		result, err = repo.BisectStart(c.context(), options)
+	case "bad", "good", "skip":
+		result, err = repo.BisectMark(c.context(), subcommand, args...)
+	case "reset":
+		var checkout *jit.CheckoutResult
+		revision := ""
+		if len(args) > 0 {
+			revision = args[0]
+		}
+		if checkout, err = repo.BisectReset(c.context(), revision); err == nil {
+			if checkout.Detached() {
+				fmt.Fprintf(c.Stderr, "HEAD is now at %s\n", checkout.OID[:7])
+			} else {
+				fmt.Fprintf(c.Stderr, "Switched to branch '%s'\n", checkout.Branch)
+			}
+			return 0, nil
+		}
+	case "log":
+		var log string
+		if log, err = repo.BisectLog(); err == nil {
+			fmt.Fprint(c.Stdout, log)
+			return 0, nil
+		}
+	case "replay":
+		var log []byte
+		if log, err = ioutil.ReadFile(c.expandPath(args[0])); err != nil {
+			fmt.Fprintf(c.Stderr, "fatal: cannot read file '%s' for replaying\n", args[0])
+			return 128, nil
+		}
+		result, err = repo.BisectReplay(c.context(), string(log))
+	case "run":
+		quoted := []string{}
+		for _, arg := range args {
+			quoted = append(quoted, "'"+strings.Replace(arg, "'", `'\''`, -1)+"'")
+		}
+		command := strings.Join(quoted, " ")
+		result, err = repo.BisectRun(c.context(), func(ctx context.Context, step *jit.BisectResult) (int, error) {
+			c.printBisectStep(step)
+			fmt.Fprintf(c.Stdout, "running %s\n", command)
+			return c.bisectTest(ctx, command)
+		})
+		if err == nil {
+			c.printBisectStep(result)
+			if result.Culprit == nil {
+				return 1, nil
+			}
+			fmt.Fprintln(c.Stdout, "bisect found first bad commit")
+			return 0, nil
+		}
+	default:
+		fmt.Fprintln(c.Stderr, bisectUsage)
+		return 129, nil
+	}
+	if err != nil {
+		return c.bisectFailed(err)
+	}
+
+	c.printBisectStep(result)
+	if len(result.Suspects) > 0 {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// bisectTest runs the command given to bisect run through the shell, from the
+// top of the working tree, returning its exit code.
+func (c *Command) bisectTest(ctx context.Context, command string) (int, error) {
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Dir = c.Dir
+	cmd.Stdin = c.Stdin
+	cmd.Stdout = c.Stdout
+	cmd.Stderr = c.Stderr
+	for name, value := range c.Env {
+		cmd.Env = append(cmd.Env, name+"="+value)
+	}
+	err := cmd.Run()
+	if exit, ok := err.(*exec.ExitError); ok {
+		return exit.ExitCode(), nil
+	}
+	return 0, err
+}
+
+func (c *Command) printBisectStep(result *jit.BisectResult) {
+	switch {
+	case result.Culprit != nil:
+		fmt.Fprintf(c.Stdout, "%s is the first bad commit\n", result.Culprit.OID)
+		c.printCommit(*result.Culprit)
+	case len(result.Suspects) > 0:
+		fmt.Fprintln(c.Stdout, "There are only 'skip'ped commits left to test.")
+		fmt.Fprintln(c.Stdout, "The first bad commit could be any of:")
+		for _, commit := range result.Suspects {
+			fmt.Fprintln(c.Stdout, commit.OID)
+		}
+		fmt.Fprintln(c.Stdout, "We cannot bisect more!")
+	case result.Current != nil:
+		fmt.Fprintf(c.Stdout, "Bisecting: %d %s left to test after this (roughly %d %s)\n",
+			result.Remaining, plural(result.Remaining, "revision", "revisions"),
+			result.Steps, plural(result.Steps, "step", "steps"))
+		fmt.Fprintf(c.Stdout, "[%s] %s\n", result.Current.OID, result.Current.Summary())
+	case result.Bad == "" && result.Good == 0:
+		fmt.Fprintln(c.Stderr, "status: waiting for both good and bad commits")
+	case result.Bad == "":
+		fmt.Fprintf(c.Stderr, "status: waiting for bad commit, %d good %s known\n",
+			result.Good, plural(result.Good, "commit", "commits"))
+	default:
+		fmt.Fprintln(c.Stderr, "status: waiting for good commit(s), bad commit known")
+	}
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
+
+func (c *Command) bisectFailed(err error) (int, error) {
+	switch err := err.(type) {
+	case *jit.NoBisect:
+		fmt.Fprintln(c.Stderr, err.Error())
+		fmt.Fprintln(c.Stderr, "You need to start by \"jit bisect start\"")
+		return 1, nil
+	case *jit.NoBisectRange, *jit.InvalidBisectLog, *jit.BisectRunFailed:
+		fmt.Fprintln(c.Stderr, "error:", err.Error())
+		return 1, nil
+	case *jit.CheckoutConflict, *jit.LocalChanges:
+		fmt.Fprintln(c.Stderr, "error:", err.Error())
+		fmt.Fprintln(c.Stderr, "Please commit your changes or stash them before you switch branches.")
+		fmt.Fprintln(c.Stderr, "Aborting")
+		return 1, nil
+	case *jit.InvalidRevision, *jit.LockDenied:
+		fmt.Fprintln(c.Stderr, "fatal:", err.Error())
+		return 128, nil
+	}
+	return 1, err
+}
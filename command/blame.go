@@ -0,0 +1,206 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tpbowden/jit/jit"
+)
+
+const blameDateFormat = "2006-01-02 15:04:05 -0700"
+
+// parseLineRange reads the argument of -L: "start,end", "start,+count",
+// "start" or ",end", returning zero for an open end.
+func parseLineRange(value string) (int, int, bool) {
+	if value == "" {
+		return 0, 0, true
+	}
+	parts := strings.SplitN(value, ",", 2)
+	start, end := 0, 0
+	var err error
+	if parts[0] != "" {
+		if start, err = strconv.Atoi(parts[0]); err != nil || start < 1 {
+			return 0, 0, false
+		}
+	}
+	if len(parts) == 1 || parts[1] == "" {
+		return start, end, true
+	}
+	if strings.HasPrefix(parts[1], "+") {
+		count, err := strconv.Atoi(parts[1][1:])
+		if err != nil || count < 1 {
+			return 0, 0, false
+		}
+		if start == 0 {
+			start = 1
+		}
+		return start, start + count - 1, true
+	}
+	end, err = strconv.Atoi(parts[1])
+	return start, end, err == nil && end >= 1
+}
+
+// blameCommit describes the commit a line is attributed to, standing in an
+// uncommitted one for lines changed in the working tree.
+func blameCommit(blame *jit.Blame, oid string) jit.CommitInfo {
+	if commit, ok := blame.Commits[oid]; ok {
+		return commit
+	}
+	now := jit.Signature{Name: "Not Committed Yet", Email: "not.committed.yet", When: time.Now()}
+	return jit.CommitInfo{
+		OID:       oid,
+		Author:    now,
+		Committer: now,
+		Message:   "Version of " + blame.Path + " from " + blame.Path + "\n",
+	}
+}
+
+func (c *Command) cmdBlame() (int, error) {
+	flags := flag.NewFlagSet("blame", flag.ContinueOnError)
+	flags.SetOutput(c.Stderr)
+	renames := flags.Bool("M", false, "follow lines through renamed files")
+	lineRange := flags.String("L", "", "blame only the given range of lines, as <start>,<end>")
+	porcelain := flags.Bool("porcelain", false, "show the results in a format meant for machines")
+	if err := flags.Parse(c.Args[2:]); err != nil {
+		return 129, nil
+	}
+	start, end, ok := parseLineRange(*lineRange)
+	if !ok {
+		fmt.Fprintf(c.Stderr, "fatal: invalid line range -L %s\n", *lineRange)
+		return 128, nil
+	}
+	args := flags.Args()
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+	if len(args) == 0 || len(args) > 2 {
+		fmt.Fprintln(c.Stderr, "usage: jit blame [-M] [-L <start>,<end>] [--porcelain] [<rev>] <file>")
+		return 129, nil
+	}
+	revision := ""
+	if len(args) == 2 {
+		revision, args = args[0], args[1:]
+	}
+
+	repo, status, err := c.open()
+	if repo == nil {
+		return status, err
+	}
+	blame, err := repo.Blame(c.context(), jit.BlameOptions{
+		Path:     c.expandPath(args[0]),
+		Revision: revision,
+		Start:    start,
+		End:      end,
+		Renames:  *renames,
+	})
+	switch err := err.(type) {
+	case nil:
+	case *jit.NoSuchPath, *jit.InvalidLineRange, *jit.InvalidRevision:
+		fmt.Fprintln(c.Stderr, "fatal:", err.Error())
+		return 128, nil
+	default:
+		return 1, err
+	}
+
+	if *porcelain {
+		c.blamePorcelain(blame)
+	} else {
+		c.blameDefault(blame)
+	}
+	return 0, nil
+}
+
+// blameDefault prints each line with its abbreviated commit, author, date
+// and line number, and its original path if any line came from another
+// file. Root commits are marked with a caret.
+func (c *Command) blameDefault(blame *jit.Blame) {
+	authorWidth, numberWidth, pathWidth := 0, 1, 0
+	showPaths := false
+	for _, line := range blame.Lines {
+		commit := blameCommit(blame, line.OID)
+		if len(commit.Author.Name) > authorWidth {
+			authorWidth = len(commit.Author.Name)
+		}
+		if width := len(strconv.Itoa(line.Number)); width > numberWidth {
+			numberWidth = width
+		}
+		if len(line.Path) > pathWidth {
+			pathWidth = len(line.Path)
+		}
+		showPaths = showPaths || line.Path != blame.Path
+	}
+
+	for _, line := range blame.Lines {
+		commit := blameCommit(blame, line.OID)
+		oid := line.OID[0:8]
+		if len(commit.Parents) == 0 && line.OID != jit.NotCommittedOID {
+			oid = "^" + line.OID[0:7]
+		}
+		if showPaths {
+			oid += fmt.Sprintf(" %-*s", pathWidth, line.Path)
+		}
+		fmt.Fprintf(c.Stdout, "%s (%-*s %s %*d) %s", oid, authorWidth, commit.Author.Name,
+			commit.Author.When.Format(blameDateFormat), numberWidth, line.Number, line.Text)
+		if !strings.HasSuffix(line.Text, "\n") {
+			fmt.Fprintln(c.Stdout)
+		}
+	}
+}
+
+// blamePorcelain prints the result in git's porcelain format: a header for
+// each run of lines from the same commit, with the commit's details the
+// first time it appears, and each line's text prefixed by a tab.
+func (c *Command) blamePorcelain(blame *jit.Blame) {
+	shown := map[string]string{}
+	for i, line := range blame.Lines {
+		previous := jit.BlameLine{}
+		if i > 0 {
+			previous = blame.Lines[i-1]
+		}
+		if previous.OID == line.OID && previous.Path == line.Path && previous.OriginalNumber+1 == line.OriginalNumber {
+			fmt.Fprintf(c.Stdout, "%s %d %d\n", line.OID, line.OriginalNumber, line.Number)
+		} else {
+			count := 1
+			for count+i < len(blame.Lines) {
+				next := blame.Lines[i+count]
+				if next.OID != line.OID || next.Path != line.Path || next.OriginalNumber != line.OriginalNumber+count {
+					break
+				}
+				count++
+			}
+			fmt.Fprintf(c.Stdout, "%s %d %d %d\n", line.OID, line.OriginalNumber, line.Number, count)
+
+			path, seen := shown[line.OID]
+			if !seen {
+				commit := blameCommit(blame, line.OID)
+				for _, person := range []struct {
+					role      string
+					signature jit.Signature
+				}{{"author", commit.Author}, {"committer", commit.Committer}} {
+					fmt.Fprintf(c.Stdout, "%s %s\n", person.role, person.signature.Name)
+					fmt.Fprintf(c.Stdout, "%s-mail <%s>\n", person.role, person.signature.Email)
+					fmt.Fprintf(c.Stdout, "%s-time %d\n", person.role, person.signature.When.Unix())
+					fmt.Fprintf(c.Stdout, "%s-tz %s\n", person.role, person.signature.When.Format("-0700"))
+				}
+				fmt.Fprintf(c.Stdout, "summary %s\n", commit.Summary())
+				if len(commit.Parents) == 0 && line.OID != jit.NotCommittedOID {
+					fmt.Fprintln(c.Stdout, "boundary")
+				}
+				if line.Previous != "" {
+					fmt.Fprintf(c.Stdout, "previous %s %s\n", line.Previous, line.PreviousPath)
+				}
+			}
+			if !seen || path != line.Path {
+				fmt.Fprintf(c.Stdout, "filename %s\n", line.Path)
+				shown[line.OID] = line.Path
+			}
+		}
+		fmt.Fprintf(c.Stdout, "\t%s", line.Text)
+		if !strings.HasSuffix(line.Text, "\n") {
+			fmt.Fprintln(c.Stdout)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package command_test
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBlameFollowsRenamesWithM(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.cleanup()
+
+	helper.jit("init")
+	helper.writeFile("old.txt", "one\ntwo\n")
+	helper.jit("add", ".")
+	helper.commit("first")
+	helper.jit("mv", "old.txt", "new.txt")
+	helper.writeFile("new.txt", "one\ntwo\nthree\n")
+	helper.jit("add", ".")
+	helper.commit("second")
+
+	if status := helper.jit("blame", "--porcelain", "new.txt"); status != 0 {
+		t.Fatalf("Expected blame to succeed: %s", helper.stderr.String())
+	}
+	if strings.Contains(helper.stdout.String(), "old.txt") {
+		t.Fatalf("Expected renames not to be followed, got %q", helper.stdout.String())
+	}
+
+	if status := helper.jit("blame", "-M", "-L", "2,+2", "new.txt"); status != 0 {
+		t.Fatalf("Expected blame to succeed: %s", helper.stderr.String())
+	}
+	lines := strings.Split(strings.TrimSuffix(helper.stdout.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected two lines, got %q", helper.stdout.String())
+	}
+	if !strings.HasPrefix(lines[0], "^") || !strings.Contains(lines[0], " old.txt (") || !strings.HasSuffix(lines[0], " 2) two") {
+		t.Errorf("Expected line 2 to come from old.txt, got %q", lines[0])
+	}
+	if strings.HasPrefix(lines[1], "^") || !strings.Contains(lines[1], " new.txt (") || !strings.HasSuffix(lines[1], " 3) three") {
+		t.Errorf("Expected line 3 to come from new.txt, got %q", lines[1])
+	}
+
+	if status := helper.jit("blame", "-L", "4", "new.txt"); status != 128 {
+		t.Fatalf("Expected blame to fail, got %d", status)
+	}
+}
@@ -0,0 +1,51 @@
+package command
+
+import (
+	"fmt"
+
+	"github.com/tpbowden/jit/jit"
+)
+
+func (c *Command) cmdCheckout() (int, error) {
+	if len(c.Args) != 3 {
+		fmt.Fprintln(c.Stderr, "usage: jit checkout <branch>|<revision>")
+		return 129, nil
+	}
+	target := c.Args[2]
+
+	repo, status, err := c.open()
+	if repo == nil {
+		return status, err
+	}
+
+	result, err := repo.Checkout(c.context(), target)
+	switch err := err.(type) {
+	case nil:
+	case *jit.CheckoutConflict:
+		fmt.Fprintln(c.Stderr, "error:", err.Error())
+		fmt.Fprintln(c.Stderr, "Please commit your changes or stash them before you switch branches.")
+		fmt.Fprintln(c.Stderr, "Aborting")
+		return 1, nil
+	case *jit.InvalidRevision:
+		fmt.Fprintf(c.Stderr, "error: pathspec '%s' did not match any file(s) known to jit\n", target)
+		return 1, nil
+	case *jit.LockDenied:
+		fmt.Fprintln(c.Stderr, "fatal:", err.Error())
+		return 128, nil
+	default:
+		return 1, err
+	}
+
+	switch {
+	case result.Detached():
+		if result.PreviousBranch == "" && result.PreviousOID != result.OID {
+			fmt.Fprintf(c.Stderr, "Previous HEAD position was %s\n", result.PreviousOID[:7])
+		}
+		fmt.Fprintf(c.Stderr, "HEAD is now at %s\n", result.OID[:7])
+	case result.Branch == result.PreviousBranch:
+		fmt.Fprintf(c.Stderr, "Already on '%s'\n", result.Branch)
+	default:
+		fmt.Fprintf(c.Stderr, "Switched to branch '%s'\n", result.Branch)
+	}
+	return 0, nil
+}
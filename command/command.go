@@ -1,11 +1,15 @@
 package command
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"path/filepath"
 	"strings"
+
+	"github.com/tpbowden/jit/jit"
 )
 
 type Command struct {
@@ -21,9 +25,34 @@ type CommandFn func() (int, error)
 
 func (c *Command) Execute() (int, error) {
 	commands := map[string]CommandFn{
-		"add":    c.cmdAdd,
-		"init":   c.cmdInit,
-		"commit": c.cmdCommit,
+		"add":             c.cmdAdd,
+		"bisect":          c.cmdBisect,
+		"blame":           c.cmdBlame,
+		"checkout":        c.cmdCheckout,
+		"cherry-pick":     c.cmdCherryPick,
+		"clone":           c.cmdClone,
+		"commit":          c.cmdCommit,
+		"diff":            c.cmdDiff,
+		"fetch":           c.cmdFetch,
+		"grep":            c.cmdGrep,
+		"init":            c.cmdInit,
+		"lfs":             c.cmdLfs,
+		"log":             c.cmdLog,
+		"ls-files":        c.cmdLsFiles,
+		"mv":              c.cmdMv,
+		"push":            c.cmdPush,
+		"rebase":          c.cmdRebase,
+		"receive-pack":    c.cmdReceivePack,
+		"remote":          c.cmdRemote,
+		"reset":           c.cmdReset,
+		"revert":          c.cmdRevert,
+		"rm":              c.cmdRm,
+		"sparse-checkout": c.cmdSparseCheckout,
+		"stash":           c.cmdStash,
+		"status":          c.cmdStatus,
+		"tag":             c.cmdTag,
+		"unlock":          c.cmdUnlock,
+		"upload-pack":     c.cmdUploadPack,
 	}
 
 	cmd := c.Args[1]
@@ -35,6 +64,60 @@ func (c *Command) Execute() (int, error) {
 	return f()
 }
 
+func (c *Command) context() context.Context {
+	return context.Background()
+}
+
+func (c *Command) identity() jit.Signature {
+	return jit.Signature{Name: c.Env["GIT_AUTHOR_NAME"], Email: c.Env["GIT_AUTHOR_EMAIL"]}
+}
+
+// open opens the repository through the library API. If it fails with a
+// status to exit with, the error has already been reported.
+func (c *Command) open() (*jit.Repository, int, error) {
+	repo, err := jit.Open(c.context(), c.Dir)
+	if err != nil {
+		if _, ok := err.(*jit.NotRepository); ok {
+			fmt.Fprintln(c.Stderr, "fatal:", err.Error())
+			return nil, 128, nil
+		}
+		return nil, 1, err
+	}
+	repo.SetIdentity(c.identity())
+	return repo, 0, nil
+}
+
+// expandPath resolves a path given on the command line against the
+// command's working directory.
+func (c *Command) expandPath(path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(c.Dir, path)
+}
+
+// isPathArgument reports whether an argument given before "--" is a path
+// rather than a revision: one that exists in the working tree, or a pattern
+// with magic or wildcards.
+func (c *Command) isPathArgument(arg string) bool {
+	if strings.HasPrefix(arg, ":") || strings.ContainsAny(arg, "*?[") {
+		return true
+	}
+	_, err := os.Stat(c.expandPath(arg))
+	return err == nil
+}
+
+// pathspecFailed reports an error parsing or matching a pathspec, returning
+// false if err is something else.
+func (c *Command) pathspecFailed(err error) (int, bool) {
+	switch err.(type) {
+	case *jit.InvalidPathspec, *jit.PathspecOutside, *jit.UnmatchedPathspec:
+		fmt.Fprintln(c.Stderr, "fatal:", err.Error())
+		return 128, true
+	}
+	return 0, false
+}
+
 func allEnvVars() map[string]string {
 	result := map[string]string{}
 	for _, env := range os.Environ() {
@@ -1,73 +1,254 @@
 package command
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"io/ioutil"
+	"os/exec"
 	"path/filepath"
 	"strings"
-	"time"
 
-	"github.com/tpbowden/jit/database"
-	"github.com/tpbowden/jit/repository"
+	"github.com/tpbowden/jit/config"
+	"github.com/tpbowden/jit/jit"
 )
 
-func (c *Command) cmdCommit() (int, error) {
-	dir := c.Dir
-	gitDir := filepath.Join(dir, ".git")
-	repo := repository.New(gitDir)
-	if err := repo.Index.Load(); err != nil {
-		return 1, err
+const commitTemplate = `
+# Please enter the commit message for your changes. Lines starting
+# with '#' will be ignored, and an empty message aborts the commit.
+`
+
+// messageList collects the values of a repeated -m flag.
+type messageList []string
+
+func (m *messageList) String() string {
+	return strings.Join(*m, "\n\n")
+}
+
+func (m *messageList) Set(value string) error {
+	*m = append(*m, value)
+	return nil
+}
+
+// cleanMessage removes trailing whitespace and surrounding blank lines from a
+// commit message, collapsing runs of blank lines, and optionally drops
+// comment lines. A non-empty result always ends in a newline.
+func cleanMessage(message string, stripComments bool) string {
+	lines := []string{}
+	blank := false
+	for _, line := range strings.Split(message, "\n") {
+		if stripComments && strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" {
+			blank = len(lines) > 0
+			continue
+		}
+		if blank {
+			lines = append(lines, "")
+			blank = false
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func (c *Command) editor(cfg *config.Config) string {
+	if editor := c.Env["GIT_EDITOR"]; editor != "" {
+		return editor
+	}
+	if editor, ok := cfg.Get("core.editor"); ok && editor != "" {
+		return editor
+	}
+	for _, name := range []string{"VISUAL", "EDITOR"} {
+		if editor := c.Env[name]; editor != "" {
+			return editor
+		}
+	}
+	return "vi"
+}
+
+// runEditor opens the user's editor on a file, waiting for it to exit.
+func (c *Command) runEditor(cfg *config.Config, path string) error {
+	editor := c.editor(cfg)
+	cmd := exec.Command("sh", "-c", editor+` "$@"`, editor, path)
+	cmd.Dir = c.Dir
+	cmd.Stdin = c.Stdin
+	cmd.Stdout = c.Stdout
+	cmd.Stderr = c.Stderr
+	for name, value := range c.Env {
+		cmd.Env = append(cmd.Env, name+"="+value)
 	}
-	entries := repo.Index.Entries()
-	dbEntries := make([]database.DatabaseEntry, len(entries))
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("There was a problem with the editor '%s'.", editor)
+	}
+	return nil
+}
 
-	for i, entry := range entries {
-		dbEntries[i] = entry
+// editMessage opens the user's editor on COMMIT_EDITMSG, seeded with the given
+// message, and returns the edited text with comments removed.
+func (c *Command) editMessage(cfg *config.Config, initial string) (string, error) {
+	path := filepath.Join(c.Dir, ".git", "COMMIT_EDITMSG")
+	if err := ioutil.WriteFile(path, []byte(initial+commitTemplate), 0644); err != nil {
+		return "", err
 	}
+	if err := c.runEditor(cfg, path); err != nil {
+		return "", err
+	}
+
+	edited, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return cleanMessage(string(edited), true), nil
+}
 
-	tree := database.BuildTree(dbEntries)
-	tree.Traverse(func(t database.Tree) {
-		if err := repo.Database.Store(t); err != nil {
-			panic(err)
+// hookRejected is returned through the library when a commit hook fails, so
+// the command can exit quietly after the hook has printed its own output.
+type hookRejected struct{}
+
+func (hookRejected) Error() string {
+	return "rejected by hook"
+}
+
+// messageFailed wraps errors reading a message file or running the editor.
+type messageFailed struct {
+	err error
+}
+
+func (e messageFailed) Error() string {
+	return e.err.Error()
+}
+
+// verifyMessage passes the message through the commit-msg hook, which may
+// edit COMMIT_EDITMSG in place. A message written in the editor is already
+// there, along with its comments, which are stripped again afterwards.
+func (c *Command) verifyMessage(cfg *config.Config, message string, edited bool, env map[string]string) (string, error) {
+	path := filepath.Join(c.Dir, ".git", "COMMIT_EDITMSG")
+	if !edited {
+		if err := ioutil.WriteFile(path, []byte(message), 0644); err != nil {
+			return "", err
 		}
-	})
-	authorName := c.Env["GIT_AUTHOR_NAME"]
-	authorEmail := c.Env["GIT_AUTHOR_EMAIL"]
-	author := database.NewAuthor(authorName, authorEmail)
-	message, err := ioutil.ReadAll(c.Stdin)
+	}
+	status, err := c.runHook(cfg, "commit-msg", nil, env, path)
 	if err != nil {
-		return 1, err
+		return "", err
 	}
-	parent, err := repo.Refs.ReadHead()
+	if status != 0 {
+		return "", hookRejected{}
+	}
+
+	contents, err := ioutil.ReadFile(path)
 	if err != nil {
-		return 1, err
+		return "", err
 	}
-	commit := database.NewCommit(
-		author,
-		database.ObjectID(tree),
-		parent,
-		string(message),
-		time.Now(),
-	)
-	if err := repo.Database.Store(commit); err != nil {
+	return cleanMessage(string(contents), edited), nil
+}
+
+func (c *Command) cmdCommit() (int, error) {
+	flags := flag.NewFlagSet("commit", flag.ContinueOnError)
+	flags.SetOutput(c.Stderr)
+	var messages messageList
+	flags.Var(&messages, "m", "use the given message; multiple -m options become separate paragraphs")
+	file := flags.String("F", "", "take the commit message from the given file, or - for stdin")
+	amend := flags.Bool("amend", false, "replace the tip of the current branch")
+	allowEmpty := flags.Bool("allow-empty", false, "allow recording a commit with an unchanged tree")
+	noVerify := flags.Bool("no-verify", false, "bypass the pre-commit and commit-msg hooks")
+	flags.BoolVar(noVerify, "n", false, "shorthand for --no-verify")
+	if err := flags.Parse(c.Args[2:]); err != nil {
+		return 129, nil
+	}
+	if len(messages) > 0 && *file != "" {
+		fmt.Fprintln(c.Stderr, "fatal: Option -m cannot be combined with -F.")
+		return 128, nil
+	}
+
+	repo, status, err := c.open()
+	if repo == nil {
+		return status, err
+	}
+	hookEnv := map[string]string{"GIT_INDEX_FILE": filepath.Join(c.Dir, ".git", "index")}
+	if !*noVerify {
+		if status, err := c.runHook(repo.Config(), "pre-commit", nil, hookEnv); err != nil || status != 0 {
+			return 1, err
+		}
+	}
+
+	options := jit.CommitOptions{
+		Amend:      *amend,
+		AllowEmpty: *allowEmpty,
+		EditMessage: func(ctx context.Context, proposed string) (string, error) {
+			var message string
+			var err error
+			edited := false
+			switch {
+			case len(messages) > 0:
+				message = cleanMessage(messages.String(), false)
+			case *file == "-":
+				var data []byte
+				data, err = ioutil.ReadAll(c.Stdin)
+				message = cleanMessage(string(data), false)
+			case *file != "":
+				var data []byte
+				data, err = ioutil.ReadFile(c.expandPath(*file))
+				message = cleanMessage(string(data), false)
+			default:
+				message, err = c.editMessage(repo.Config(), proposed)
+				edited = true
+			}
+			if err != nil {
+				return "", messageFailed{err}
+			}
+			if message == "" || *noVerify {
+				return message, nil
+			}
+			return c.verifyMessage(repo.Config(), message, edited, hookEnv)
+		},
+	}
+	if !*amend {
+		identity := c.identity()
+		options.Author = &identity
+	}
+
+	result, err := repo.Commit(c.context(), options)
+	switch err := err.(type) {
+	case nil:
+	case hookRejected:
+		return 1, nil
+	case *jit.NothingToCommit:
+		if err.Amend {
+			fmt.Fprintln(c.Stderr, "You asked to amend the most recent commit, but doing so would make")
+			fmt.Fprintln(c.Stderr, "it empty. Use --allow-empty to record it anyway.")
+		} else {
+			fmt.Fprintln(c.Stdout, err.Error())
+		}
+		return 1, nil
+	case *jit.EmptyMessage:
+		fmt.Fprintln(c.Stderr, err.Error())
+		return 1, nil
+	case *jit.UnmergedPaths:
+		fmt.Fprintln(c.Stderr, "error:", err.Error())
+		fmt.Fprintln(c.Stderr, "fatal: Exiting because of an unresolved conflict.")
+		return 128, nil
+	case messageFailed, *jit.NothingToAmend, *jit.LockDenied:
+		fmt.Fprintln(c.Stderr, "fatal:", err.Error())
+		return 128, nil
+	default:
 		return 1, err
 	}
 
-	if err := repo.Refs.UpdateHead(database.ObjectID(commit)); err != nil {
+	if _, err := c.runHook(repo.Config(), "post-commit", nil, hookEnv); err != nil {
 		return 1, err
 	}
 
 	isRoot := ""
-	if parent == "" {
+	if result.Root() {
 		isRoot = "(root-commit) "
 	}
-
-	fmt.Fprintf(
-		c.Stdout,
-		"[%s%s] %s\n",
-		isRoot,
-		database.ObjectID(commit),
-		strings.Split(string(commit.Message), "\n")[0],
-	)
+	fmt.Fprintf(c.Stdout, "[%s%s] %s\n", isRoot, result.OID, result.Summary())
 	return 0, nil
 }
@@ -0,0 +1,237 @@
+package command_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tpbowden/jit/database"
+)
+
+func (h *TestHelper) headCommit() database.Commit {
+	oid, err := h.repo.Refs.ReadHead()
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	object, err := h.repo.Database.Load(oid)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	return object.(database.Commit)
+}
+
+func TestCommitJoinsRepeatedMessages(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.cleanup()
+	helper.jit("init")
+
+	helper.writeFile("a.txt", "one")
+	helper.jit("add", ".")
+	if status := helper.jit("commit", "-m", "subject", "-m", "body  "); status != 0 {
+		t.Fatalf("Commit failed: %s", helper.stderr.String())
+	}
+	if message := helper.headCommit().Message; message != "subject\n\nbody\n" {
+		t.Fatalf("Unexpected message %q", message)
+	}
+}
+
+func TestCommitReadsMessageFromFile(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.cleanup()
+	helper.jit("init")
+
+	helper.writeFile("a.txt", "one")
+	helper.writeFile("msg", "\n\nfrom a file\n\n\n")
+	helper.jit("add", "a.txt")
+	if status := helper.jit("commit", "-F", "msg"); status != 0 {
+		t.Fatalf("Commit failed: %s", helper.stderr.String())
+	}
+	if message := helper.headCommit().Message; message != "from a file\n" {
+		t.Fatalf("Unexpected message %q", message)
+	}
+
+	helper.writeFile("a.txt", "two")
+	helper.jit("add", "a.txt")
+	helper.cmd.Stdin = strings.NewReader("from stdin")
+	if status := helper.jit("commit", "-F", "-"); status != 0 {
+		t.Fatalf("Commit failed: %s", helper.stderr.String())
+	}
+	if message := helper.headCommit().Message; message != "from stdin\n" {
+		t.Fatalf("Unexpected message %q", message)
+	}
+}
+
+func TestCommitRefusesUnchangedTree(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.cleanup()
+	helper.jit("init")
+
+	if status := helper.jit("commit", "-m", "empty"); status != 1 {
+		t.Fatalf("Expected status 1, got %d", status)
+	}
+
+	helper.writeFile("a.txt", "one")
+	helper.jit("add", ".")
+	helper.commit("first")
+	first := helper.headCommit()
+
+	if status := helper.jit("commit", "-m", "again"); status != 1 {
+		t.Fatalf("Expected status 1, got %d", status)
+	}
+	if status := helper.jit("commit", "--allow-empty", "-m", "again"); status != 0 {
+		t.Fatalf("Commit failed: %s", helper.stderr.String())
+	}
+	if helper.headCommit().TreeID != first.TreeID {
+		t.Fatal("Expected the empty commit to keep the tree")
+	}
+}
+
+func TestCommitAbortsOnEmptyMessage(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.cleanup()
+	helper.jit("init")
+
+	helper.writeFile("a.txt", "one")
+	helper.jit("add", ".")
+	if status := helper.jit("commit", "-m", "  "); status != 1 {
+		t.Fatalf("Expected status 1, got %d", status)
+	}
+	if oid, _ := helper.repo.Refs.ReadHead(); oid != "" {
+		t.Fatal("Expected no commit to be made")
+	}
+}
+
+func TestCommitAmendKeepsParentAndAuthor(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.cleanup()
+	helper.jit("init")
+
+	helper.writeFile("a.txt", "one")
+	helper.jit("add", ".")
+	helper.commit("first")
+	helper.writeFile("a.txt", "two")
+	helper.jit("add", ".")
+	helper.commit("second")
+	second := helper.headCommit()
+
+	helper.writeFile("b.txt", "three")
+	helper.jit("add", ".")
+	helper.cmd.Env["GIT_AUTHOR_NAME"] = "Someone Else"
+	if status := helper.jit("commit", "--amend", "-m", "amended"); status != 0 {
+		t.Fatalf("Commit failed: %s", helper.stderr.String())
+	}
+
+	amended := helper.headCommit()
+	if amended.ParentID != second.ParentID {
+		t.Fatal("Expected the amended commit to replace the tip")
+	}
+	if amended.Author.Name() != second.Author.Name() || amended.Committer.Name() != "Someone Else" {
+		t.Fatalf("Unexpected author %s and committer %s", amended.Author.Name(), amended.Committer.Name())
+	}
+	if amended.Message != "amended\n" {
+		t.Fatalf("Unexpected message %q", amended.Message)
+	}
+}
+
+func TestCommitEditorStripsComments(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.cleanup()
+	helper.jit("init")
+
+	helper.writeFile("a.txt", "one")
+	helper.jit("add", ".")
+	helper.commit("first")
+	helper.writeFile("a.txt", "two")
+	helper.jit("add", ".")
+
+	helper.cmd.Env["GIT_EDITOR"] = `printf '# note\nedited\n' >`
+	if status := helper.jit("commit"); status != 0 {
+		t.Fatalf("Commit failed: %s", helper.stderr.String())
+	}
+	if message := helper.headCommit().Message; message != "edited\n" {
+		t.Fatalf("Unexpected message %q", message)
+	}
+
+	helper.cmd.Env["GIT_EDITOR"] = "true"
+	if status := helper.jit("commit", "--amend"); status != 0 {
+		t.Fatalf("Commit failed: %s", helper.stderr.String())
+	}
+	if message := helper.headCommit().Message; message != "edited\n" {
+		t.Fatalf("Expected amend to keep the message, got %q", message)
+	}
+	contents, err := ioutil.ReadFile(filepath.Join(helper.path, ".git", "COMMIT_EDITMSG"))
+	if err != nil || !strings.Contains(string(contents), "# Please enter the commit message") {
+		t.Fatalf("Expected COMMIT_EDITMSG to hold the template, got %q", contents)
+	}
+}
+
+func (h *TestHelper) writeHook(name, script string) {
+	path := filepath.Join(h.path, ".git", "hooks", name)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		h.t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		h.t.Fatal(err)
+	}
+}
+
+func TestCommitAbortsWhenPreCommitHookFails(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.cleanup()
+	helper.jit("init")
+
+	helper.writeFile("a.txt", "one")
+	helper.jit("add", ".")
+	helper.writeHook("pre-commit", "echo lint failed\nexit 1\n")
+
+	if status := helper.jit("commit", "-m", "first"); status != 1 {
+		t.Fatalf("Expected status 1, got %d", status)
+	}
+	if !strings.Contains(helper.stderr.String(), "lint failed") {
+		t.Fatalf("Expected hook output on stderr, got %q", helper.stderr.String())
+	}
+	if oid, _ := helper.repo.Refs.ReadHead(); oid != "" {
+		t.Fatal("Expected no commit to be made")
+	}
+
+	if status := helper.jit("commit", "--no-verify", "-m", "first"); status != 0 {
+		t.Fatalf("Commit failed: %s", helper.stderr.String())
+	}
+}
+
+func TestCommitMsgHookCanRewriteMessage(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.cleanup()
+	helper.jit("init")
+
+	helper.writeFile("a.txt", "one")
+	helper.jit("add", ".")
+	helper.writeHook("commit-msg", `echo "Signed-off-by: hook" >> "$1"`+"\n")
+	helper.writeHook("post-commit", "touch post-commit-ran\n")
+
+	helper.commit("first")
+	if message := helper.headCommit().Message; message != "first\nSigned-off-by: hook\n" {
+		t.Fatalf("Unexpected message %q", message)
+	}
+	if _, err := os.Stat(filepath.Join(helper.path, "post-commit-ran")); err != nil {
+		t.Fatal("Expected the post-commit hook to run")
+	}
+}
+
+func TestCommitUsesConfiguredHooksPath(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.cleanup()
+	helper.jit("init")
+
+	helper.writeFile("a.txt", "one")
+	helper.jit("add", ".")
+	helper.writeFile("hooks/pre-commit", "#!/bin/sh\nexit 1\n")
+	os.Chmod(filepath.Join(helper.path, "hooks", "pre-commit"), 0755)
+	helper.writeFile(".git/config", "[core]\n\thooksPath = hooks\n")
+
+	if status := helper.jit("commit", "-m", "first"); status != 1 {
+		t.Fatalf("Expected status 1, got %d", status)
+	}
+}
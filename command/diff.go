@@ -0,0 +1,169 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/tpbowden/jit/diff"
+	"github.com/tpbowden/jit/jit"
+)
+
+func (c *Command) cmdDiff() (int, error) {
+	args := c.Args[2:]
+	var paths []string
+	for i, arg := range args {
+		if arg == "--" {
+			args, paths = args[:i], args[i+1:]
+			break
+		}
+	}
+
+	repo, status, err := c.open()
+	if repo == nil {
+		return status, err
+	}
+	renames, err := repo.DefaultRenames()
+	if err != nil {
+		return 1, err
+	}
+	args, renames, ok := renameArgs(args, renames)
+	if !ok {
+		fmt.Fprintln(c.Stderr, "error: invalid rename threshold")
+		return 129, nil
+	}
+
+	flags := flag.NewFlagSet("diff", flag.ContinueOnError)
+	flags.SetOutput(c.Stderr)
+	cached := flags.Bool("cached", false, "compare the index with HEAD")
+	flags.BoolVar(cached, "staged", false, "synonym for --cached")
+	unified := flags.Int("U", jit.DefaultContext, "number of context lines")
+	if err := flags.Parse(args); err != nil {
+		return 129, nil
+	}
+	paths = append(flags.Args(), paths...)
+
+	lines := *unified
+	if lines == 0 {
+		lines = -1
+	}
+	diffs, err := repo.Diff(c.context(), jit.DiffOptions{
+		Cached:  *cached,
+		Context: lines,
+		Paths:   paths,
+		Renames: renames,
+	})
+	if status, ok := c.pathspecFailed(err); ok {
+		return status, nil
+	} else if err != nil {
+		return 1, err
+	}
+	for _, file := range diffs {
+		c.printFileDiff(file)
+	}
+	return 0, nil
+}
+
+var renameKinds = map[jit.ChangeType]string{
+	jit.Renamed: "rename",
+	jit.Copied:  "copy",
+}
+
+// renameArgs takes -M[<n>], -C[<n>] and --no-renames out of args, since the
+// flag package cannot parse a value attached to a flag, and applies them to
+// the rename detection configured by default. Like git, a threshold given
+// without a percent sign is read as a fraction: -M5 means 50%.
+func renameArgs(args []string, renames *jit.RenameOptions) ([]string, *jit.RenameOptions, bool) {
+	rest := []string{}
+	for i, arg := range args {
+		switch {
+		case arg == "--":
+			return append(rest, args[i:]...), renames, true
+		case arg == "--no-renames":
+			renames = nil
+		case strings.HasPrefix(arg, "-M"), strings.HasPrefix(arg, "-C"):
+			threshold, value := 0, arg[2:]
+			if value != "" {
+				percent := strings.HasSuffix(value, "%")
+				value = strings.TrimSuffix(value, "%")
+				n, err := strconv.Atoi(value)
+				if err != nil || n < 0 || percent && n > 100 {
+					return nil, nil, false
+				}
+				if threshold = n; !percent {
+					threshold, _ = strconv.Atoi((value + "00")[:2])
+				}
+			}
+			copies := arg[1] == 'C' || renames != nil && renames.Copies
+			renames = &jit.RenameOptions{Threshold: threshold, Copies: copies}
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	return rest, renames, true
+}
+
+func shortOID(oid string) string {
+	if oid == "" {
+		return "0000000"
+	}
+	return oid[:7]
+}
+
+func (c *Command) printFileDiff(file jit.FileDiff) {
+	a, b := "a/"+file.Path, "b/"+file.Path
+	if file.OldPath != "" {
+		a = "a/" + file.OldPath
+	}
+	fmt.Fprintf(c.Stdout, "diff --git %s %s\n", a, b)
+
+	switch {
+	case file.Status == jit.Added:
+		fmt.Fprintf(c.Stdout, "new file mode %o\n", file.NewMode)
+		a = "/dev/null"
+	case file.Status == jit.Deleted:
+		fmt.Fprintf(c.Stdout, "deleted file mode %o\n", file.OldMode)
+		b = "/dev/null"
+	case file.OldMode != file.NewMode:
+		fmt.Fprintf(c.Stdout, "old mode %o\nnew mode %o\n", file.OldMode, file.NewMode)
+	}
+	if kind, found := renameKinds[file.Status]; found {
+		fmt.Fprintf(c.Stdout, "similarity index %d%%\n", file.Similarity)
+		fmt.Fprintf(c.Stdout, "%s from %s\n%s to %s\n", kind, file.OldPath, kind, file.Path)
+	}
+
+	if file.OldOID == file.NewOID {
+		return
+	}
+	index := fmt.Sprintf("index %s..%s", shortOID(file.OldOID), shortOID(file.NewOID))
+	if file.Status != jit.Added && file.Status != jit.Deleted && file.OldMode == file.NewMode {
+		index += fmt.Sprintf(" %o", file.OldMode)
+	}
+	fmt.Fprintln(c.Stdout, index)
+
+	if file.Binary {
+		fmt.Fprintf(c.Stdout, "Binary files %s and %s differ\n", a, b)
+		return
+	}
+	fmt.Fprintf(c.Stdout, "--- %s\n+++ %s\n", a, b)
+	for _, hunk := range file.Hunks {
+		fmt.Fprintln(c.Stdout, hunk.Header())
+		for _, edit := range hunk.Edits {
+			c.printEdit(edit)
+		}
+	}
+}
+
+var editSymbols = map[diff.Kind]string{
+	diff.Equal:  " ",
+	diff.Insert: "+",
+	diff.Delete: "-",
+}
+
+func (c *Command) printEdit(edit diff.Edit) {
+	fmt.Fprint(c.Stdout, editSymbols[edit.Kind], edit.Text)
+	if !strings.HasSuffix(edit.Text, "\n") {
+		fmt.Fprint(c.Stdout, "\n\\ No newline at end of file\n")
+	}
+}
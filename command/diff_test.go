@@ -0,0 +1,109 @@
+package command_test
+
+import (
+	"strings"
+	"testing"
+)
+
+func setupRename(t *testing.T) *TestHelper {
+	helper := NewTestHelper(t)
+	helper.jit("init")
+	helper.writeFile("old.txt", "one\ntwo\nthree\nfour\n")
+	helper.writeFile("kept.txt", "kept\n")
+	helper.jit("add", ".")
+	helper.commit("first")
+	helper.jit("mv", "old.txt", "new.txt")
+	helper.writeFile("new.txt", "one\ntwo\nthree\nFOUR\n")
+	helper.writeFile("copy.txt", "kept\n")
+	helper.jit("add", ".")
+	return helper
+}
+
+func TestStatusAndDiffReportRenames(t *testing.T) {
+	helper := setupRename(t)
+	defer helper.cleanup()
+
+	helper.jit("status", "--porcelain")
+	if status := helper.stdout.String(); status != "A  copy.txt\nR  old.txt -> new.txt\n" {
+		t.Fatalf("Unexpected status %q", status)
+	}
+
+	helper.jit("diff", "--cached", "-C")
+	expected := "diff --git a/kept.txt b/copy.txt\n" +
+		"similarity index 100%\n" +
+		"copy from kept.txt\n" +
+		"copy to copy.txt\n" +
+		"diff --git a/old.txt b/new.txt\n" +
+		"similarity index 75%\n" +
+		"rename from old.txt\n" +
+		"rename to new.txt\n"
+	if diff := helper.stdout.String(); !strings.HasPrefix(diff, expected) {
+		t.Fatalf("Unexpected diff %q", diff)
+	}
+
+	helper.jit("diff", "--cached", "-M80%")
+	if diff := helper.stdout.String(); strings.Contains(diff, "rename") || !strings.Contains(diff, "deleted file mode") {
+		t.Fatalf("Expected no renames above the threshold, got %q", diff)
+	}
+
+	helper.commit("second")
+	helper.jit("log", "--oneline", "--name-status", "-n", "1")
+	lines := strings.Split(helper.stdout.String(), "\n")
+	if len(lines) != 4 || lines[1] != "A\tcopy.txt" || lines[2] != "R075\told.txt\tnew.txt" {
+		t.Fatalf("Unexpected log %q", helper.stdout.String())
+	}
+}
+
+func TestCherryPickFollowsRenames(t *testing.T) {
+	helper := setupRename(t)
+	defer helper.cleanup()
+	helper.commit("second")
+
+	helper.jit("checkout", "HEAD~1")
+	helper.writeFile("old.txt", "zero\none\ntwo\nthree\nfour\n")
+	helper.jit("add", ".")
+	helper.commit("third")
+	helper.jit("log", "--oneline", "-n", "1")
+	third := strings.Fields(helper.stdout.String())[0]
+
+	helper.jit("checkout", "master")
+	if status := helper.jit("cherry-pick", third); status != 0 {
+		t.Fatalf("Expected the pick to succeed: %s", helper.stderr.String())
+	}
+	if contents := helper.readFile("new.txt"); contents != "zero\none\ntwo\nthree\nFOUR\n" {
+		t.Fatalf("Unexpected contents %q", contents)
+	}
+	helper.jit("status", "--porcelain")
+	if status := helper.stdout.String(); status != "" {
+		t.Fatalf("Expected a clean tree, got %q", status)
+	}
+}
+
+func TestRenameLimitsAndMergeRenames(t *testing.T) {
+	helper := setupRename(t)
+	defer helper.cleanup()
+
+	helper.writeFile(".git/config", "[diff]\n\trenameLimit = 1\n")
+	helper.jit("status", "--porcelain")
+	if status := helper.stdout.String(); status != "A  copy.txt\nA  new.txt\nD  old.txt\n" {
+		t.Fatalf("Expected no renames beyond the limit, got %q", status)
+	}
+
+	helper.writeFile(".git/config", "")
+	helper.commit("second")
+	helper.jit("checkout", "HEAD~1")
+	helper.writeFile("old.txt", "zero\none\ntwo\nthree\nfour\n")
+	helper.jit("add", ".")
+	helper.commit("third")
+	helper.jit("log", "--oneline", "-n", "1")
+	third := strings.Fields(helper.stdout.String())[0]
+
+	helper.jit("checkout", "master")
+	helper.writeFile(".git/config", "[merge]\n\trenames = false\n")
+	if status := helper.jit("cherry-pick", third); status == 0 {
+		t.Fatal("Expected the pick to conflict without rename detection")
+	}
+	if contents := helper.readFile("new.txt"); contents != "one\ntwo\nthree\nFOUR\n" {
+		t.Fatalf("Expected the renamed file to be left alone, got %q", contents)
+	}
+}
@@ -0,0 +1,92 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/tpbowden/jit/jit"
+)
+
+func (c *Command) cmdGrep() (int, error) {
+	args := c.Args[2:]
+	var paths []string
+	for i, arg := range args {
+		if arg == "--" {
+			args, paths = args[:i], args[i+1:]
+			break
+		}
+	}
+
+	flags := flag.NewFlagSet("grep", flag.ContinueOnError)
+	flags.SetOutput(c.Stderr)
+	lineNumbers := flags.Bool("n", false, "prefix each match with its line number")
+	ignoreCase := flags.Bool("i", false, "ignore case differences between the pattern and the files")
+	filesOnly := flags.Bool("l", false, "show only the names of files that match")
+	words := flags.Bool("w", false, "match the pattern only at word boundaries")
+	extended := flags.Bool("E", false, "use extended regular expressions")
+	cached := flags.Bool("cached", false, "search the index instead of the working tree")
+	if err := flags.Parse(args); err != nil {
+		return 129, nil
+	}
+	if flags.NArg() == 0 {
+		fmt.Fprintln(c.Stderr, "usage: jit grep [-n] [-i] [-l] [-w] [-E] [--cached] <pattern> [<tree-ish>] [--] [<path>...]")
+		return 129, nil
+	}
+
+	// The argument after the pattern names a commit to search if it comes
+	// right before "--", or is neither a path in the working tree nor a
+	// pattern with magic or wildcards.
+	revision, rest := "", flags.Args()[1:]
+	if len(rest) > 0 {
+		if !c.isPathArgument(rest[0]) || len(paths) > 0 && len(rest) == 1 {
+			revision, rest = rest[0], rest[1:]
+		}
+	}
+	paths = append(rest, paths...)
+	if revision != "" && *cached {
+		fmt.Fprintln(c.Stderr, "fatal: --cached cannot be used with a tree")
+		return 128, nil
+	}
+
+	repo, status, err := c.open()
+	if repo == nil {
+		return status, err
+	}
+	matches, err := repo.Grep(c.context(), jit.GrepOptions{
+		Pattern:          flags.Arg(0),
+		Extended:         *extended,
+		IgnoreCase:       *ignoreCase,
+		WordRegexp:       *words,
+		FilesWithMatches: *filesOnly,
+		Cached:           *cached,
+		Revision:         revision,
+		Paths:            paths,
+	})
+	switch err := err.(type) {
+	case nil:
+	case *jit.InvalidPattern, *jit.InvalidRevision, *jit.InvalidPathspec, *jit.PathspecOutside:
+		fmt.Fprintln(c.Stderr, "fatal:", err.Error())
+		return 128, nil
+	default:
+		return 1, err
+	}
+
+	prefix := ""
+	if revision != "" {
+		prefix = revision + ":"
+	}
+	for _, match := range matches {
+		switch {
+		case *filesOnly:
+			fmt.Fprintf(c.Stdout, "%s%s\n", prefix, match.Path)
+		case *lineNumbers:
+			fmt.Fprintf(c.Stdout, "%s%s:%d:%s\n", prefix, match.Path, match.Line, match.Text)
+		default:
+			fmt.Fprintf(c.Stdout, "%s%s:%s\n", prefix, match.Path, match.Text)
+		}
+	}
+	if len(matches) == 0 {
+		return 1, nil
+	}
+	return 0, nil
+}
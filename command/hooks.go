@@ -0,0 +1,60 @@
+package command
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/tpbowden/jit/config"
+)
+
+// hookDir returns the directory hooks are looked up in: core.hooksPath if it
+// is set, relative to the top of the working tree, or .git/hooks.
+func (c *Command) hookDir(cfg *config.Config) string {
+	if path, ok := cfg.Get("core.hooksPath"); ok && path != "" {
+		return c.expandPath(path)
+	}
+	return filepath.Join(c.Dir, ".git", "hooks")
+}
+
+// runHook runs the named hook, if it exists and is executable, from the top
+// of the working tree. The hook's output goes to the command's stderr, as its
+// stdout is reserved for the command's own output. Missing hooks succeed.
+func (c *Command) runHook(cfg *config.Config, name string, stdin io.Reader, env map[string]string, args ...string) (int, error) {
+	path := filepath.Join(c.hookDir(cfg), name)
+	stat, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if stat.IsDir() || stat.Mode()&0111 == 0 {
+		fmt.Fprintf(c.Stderr, "hint: The '%s' hook was ignored because it's not set as executable.\n", name)
+		return 0, nil
+	}
+
+	cmd := exec.Command(path, args...)
+	cmd.Dir = c.Dir
+	cmd.Stdin = stdin
+	cmd.Stdout = c.Stderr
+	cmd.Stderr = c.Stderr
+	for key, value := range c.Env {
+		if _, overridden := env[key]; !overridden {
+			cmd.Env = append(cmd.Env, key+"="+value)
+		}
+	}
+	for key, value := range env {
+		cmd.Env = append(cmd.Env, key+"="+value)
+	}
+
+	if err := cmd.Run(); err != nil {
+		if exit, ok := err.(*exec.ExitError); ok {
+			return exit.ExitCode(), nil
+		}
+		return 0, err
+	}
+	return 0, nil
+}
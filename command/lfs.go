@@ -0,0 +1,122 @@
+package command
+
+import (
+	"fmt"
+
+	"github.com/tpbowden/jit/jit"
+	"github.com/tpbowden/jit/remote"
+)
+
+const lfsUsage = "usage: jit lfs (track [<pattern>...] | ls-files | fetch [<remote> [<ref>...]] | pull [<remote> [<ref>...]] | push <remote> [<ref>...] | checkout)"
+
+func (c *Command) cmdLfs() (int, error) {
+	if len(c.Args) < 3 {
+		fmt.Fprintln(c.Stderr, lfsUsage)
+		return 129, nil
+	}
+	subcommand, args := c.Args[2], c.Args[3:]
+	switch {
+	case subcommand == "ls-files" && len(args) > 0, subcommand == "checkout" && len(args) > 0,
+		subcommand == "push" && len(args) == 0:
+		fmt.Fprintln(c.Stderr, lfsUsage)
+		return 129, nil
+	}
+
+	repo, status, err := c.open()
+	if repo == nil {
+		return status, err
+	}
+	options := jit.LFSOptions{}
+	if len(args) > 0 {
+		options.Remote, options.Revisions = args[0], args[1:]
+	}
+
+	switch subcommand {
+	case "track":
+		return c.lfsTrack(repo, args)
+	case "ls-files":
+		var files []jit.LFSFile
+		if files, err = repo.LFSFiles(c.context()); err == nil {
+			for _, file := range files {
+				marker := "-"
+				if file.CheckedOut {
+					marker = "*"
+				}
+				fmt.Fprintf(c.Stdout, "%s %s %s\n", file.Pointer.OID[:10], marker, file.Path)
+			}
+			return 0, nil
+		}
+	case "fetch":
+		var result *jit.LFSTransferResult
+		if result, err = repo.LFSFetch(c.context(), options); err == nil {
+			c.printLFSTransfer("Downloading", result)
+			return 0, nil
+		}
+	case "pull":
+		var result *jit.LFSTransferResult
+		if result, _, err = repo.LFSPull(c.context(), options); err == nil {
+			c.printLFSTransfer("Downloading", result)
+			return 0, nil
+		}
+	case "push":
+		var result *jit.LFSTransferResult
+		if result, err = repo.LFSPush(c.context(), options); err == nil {
+			c.printLFSTransfer("Uploading", result)
+			return 0, nil
+		}
+	case "checkout":
+		if _, err = repo.LFSCheckout(c.context()); err == nil {
+			return 0, nil
+		}
+	default:
+		fmt.Fprintln(c.Stderr, lfsUsage)
+		return 129, nil
+	}
+
+	switch err.(type) {
+	case *jit.LFSUnsupported, *jit.NotRepository, *jit.LFSMissingObject, *jit.LFSCorruptObject,
+		*jit.InvalidRevision, *jit.LockDenied, *remote.UnknownRemote:
+		fmt.Fprintln(c.Stderr, "fatal:", err.Error())
+		return 128, nil
+	}
+	return 1, err
+}
+
+// lfsTrack lists the patterns stored with LFS, or adds new ones.
+func (c *Command) lfsTrack(repo *jit.Repository, patterns []string) (int, error) {
+	if len(patterns) == 0 {
+		tracked, err := repo.LFSTracked()
+		if err != nil {
+			return 1, err
+		}
+		fmt.Fprintln(c.Stdout, "Listing tracked patterns")
+		for _, pattern := range tracked {
+			fmt.Fprintf(c.Stdout, "    %s (.gitattributes)\n", pattern)
+		}
+		return 0, nil
+	}
+
+	added, err := repo.LFSTrack(patterns...)
+	if err != nil {
+		return 1, err
+	}
+	isAdded := map[string]bool{}
+	for _, pattern := range added {
+		isAdded[pattern] = true
+	}
+	for _, pattern := range patterns {
+		if isAdded[pattern] {
+			fmt.Fprintf(c.Stdout, "Tracking \"%s\"\n", pattern)
+		} else {
+			fmt.Fprintf(c.Stdout, "\"%s\" already supported\n", pattern)
+		}
+	}
+	return 0, nil
+}
+
+func (c *Command) printLFSTransfer(verb string, result *jit.LFSTransferResult) {
+	if result.Transferred == 0 {
+		return
+	}
+	fmt.Fprintf(c.Stderr, "%s LFS objects: 100%% (%d/%d), done.\n", verb, result.Transferred, result.Transferred)
+}
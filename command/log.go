@@ -0,0 +1,121 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/tpbowden/jit/jit"
+)
+
+func (c *Command) cmdLog() (int, error) {
+	repo, status, err := c.open()
+	if repo == nil {
+		return status, err
+	}
+	renames, err := repo.DefaultRenames()
+	if err != nil {
+		return 1, err
+	}
+	args := c.Args[2:]
+	var paths []string
+	for i, arg := range args {
+		if arg == "--" {
+			args, paths = args[:i], args[i+1:]
+			break
+		}
+	}
+	args, renames, ok := renameArgs(args, renames)
+	if !ok {
+		fmt.Fprintln(c.Stderr, "error: invalid rename threshold")
+		return 129, nil
+	}
+
+	flags := flag.NewFlagSet("log", flag.ContinueOnError)
+	flags.SetOutput(c.Stderr)
+	maxCount := flags.Int("n", 0, "limit the number of commits to output")
+	oneline := flags.Bool("oneline", false, "show each commit on a single line")
+	nameStatus := flags.Bool("name-status", false, "show the files each commit changed and how")
+	if err := flags.Parse(args); err != nil {
+		return 129, nil
+	}
+
+	// Without "--", arguments after the revision are paths, as is the first
+	// one if it names a file or looks like a pattern.
+	revision, rest := "", flags.Args()
+	if len(rest) > 0 && (paths != nil || !c.isPathArgument(rest[0])) {
+		revision, rest = rest[0], rest[1:]
+	}
+	if len(rest) > 0 && paths != nil {
+		fmt.Fprintln(c.Stderr, "fatal: too many revisions")
+		return 128, nil
+	}
+	paths = append(rest, paths...)
+
+	commits, err := repo.Log(c.context(), jit.LogOptions{Revision: revision, MaxCount: *maxCount, Paths: paths})
+	if status, ok := c.pathspecFailed(err); ok {
+		return status, nil
+	} else if err != nil {
+		if _, ok := err.(*jit.InvalidRevision); ok {
+			fmt.Fprintf(c.Stderr, "fatal: ambiguous argument '%s': unknown revision or path not in the working tree.\n", revision)
+			return 128, nil
+		}
+		return 1, err
+	}
+	if len(commits) == 0 && revision == "" && len(paths) == 0 {
+		fmt.Fprintln(c.Stderr, "fatal: your current branch does not have any commits yet")
+		return 128, nil
+	}
+
+	for i, commit := range commits {
+		if *oneline {
+			fmt.Fprintf(c.Stdout, "%s %s\n", commit.OID[:7], commit.Summary())
+		} else {
+			if i > 0 {
+				fmt.Fprintln(c.Stdout)
+			}
+			c.printCommit(commit)
+		}
+		if *nameStatus && len(commit.Parents) < 2 {
+			if err := c.printNameStatus(repo, commit, paths, renames, !*oneline); err != nil {
+				return 1, err
+			}
+		}
+	}
+	return 0, nil
+}
+
+// printCommit prints a commit's ID, author, date and indented message.
+func (c *Command) printCommit(commit jit.CommitInfo) {
+	fmt.Fprintf(c.Stdout, "commit %s\n", commit.OID)
+	fmt.Fprintf(c.Stdout, "Author: %s <%s>\n", commit.Author.Name, commit.Author.Email)
+	fmt.Fprintf(c.Stdout, "Date:   %s\n\n", commit.Author.When.Format("Mon Jan 2 15:04:05 2006 -0700"))
+	for _, line := range strings.Split(strings.TrimRight(commit.Message, "\n"), "\n") {
+		fmt.Fprintf(c.Stdout, "    %s\n", line)
+	}
+}
+
+// printNameStatus lists the files matching paths that a commit changed from
+// its parent, each with its status letter and, for renames and copies, the
+// similarity and the path it came from.
+func (c *Command) printNameStatus(repo *jit.Repository, commit jit.CommitInfo, paths []string, renames *jit.RenameOptions, separate bool) error {
+	parent := ""
+	if len(commit.Parents) > 0 {
+		parent = commit.Parents[0]
+	}
+	diffs, err := repo.DiffCommits(c.context(), parent, commit.OID, jit.DiffOptions{Paths: paths, Renames: renames})
+	if err != nil || len(diffs) == 0 {
+		return err
+	}
+	if separate {
+		fmt.Fprintln(c.Stdout)
+	}
+	for _, file := range diffs {
+		if file.OldPath != "" {
+			fmt.Fprintf(c.Stdout, "%c%03d\t%s\t%s\n", file.Status, file.Similarity, file.OldPath, file.Path)
+		} else {
+			fmt.Fprintf(c.Stdout, "%c\t%s\n", file.Status, file.Path)
+		}
+	}
+	return nil
+}
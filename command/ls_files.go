@@ -0,0 +1,48 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/tpbowden/jit/jit"
+)
+
+func (c *Command) cmdLsFiles() (int, error) {
+	flags := flag.NewFlagSet("ls-files", flag.ContinueOnError)
+	flags.SetOutput(c.Stderr)
+	options := jit.ListFilesOptions{}
+	flags.BoolVar(&options.Cached, "c", false, "show cached files")
+	flags.BoolVar(&options.Cached, "cached", false, "synonym for -c")
+	flags.BoolVar(&options.Deleted, "d", false, "show deleted files")
+	flags.BoolVar(&options.Deleted, "deleted", false, "synonym for -d")
+	flags.BoolVar(&options.Modified, "m", false, "show modified files")
+	flags.BoolVar(&options.Modified, "modified", false, "synonym for -m")
+	flags.BoolVar(&options.Others, "o", false, "show untracked files")
+	flags.BoolVar(&options.Others, "others", false, "synonym for -o")
+	stage := flags.Bool("s", false, "show the mode, object ID and stage of each file")
+	flags.BoolVar(stage, "stage", false, "synonym for -s")
+	if err := flags.Parse(c.Args[2:]); err != nil {
+		return 129, nil
+	}
+	options.Paths = flags.Args()
+	options.Cached = options.Cached || *stage
+
+	repo, status, err := c.open()
+	if repo == nil {
+		return status, err
+	}
+	files, err := repo.ListFiles(c.context(), options)
+	if status, ok := c.pathspecFailed(err); ok {
+		return status, nil
+	} else if err != nil {
+		return 1, err
+	}
+	for _, file := range files {
+		if *stage && file.Tracked {
+			fmt.Fprintf(c.Stdout, "%06o %s %d\t%s\n", file.Mode, file.OID, file.Stage, file.Path)
+		} else {
+			fmt.Fprintln(c.Stdout, file.Path)
+		}
+	}
+	return 0, nil
+}
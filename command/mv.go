@@ -0,0 +1,42 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/tpbowden/jit/jit"
+)
+
+func (c *Command) cmdMv() (int, error) {
+	flags := flag.NewFlagSet("mv", flag.ContinueOnError)
+	flags.SetOutput(c.Stderr)
+	force := flags.Bool("f", false, "overwrite the destination if it exists")
+	if err := flags.Parse(c.Args[2:]); err != nil {
+		return 129, nil
+	}
+	if flags.NArg() < 2 {
+		fmt.Fprintln(c.Stderr, "usage: jit mv [-f] <source>... <destination>")
+		return 129, nil
+	}
+
+	repo, status, err := c.open()
+	if repo == nil {
+		return status, err
+	}
+
+	paths := flags.Args()
+	err = repo.Move(c.context(), jit.MoveOptions{
+		Sources:     paths[:len(paths)-1],
+		Destination: paths[len(paths)-1],
+		Force:       *force,
+	})
+	switch err.(type) {
+	case nil:
+		return 0, nil
+	case *jit.PathOutside, *jit.NotDirectory, *jit.InvalidMove, *jit.MissingFile, *jit.LockDenied:
+		fmt.Fprintln(c.Stderr, "fatal:", err.Error())
+		return 128, nil
+	default:
+		return 1, err
+	}
+}
@@ -0,0 +1,112 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/tpbowden/jit/jit"
+)
+
+func (c *Command) cmdCherryPick() (int, error) {
+	return c.runSequence("cherry-pick")
+}
+
+func (c *Command) cmdRevert() (int, error) {
+	return c.runSequence("revert")
+}
+
+func (c *Command) runSequence(name string) (int, error) {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(c.Stderr)
+	resume := flags.Bool("continue", false, "resume after resolving a conflict")
+	skip := flags.Bool("skip", false, "skip the current commit and carry on")
+	abort := flags.Bool("abort", false, "cancel the operation and restore the original HEAD")
+	mainline := flags.Int("m", 0, "the parent number of a merge commit to apply changes relative to")
+	if err := flags.Parse(c.Args[2:]); err != nil {
+		return 129, nil
+	}
+	control := *resume || *skip || *abort
+	if control == (flags.NArg() > 0) {
+		fmt.Fprintf(c.Stderr, "usage: jit %s [-m <parent-number>] <commit>...\n", name)
+		fmt.Fprintf(c.Stderr, "   or: jit %s (--continue | --skip | --abort)\n", name)
+		return 129, nil
+	}
+
+	repo, status, err := c.open()
+	if repo == nil {
+		return status, err
+	}
+
+	var result *jit.SequenceResult
+	switch {
+	case *abort:
+		err = repo.SequenceAbort(c.context())
+	case *skip:
+		result, err = repo.SequenceSkip(c.context())
+	case *resume:
+		result, err = repo.SequenceContinue(c.context())
+	case name == "revert":
+		result, err = repo.Revert(c.context(), jit.SequenceOptions{Revisions: flags.Args(), Mainline: *mainline})
+	default:
+		result, err = repo.CherryPick(c.context(), jit.SequenceOptions{Revisions: flags.Args(), Mainline: *mainline})
+	}
+	if err != nil {
+		return c.sequenceFailed(name, err)
+	}
+	if result == nil {
+		return 0, nil
+	}
+
+	for _, commit := range result.Commits {
+		fmt.Fprintf(c.Stdout, "[%s] %s\n", commit.OID, commit.Summary())
+	}
+	if result.Stopped == nil {
+		return 0, nil
+	}
+
+	stopped := result.Stopped.OID[0:7] + "... " + result.Stopped.Summary()
+	if len(result.Conflicts) == 0 {
+		fmt.Fprintf(c.Stderr, "The previous %s is now empty, possibly due to conflict resolution.\n", name)
+		fmt.Fprintf(c.Stderr, "hint: use 'jit %s --skip' to skip this commit\n", name)
+		return 1, nil
+	}
+	for _, path := range result.Conflicts {
+		fmt.Fprintf(c.Stdout, "CONFLICT: Merge conflict in %s\n", path)
+	}
+	if name == "revert" {
+		fmt.Fprintln(c.Stderr, "error: could not revert", stopped)
+	} else {
+		fmt.Fprintln(c.Stderr, "error: could not apply", stopped)
+	}
+	fmt.Fprintln(c.Stderr, "hint: after resolving the conflicts, mark the corrected paths")
+	fmt.Fprintln(c.Stderr, "hint: with 'jit add <paths>' or 'jit rm <paths>'")
+	fmt.Fprintf(c.Stderr, "hint: and run 'jit %s --continue'\n", name)
+	return 1, nil
+}
+
+func (c *Command) sequenceFailed(name string, err error) (int, error) {
+	switch err := err.(type) {
+	case *jit.NothingToCommit:
+		fmt.Fprintf(c.Stderr, "The previous %s is now empty, possibly due to conflict resolution.\n", name)
+		fmt.Fprintf(c.Stderr, "hint: use 'jit %s --skip' to skip this commit\n", name)
+		return 1, nil
+	case *jit.SequenceInProgress:
+		fmt.Fprintln(c.Stderr, "error:", err.Error())
+		fmt.Fprintf(c.Stderr, "hint: try \"jit %s (--continue | --skip | --abort)\"\n", name)
+	case *jit.LocalChanges:
+		fmt.Fprintln(c.Stderr, "error:", err.Error())
+		fmt.Fprintln(c.Stderr, "Aborting")
+	case *jit.NoSequence, *jit.MergeWithoutMainline, *jit.InvalidMainline, *jit.DirtyIndex, *jit.UnmergedPaths:
+		fmt.Fprintln(c.Stderr, "error:", err.Error())
+	case *jit.InvalidRevision:
+		fmt.Fprintln(c.Stderr, "fatal:", err.Error())
+		return 128, nil
+	case *jit.LockDenied:
+		fmt.Fprintln(c.Stderr, "fatal:", err.Error())
+		return 128, nil
+	default:
+		return 1, err
+	}
+	fmt.Fprintf(c.Stderr, "fatal: %s failed\n", name)
+	return 128, nil
+}
@@ -0,0 +1,174 @@
+package command
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/tpbowden/jit/jit"
+)
+
+func (c *Command) cmdRebase() (int, error) {
+	flags := flag.NewFlagSet("rebase", flag.ContinueOnError)
+	flags.SetOutput(c.Stderr)
+	interactive := flags.Bool("interactive", false, "edit the list of commits to rebase")
+	flags.BoolVar(interactive, "i", false, "shorthand for --interactive")
+	onto := flags.String("onto", "", "rebase onto the given commit instead of the upstream")
+	resume := flags.Bool("continue", false, "resume after resolving a conflict or editing a commit")
+	skip := flags.Bool("skip", false, "skip the current commit and carry on")
+	abort := flags.Bool("abort", false, "cancel the rebase and check out the original branch")
+	if err := flags.Parse(c.Args[2:]); err != nil {
+		return 129, nil
+	}
+	control := *resume || *skip || *abort
+	if control == (flags.NArg() == 1) || flags.NArg() > 1 {
+		fmt.Fprintln(c.Stderr, "usage: jit rebase [-i] [--onto <newbase>] <upstream>")
+		fmt.Fprintln(c.Stderr, "   or: jit rebase (--continue | --skip | --abort)")
+		return 129, nil
+	}
+
+	repo, status, err := c.open()
+	if repo == nil {
+		return status, err
+	}
+	hooks := jit.RebaseHooks{
+		EditTodo: func(ctx context.Context, todo string) (string, error) {
+			return c.editTodo(repo, todo)
+		},
+		EditMessage: func(ctx context.Context, proposed string) (string, error) {
+			message, err := c.editMessage(repo.Config(), proposed)
+			if err != nil {
+				return "", messageFailed{err}
+			}
+			return message, nil
+		},
+		Exec: c.rebaseExec,
+	}
+
+	var result *jit.RebaseResult
+	switch {
+	case *abort:
+		err = repo.RebaseAbort(c.context())
+	case *skip:
+		result, err = repo.RebaseSkip(c.context(), hooks)
+	case *resume:
+		result, err = repo.RebaseContinue(c.context(), hooks)
+	default:
+		result, err = repo.Rebase(c.context(), jit.RebaseOptions{
+			Upstream:    flags.Arg(0),
+			Onto:        *onto,
+			Interactive: *interactive,
+			RebaseHooks: hooks,
+		})
+	}
+	if err != nil {
+		return c.rebaseFailed(err)
+	}
+	if result == nil {
+		return 0, nil
+	}
+
+	if result.Finished() {
+		if result.Branch != "" {
+			fmt.Fprintf(c.Stderr, "Successfully rebased and updated %s.\n", result.Branch)
+		} else {
+			fmt.Fprintln(c.Stderr, "Successfully rebased.")
+		}
+		return 0, nil
+	}
+	if result.FailedExec != "" {
+		fmt.Fprintln(c.Stderr, "warning: execution failed:", result.FailedExec)
+		fmt.Fprintln(c.Stderr, "You can fix the problem, and then run")
+		fmt.Fprintln(c.Stderr)
+		fmt.Fprintln(c.Stderr, "  jit rebase --continue")
+		fmt.Fprintln(c.Stderr)
+		return 1, nil
+	}
+
+	stopped := result.Stopped.OID[0:7] + "... " + result.Stopped.Summary()
+	if result.Edit {
+		fmt.Fprintln(c.Stderr, "Stopped at", stopped)
+		fmt.Fprintln(c.Stderr, "You can amend the commit now, with")
+		fmt.Fprintln(c.Stderr)
+		fmt.Fprintln(c.Stderr, "  jit commit --amend")
+		fmt.Fprintln(c.Stderr)
+		fmt.Fprintln(c.Stderr, "Once you are satisfied with your changes, run")
+		fmt.Fprintln(c.Stderr)
+		fmt.Fprintln(c.Stderr, "  jit rebase --continue")
+		return 0, nil
+	}
+	for _, path := range result.Conflicts {
+		fmt.Fprintf(c.Stdout, "CONFLICT: Merge conflict in %s\n", path)
+	}
+	fmt.Fprintln(c.Stderr, "error: could not apply", stopped)
+	fmt.Fprintln(c.Stderr, "hint: Resolve all conflicts manually, mark them as resolved with")
+	fmt.Fprintln(c.Stderr, "hint: \"jit add/rm <conflicted_files>\", then run \"jit rebase --continue\".")
+	fmt.Fprintln(c.Stderr, "hint: You can instead skip this commit: run \"jit rebase --skip\".")
+	fmt.Fprintln(c.Stderr, "hint: To abort and get back to the state before \"jit rebase\", run \"jit rebase --abort\".")
+	return 1, nil
+}
+
+// editTodo opens the user's editor on the todo list of an interactive
+// rebase, in .git/rebase-merge/git-rebase-todo where git keeps it.
+func (c *Command) editTodo(repo *jit.Repository, todo string) (string, error) {
+	dir := filepath.Join(c.Dir, ".git", "rebase-merge")
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, "git-rebase-todo")
+	if err := ioutil.WriteFile(path, []byte(todo), 0644); err != nil {
+		return "", err
+	}
+	if err := c.runEditor(repo.Config(), path); err != nil {
+		return "", messageFailed{err}
+	}
+	edited, err := ioutil.ReadFile(path)
+	return string(edited), err
+}
+
+// rebaseExec runs the command of an exec step through the shell, from the
+// top of the working tree.
+func (c *Command) rebaseExec(ctx context.Context, command string) error {
+	fmt.Fprintln(c.Stderr, "Executing:", command)
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Dir = c.Dir
+	cmd.Stdin = c.Stdin
+	cmd.Stdout = c.Stdout
+	cmd.Stderr = c.Stderr
+	for name, value := range c.Env {
+		cmd.Env = append(cmd.Env, name+"="+value)
+	}
+	return cmd.Run()
+}
+
+func (c *Command) rebaseFailed(err error) (int, error) {
+	switch err := err.(type) {
+	case *jit.UncommittedChanges:
+		fmt.Fprintln(c.Stderr, "error:", err.Error())
+		fmt.Fprintln(c.Stderr, "error: Please commit or stash them.")
+		return 1, nil
+	case *jit.RebaseInProgress:
+		fmt.Fprintln(c.Stderr, "fatal:", err.Error())
+		fmt.Fprintln(c.Stderr, "hint: try \"jit rebase (--continue | --skip | --abort)\"")
+		return 128, nil
+	case *jit.UnmergedPaths:
+		fmt.Fprintln(c.Stderr, "error:", err.Error())
+		fmt.Fprintln(c.Stderr, "hint: fix conflicts and then run \"jit rebase --continue\"")
+		return 1, nil
+	case *jit.CheckoutConflict, *jit.LocalChanges, *jit.DirtyIndex, *jit.InvalidTodo, *jit.EmptyTodo:
+		fmt.Fprintln(c.Stderr, "error:", err.Error())
+		return 1, nil
+	case *jit.EmptyMessage:
+		fmt.Fprintln(c.Stderr, err.Error())
+		return 1, nil
+	case *jit.NoRebase, *jit.InvalidRevision, *jit.LockDenied, messageFailed:
+		fmt.Fprintln(c.Stderr, "fatal:", err.Error())
+		return 128, nil
+	default:
+		return 1, err
+	}
+}
@@ -0,0 +1,65 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/tpbowden/jit/jit"
+	"github.com/tpbowden/jit/remote"
+)
+
+func (c *Command) cmdRemote() (int, error) {
+	flags := flag.NewFlagSet("remote", flag.ContinueOnError)
+	flags.SetOutput(c.Stderr)
+	verbose := flags.Bool("v", false, "show remote URLs")
+	if err := flags.Parse(c.Args[2:]); err != nil {
+		return 129, nil
+	}
+	args := flags.Args()
+
+	repo, status, err := c.open()
+	if repo == nil {
+		return status, err
+	}
+
+	if len(args) == 0 {
+		remotes, err := repo.Remotes()
+		if err != nil {
+			return 1, err
+		}
+		for _, r := range remotes {
+			if *verbose {
+				fmt.Fprintf(c.Stdout, "%s\t%s (fetch)\n", r.Name, r.URL)
+				fmt.Fprintf(c.Stdout, "%s\t%s (push)\n", r.Name, r.URL)
+			} else {
+				fmt.Fprintln(c.Stdout, r.Name)
+			}
+		}
+		return 0, nil
+	}
+
+	switch {
+	case args[0] == "add" && len(args) == 3:
+		err = repo.AddRemote(args[1], args[2])
+	case (args[0] == "remove" || args[0] == "rm") && len(args) == 2:
+		err = repo.RemoveRemote(args[1])
+	default:
+		fmt.Fprintln(c.Stderr, "usage: jit remote [-v]")
+		fmt.Fprintln(c.Stderr, "   or: jit remote add <name> <url>")
+		fmt.Fprintln(c.Stderr, "   or: jit remote remove <name>")
+		return 129, nil
+	}
+
+	switch err.(type) {
+	case nil:
+		return 0, nil
+	case *remote.RemoteExists, *remote.InvalidRefspec, *jit.LockDenied:
+		fmt.Fprintln(c.Stderr, "error:", err.Error())
+		return 3, nil
+	case *remote.UnknownRemote:
+		fmt.Fprintln(c.Stderr, "error:", err.Error())
+		return 2, nil
+	default:
+		return 1, err
+	}
+}
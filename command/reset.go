@@ -0,0 +1,75 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/tpbowden/jit/jit"
+)
+
+func (c *Command) cmdReset() (int, error) {
+	args := c.Args[2:]
+	var paths []string
+	for i, arg := range args {
+		if arg == "--" {
+			args, paths = args[:i], args[i+1:]
+			break
+		}
+	}
+
+	flags := flag.NewFlagSet("reset", flag.ContinueOnError)
+	flags.SetOutput(c.Stderr)
+	soft := flags.Bool("soft", false, "move HEAD without touching the index or workspace")
+	flags.Bool("mixed", false, "move HEAD and reset the index (default)")
+	hard := flags.Bool("hard", false, "move HEAD and reset the index and workspace")
+	if err := flags.Parse(args); err != nil {
+		return 129, nil
+	}
+	args = flags.Args()
+	modes := []string{}
+	for _, mode := range []string{"soft", "mixed", "hard"} {
+		if flags.Lookup(mode).Value.String() == "true" {
+			modes = append(modes, mode)
+		}
+	}
+	if len(modes) > 1 {
+		fmt.Fprintf(c.Stderr, "fatal: options '--%s' and '--%s' cannot be used together\n", modes[0], modes[1])
+		return 128, nil
+	}
+
+	repo, status, err := c.open()
+	if repo == nil {
+		return status, err
+	}
+
+	// Without "--", the first argument is a revision unless it names a file.
+	options := jit.ResetOptions{}
+	if len(args) > 0 && (paths != nil || !c.isPathArgument(args[0])) {
+		options.Revision, args = args[0], args[1:]
+	}
+	options.Paths = append(args, paths...)
+	switch {
+	case *soft:
+		options.Mode = jit.ResetSoft
+	case *hard:
+		options.Mode = jit.ResetHard
+	}
+
+	result, err := repo.Reset(c.context(), options)
+	switch err.(type) {
+	case nil:
+	case *jit.InvalidRevision:
+		fmt.Fprintf(c.Stderr, "fatal: ambiguous argument '%s': unknown revision or path not in the working tree.\n", options.Revision)
+		return 128, nil
+	case *jit.ResetWithPaths, *jit.PathspecOutside, *jit.LockDenied:
+		fmt.Fprintln(c.Stderr, "fatal:", err.Error())
+		return 128, nil
+	default:
+		return 1, err
+	}
+
+	if *hard && result.OID != "" {
+		fmt.Fprintf(c.Stdout, "HEAD is now at %s %s\n", result.OID[0:7], result.Summary())
+	}
+	return 0, nil
+}
@@ -0,0 +1,96 @@
+package command_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func setupResetHistory(t *testing.T) *TestHelper {
+	helper := NewTestHelper(t)
+	helper.jit("init")
+	helper.writeFile("a.txt", "one")
+	helper.jit("add", ".")
+	helper.commit("first")
+	helper.writeFile("a.txt", "two")
+	helper.writeFile("dir/b.txt", "new")
+	helper.jit("add", ".")
+	helper.commit("second")
+	return helper
+}
+
+func TestMixedResetRebuildsTheIndex(t *testing.T) {
+	helper := setupResetHistory(t)
+	defer helper.cleanup()
+
+	if status := helper.jit("reset", "HEAD^"); status != 0 {
+		t.Fatalf("Expected reset to succeed: %s", helper.stderr.String())
+	}
+
+	helper.assertIndex(map[string]string{"a.txt": "one"})
+	if contents := helper.readFile("a.txt"); contents != "two" {
+		t.Errorf("Expected the workspace to be untouched, got %q", contents)
+	}
+}
+
+func TestHardResetRewritesTheWorkspace(t *testing.T) {
+	helper := setupResetHistory(t)
+	defer helper.cleanup()
+
+	helper.jit("reset", "--hard", "HEAD~1")
+
+	helper.assertIndex(map[string]string{"a.txt": "one"})
+	if contents := helper.readFile("a.txt"); contents != "one" {
+		t.Errorf("Expected a.txt to be restored, got %q", contents)
+	}
+	if _, err := os.Stat(filepath.Join(helper.path, "dir")); !os.IsNotExist(err) {
+		t.Errorf("Expected dir to be removed")
+	}
+}
+
+func TestResetCanBeUndoneWithOrigHead(t *testing.T) {
+	helper := setupResetHistory(t)
+	defer helper.cleanup()
+
+	head, _ := helper.repo.Refs.ReadHead()
+	helper.jit("reset", "--soft", "HEAD^")
+	helper.jit("reset", "--soft", "ORIG_HEAD")
+
+	if restored, _ := helper.repo.Refs.ReadHead(); restored != head {
+		t.Errorf("Expected HEAD to be %s, got %s", head, restored)
+	}
+	entries, err := helper.repo.Refs.ReadReflog("HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 4 {
+		t.Errorf("Expected 4 reflog entries, got %d", len(entries))
+	}
+}
+
+func TestResettingPathsOnlyTouchesThoseEntries(t *testing.T) {
+	helper := setupResetHistory(t)
+	defer helper.cleanup()
+
+	helper.writeFile("a.txt", "three")
+	helper.jit("add", "a.txt")
+	helper.jit("reset", "HEAD^", "--", "dir")
+
+	helper.assertIndex(map[string]string{"a.txt": "three"})
+}
+
+func TestResetRejectsConflictingModesAndPathsOutside(t *testing.T) {
+	helper := setupResetHistory(t)
+	defer helper.cleanup()
+
+	if status := helper.jit("reset", "--soft", "--hard", "HEAD^"); status != 128 {
+		t.Fatalf("Expected conflicting modes to be refused, got %d", status)
+	}
+	if stderr := helper.stderr.String(); stderr != "fatal: options '--soft' and '--hard' cannot be used together\n" {
+		t.Errorf("Unexpected error %q", stderr)
+	}
+	if status := helper.jit("reset", "HEAD^", "--", "../x"); status != 128 {
+		t.Fatalf("Expected a path outside the repository to be refused, got %d", status)
+	}
+	helper.assertIndex(map[string]string{"a.txt": "two", "dir/b.txt": "new"})
+}
@@ -0,0 +1,57 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/tpbowden/jit/jit"
+)
+
+func (c *Command) cmdRm() (int, error) {
+	flags := flag.NewFlagSet("rm", flag.ContinueOnError)
+	flags.SetOutput(c.Stderr)
+	cached := flags.Bool("cached", false, "only remove from the index")
+	recursive := flags.Bool("r", false, "allow recursive removal")
+	force := flags.Bool("f", false, "override the up-to-date check")
+	if err := flags.Parse(c.Args[2:]); err != nil {
+		return 129, nil
+	}
+	if flags.NArg() == 0 {
+		fmt.Fprintln(c.Stderr, "fatal: No pathspec was given. Which files should I remove?")
+		return 128, nil
+	}
+
+	repo, status, err := c.open()
+	if repo == nil {
+		return status, err
+	}
+
+	removed, err := repo.Remove(c.context(), jit.RemoveOptions{
+		Paths:     flags.Args(),
+		Cached:    *cached,
+		Recursive: *recursive,
+		Force:     *force,
+	})
+	if status, ok := c.pathspecFailed(err); ok {
+		return status, nil
+	}
+	switch err := err.(type) {
+	case nil:
+	case *jit.RemoveConflict:
+		for i, path := range err.Paths {
+			fmt.Fprintf(c.Stderr, "error: '%s' has %s\n", path, err.Problems[i])
+		}
+		fmt.Fprintln(c.Stderr, "(use --cached to keep the file, or -f to force removal)")
+		return 1, nil
+	case *jit.NotRecursive, *jit.LockDenied:
+		fmt.Fprintln(c.Stderr, "fatal:", err.Error())
+		return 128, nil
+	default:
+		return 1, err
+	}
+
+	for _, path := range removed {
+		fmt.Fprintf(c.Stdout, "rm '%s'\n", path)
+	}
+	return 0, nil
+}
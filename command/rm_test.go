@@ -0,0 +1,96 @@
+package command_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRemovingAModifiedFileRequiresForce(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.cleanup()
+
+	helper.jit("init")
+	helper.writeFile("a.txt", "one")
+	helper.jit("add", ".")
+	helper.commit("first")
+	helper.writeFile("a.txt", "two")
+
+	if status := helper.jit("rm", "a.txt"); status != 1 {
+		t.Fatalf("Expected rm to refuse, got %d", status)
+	}
+	helper.assertIndex(map[string]string{"a.txt": "one"})
+
+	if status := helper.jit("rm", "-f", "a.txt"); status != 0 {
+		t.Fatalf("Expected forced rm to succeed: %s", helper.stderr.String())
+	}
+	helper.assertIndex(map[string]string{})
+	if _, err := os.Stat(filepath.Join(helper.path, "a.txt")); !os.IsNotExist(err) {
+		t.Errorf("Expected a.txt to be deleted")
+	}
+}
+
+func TestRemovingCachedKeepsTheWorkspaceFile(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.cleanup()
+
+	helper.jit("init")
+	helper.writeFile("dir/a.txt", "one")
+	helper.jit("add", ".")
+	helper.commit("first")
+
+	if status := helper.jit("rm", "--cached", "-r", "dir"); status != 0 {
+		t.Fatalf("Expected rm to succeed: %s", helper.stderr.String())
+	}
+	helper.assertIndex(map[string]string{})
+	if contents := helper.readFile("dir/a.txt"); contents != "one" {
+		t.Errorf("Expected dir/a.txt to be kept, got %q", contents)
+	}
+}
+
+func TestMovingADirectory(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.cleanup()
+
+	helper.jit("init")
+	helper.writeFile("dir/a.txt", "one")
+	helper.writeFile("b.txt", "two")
+	helper.jit("add", ".")
+
+	if status := helper.jit("mv", "dir", "other"); status != 0 {
+		t.Fatalf("Expected mv to succeed: %s", helper.stderr.String())
+	}
+	if status := helper.jit("mv", "b.txt", "other/a.txt"); status != 128 {
+		t.Fatalf("Expected mv onto an existing file to fail, got %d", status)
+	}
+	helper.assertIndex(map[string]string{"other/a.txt": "one", "b.txt": "two"})
+	if contents := helper.readFile("other/a.txt"); contents != "one" {
+		t.Errorf("Expected other/a.txt to be moved, got %q", contents)
+	}
+}
+
+func TestRemovingWithPathspecs(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.cleanup()
+
+	helper.jit("init")
+	helper.writeFile("a.txt", "a")
+	helper.writeFile("b.log", "b")
+	helper.writeFile("dir/c.txt", "c")
+	helper.writeFile("dir/keep.txt", "keep")
+	helper.jit("add", ".")
+	helper.commit("first")
+
+	if status := helper.jit("rm", "--cached", "*.txt", ":!dir/keep.txt"); status != 0 {
+		t.Fatalf("Expected rm to succeed: %s", helper.stderr.String())
+	}
+	helper.assertIndex(map[string]string{"b.log": "b", "dir/keep.txt": "keep"})
+
+	if status := helper.jit("rm", "--cached", "dir"); status != 128 {
+		t.Fatalf("Expected rm of a directory without -r to fail, got %d", status)
+	}
+	if status := helper.jit("rm", "--cached", "*.md"); status != 128 {
+		t.Fatalf("Expected an unmatched pathspec to fail, got %d", status)
+	}
+	helper.assertIndex(map[string]string{"b.log": "b", "dir/keep.txt": "keep"})
+}
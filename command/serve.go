@@ -0,0 +1,50 @@
+package command
+
+import (
+	"fmt"
+
+	"github.com/tpbowden/jit/repository"
+	"github.com/tpbowden/jit/transport"
+)
+
+// openServer opens the repository named by the single argument to
+// upload-pack or receive-pack, which may be a working tree or bare.
+func (c *Command) openServer(name string) (*transport.Server, int, error) {
+	if len(c.Args) != 3 {
+		fmt.Fprintf(c.Stderr, "usage: jit %s <directory>\n", name)
+		return nil, 129, nil
+	}
+	path := c.expandPath(c.Args[2])
+	gitDir, bare, ok := repository.Discover(path)
+	if !ok {
+		fmt.Fprintf(c.Stderr, "fatal: '%s' does not appear to be a jit repository\n", c.Args[2])
+		return nil, 128, nil
+	}
+	repo, err := repository.Open(gitDir)
+	if err != nil {
+		return nil, 1, err
+	}
+	return transport.NewServer(repo, bare), 0, nil
+}
+
+func (c *Command) cmdUploadPack() (int, error) {
+	server, status, err := c.openServer("upload-pack")
+	if server == nil {
+		return status, err
+	}
+	if err := server.UploadPack(c.context(), c.Stdin, c.Stdout); err != nil {
+		return 1, err
+	}
+	return 0, nil
+}
+
+func (c *Command) cmdReceivePack() (int, error) {
+	server, status, err := c.openServer("receive-pack")
+	if server == nil {
+		return status, err
+	}
+	if err := server.ReceivePack(c.context(), c.Stdin, c.Stdout); err != nil {
+		return 1, err
+	}
+	return 0, nil
+}
@@ -0,0 +1,68 @@
+package command
+
+import (
+	"fmt"
+
+	"github.com/tpbowden/jit/jit"
+)
+
+const sparseCheckoutUsage = "usage: jit sparse-checkout (set [<dir>...] | add <dir>... | list | disable)"
+
+func (c *Command) cmdSparseCheckout() (int, error) {
+	if len(c.Args) < 3 {
+		fmt.Fprintln(c.Stderr, sparseCheckoutUsage)
+		return 129, nil
+	}
+	subcommand, args := c.Args[2], c.Args[3:]
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+	switch {
+	case subcommand == "add" && len(args) == 0,
+		subcommand == "list" && len(args) > 0, subcommand == "disable" && len(args) > 0:
+		fmt.Fprintln(c.Stderr, sparseCheckoutUsage)
+		return 129, nil
+	}
+
+	repo, status, err := c.open()
+	if repo == nil {
+		return status, err
+	}
+
+	var result *jit.SparseCheckoutResult
+	switch subcommand {
+	case "set":
+		result, err = repo.SparseCheckoutSet(c.context(), args...)
+	case "add":
+		result, err = repo.SparseCheckoutAdd(c.context(), args...)
+	case "disable":
+		result, err = repo.SparseCheckoutDisable(c.context())
+	case "list":
+		var dirs []string
+		if dirs, err = repo.SparseCheckoutList(); err == nil {
+			for _, dir := range dirs {
+				fmt.Fprintln(c.Stdout, dir)
+			}
+			return 0, nil
+		}
+	default:
+		fmt.Fprintln(c.Stderr, sparseCheckoutUsage)
+		return 129, nil
+	}
+
+	switch err.(type) {
+	case nil:
+	case *jit.NotSparse, *jit.InvalidSparseDirectory, *jit.LockDenied:
+		fmt.Fprintln(c.Stderr, "fatal:", err.Error())
+		return 128, nil
+	default:
+		return 1, err
+	}
+	if len(result.Kept) > 0 {
+		fmt.Fprintln(c.Stderr, "warning: The following paths are not up to date and were left despite sparse patterns:")
+		for _, path := range result.Kept {
+			fmt.Fprintf(c.Stderr, "\t%s\n", path)
+		}
+	}
+	return 0, nil
+}
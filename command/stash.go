@@ -0,0 +1,162 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/tpbowden/jit/jit"
+)
+
+var stashPattern = regexp.MustCompile(`^(?:(?:refs/)?stash@\{(\d+)\}|(\d+))$`)
+
+// parseStash turns "stash@{n}", or a bare n, into a position on the stash
+// stack, defaulting to the newest entry.
+func parseStash(args []string) (int, bool) {
+	if len(args) == 0 {
+		return 0, true
+	}
+	match := stashPattern.FindStringSubmatch(args[0])
+	if len(args) > 1 || match == nil {
+		return 0, false
+	}
+	n, err := strconv.Atoi(match[1] + match[2])
+	return n, err == nil
+}
+
+func (c *Command) cmdStash() (int, error) {
+	subcommand, args := "push", c.Args[2:]
+	if len(args) > 0 && args[0] != "-m" {
+		subcommand, args = args[0], args[1:]
+	}
+
+	flags := flag.NewFlagSet("stash "+subcommand, flag.ContinueOnError)
+	flags.SetOutput(c.Stderr)
+	var message *string
+	var index *bool
+	switch subcommand {
+	case "push", "save":
+		message = flags.String("m", "", "describe the stash entry")
+	case "pop", "apply":
+		index = flags.Bool("index", false, "restore the index as well as the working tree")
+	case "list", "drop":
+	default:
+		fmt.Fprintln(c.Stderr, "usage: jit stash list")
+		fmt.Fprintln(c.Stderr, "   or: jit stash drop [<stash>]")
+		fmt.Fprintln(c.Stderr, "   or: jit stash ( pop | apply ) [--index] [<stash>]")
+		fmt.Fprintln(c.Stderr, "   or: jit stash [push [-m <message>]]")
+		return 129, nil
+	}
+	if err := flags.Parse(args); err != nil {
+		return 129, nil
+	}
+	args = flags.Args()
+
+	repo, status, err := c.open()
+	if repo == nil {
+		return status, err
+	}
+
+	switch subcommand {
+	case "push", "save":
+		if len(args) > 0 {
+			fmt.Fprintln(c.Stderr, "fatal: stashing individual paths is not supported")
+			return 128, nil
+		}
+		entry, err := repo.StashPush(c.context(), jit.StashPushOptions{Message: *message})
+		if err != nil {
+			return c.stashFailed(err)
+		}
+		fmt.Fprintln(c.Stdout, "Saved working directory and index state", entry.Message)
+		return 0, nil
+	case "list":
+		entries, err := repo.StashList()
+		if err != nil {
+			return 1, err
+		}
+		for i, entry := range entries {
+			fmt.Fprintf(c.Stdout, "stash@{%d}: %s\n", i, entry.Message)
+		}
+		return 0, nil
+	}
+
+	n, ok := parseStash(args)
+	if !ok {
+		fmt.Fprintf(c.Stderr, "error: %s is not a valid reference\n", strings.Join(args, " "))
+		return 1, nil
+	}
+
+	if subcommand == "drop" {
+		entry, err := repo.StashDrop(n)
+		if err != nil {
+			return c.stashFailed(err)
+		}
+		fmt.Fprintf(c.Stdout, "Dropped refs/stash@{%d} (%s)\n", n, entry.OID)
+		return 0, nil
+	}
+
+	options := jit.StashApplyOptions{Stash: n, Index: *index}
+	var result *jit.StashApplyResult
+	if subcommand == "pop" {
+		result, err = repo.StashPop(c.context(), options)
+	} else {
+		result, err = repo.StashApply(c.context(), options)
+	}
+	if err != nil {
+		return c.stashFailed(err)
+	}
+
+	if len(result.Conflicts) > 0 {
+		for _, path := range result.Conflicts {
+			fmt.Fprintf(c.Stdout, "CONFLICT: Merge conflict in %s\n", path)
+		}
+		if subcommand == "pop" {
+			fmt.Fprintln(c.Stdout, "The stash entry is kept in case you need it again.")
+		}
+		return 1, nil
+	}
+
+	current, err := repo.Status(c.context())
+	if err != nil {
+		return 1, err
+	}
+	c.printLongStatus(current)
+	if result.Dropped != nil {
+		fmt.Fprintf(c.Stdout, "Dropped refs/stash@{%d} (%s)\n", n, result.Dropped.OID)
+	}
+	return 0, nil
+}
+
+func (c *Command) stashFailed(err error) (int, error) {
+	switch err := err.(type) {
+	case *jit.NoLocalChanges:
+		fmt.Fprintln(c.Stdout, err.Error())
+		return 0, nil
+	case *jit.UnmergedPaths:
+		for _, path := range err.Paths {
+			fmt.Fprintf(c.Stderr, "%s: needs merge\n", path)
+		}
+		return 1, nil
+	case *jit.InvalidStash:
+		if err.Count == 0 {
+			fmt.Fprintln(c.Stderr, err.Error())
+		} else {
+			fmt.Fprintln(c.Stderr, "error:", err.Error())
+		}
+		return 1, nil
+	case *jit.LocalChanges:
+		fmt.Fprintln(c.Stderr, "error:", err.Error())
+		fmt.Fprintln(c.Stderr, "Aborting")
+		return 1, nil
+	case *jit.NoInitialCommit, *jit.StashIndexConflict:
+		fmt.Fprintln(c.Stderr, err.Error())
+		return 1, nil
+	case *jit.NotStashCommit, *jit.LockDenied:
+		fmt.Fprintln(c.Stderr, "fatal:", err.Error())
+		return 128, nil
+	default:
+		return 1, err
+	}
+}
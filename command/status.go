@@ -0,0 +1,141 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/tpbowden/jit/jit"
+)
+
+func (c *Command) cmdStatus() (int, error) {
+	flags := flag.NewFlagSet("status", flag.ContinueOnError)
+	flags.SetOutput(c.Stderr)
+	porcelain := flags.Bool("porcelain", false, "give the output in a stable, easy-to-parse format")
+	if err := flags.Parse(c.Args[2:]); err != nil {
+		return 129, nil
+	}
+
+	repo, code, err := c.open()
+	if repo == nil {
+		return code, err
+	}
+	status, err := repo.Status(c.context(), flags.Args()...)
+	if code, ok := c.pathspecFailed(err); ok {
+		return code, nil
+	} else if err != nil {
+		if ld, ok := err.(*jit.LockDenied); ok {
+			fmt.Fprintln(c.Stderr, "fatal:", ld.Error())
+			return 128, nil
+		}
+		return 1, err
+	}
+
+	if *porcelain {
+		c.printPorcelainStatus(status)
+		return 0, nil
+	}
+	c.printLongStatus(status)
+	return 0, nil
+}
+
+func (c *Command) printPorcelainStatus(status *jit.Status) {
+	for _, conflict := range status.Conflicts {
+		fmt.Fprintf(c.Stdout, "%s %s\n", conflict.Code, conflict.Path)
+	}
+	for _, entry := range status.Entries {
+		fmt.Fprintf(c.Stdout, "%c%c %s\n", entry.Index, entry.Workspace, statusPath(entry))
+	}
+	for _, path := range status.Untracked {
+		fmt.Fprintf(c.Stdout, "?? %s\n", path)
+	}
+}
+
+var statusLabels = map[jit.ChangeType]string{
+	jit.Added:    "new file:",
+	jit.Deleted:  "deleted:",
+	jit.Modified: "modified:",
+	jit.Renamed:  "renamed:",
+	jit.Copied:   "copied:",
+}
+
+// statusPath shows a renamed or copied file as the path it came from and
+// its new path.
+func statusPath(entry jit.StatusEntry) string {
+	if entry.OrigPath == "" {
+		return entry.Path
+	}
+	return entry.OrigPath + " -> " + entry.Path
+}
+
+var conflictLabels = map[string]string{
+	"UU": "both modified:",
+	"AA": "both added:",
+	"DD": "both deleted:",
+	"AU": "added by us:",
+	"UA": "added by them:",
+	"DU": "deleted by us:",
+	"UD": "deleted by them:",
+}
+
+func (c *Command) printChangeSet(title string, entries []jit.StatusEntry, change func(jit.StatusEntry) jit.ChangeType) bool {
+	printed := false
+	for _, entry := range entries {
+		if change(entry) == jit.Unmodified {
+			continue
+		}
+		if !printed {
+			fmt.Fprintf(c.Stdout, "%s\n\n", title)
+			printed = true
+		}
+		path := entry.Path
+		if change(entry) == entry.Index {
+			path = statusPath(entry)
+		}
+		fmt.Fprintf(c.Stdout, "\t%-12s%s\n", statusLabels[change(entry)], path)
+	}
+	if printed {
+		fmt.Fprintln(c.Stdout)
+	}
+	return printed
+}
+
+func (c *Command) printLongStatus(status *jit.Status) {
+	if status.Branch == "" {
+		fmt.Fprintln(c.Stdout, "Not currently on any branch.")
+	} else {
+		fmt.Fprintf(c.Stdout, "On branch %s\n", status.Branch)
+	}
+	fmt.Fprintln(c.Stdout)
+
+	staged := c.printChangeSet("Changes to be committed:", status.Entries, func(e jit.StatusEntry) jit.ChangeType {
+		return e.Index
+	})
+	if len(status.Conflicts) > 0 {
+		fmt.Fprint(c.Stdout, "Unmerged paths:\n\n")
+		for _, conflict := range status.Conflicts {
+			fmt.Fprintf(c.Stdout, "\t%-17s%s\n", conflictLabels[conflict.Code], conflict.Path)
+		}
+		fmt.Fprintln(c.Stdout)
+	}
+	unstaged := c.printChangeSet("Changes not staged for commit:", status.Entries, func(e jit.StatusEntry) jit.ChangeType {
+		return e.Workspace
+	}) || len(status.Conflicts) > 0
+
+	if len(status.Untracked) > 0 {
+		fmt.Fprint(c.Stdout, "Untracked files:\n\n")
+		for _, path := range status.Untracked {
+			fmt.Fprintf(c.Stdout, "\t%s\n", path)
+		}
+		fmt.Fprintln(c.Stdout)
+	}
+
+	switch {
+	case staged:
+	case unstaged:
+		fmt.Fprintln(c.Stdout, "no changes added to commit")
+	case len(status.Untracked) > 0:
+		fmt.Fprintln(c.Stdout, "nothing added to commit but untracked files present")
+	default:
+		fmt.Fprintln(c.Stdout, "nothing to commit, working tree clean")
+	}
+}
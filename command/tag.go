@@ -0,0 +1,97 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/tpbowden/jit/jit"
+)
+
+func (c *Command) cmdTag() (int, error) {
+	flags := flag.NewFlagSet("tag", flag.ContinueOnError)
+	flags.SetOutput(c.Stderr)
+	list := flags.Bool("l", false, "list tag names matching the given patterns")
+	remove := flags.Bool("d", false, "delete the given tags")
+	annotate := flags.Bool("a", false, "make an annotated tag object")
+	message := flags.String("m", "", "use the given message for an annotated tag")
+	force := flags.Bool("f", false, "replace an existing tag")
+	if err := flags.Parse(c.Args[2:]); err != nil {
+		return 129, nil
+	}
+
+	repo, status, err := c.open()
+	if repo == nil {
+		return status, err
+	}
+	args := flags.Args()
+
+	switch {
+	case *remove:
+		if len(args) == 0 {
+			fmt.Fprintln(c.Stderr, "usage: jit tag -d <tagname>...")
+			return 129, nil
+		}
+		return c.deleteTags(repo, args)
+	case *list || len(args) == 0:
+		names, err := repo.Tags(args...)
+		if err != nil {
+			return 1, err
+		}
+		for _, name := range names {
+			fmt.Fprintln(c.Stdout, name)
+		}
+		return 0, nil
+	}
+
+	if len(args) > 2 {
+		fmt.Fprintln(c.Stderr, "fatal: too many params")
+		return 128, nil
+	}
+	if *annotate && *message == "" {
+		fmt.Fprintln(c.Stderr, "fatal: no tag message given, use -m to supply one")
+		return 128, nil
+	}
+
+	options := jit.TagOptions{Message: *message, Force: *force}
+	if len(args) == 2 {
+		options.Revision = args[1]
+	}
+	result, err := repo.CreateTag(c.context(), args[0], options)
+	switch err.(type) {
+	case nil:
+	case *jit.InvalidRevision:
+		revision := options.Revision
+		if revision == "" {
+			revision = "HEAD"
+		}
+		fmt.Fprintf(c.Stderr, "fatal: Failed to resolve '%s' as a valid ref.\n", revision)
+		return 128, nil
+	case *jit.InvalidTagName, *jit.TagExists, *jit.LockDenied:
+		fmt.Fprintln(c.Stderr, "fatal:", err.Error())
+		return 128, nil
+	default:
+		return 1, err
+	}
+
+	if result.PreviousOID != "" && result.PreviousOID != result.OID {
+		fmt.Fprintf(c.Stdout, "Updated tag '%s' (was %s)\n", args[0], result.PreviousOID[0:7])
+	}
+	return 0, nil
+}
+
+func (c *Command) deleteTags(repo *jit.Repository, names []string) (int, error) {
+	status := 0
+	for _, name := range names {
+		oid, err := repo.DeleteTag(name)
+		switch err.(type) {
+		case nil:
+			fmt.Fprintf(c.Stdout, "Deleted tag '%s' (was %s)\n", name, oid[0:7])
+		case *jit.TagNotFound, *jit.LockDenied:
+			fmt.Fprintln(c.Stderr, "error:", err.Error())
+			status = 1
+		default:
+			return 1, err
+		}
+	}
+	return status, nil
+}
@@ -0,0 +1,74 @@
+package command_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tpbowden/jit/database"
+)
+
+func TestCreatingListingAndDeletingTags(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.cleanup()
+	helper.jit("init")
+	helper.writeFile("a.txt", "one")
+	helper.jit("add", ".")
+	helper.commit("first")
+	first, _ := helper.repo.Refs.ReadHead()
+
+	if status := helper.jit("tag", "v1.0"); status != 0 {
+		t.Fatalf("Tag failed: %s", helper.stderr.String())
+	}
+	if status := helper.jit("tag", "-m", "release", "v1.1"); status != 0 {
+		t.Fatalf("Tag failed: %s", helper.stderr.String())
+	}
+	helper.jit("tag", "other")
+	if oid, _ := helper.repo.Refs.ReadRef("refs/tags/v1.0"); oid != first {
+		t.Fatalf("Expected a lightweight tag at %s, got %s", first, oid)
+	}
+	annotated, _ := helper.repo.Refs.ReadRef("refs/tags/v1.1")
+	object, err := helper.repo.Database.Load(annotated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag, ok := object.(database.Tag); !ok || tag.Object != first || tag.Message != "release\n" {
+		t.Fatalf("Unexpected tag object %#v", object)
+	}
+
+	if status := helper.jit("tag", "-l", "v*"); status != 0 || helper.stdout.String() != "v1.0\nv1.1\n" {
+		t.Fatalf("Unexpected listing %q", helper.stdout.String())
+	}
+
+	if status := helper.jit("tag", "v1.0"); status != 128 || !strings.Contains(helper.stderr.String(), "already exists") {
+		t.Fatalf("Expected an existing tag to be refused, got %d: %s", status, helper.stderr.String())
+	}
+	if status := helper.jit("tag", "bad..name"); status != 128 || !strings.Contains(helper.stderr.String(), "not a valid tag name") {
+		t.Fatalf("Expected an invalid name to be refused, got %d: %s", status, helper.stderr.String())
+	}
+	if status := helper.jit("tag", "v2.0", "nowhere"); status != 128 {
+		t.Fatalf("Expected an unknown revision to be refused, got %d", status)
+	}
+
+	helper.writeFile("a.txt", "two")
+	helper.jit("add", ".")
+	helper.commit("second")
+	if status := helper.jit("tag", "-f", "v1.0"); status != 0 || helper.stdout.String() != "Updated tag 'v1.0' (was "+first[:7]+")\n" {
+		t.Fatalf("Unexpected forced update %d: %q", status, helper.stdout.String())
+	}
+
+	if status := helper.jit("tag", "-d", "other", "missing", "../../HEAD"); status != 1 {
+		t.Fatalf("Expected deleting missing tags to fail, got %d", status)
+	}
+	if helper.stdout.String() != "Deleted tag 'other' (was "+first[:7]+")\n" {
+		t.Fatalf("Unexpected output %q", helper.stdout.String())
+	}
+	if stderr := helper.stderr.String(); stderr != "error: tag 'missing' not found.\nerror: tag '../../HEAD' not found.\n" {
+		t.Fatalf("Unexpected errors %q", stderr)
+	}
+	if head, _ := helper.repo.Refs.ReadHead(); head == "" {
+		t.Fatal("Expected HEAD to survive")
+	}
+	if status := helper.jit("tag", "-d"); status != 129 {
+		t.Fatalf("Expected deleting no tags to be a usage error, got %d", status)
+	}
+}
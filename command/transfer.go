@@ -0,0 +1,178 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/tpbowden/jit/jit"
+	"github.com/tpbowden/jit/remote"
+	"github.com/tpbowden/jit/transport"
+)
+
+func shortRef(name string) string {
+	for _, prefix := range []string{"refs/heads/", "refs/tags/", "refs/remotes/"} {
+		if strings.HasPrefix(name, prefix) {
+			return strings.TrimPrefix(name, prefix)
+		}
+	}
+	return name
+}
+
+// printRefChanges reports each changed ref in the style of git's fetch and
+// push summaries.
+func (c *Command) printRefChanges(heading string, result *jit.TransferResult) {
+	printed := false
+	for _, change := range result.Changes {
+		if change.Status == remote.RefUpToDate {
+			continue
+		}
+		if !printed {
+			fmt.Fprintf(c.Stderr, "%s %s\n", heading, result.URL)
+			printed = true
+		}
+
+		from, to := shortRef(change.Source), shortRef(change.Destination)
+		summary, marker, suffix := "", " ", ""
+		switch change.Status {
+		case remote.RefCreated:
+			marker, summary = "*", "[new branch]"
+			if strings.HasPrefix(change.Destination, "refs/tags/") {
+				summary = "[new tag]"
+			}
+		case remote.RefFastForward:
+			summary = change.Old[:7] + ".." + change.New[:7]
+		case remote.RefForced:
+			marker, summary, suffix = "+", change.Old[:7]+"..."+change.New[:7], " (forced update)"
+		case remote.RefDeleted:
+			marker, summary = "-", "[deleted]"
+		case remote.RefRejected:
+			marker, summary, suffix = "!", "[rejected]", " ("+change.Reason+")"
+		}
+
+		if change.Source == "" {
+			fmt.Fprintf(c.Stderr, " %s %-17s %s\n", marker, summary, to)
+			continue
+		}
+		fmt.Fprintf(c.Stderr, " %s %-17s %s -> %s%s\n", marker, summary, from, to, suffix)
+	}
+	if !printed && heading == "To" {
+		fmt.Fprintln(c.Stderr, "Everything up-to-date")
+	}
+}
+
+// transferFailed reports errors shared by fetch and push.
+func (c *Command) transferFailed(err error) (int, error) {
+	switch err.(type) {
+	case *remote.UnknownRemote, *remote.NoRepository, *remote.Unreachable,
+		*remote.InvalidRefspec, *jit.DetachedHead, *jit.LockDenied,
+		*transport.RemoteError, *transport.ProtocolError, *transport.CorruptPack,
+		*transport.HTTPError, *transport.AuthenticationFailed:
+		fmt.Fprintln(c.Stderr, "fatal:", err.Error())
+		return 128, nil
+	}
+	return 1, err
+}
+
+func (c *Command) cmdFetch() (int, error) {
+	flags := flag.NewFlagSet("fetch", flag.ContinueOnError)
+	flags.SetOutput(c.Stderr)
+	if err := flags.Parse(c.Args[2:]); err != nil {
+		return 129, nil
+	}
+
+	repo, status, err := c.open()
+	if repo == nil {
+		return status, err
+	}
+	options := jit.FetchOptions{Remote: flags.Arg(0), Progress: c.Stderr, SSHCommand: c.Env["GIT_SSH_COMMAND"]}
+	if flags.NArg() > 1 {
+		options.Refspecs = flags.Args()[1:]
+	}
+
+	result, err := repo.Fetch(c.context(), options)
+	if err != nil {
+		return c.transferFailed(err)
+	}
+	c.printRefChanges("From", result)
+	if result.Rejected() {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func (c *Command) cmdPush() (int, error) {
+	flags := flag.NewFlagSet("push", flag.ContinueOnError)
+	flags.SetOutput(c.Stderr)
+	force := flags.Bool("f", false, "force updates that are not fast-forwards")
+	flags.BoolVar(force, "force", false, "synonym for -f")
+	if err := flags.Parse(c.Args[2:]); err != nil {
+		return 129, nil
+	}
+
+	repo, status, err := c.open()
+	if repo == nil {
+		return status, err
+	}
+	options := jit.PushOptions{
+		Remote:     flags.Arg(0),
+		Force:      *force,
+		Progress:   c.Stderr,
+		SSHCommand: c.Env["GIT_SSH_COMMAND"],
+	}
+	if flags.NArg() > 1 {
+		options.Refspecs = flags.Args()[1:]
+	}
+
+	result, err := repo.Push(c.context(), options)
+	if err != nil {
+		return c.transferFailed(err)
+	}
+	c.printRefChanges("To", result)
+	if result.Rejected() {
+		fmt.Fprintf(c.Stderr, "error: failed to push some refs to '%s'\n", result.URL)
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func (c *Command) cmdClone() (int, error) {
+	flags := flag.NewFlagSet("clone", flag.ContinueOnError)
+	flags.SetOutput(c.Stderr)
+	uploadPack := flags.String("upload-pack", "", "program to run on the remote for the smart protocol")
+	flags.StringVar(uploadPack, "u", "", "synonym for --upload-pack")
+	if err := flags.Parse(c.Args[2:]); err != nil {
+		return 129, nil
+	}
+	if flags.NArg() < 1 || flags.NArg() > 2 {
+		fmt.Fprintln(c.Stderr, "usage: jit clone [-u <upload-pack>] <repository> [<directory>]")
+		return 129, nil
+	}
+	source := flags.Arg(0)
+	dir := strings.TrimSuffix(strings.TrimSuffix(strings.TrimRight(source, "/"), "/.git"), ".git")
+	dir = dir[strings.LastIndexAny(dir, "/:")+1:]
+	if flags.NArg() == 2 {
+		dir = flags.Arg(1)
+	}
+
+	fmt.Fprintf(c.Stderr, "Cloning into '%s'...\n", dir)
+	if !strings.Contains(source, ":") {
+		source = c.expandPath(source)
+	}
+	_, err := jit.Clone(c.context(), source, c.expandPath(dir), jit.CloneOptions{
+		Identity:   c.identity(),
+		UploadPack: *uploadPack,
+		Progress:   c.Stderr,
+		SSHCommand: c.Env["GIT_SSH_COMMAND"],
+	})
+	switch err.(type) {
+	case nil:
+		return 0, nil
+	case *jit.DestinationExists, *remote.NoRepository, *remote.Unreachable,
+		*transport.RemoteError, *transport.ProtocolError, *transport.CorruptPack,
+		*transport.HTTPError, *transport.AuthenticationFailed:
+		fmt.Fprintln(c.Stderr, "fatal:", err.Error())
+		return 128, nil
+	}
+	return 1, err
+}
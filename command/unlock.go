@@ -0,0 +1,104 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/tpbowden/jit/core"
+)
+
+func describeLock(status core.LockStatus, owner *core.LockOwner) string {
+	holder := "an unknown process"
+	if owner != nil {
+		holder = fmt.Sprintf("pid %d on %s", owner.PID, owner.Hostname)
+	}
+
+	switch status {
+	case core.LockMissing:
+		return "no lock"
+	case core.LockActive:
+		return fmt.Sprintf("held by %s, which is still running", holder)
+	case core.LockStale:
+		return fmt.Sprintf("stale, left behind by %s", holder)
+	}
+	return fmt.Sprintf("held by %s, which cannot be checked", holder)
+}
+
+func (c *Command) cmdUnlock() (int, error) {
+	flags := flag.NewFlagSet("unlock", flag.ContinueOnError)
+	flags.SetOutput(c.Stderr)
+	dryRun := flags.Bool("n", false, "only report the locks that are present")
+	force := flags.Bool("f", false, "also remove locks whose owner cannot be checked")
+	if err := flags.Parse(c.Args[2:]); err != nil {
+		return 129, nil
+	}
+
+	gitDir := filepath.Join(c.Dir, ".git")
+	found, err := core.FindLocks(gitDir)
+	if err != nil {
+		return 1, err
+	}
+	isLock := map[string]bool{}
+	for _, lock := range found {
+		isLock[lock] = true
+	}
+
+	// Named locks are only touched if FindLocks lists them, so nothing
+	// outside the git directory can be removed.
+	locks := found
+	if flags.NArg() > 0 {
+		locks = []string{}
+		for _, arg := range flags.Args() {
+			if !strings.HasSuffix(arg, ".lock") {
+				arg += ".lock"
+			}
+			lock := filepath.Join(gitDir, arg)
+			if name, err := filepath.Rel(gitDir, lock); err != nil || name == ".." || strings.HasPrefix(name, "../") {
+				fmt.Fprintf(c.Stderr, "fatal: '%s' is outside the repository\n", arg)
+				return 128, nil
+			}
+			locks = append(locks, lock)
+		}
+	}
+	if len(locks) == 0 {
+		fmt.Fprintln(c.Stdout, "No locks found")
+		return 0, nil
+	}
+
+	// A lock that could not be removed gives a status of 1, and one that
+	// was named but does not exist a status of 2.
+	status := 0
+	for _, lock := range locks {
+		name, err := filepath.Rel(gitDir, lock)
+		if err != nil {
+			return 1, err
+		}
+
+		if !isLock[lock] {
+			fmt.Fprintf(c.Stderr, "error: '%s': %s\n", name, describeLock(core.LockMissing, nil))
+			if status == 0 {
+				status = 2
+			}
+			continue
+		}
+		if *dryRun {
+			lockStatus, owner := core.InspectLock(gitDir, lock)
+			fmt.Fprintf(c.Stdout, "%s: %s\n", name, describeLock(lockStatus, owner))
+			continue
+		}
+
+		if err := core.RemoveLock(gitDir, lock, *force); err != nil {
+			if _, ok := err.(*core.LockDenied); ok {
+				lockStatus, owner := core.InspectLock(gitDir, lock)
+				fmt.Fprintf(c.Stderr, "error: not removing '%s': %s\n", name, describeLock(lockStatus, owner))
+				status = 1
+				continue
+			}
+			return 1, err
+		}
+		fmt.Fprintf(c.Stdout, "Removed lock '%s'\n", name)
+	}
+	return status, nil
+}
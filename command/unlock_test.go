@@ -0,0 +1,43 @@
+package command_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUnlockOnlyRemovesLocksInTheRepository(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.cleanup()
+	helper.jit("init")
+	hostname, _ := os.Hostname()
+	helper.writeFile(".git/index.lock", "")
+	helper.writeFile(".git/locks/index.lock.owner", fmt.Sprintf("%d %s\n", 1<<30, hostname))
+	helper.writeFile("outside.lock", "")
+
+	if status := helper.jit("unlock", "-n", "index", "HEAD"); status != 2 {
+		t.Fatalf("Expected a missing lock to give status 2, got %d", status)
+	}
+	if !strings.Contains(helper.stdout.String(), "index.lock: stale") || helper.stderr.String() != "error: 'HEAD.lock': no lock\n" {
+		t.Fatalf("Unexpected output %q, %q", helper.stdout.String(), helper.stderr.String())
+	}
+
+	if status := helper.jit("unlock", "../outside"); status != 128 {
+		t.Fatalf("Expected a path outside the repository to be refused, got %d", status)
+	}
+	if status := helper.jit("unlock", "objects/../../outside.lock"); status != 128 {
+		t.Fatalf("Expected a path outside the repository to be refused, got %d", status)
+	}
+	if _, err := os.Stat(filepath.Join(helper.path, "outside.lock")); err != nil {
+		t.Fatalf("Expected the file outside the repository to survive, got %v", err)
+	}
+
+	if status := helper.jit("unlock", "index"); status != 0 || helper.stdout.String() != "Removed lock 'index.lock'\n" {
+		t.Fatalf("Unexpected result %d: %q", status, helper.stderr.String())
+	}
+	if status := helper.jit("unlock"); status != 0 || helper.stdout.String() != "No locks found\n" {
+		t.Fatalf("Unexpected result %d: %q", status, helper.stdout.String())
+	}
+}
@@ -0,0 +1,348 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tpbowden/jit/core"
+)
+
+var (
+	sectionLine  = regexp.MustCompile(`^\s*\[([A-Za-z0-9.-]+)(?:\s+"((?:\\.|[^"\\])*)")?\]\s*(?:[#;].*)?$`)
+	variableLine = regexp.MustCompile(`^\s*([A-Za-z][A-Za-z0-9-]*)\s*(?:=(.*))?$`)
+	blankLine    = regexp.MustCompile(`^\s*(?:[#;].*)?$`)
+)
+
+type line struct {
+	text    string
+	section string
+	name    string
+	value   string
+}
+
+// Config reads and writes git-style configuration files. Sections and
+// variable names are case insensitive, subsections are not, and keys are
+// written as "section.name" or "section.subsection.name".
+type Config struct {
+	path     string
+	lines    []line
+	lockfile *core.Lockfile
+}
+
+func splitKey(key string) (string, string, error) {
+	first := strings.Index(key, ".")
+	last := strings.LastIndex(key, ".")
+	if first <= 0 || last == len(key)-1 {
+		return "", "", invalidKey(key)
+	}
+
+	section := strings.ToLower(key[:first])
+	if first != last {
+		section += "." + key[first+1:last]
+	}
+	return section, strings.ToLower(key[last+1:]), nil
+}
+
+func unquote(raw string) (string, error) {
+	var result strings.Builder
+	quoted := false
+	pending := ""
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == '\\' && i+1 < len(raw):
+			i++
+			switch raw[i] {
+			case 'n':
+				result.WriteString(pending + "\n")
+			case 't':
+				result.WriteString(pending + "\t")
+			case '"', '\\':
+				result.WriteString(pending + string(raw[i]))
+			default:
+				return "", fmt.Errorf("Invalid escape sequence in '%s'", raw)
+			}
+			pending = ""
+			continue
+		case !quoted && (c == '#' || c == ';'):
+			return result.String(), nil
+		case !quoted && (c == ' ' || c == '\t'):
+			if result.Len() > 0 {
+				pending += string(c)
+			}
+			continue
+		default:
+			result.WriteString(pending)
+			result.WriteByte(c)
+		}
+		pending = ""
+	}
+	if quoted {
+		return "", fmt.Errorf("Unterminated quote in '%s'", raw)
+	}
+	return result.String(), nil
+}
+
+func quote(value string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`).Replace(value)
+	if value != strings.TrimSpace(value) || strings.ContainsAny(value, "#;") {
+		return `"` + escaped + `"`
+	}
+	return escaped
+}
+
+func (c *Config) parse(data []byte) error {
+	c.lines = nil
+	section := ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for number := 1; scanner.Scan(); number++ {
+		text := scanner.Text()
+		if match := sectionLine.FindStringSubmatch(text); match != nil {
+			section = strings.ToLower(match[1])
+			if match[2] != "" {
+				subsection, err := unquote(`"` + match[2] + `"`)
+				if err != nil {
+					return err
+				}
+				section += "." + subsection
+			}
+			c.lines = append(c.lines, line{text: text, section: section})
+			continue
+		}
+		if blankLine.MatchString(text) {
+			c.lines = append(c.lines, line{text: text, section: section})
+			continue
+		}
+		match := variableLine.FindStringSubmatch(text)
+		if match == nil || section == "" {
+			return fmt.Errorf("bad config line %d in file %s", number, c.path)
+		}
+
+		value := "true"
+		if strings.Contains(text, "=") {
+			var err error
+			if value, err = unquote(match[2]); err != nil {
+				return fmt.Errorf("bad config line %d in file %s", number, c.path)
+			}
+		}
+		c.lines = append(c.lines, line{
+			text:    text,
+			section: section,
+			name:    strings.ToLower(match[1]),
+			value:   value,
+		})
+	}
+	return scanner.Err()
+}
+
+// Open reads the configuration file. A missing file is treated as empty.
+func (c *Config) Open() error {
+	data, err := ioutil.ReadFile(c.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			c.lines = nil
+			return nil
+		}
+		return err
+	}
+	return c.parse(data)
+}
+
+func (c *Config) OpenForUpdate() error {
+	if err := c.lockfile.HoldForUpdate(); err != nil {
+		return err
+	}
+	if err := c.Open(); err != nil {
+		c.lockfile.Rollback()
+		return err
+	}
+	return nil
+}
+
+func (c *Config) Save() error {
+	var buf bytes.Buffer
+	for _, l := range c.lines {
+		buf.WriteString(l.text)
+		buf.WriteByte('\n')
+	}
+	if err := c.lockfile.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	return c.lockfile.Commit()
+}
+
+func (c *Config) ReleaseLock() error {
+	return c.lockfile.Rollback()
+}
+
+func (c *Config) GetAll(key string) []string {
+	section, name, err := splitKey(key)
+	if err != nil {
+		return nil
+	}
+	values := []string{}
+	for _, l := range c.lines {
+		if l.section == section && l.name == name {
+			values = append(values, l.value)
+		}
+	}
+	return values
+}
+
+// Get returns the last value set for key.
+func (c *Config) Get(key string) (string, bool) {
+	values := c.GetAll(key)
+	if len(values) == 0 {
+		return "", false
+	}
+	return values[len(values)-1], true
+}
+
+func (c *Config) GetBool(key string, fallback bool) (bool, error) {
+	value, exists := c.Get(key)
+	if !exists {
+		return fallback, nil
+	}
+	switch strings.ToLower(value) {
+	case "true", "yes", "on", "1":
+		return true, nil
+	case "false", "no", "off", "0", "":
+		return false, nil
+	}
+	return false, invalidValue(key, value)
+}
+
+func (c *Config) GetInt(key string, fallback int) (int, error) {
+	value, exists := c.Get(key)
+	if !exists {
+		return fallback, nil
+	}
+	multiplier := 1
+	switch {
+	case strings.HasSuffix(value, "k"):
+		multiplier = 1024
+	case strings.HasSuffix(value, "m"):
+		multiplier = 1024 * 1024
+	}
+	if multiplier != 1 {
+		value = value[:len(value)-1]
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, invalidValue(key, value)
+	}
+	return n * multiplier, nil
+}
+
+func sectionHeader(section string) string {
+	parts := strings.SplitN(section, ".", 2)
+	if len(parts) == 1 {
+		return fmt.Sprintf("[%s]", parts[0])
+	}
+	subsection := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(parts[1])
+	return fmt.Sprintf("[%s \"%s\"]", parts[0], subsection)
+}
+
+// Add appends a value for key, keeping any existing values.
+func (c *Config) Add(key, value string) error {
+	section, name, err := splitKey(key)
+	if err != nil {
+		return err
+	}
+
+	entry := line{
+		text:    fmt.Sprintf("\t%s = %s", name, quote(value)),
+		section: section,
+		name:    name,
+		value:   value,
+	}
+
+	last := -1
+	for i, l := range c.lines {
+		if l.section == section && (l.name != "" || strings.HasPrefix(strings.TrimSpace(l.text), "[")) {
+			last = i
+		}
+	}
+	if last == -1 {
+		c.lines = append(c.lines, line{text: sectionHeader(section), section: section}, entry)
+		return nil
+	}
+
+	c.lines = append(c.lines[:last+1], append([]line{entry}, c.lines[last+1:]...)...)
+	return nil
+}
+
+// Set replaces every value of key with a single value.
+func (c *Config) Set(key, value string) error {
+	if err := c.Unset(key); err != nil {
+		return err
+	}
+	return c.Add(key, value)
+}
+
+func (c *Config) Unset(key string) error {
+	section, name, err := splitKey(key)
+	if err != nil {
+		return err
+	}
+	lines := c.lines[:0]
+	for _, l := range c.lines {
+		if l.section != section || l.name != name {
+			lines = append(lines, l)
+		}
+	}
+	c.lines = lines
+	return nil
+}
+
+// RemoveSection deletes a section such as "remote.origin" along with all of
+// its variables, reporting whether it existed.
+func (c *Config) RemoveSection(section string) bool {
+	parts := strings.SplitN(section, ".", 2)
+	parts[0] = strings.ToLower(parts[0])
+	section = strings.Join(parts, ".")
+
+	found := false
+	lines := c.lines[:0]
+	for _, l := range c.lines {
+		if l.section == section {
+			found = true
+			continue
+		}
+		lines = append(lines, l)
+	}
+	c.lines = lines
+	return found
+}
+
+// Subsections lists the subsections of a section, e.g. the remote names for
+// "remote".
+func (c *Config) Subsections(section string) []string {
+	prefix := strings.ToLower(section) + "."
+	seen := map[string]bool{}
+	names := []string{}
+	for _, l := range c.lines {
+		if strings.HasPrefix(l.section, prefix) && !seen[l.section] {
+			seen[l.section] = true
+			names = append(names, strings.TrimPrefix(l.section, prefix))
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func New(path string) *Config {
+	return &Config{
+		path:     path,
+		lockfile: core.NewLockfile(path),
+	}
+}
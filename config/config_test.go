@@ -0,0 +1,82 @@
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tpbowden/jit/config"
+)
+
+const sample = `# settings
+[core]
+	editor = vim
+	lockTimeout = 2k
+	bare
+[remote "origin"]
+	url = "/srv/repo one.git" ; a comment
+	fetch = +refs/heads/*:refs/remotes/origin/*
+`
+
+func openSample(t *testing.T) (*config.Config, string) {
+	dir, err := ioutil.TempDir("", "jit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "config")
+	if err := ioutil.WriteFile(path, []byte(sample), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := config.New(path)
+	if err := c.OpenForUpdate(); err != nil {
+		t.Fatal(err)
+	}
+	return c, dir
+}
+
+func TestReadingValues(t *testing.T) {
+	c, dir := openSample(t)
+	defer os.RemoveAll(dir)
+	defer c.ReleaseLock()
+
+	if value, _ := c.Get("Core.Editor"); value != "vim" {
+		t.Errorf("Expected editor to be vim, got %q", value)
+	}
+	if value, _ := c.Get("remote.origin.url"); value != "/srv/repo one.git" {
+		t.Errorf("Unexpected url %q", value)
+	}
+	if n, err := c.GetInt("core.lockTimeout", 0); err != nil || n != 2048 {
+		t.Errorf("Expected lockTimeout to be 2048, got %d (%v)", n, err)
+	}
+	if bare, err := c.GetBool("core.bare", false); err != nil || !bare {
+		t.Errorf("Expected core.bare to be true")
+	}
+	if _, exists := c.Get("remote.Origin.url"); exists {
+		t.Errorf("Expected subsections to be case sensitive")
+	}
+}
+
+func TestWritingValues(t *testing.T) {
+	c, dir := openSample(t)
+	defer os.RemoveAll(dir)
+
+	c.Set("core.editor", "nano")
+	c.Add("remote.upstream.url", "/srv/upstream")
+	c.RemoveSection("remote.origin")
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := config.New(filepath.Join(dir, "config"))
+	if err := reloaded.Open(); err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := reloaded.Get("core.editor"); value != "nano" {
+		t.Errorf("Expected editor to be nano, got %q", value)
+	}
+	if remotes := reloaded.Subsections("remote"); len(remotes) != 1 || remotes[0] != "upstream" {
+		t.Errorf("Expected only the upstream remote, got %v", remotes)
+	}
+}
@@ -0,0 +1,28 @@
+package config
+
+import "fmt"
+
+type InvalidKey struct {
+	key string
+}
+
+func (e *InvalidKey) Error() string {
+	return fmt.Sprintf("key does not contain a section: %s", e.key)
+}
+
+func invalidKey(key string) error {
+	return &InvalidKey{key}
+}
+
+type InvalidValue struct {
+	key   string
+	value string
+}
+
+func (e *InvalidValue) Error() string {
+	return fmt.Sprintf("bad config value '%s' for '%s'", e.value, e.key)
+}
+
+func invalidValue(key, value string) error {
+	return &InvalidValue{key, value}
+}
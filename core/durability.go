@@ -0,0 +1,194 @@
+package core
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Durability controls which writes are flushed to stable storage before
+// they are renamed into place.
+type Durability int
+
+const (
+	// DurabilityNone leaves flushing to the operating system.
+	DurabilityNone Durability = iota
+	// DurabilityObjects flushes objects, so refs never point at objects that
+	// could be lost or truncated by a crash.
+	DurabilityObjects
+	// DurabilityAll also flushes the index, refs and reflogs.
+	DurabilityAll
+)
+
+func ParseDurability(value string) (Durability, error) {
+	switch value {
+	case "none":
+		return DurabilityNone, nil
+	case "objects":
+		return DurabilityObjects, nil
+	case "all":
+		return DurabilityAll, nil
+	}
+	return DurabilityNone, fmt.Errorf("Unknown durability mode '%s'", value)
+}
+
+// FileOp describes a filesystem operation that affects what survives a crash.
+type FileOp struct {
+	Kind   string
+	Path   string
+	Target string
+	Data   []byte
+}
+
+const (
+	OpCreate  = "create"
+	OpWrite   = "write"
+	OpSync    = "sync"
+	OpRename  = "rename"
+	OpRemove  = "remove"
+	OpMkdir   = "mkdir"
+	OpSyncDir = "syncdir"
+)
+
+// files makes filesystem changes on behalf of the stores in this package,
+// telling an observer, if there is one, about each. Tests use the observer to
+// replay a sequence of writes and simulate a crash at each step.
+type files struct {
+	observer func(FileOp)
+}
+
+func (f files) observe(op FileOp) {
+	if f.observer != nil {
+		op.Data = append([]byte(nil), op.Data...)
+		f.observer(op)
+	}
+}
+
+func (f files) createExclusive(path string) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	if err == nil {
+		f.observe(FileOp{Kind: OpCreate, Path: path})
+	}
+	return file, err
+}
+
+func (f files) createTemp(dir, pattern string) (*os.File, error) {
+	file, err := ioutil.TempFile(dir, pattern)
+	if err == nil {
+		f.observe(FileOp{Kind: OpCreate, Path: file.Name()})
+	}
+	return file, err
+}
+
+func (f files) write(file *os.File, data []byte) error {
+	if _, err := file.Write(data); err != nil {
+		return err
+	}
+	f.observe(FileOp{Kind: OpWrite, Path: file.Name(), Data: data})
+	return nil
+}
+
+func (f files) sync(file *os.File) error {
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	f.observe(FileOp{Kind: OpSync, Path: file.Name()})
+	return nil
+}
+
+// syncDir flushes a directory, making the creation, renaming and removal of
+// its entries durable.
+func (f files) syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		return err
+	}
+	f.observe(FileOp{Kind: OpSyncDir, Path: dir})
+	return nil
+}
+
+func (f files) rename(from, to string) error {
+	if err := os.Rename(from, to); err != nil {
+		return err
+	}
+	f.observe(FileOp{Kind: OpRename, Path: from, Target: to})
+	return nil
+}
+
+func (f files) remove(path string) error {
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	f.observe(FileOp{Kind: OpRemove, Path: path})
+	return nil
+}
+
+// mkdirAll creates a directory and any missing parents. When sync is set, the
+// parent of each new directory is flushed so that the directory survives a
+// crash.
+func (f files) mkdirAll(dir string, sync bool) error {
+	if _, err := os.Stat(dir); err == nil {
+		return nil
+	}
+	parent := filepath.Dir(dir)
+	if parent != dir {
+		if err := f.mkdirAll(parent, sync); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Mkdir(dir, os.ModePerm); err != nil {
+		if os.IsExist(err) {
+			return nil
+		}
+		return err
+	}
+	f.observe(FileOp{Kind: OpMkdir, Path: dir})
+	if sync {
+		return f.syncDir(parent)
+	}
+	return nil
+}
+
+// WriteNewFile writes data to a temporary file named by pattern, as for
+// ioutil.TempFile, in the directory of path, and then renames it into place,
+// creating the directory first if needed. When sync is set, the data and then
+// the new directory entries are flushed to stable storage. The observer, if
+// not nil, is told about each operation.
+func WriteNewFile(path, pattern string, data []byte, sync bool, observer func(FileOp)) error {
+	f := files{observer}
+	dir := filepath.Dir(path)
+	if err := f.mkdirAll(dir, sync); err != nil {
+		return err
+	}
+
+	temp, err := f.createTemp(dir, pattern)
+	if err != nil {
+		return err
+	}
+	if err := f.write(temp, data); err != nil {
+		temp.Close()
+		return err
+	}
+	if sync {
+		if err := f.sync(temp); err != nil {
+			temp.Close()
+			return err
+		}
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	if err := f.rename(temp.Name(), path); err != nil {
+		return err
+	}
+	if sync {
+		return f.syncDir(dir)
+	}
+	return nil
+}
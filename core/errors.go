@@ -1,6 +1,9 @@
 package core
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 type MissingFile struct {
 	path string
@@ -27,13 +30,43 @@ func noPermission(path string) error {
 }
 
 type LockDenied struct {
-	path string
+	path   string
+	owner  *LockOwner
+	status LockStatus
 }
 
 func (e *LockDenied) Error() string {
-	return fmt.Sprintf("Lock denied: '%s' exists", e.path)
+	message := fmt.Sprintf("Lock denied: '%s' exists", e.path)
+	if e.owner != nil {
+		message += fmt.Sprintf(
+			" (held by pid %d on %s since %s)",
+			e.owner.PID,
+			e.owner.Hostname,
+			e.owner.Since.Format(time.RFC3339),
+		)
+	}
+	if e.status == LockStale {
+		message += "; its owner is no longer running, remove it with 'jit unlock'"
+	}
+	return message
+}
+
+func (e *LockDenied) Stale() bool {
+	return e.status == LockStale
+}
+
+func lockDenied(path string, owner *LockOwner, status LockStatus) error {
+	return &LockDenied{path, owner, status}
+}
+
+type InvalidRef struct {
+	name string
+}
+
+func (e *InvalidRef) Error() string {
+	return fmt.Sprintf("'%s' is not a valid ref name", e.name)
 }
 
-func lockDenied(path string) error {
-	return &LockDenied{path}
+func invalidRef(name string) error {
+	return &InvalidRef{name}
 }
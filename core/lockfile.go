@@ -2,31 +2,159 @@ package core
 
 import (
 	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 )
 
+const maxLockBackoff = time.Second
+
+// StaleLockAge is how old a lock without owner information must be before it
+// is presumed to have been abandoned.
+const StaleLockAge = 10 * time.Minute
+
+type LockStatus int
+
+const (
+	LockActive LockStatus = iota
+	LockStale
+	LockUnknown
+	// LockMissing means there is no lock file at all.
+	LockMissing
+)
+
+// LockOwner describes the process holding a lock, as recorded in the git
+// directory's "locks" directory. It is kept out of the lock's own directory
+// because git would take a "<name>.lock.owner" file under refs/ for a ref.
+type LockOwner struct {
+	PID      int
+	Hostname string
+	Since    time.Time
+}
+
 type Lockfile struct {
 	filePath string
 	lockPath string
 	lock     *os.File
+	// Timeout is how long HoldForUpdate keeps retrying while another process
+	// holds the lock. Zero fails immediately.
+	Timeout time.Duration
+	// Sync flushes the new contents, and then the rename that commits them,
+	// to stable storage.
+	Sync bool
+	// Observer, if set, is told about each change made to the lock file.
+	Observer func(FileOp)
+	// GitDir is the directory whose "locks" directory records who holds the
+	// lock. NewLockfile takes it to be the directory holding the file.
+	GitDir string
+}
+
+func (l *Lockfile) files() files {
+	return files{l.Observer}
+}
+
+// ownerPath returns the file recording who holds a lock in gitDir. It is named
+// after the lock's path within gitDir, escaped so that every lock has a file of
+// its own directly inside the locks directory.
+func ownerPath(gitDir, lockPath string) string {
+	name, err := filepath.Rel(gitDir, lockPath)
+	if err != nil {
+		name = lockPath
+	}
+	return filepath.Join(gitDir, "locks", url.PathEscape(filepath.ToSlash(name))+".owner")
 }
 
+// writeOwner records this process as the holder of the lock. The record is
+// written to a temporary file and renamed into place, so that it is never
+// seen half written.
+func (l *Lockfile) writeOwner() error {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return err
+	}
+	path := ownerPath(l.GitDir, l.lockPath)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	temp, err := ioutil.TempFile(filepath.Dir(path), "tmp_owner_*")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(temp, "%d %s\n", os.Getpid(), hostname)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+	}
+	return err
+}
+
+func (l *Lockfile) removeOwner() {
+	os.Remove(ownerPath(l.GitDir, l.lockPath))
+}
+
+func (l *Lockfile) tryLock() error {
+	lockfile, err := l.files().createExclusive(l.lockPath)
+	if err != nil {
+		return err
+	}
+	l.lock = lockfile
+	if err := l.writeOwner(); err != nil {
+		l.Rollback()
+		return err
+	}
+	return nil
+}
+
+// HoldForUpdate takes the lock, retrying with randomised exponential backoff
+// for up to Timeout while the lock is held elsewhere.
 func (l *Lockfile) HoldForUpdate() error {
 	if l.lock != nil {
 		return nil
 	}
-	lockfile, err := os.OpenFile(l.lockPath, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
-	if err != nil {
-		if os.IsExist(err) {
-			return lockDenied(l.lockPath)
+
+	deadline := time.Now().Add(l.Timeout)
+	backoff := time.Millisecond
+	// The global source is not seeded before go1.20, which would have
+	// every process back off in step.
+	random := rand.New(rand.NewSource(time.Now().UnixNano() ^ int64(os.Getpid())))
+	for {
+		err := l.tryLock()
+		if err == nil {
+			return nil
 		}
 		if os.IsPermission(err) {
 			return noPermission(l.lockPath)
 		}
-		return err
+		if !os.IsExist(err) {
+			return err
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			status, owner := InspectLock(l.GitDir, l.lockPath)
+			return lockDenied(l.lockPath, owner, status)
+		}
+
+		wait := backoff/2 + time.Duration(random.Int63n(int64(backoff)))
+		if wait > remaining {
+			wait = remaining
+		}
+		time.Sleep(wait)
+		if backoff *= 2; backoff > maxLockBackoff {
+			backoff = maxLockBackoff
+		}
 	}
-	l.lock = lockfile
-	return nil
 }
 
 func (l *Lockfile) Rollback() error {
@@ -34,7 +162,10 @@ func (l *Lockfile) Rollback() error {
 		return fmt.Errorf("No lock held for '%s'", l.filePath)
 	}
 	l.lock.Close()
-	if err := os.Remove(l.lockPath); err != nil {
+	// The owner goes first, so that it is never left describing a lock
+	// someone else has since taken.
+	l.removeOwner()
+	if err := l.files().remove(l.lockPath); err != nil {
 		return err
 	}
 	l.lock = nil
@@ -45,7 +176,7 @@ func (l *Lockfile) Write(data []byte) error {
 	if l.lock == nil {
 		return fmt.Errorf("No lock held for '%s'", l.filePath)
 	}
-	if _, err := l.lock.Write(data); err != nil {
+	if err := l.files().write(l.lock, data); err != nil {
 		return err
 	}
 
@@ -56,20 +187,144 @@ func (l *Lockfile) Commit() error {
 	if l.lock == nil {
 		return fmt.Errorf("No lock held for '%s'", l.filePath)
 	}
+	if l.Sync {
+		if err := l.files().sync(l.lock); err != nil {
+			return err
+		}
+	}
 	if err := l.lock.Close(); err != nil {
 		return err
 	}
-	if err := os.Rename(l.lockPath, l.filePath); err != nil {
+	l.removeOwner()
+	if err := l.files().rename(l.lockPath, l.filePath); err != nil {
 		return err
 	}
+	if l.Sync {
+		if err := l.files().syncDir(filepath.Dir(l.filePath)); err != nil {
+			return err
+		}
+	}
 	l.lock = nil
 
 	return nil
 }
 
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
+
+// InspectLock reports who holds a lock file in gitDir and whether they still
+// appear to be running. Owners on other hosts cannot be checked and are
+// reported as unknown. An owner recorded before the lock was taken was left
+// behind by an earlier holder and is ignored.
+func InspectLock(gitDir, lockPath string) (LockStatus, *LockOwner) {
+	stat, err := os.Stat(lockPath)
+	if os.IsNotExist(err) {
+		return LockMissing, nil
+	} else if err != nil {
+		return LockUnknown, nil
+	}
+
+	path := ownerPath(gitDir, lockPath)
+	content, err := ioutil.ReadFile(path)
+	fields := strings.Fields(string(content))
+	if ownerStat, statErr := os.Stat(path); statErr == nil && ownerStat.ModTime().Before(stat.ModTime()) {
+		err = os.ErrNotExist
+	}
+	if err != nil || len(fields) != 2 {
+		if time.Since(stat.ModTime()) > StaleLockAge {
+			return LockStale, nil
+		}
+		return LockUnknown, nil
+	}
+
+	pid, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return LockUnknown, nil
+	}
+	owner := &LockOwner{PID: pid, Hostname: fields[1], Since: stat.ModTime()}
+
+	hostname, err := os.Hostname()
+	if err != nil || hostname != owner.Hostname {
+		return LockUnknown, owner
+	}
+	if processAlive(pid) {
+		return LockActive, owner
+	}
+	return LockStale, owner
+}
+
+// RemoveLock deletes an abandoned lock file in gitDir. Locks whose owner is
+// still running are never removed; locks whose owner cannot be determined are
+// only removed when forced. Removing a lock that does not exist does nothing.
+//
+// The lock is first moved aside and checked to be the file that was
+// inspected, so that a lock taken by another process in the meantime is put
+// back rather than removed.
+func RemoveLock(gitDir, lockPath string, force bool) error {
+	stat, err := os.Stat(lockPath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	status, owner := InspectLock(gitDir, lockPath)
+	if status == LockMissing {
+		return nil
+	}
+	if status == LockActive || (status == LockUnknown && !force) {
+		return lockDenied(lockPath, owner, status)
+	}
+
+	aside := strings.TrimSuffix(ownerPath(gitDir, lockPath), ".owner") + ".removed"
+	if err := os.MkdirAll(filepath.Dir(aside), os.ModePerm); err != nil {
+		return err
+	}
+	if err := os.Rename(lockPath, aside); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	moved, err := os.Stat(aside)
+	if err != nil || !os.SameFile(stat, moved) {
+		os.Rename(aside, lockPath)
+		status, owner := InspectLock(gitDir, lockPath)
+		return lockDenied(lockPath, owner, status)
+	}
+	if err := os.Remove(aside); err != nil {
+		return err
+	}
+	// The owner is left alone if the lock has been taken again since.
+	if _, err := os.Stat(lockPath); os.IsNotExist(err) {
+		os.Remove(ownerPath(gitDir, lockPath))
+	}
+	return nil
+}
+
+// FindLocks lists the lock files present in a repository's git directory.
+func FindLocks(gitDir string) ([]string, error) {
+	locks := []string{}
+	err := filepath.Walk(gitDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && (path == filepath.Join(gitDir, "objects") || path == filepath.Join(gitDir, "locks")) {
+			return filepath.SkipDir
+		}
+		if !info.IsDir() && strings.HasSuffix(path, ".lock") {
+			locks = append(locks, path)
+		}
+		return nil
+	})
+	return locks, err
+}
+
 func NewLockfile(path string) *Lockfile {
 	return &Lockfile{
 		filePath: path,
 		lockPath: fmt.Sprintf("%s.lock", path),
+		GitDir:   filepath.Dir(path),
 	}
 }
@@ -0,0 +1,127 @@
+package core_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tpbowden/jit/core"
+)
+
+func lockDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "jit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestContendedLocksAreRetried(t *testing.T) {
+	dir := lockDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "index")
+
+	holder := core.NewLockfile(path)
+	if err := holder.HoldForUpdate(); err != nil {
+		t.Fatal(err)
+	}
+
+	waiter := core.NewLockfile(path)
+	if _, ok := waiter.HoldForUpdate().(*core.LockDenied); !ok {
+		t.Fatal("Expected the lock to be denied without a timeout")
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		holder.Rollback()
+	}()
+	waiter.Timeout = 5 * time.Second
+	if err := waiter.HoldForUpdate(); err != nil {
+		t.Fatalf("Expected the lock to be acquired once released, got %v", err)
+	}
+	waiter.Rollback()
+}
+
+func TestLocksLeftByDeadProcessesAreStale(t *testing.T) {
+	dir := lockDir(t)
+	defer os.RemoveAll(dir)
+	lockPath := filepath.Join(dir, "HEAD.lock")
+
+	hostname, _ := os.Hostname()
+	ioutil.WriteFile(lockPath, nil, 0644)
+	os.Mkdir(filepath.Join(dir, "locks"), os.ModePerm)
+	ioutil.WriteFile(filepath.Join(dir, "locks", "HEAD.lock.owner"), []byte(fmt.Sprintf("%d %s\n", 1<<30, hostname)), 0644)
+
+	err := core.NewLockfile(filepath.Join(dir, "HEAD")).HoldForUpdate()
+	if ld, ok := err.(*core.LockDenied); !ok || !ld.Stale() {
+		t.Fatalf("Expected a stale lock error, got %v", err)
+	}
+
+	if err := core.RemoveLock(dir, lockPath, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(lockPath); !os.IsNotExist(err) {
+		t.Error("Expected the stale lock to be removed")
+	}
+}
+
+func TestLocksHeldByRunningProcessesAreNeverRemoved(t *testing.T) {
+	dir := lockDir(t)
+	defer os.RemoveAll(dir)
+
+	lockfile := core.NewLockfile(filepath.Join(dir, "index"))
+	if err := lockfile.HoldForUpdate(); err != nil {
+		t.Fatal(err)
+	}
+	defer lockfile.Rollback()
+
+	lockPath := filepath.Join(dir, "index.lock")
+	if status, owner := core.InspectLock(dir, lockPath); status != core.LockActive || owner.PID != os.Getpid() {
+		t.Errorf("Expected the lock to be held by this process, got %v %+v", status, owner)
+	}
+	if err := core.RemoveLock(dir, lockPath, true); err == nil {
+		t.Error("Expected an active lock not to be removed")
+	}
+}
+
+func TestMissingLocksAreReported(t *testing.T) {
+	dir := lockDir(t)
+	defer os.RemoveAll(dir)
+
+	lockPath := filepath.Join(dir, "HEAD.lock")
+	if status, owner := core.InspectLock(dir, lockPath); status != core.LockMissing || owner != nil {
+		t.Errorf("Expected no lock, got %v %+v", status, owner)
+	}
+	if err := core.RemoveLock(dir, lockPath, false); err != nil {
+		t.Errorf("Expected removing a missing lock to do nothing, got %v", err)
+	}
+}
+
+func TestLockOwnersAreKeptOutOfRefs(t *testing.T) {
+	dir := lockDir(t)
+	defer os.RemoveAll(dir)
+	heads := filepath.Join(dir, "refs", "heads")
+	os.MkdirAll(heads, os.ModePerm)
+
+	lockfile := core.NewLockfile(filepath.Join(heads, "master"))
+	lockfile.GitDir = dir
+	if err := lockfile.HoldForUpdate(); err != nil {
+		t.Fatal(err)
+	}
+	defer lockfile.Rollback()
+
+	files, err := ioutil.ReadDir(heads)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Name() != "master.lock" {
+		t.Errorf("Expected only the lock in refs/heads, got %d files", len(files))
+	}
+	lockPath := filepath.Join(heads, "master.lock")
+	if status, owner := core.InspectLock(dir, lockPath); status != core.LockActive || owner.PID != os.Getpid() {
+		t.Errorf("Expected the lock to be held by this process, got %v %+v", status, owner)
+	}
+}
@@ -0,0 +1,135 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type ReflogEntry struct {
+	OldOID   string
+	NewOID   string
+	Identity string
+	Message  string
+}
+
+const nullOID = "0000000000000000000000000000000000000000"
+
+func (e ReflogEntry) String() string {
+	old := e.OldOID
+	if old == "" {
+		old = nullOID
+	}
+	message := strings.Split(strings.TrimSpace(e.Message), "\n")[0]
+	return fmt.Sprintf("%s %s %s\t%s\n", old, e.NewOID, e.Identity, message)
+}
+
+func parseReflogEntry(line string) (ReflogEntry, error) {
+	parts := strings.SplitN(line, "\t", 2)
+	fields := strings.SplitN(parts[0], " ", 3)
+	if len(fields) != 3 {
+		return ReflogEntry{}, fmt.Errorf("Invalid reflog entry '%s'", line)
+	}
+
+	entry := ReflogEntry{
+		OldOID:   fields[0],
+		NewOID:   fields[1],
+		Identity: fields[2],
+	}
+	if entry.OldOID == nullOID {
+		entry.OldOID = ""
+	}
+	if len(parts) == 2 {
+		entry.Message = parts[1]
+	}
+	return entry, nil
+}
+
+func (r Refs) reflogPath(name string) string {
+	return filepath.Join(r.gitDir, "logs", name)
+}
+
+func (r Refs) AppendReflog(name string, entry ReflogEntry) error {
+	path := r.reflogPath(name)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(entry.String()); err != nil {
+		f.Close()
+		return err
+	}
+	if r.durability == DurabilityAll {
+		if err := (files{r.observer}).sync(f); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// ReadReflog returns the entries recorded for a ref, oldest first.
+func (r Refs) ReadReflog(name string) ([]ReflogEntry, error) {
+	f, err := os.Open(r.reflogPath(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	entries := []ReflogEntry{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if scanner.Text() == "" {
+			continue
+		}
+		entry, err := parseReflogEntry(scanner.Text())
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// WriteReflog replaces the entries recorded for a ref, removing its reflog
+// when there are none.
+func (r Refs) WriteReflog(name string, entries []ReflogEntry) error {
+	path := r.reflogPath(name)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	lockfile := r.newLockfile(path)
+	if err := lockfile.HoldForUpdate(); err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			lockfile.Rollback()
+			return err
+		}
+		return lockfile.Rollback()
+	}
+
+	content := ""
+	for _, entry := range entries {
+		content += entry.String()
+	}
+	if err := lockfile.Write([]byte(content)); err != nil {
+		return err
+	}
+	return lockfile.Commit()
+}
+
+// RecordHeadUpdate logs a change of HEAD, and of the branch it points to.
+func (r Refs) RecordHeadUpdate(entry ReflogEntry) error {
+	return recordHeadUpdate(r, entry)
+}
@@ -5,16 +5,48 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 )
 
 type Refs struct {
-	gitDir string
+	gitDir      string
+	lockTimeout time.Duration
+	durability  Durability
+	observer    func(FileOp)
 }
 
-func (r Refs) UpdateHead(oid string) error {
-	head := filepath.Join(r.gitDir, "HEAD")
-	lockfile := NewLockfile(head)
+// SetLockTimeout sets how long ref updates wait for a lock held elsewhere.
+func (r *Refs) SetLockTimeout(timeout time.Duration) {
+	r.lockTimeout = timeout
+}
+
+func (r *Refs) SetDurability(durability Durability) {
+	r.durability = durability
+}
+
+// ObserveFileOps sets a function to be told about each change ref updates
+// make on disk, or clears it when nil.
+func (r *Refs) ObserveFileOps(observer func(FileOp)) {
+	r.observer = observer
+}
+
+func (r Refs) newLockfile(path string) *Lockfile {
+	lockfile := NewLockfile(path)
+	lockfile.Timeout = r.lockTimeout
+	lockfile.Sync = r.durability == DurabilityAll
+	lockfile.Observer = r.observer
+	lockfile.GitDir = r.gitDir
+	return lockfile
+}
+
+func (r Refs) writeFile(path, oid string) error {
+	if err := (files{r.observer}).mkdirAll(filepath.Dir(path), r.durability == DurabilityAll); err != nil {
+		return err
+	}
+
+	lockfile := r.newLockfile(path)
 	if err := lockfile.HoldForUpdate(); err != nil {
 		return err
 	}
@@ -31,10 +63,13 @@ func (r Refs) UpdateHead(oid string) error {
 	return nil
 }
 
-func (r Refs) ReadHead() (string, error) {
-	head := filepath.Join(r.gitDir, "HEAD")
-
-	oid, err := ioutil.ReadFile(head)
+// readFile returns the contents of a ref file, or nothing if there is no such
+// file. A directory, which holds refs named under it, is not a ref either.
+func (r Refs) readFile(path string) (string, error) {
+	if stat, err := os.Stat(path); err == nil && stat.IsDir() {
+		return "", nil
+	}
+	oid, err := ioutil.ReadFile(path)
 	if os.IsNotExist(err) {
 		return "", nil
 	}
@@ -46,6 +81,149 @@ func (r Refs) ReadHead() (string, error) {
 	return strings.TrimSpace(string(oid)), nil
 }
 
+const symrefPrefix = "ref: "
+
+// CurrentRef returns the name of the branch HEAD points to, or "HEAD" when
+// HEAD is detached.
+func (r Refs) CurrentRef() (string, error) {
+	content, err := r.readFile(filepath.Join(r.gitDir, "HEAD"))
+	if err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(content, symrefPrefix) {
+		return strings.TrimPrefix(content, symrefPrefix), nil
+	}
+	return "HEAD", nil
+}
+
+func (r Refs) SetHead(ref string) error {
+	if !ValidRefName(ref) {
+		return invalidRef(ref)
+	}
+	return r.writeFile(filepath.Join(r.gitDir, "HEAD"), symrefPrefix+ref)
+}
+
+func (r Refs) UpdateHead(oid string) error {
+	ref, err := r.CurrentRef()
+	if err != nil {
+		return err
+	}
+	if ref != "HEAD" {
+		return r.UpdateRef(ref, oid)
+	}
+	return r.writeFile(filepath.Join(r.gitDir, "HEAD"), oid)
+}
+
+func (r Refs) ReadHead() (string, error) {
+	return readHead(r)
+}
+
+// ValidRefName reports whether name follows git's rules for ref names.
+func ValidRefName(name string) bool {
+	if name == "" || name == "@" || strings.HasPrefix(name, "/") ||
+		strings.HasSuffix(name, "/") || strings.HasSuffix(name, ".") ||
+		strings.Contains(name, "..") || strings.Contains(name, "@{") ||
+		strings.Contains(name, "//") {
+		return false
+	}
+	if strings.ContainsAny(name, " ~^:?*[\\\x7f") {
+		return false
+	}
+	for _, c := range name {
+		if c < 040 {
+			return false
+		}
+	}
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") || strings.HasSuffix(part, ".lock") {
+			return false
+		}
+	}
+	return true
+}
+
+func (r Refs) ReadRef(name string) (string, error) {
+	return r.readFile(filepath.Join(r.gitDir, name))
+}
+
+func (r Refs) UpdateRef(name, oid string) error {
+	if !ValidRefName(name) {
+		return invalidRef(name)
+	}
+	return r.writeFile(filepath.Join(r.gitDir, name), oid)
+}
+
+// DeleteRef removes a ref along with its reflog.
+func (r Refs) DeleteRef(name string) error {
+	if !ValidRefName(name) {
+		return invalidRef(name)
+	}
+	path := filepath.Join(r.gitDir, name)
+	lockfile := r.newLockfile(path)
+	if err := lockfile.HoldForUpdate(); err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		lockfile.Rollback()
+		return err
+	}
+	if err := lockfile.Rollback(); err != nil {
+		return err
+	}
+	r.removeEmptyDirs(filepath.Dir(path), filepath.Join(r.gitDir, "refs"))
+
+	reflog := r.reflogPath(name)
+	if err := os.Remove(reflog); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	r.removeEmptyDirs(filepath.Dir(reflog), filepath.Join(r.gitDir, "logs", "refs"))
+	return nil
+}
+
+// removeEmptyDirs removes dir and its parents while they are empty, stopping
+// at root.
+func (r Refs) removeEmptyDirs(dir, root string) {
+	for strings.HasPrefix(dir, root+string(filepath.Separator)) {
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// ListRefs returns the full names of all refs under prefix, e.g. "refs/tags/".
+func (r Refs) ListRefs(prefix string) ([]string, error) {
+	root := filepath.Join(r.gitDir, "refs")
+	names := []string{}
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || strings.HasSuffix(path, ".lock") {
+			return nil
+		}
+		relative, err := filepath.Rel(r.gitDir, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(relative)
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(names)
+	return names, nil
+}
+
 func NewRefs(gitDir string) Refs {
 	return Refs{
 		gitDir: gitDir,
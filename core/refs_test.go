@@ -0,0 +1,52 @@
+package core_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tpbowden/jit/core"
+)
+
+func TestDeleteRefRejectsInvalidNames(t *testing.T) {
+	dir := lockDir(t)
+	defer os.RemoveAll(dir)
+	gitDir := filepath.Join(dir, "repo", ".git")
+	if err := os.MkdirAll(gitDir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	victim := filepath.Join(dir, "victim")
+	if err := ioutil.WriteFile(victim, []byte(oid+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	refs := core.NewRefs(gitDir)
+	if err := refs.DeleteRef("../../victim"); err == nil {
+		t.Fatal("Expected an invalid ref error")
+	} else if _, ok := err.(*core.InvalidRef); !ok {
+		t.Fatalf("Expected InvalidRef, got %v", err)
+	}
+	if _, err := os.Stat(victim); err != nil {
+		t.Fatalf("Expected the file outside the repository to survive, got %v", err)
+	}
+
+	if err := refs.UpdateRef("refs/tags/v1", oid); err != nil {
+		t.Fatal(err)
+	}
+	if err := refs.AppendReflog("refs/tags/v1", core.ReflogEntry{NewOID: oid, Identity: "A. U. Thor <author@example.com> 1500000000 +0000"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := refs.DeleteRef("refs/tags/v1"); err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := refs.ReadRef("refs/tags/v1"); value != "" {
+		t.Fatalf("Expected the tag to be deleted, got %q", value)
+	}
+	if _, err := os.Stat(filepath.Join(gitDir, "logs", "refs", "tags")); !os.IsNotExist(err) {
+		t.Fatalf("Expected the reflog to be deleted with the tag, got %v", err)
+	}
+	if err := core.NewMemoryRefs().DeleteRef("refs/heads/bad..name"); err == nil {
+		t.Fatal("Expected an invalid ref error")
+	}
+}
@@ -0,0 +1,163 @@
+package core
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// RefStore is where a repository keeps its refs and reflogs. Refs stores them
+// as files in the git layout; MemoryRefs keeps them in memory.
+type RefStore interface {
+	CurrentRef() (string, error)
+	SetHead(ref string) error
+	UpdateHead(oid string) error
+	ReadHead() (string, error)
+	ReadRef(name string) (string, error)
+	UpdateRef(name, oid string) error
+	DeleteRef(name string) error
+	ListRefs(prefix string) ([]string, error)
+	AppendReflog(name string, entry ReflogEntry) error
+	ReadReflog(name string) ([]ReflogEntry, error)
+	WriteReflog(name string, entries []ReflogEntry) error
+	RecordHeadUpdate(entry ReflogEntry) error
+}
+
+func readHead(store RefStore) (string, error) {
+	ref, err := store.CurrentRef()
+	if err != nil {
+		return "", err
+	}
+	return store.ReadRef(ref)
+}
+
+// recordHeadUpdate logs a change of HEAD, and of the branch it points to.
+func recordHeadUpdate(store RefStore, entry ReflogEntry) error {
+	if err := store.AppendReflog("HEAD", entry); err != nil {
+		return err
+	}
+
+	ref, err := store.CurrentRef()
+	if err != nil {
+		return err
+	}
+	if ref == "HEAD" {
+		return nil
+	}
+	return store.AppendReflog(ref, entry)
+}
+
+// MemoryRefs is a RefStore that keeps refs in memory, for tests and for
+// embedding jit without touching the filesystem. HEAD starts out pointing at
+// refs/heads/master. It is safe for concurrent use.
+type MemoryRefs struct {
+	mutex   sync.RWMutex
+	refs    map[string]string
+	reflogs map[string][]ReflogEntry
+}
+
+func (m *MemoryRefs) CurrentRef() (string, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	if content := m.refs["HEAD"]; strings.HasPrefix(content, symrefPrefix) {
+		return strings.TrimPrefix(content, symrefPrefix), nil
+	}
+	return "HEAD", nil
+}
+
+func (m *MemoryRefs) SetHead(ref string) error {
+	if !ValidRefName(ref) {
+		return invalidRef(ref)
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.refs["HEAD"] = symrefPrefix + ref
+	return nil
+}
+
+func (m *MemoryRefs) UpdateHead(oid string) error {
+	ref, err := m.CurrentRef()
+	if err != nil {
+		return err
+	}
+	return m.UpdateRef(ref, oid)
+}
+
+func (m *MemoryRefs) ReadHead() (string, error) {
+	return readHead(m)
+}
+
+func (m *MemoryRefs) ReadRef(name string) (string, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.refs[name], nil
+}
+
+func (m *MemoryRefs) UpdateRef(name, oid string) error {
+	if !ValidRefName(name) {
+		return invalidRef(name)
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.refs[name] = oid
+	return nil
+}
+
+func (m *MemoryRefs) DeleteRef(name string) error {
+	if !ValidRefName(name) {
+		return invalidRef(name)
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.refs, name)
+	delete(m.reflogs, name)
+	return nil
+}
+
+func (m *MemoryRefs) ListRefs(prefix string) ([]string, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	names := []string{}
+	for name := range m.refs {
+		if strings.HasPrefix(name, "refs/") && strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (m *MemoryRefs) AppendReflog(name string, entry ReflogEntry) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.reflogs[name] = append(m.reflogs[name], entry)
+	return nil
+}
+
+func (m *MemoryRefs) ReadReflog(name string) ([]ReflogEntry, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return append([]ReflogEntry(nil), m.reflogs[name]...), nil
+}
+
+func (m *MemoryRefs) WriteReflog(name string, entries []ReflogEntry) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if len(entries) == 0 {
+		delete(m.reflogs, name)
+		return nil
+	}
+	m.reflogs[name] = append([]ReflogEntry(nil), entries...)
+	return nil
+}
+
+func (m *MemoryRefs) RecordHeadUpdate(entry ReflogEntry) error {
+	return recordHeadUpdate(m, entry)
+}
+
+func NewMemoryRefs() *MemoryRefs {
+	return &MemoryRefs{
+		refs:    map[string]string{"HEAD": symrefPrefix + "refs/heads/master"},
+		reflogs: map[string][]ReflogEntry{},
+	}
+}
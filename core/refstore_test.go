@@ -0,0 +1,34 @@
+package core_test
+
+import (
+	"testing"
+
+	"github.com/tpbowden/jit/core"
+)
+
+const oid = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+func TestMemoryRefsFollowHead(t *testing.T) {
+	refs := core.NewMemoryRefs()
+	if err := refs.UpdateHead(oid); err != nil {
+		t.Fatal(err)
+	}
+	if head, _ := refs.ReadRef("refs/heads/master"); head != oid {
+		t.Fatalf("Expected master to be updated, got %q", head)
+	}
+
+	if err := refs.UpdateRef("HEAD", oid); err != nil {
+		t.Fatal(err)
+	}
+	if ref, _ := refs.CurrentRef(); ref != "HEAD" {
+		t.Fatalf("Expected a detached HEAD, got %s", ref)
+	}
+
+	refs.UpdateRef("refs/tags/v1", oid)
+	if names, _ := refs.ListRefs("refs/"); len(names) != 2 || names[0] != "refs/heads/master" || names[1] != "refs/tags/v1" {
+		t.Fatalf("Unexpected refs %v", names)
+	}
+	if err := refs.UpdateRef("refs/heads/bad..name", oid); err == nil {
+		t.Fatal("Expected an invalid ref error")
+	}
+}
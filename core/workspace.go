@@ -6,8 +6,34 @@ import (
 	"path/filepath"
 )
 
+// Filter converts file contents between the form kept in the working tree
+// and the form stored in the database.
+type Filter interface {
+	Clean(path string, data []byte) ([]byte, error)
+	Smudge(path string, data []byte) ([]byte, error)
+}
+
+// Sparse chooses the files a sparse checkout keeps in the working tree, given
+// slash-separated paths relative to its top.
+type Sparse interface {
+	Includes(path string) bool
+}
+
 type Workspace struct {
 	rootDir string
+	filter  Filter
+	sparse  Sparse
+}
+
+// SetFilter sets the filter ReadBlob and WriteBlob pass contents through.
+func (w *Workspace) SetFilter(filter Filter) {
+	w.filter = filter
+}
+
+// SetSparse limits the files listed to those in a sparse checkout, or lifts
+// the limit if sparse is nil.
+func (w *Workspace) SetSparse(sparse Sparse) {
+	w.sparse = sparse
 }
 
 func (w Workspace) doListFiles(root string, fileNames []string) ([]string, error) {
@@ -49,6 +75,9 @@ func (w Workspace) doListFiles(root string, fileNames []string) ([]string, error
 		if err != nil {
 			return nil, err
 		}
+		if w.sparse != nil && !w.sparse.Includes(filepath.ToSlash(relative)) {
+			continue
+		}
 		fileNames = append(fileNames, relative)
 	}
 
@@ -75,6 +104,28 @@ func (w Workspace) ReadFile(path string) ([]byte, error) {
 
 }
 
+// ReadBlob reads a file and converts it into the form to store in the
+// database.
+func (w Workspace) ReadBlob(path string) ([]byte, error) {
+	data, err := w.ReadFile(path)
+	if err != nil || w.filter == nil {
+		return data, err
+	}
+	return w.filter.Clean(path, data)
+}
+
+// WriteBlob converts contents from the database into the form kept in the
+// working tree and writes them to a file.
+func (w Workspace) WriteBlob(path string, data []byte, mode int32) error {
+	if w.filter != nil {
+		var err error
+		if data, err = w.filter.Smudge(path, data); err != nil {
+			return err
+		}
+	}
+	return w.WriteFile(path, data, mode)
+}
+
 func (w Workspace) StatFile(path string) (os.FileInfo, error) {
 	info, err := os.Stat(filepath.Join(w.rootDir, path))
 	if err != nil {
@@ -86,6 +137,67 @@ func (w Workspace) StatFile(path string) (os.FileInfo, error) {
 	return info, nil
 }
 
+func (w Workspace) WriteFile(path string, data []byte, mode int32) error {
+	fullPath := filepath.Join(w.rootDir, path)
+	if err := os.MkdirAll(filepath.Dir(fullPath), os.ModePerm); err != nil {
+		return err
+	}
+
+	perm := os.FileMode(0644)
+	if mode&0111 != 0 {
+		perm = 0755
+	}
+	if err := ioutil.WriteFile(fullPath, data, perm); err != nil {
+		if os.IsPermission(err) {
+			return noPermission(path)
+		}
+		return err
+	}
+	return os.Chmod(fullPath, perm)
+}
+
+// RemoveFile deletes a file along with any parent directories it leaves empty.
+func (w Workspace) RemoveFile(path string) error {
+	if err := os.Remove(filepath.Join(w.rootDir, path)); err != nil && !os.IsNotExist(err) {
+		if os.IsPermission(err) {
+			return noPermission(path)
+		}
+		return err
+	}
+
+	for dir := filepath.Dir(path); dir != "."; dir = filepath.Dir(dir) {
+		if err := os.Remove(filepath.Join(w.rootDir, dir)); err != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// MoveFile renames a file or directory, creating the destination's parent
+// directories and pruning any the source leaves empty.
+func (w Workspace) MoveFile(from, to string) error {
+	target := filepath.Join(w.rootDir, to)
+	if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+		return err
+	}
+	if err := os.Rename(filepath.Join(w.rootDir, from), target); err != nil {
+		if os.IsNotExist(err) {
+			return missingFile(from)
+		}
+		if os.IsPermission(err) {
+			return noPermission(from)
+		}
+		return err
+	}
+
+	for dir := filepath.Dir(from); dir != "."; dir = filepath.Dir(dir) {
+		if err := os.Remove(filepath.Join(w.rootDir, dir)); err != nil {
+			break
+		}
+	}
+	return nil
+}
+
 func NewWorkspace(rootDir string) Workspace {
 	return Workspace{
 		rootDir: rootDir,
@@ -1,10 +1,80 @@
 package database
 
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
 type Author struct {
 	name  string
 	email string
 }
 
+func (a Author) Name() string {
+	return a.name
+}
+
+func (a Author) Email() string {
+	return a.email
+}
+
+func (a Author) Format(timestamp time.Time) string {
+	return fmt.Sprintf(
+		"%s <%s> %d %s",
+		a.name,
+		a.email,
+		timestamp.Unix(),
+		timestamp.Format("-0700"),
+	)
+}
+
+func ParseAuthor(line string) (Author, time.Time, error) {
+	open := strings.Index(line, "<")
+	end := strings.LastIndex(line, ">")
+	if open == -1 || end < open {
+		return Author{}, time.Time{}, fmt.Errorf("Invalid author line '%s'", line)
+	}
+
+	author := NewAuthor(strings.TrimSpace(line[:open]), line[open+1:end])
+	fields := strings.Fields(line[end+1:])
+	if len(fields) != 2 {
+		return Author{}, time.Time{}, fmt.Errorf("Invalid author line '%s'", line)
+	}
+
+	seconds, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return Author{}, time.Time{}, err
+	}
+	zone, err := parseZone(fields[1])
+	if err != nil {
+		return Author{}, time.Time{}, err
+	}
+
+	return author, time.Unix(seconds, 0).In(zone), nil
+}
+
+func parseZone(offset string) (*time.Location, error) {
+	if len(offset) != 5 || (offset[0] != '+' && offset[0] != '-') {
+		return nil, errors.New("Invalid timezone offset")
+	}
+	hours, err := strconv.Atoi(offset[1:3])
+	if err != nil {
+		return nil, err
+	}
+	minutes, err := strconv.Atoi(offset[3:5])
+	if err != nil {
+		return nil, err
+	}
+	seconds := hours*3600 + minutes*60
+	if offset[0] == '-' {
+		seconds = -seconds
+	}
+	return time.FixedZone("", seconds), nil
+}
+
 func NewAuthor(name string, email string) Author {
 	return Author{
 		name:  name,
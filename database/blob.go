@@ -12,6 +12,10 @@ func (b Blob) Data() []byte {
 	return b.data
 }
 
+func ParseBlob(data []byte) (Blob, error) {
+	return NewBlob(data), nil
+}
+
 func NewBlob(data []byte) Blob {
 	return Blob{data}
 }
@@ -1,16 +1,24 @@
 package database
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 )
 
+// Commit is a commit object. ParentID is the first parent, which is all
+// most history walks follow, and Parents lists every parent in order.
 type Commit struct {
-	Author    Author
-	TreeID    string
-	ParentID  string
-	Message   string
-	Timestamp time.Time
+	Author     Author
+	TreeID     string
+	ParentID   string
+	Parents    []string
+	Message    string
+	Timestamp  time.Time
+	Committer  Author
+	CommitTime time.Time
 }
 
 func (c Commit) Type() string {
@@ -18,21 +26,15 @@ func (c Commit) Type() string {
 }
 
 func (c Commit) Data() (result []byte) {
-	authorString := fmt.Sprintf(
-		"%s <%s> %d +0000",
-		c.Author.name,
-		c.Author.email,
-		c.Timestamp.Unix(),
-	)
+	authorString := c.Author.Format(c.Timestamp)
 	tree := fmt.Sprintf("tree %s\n", c.TreeID)
-	parent := fmt.Sprintf("parent %s\n", c.ParentID)
 	author := fmt.Sprintf("author %s\n", authorString)
-	committer := fmt.Sprintf("committer %s\n", authorString)
+	committer := fmt.Sprintf("committer %s\n", c.Committer.Format(c.CommitTime))
 	message := fmt.Sprintf("\n%s", c.Message)
 
 	result = append(result, tree...)
-	if c.ParentID != "" {
-		result = append(result, parent...)
+	for _, parent := range c.Parents {
+		result = append(result, fmt.Sprintf("parent %s\n", parent)...)
 	}
 	result = append(result, author...)
 	result = append(result, committer...)
@@ -41,6 +43,47 @@ func (c Commit) Data() (result []byte) {
 	return result
 }
 
+// parseHeaders splits an object body into its header lines and message.
+func parseHeaders(data []byte) (map[string][]string, string) {
+	headers := map[string][]string{}
+	parts := bytes.SplitN(data, []byte("\n\n"), 2)
+	for _, line := range strings.Split(string(parts[0]), "\n") {
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		headers[fields[0]] = append(headers[fields[0]], fields[1])
+	}
+
+	message := ""
+	if len(parts) == 2 {
+		message = string(parts[1])
+	}
+	return headers, message
+}
+
+func ParseCommit(data []byte) (Commit, error) {
+	headers, message := parseHeaders(data)
+	if len(headers["tree"]) != 1 || len(headers["author"]) != 1 {
+		return Commit{}, errors.New("Invalid commit object")
+	}
+
+	author, timestamp, err := ParseAuthor(headers["author"][0])
+	if err != nil {
+		return Commit{}, err
+	}
+
+	commit := NewMergeCommit(author, headers["tree"][0], headers["parent"], message, timestamp)
+	if len(headers["committer"]) == 1 {
+		committer, commitTime, err := ParseAuthor(headers["committer"][0])
+		if err != nil {
+			return Commit{}, err
+		}
+		commit.Committer, commit.CommitTime = committer, commitTime
+	}
+	return commit, nil
+}
+
 func NewCommit(
 	author Author,
 	treeID string,
@@ -48,11 +91,32 @@ func NewCommit(
 	message string,
 	timestamp time.Time,
 ) Commit {
-	return Commit{
-		Author:    author,
-		TreeID:    treeID,
-		ParentID:  parentID,
-		Message:   message,
-		Timestamp: timestamp,
+	parents := []string{}
+	if parentID != "" {
+		parents = append(parents, parentID)
+	}
+	return NewMergeCommit(author, treeID, parents, message, timestamp)
+}
+
+// NewMergeCommit creates a commit with any number of parents.
+func NewMergeCommit(
+	author Author,
+	treeID string,
+	parents []string,
+	message string,
+	timestamp time.Time,
+) Commit {
+	commit := Commit{
+		Author:     author,
+		TreeID:     treeID,
+		Parents:    append([]string{}, parents...),
+		Message:    message,
+		Timestamp:  timestamp,
+		Committer:  author,
+		CommitTime: timestamp,
+	}
+	if len(parents) > 0 {
+		commit.ParentID = parents[0]
 	}
+	return commit
 }
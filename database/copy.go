@@ -0,0 +1,87 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// copyFrame is an object waiting to be copied. It is expanded once the
+// objects it refers to have been queued ahead of it.
+type copyFrame struct {
+	oid      string
+	object   Raw
+	expanded bool
+}
+
+// CopyObjects copies every object reachable from tips that the destination
+// lacks, returning how many were copied. An object already present is
+// assumed to have everything it refers to present as well, so objects are
+// stored only after everything they refer to.
+func CopyObjects(ctx context.Context, from, to ObjectStore, tips []string) (int, error) {
+	copied := 0
+	stack := []copyFrame{}
+	for _, oid := range tips {
+		stack = append(stack, copyFrame{oid: oid})
+	}
+	seen := map[string]bool{}
+
+	for len(stack) > 0 {
+		if err := ctx.Err(); err != nil {
+			return copied, err
+		}
+		frame := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if frame.expanded {
+			if err := to.Store(frame.object); err != nil {
+				return copied, err
+			}
+			copied++
+			continue
+		}
+		if frame.oid == "" || seen[frame.oid] || to.Exists(frame.oid) {
+			continue
+		}
+		seen[frame.oid] = true
+
+		objectType, data, err := from.ReadObject(frame.oid)
+		if err != nil {
+			return copied, err
+		}
+		raw := NewRaw(objectType, data)
+		if ObjectID(raw) != frame.oid {
+			return copied, fmt.Errorf("Object '%s' is corrupt", frame.oid)
+		}
+		stack = append(stack, copyFrame{oid: frame.oid, object: raw, expanded: true})
+
+		references, err := References(objectType, data)
+		if err != nil {
+			return copied, err
+		}
+		for _, oid := range references {
+			stack = append(stack, copyFrame{oid: oid})
+		}
+	}
+	return copied, nil
+}
+
+// References lists the objects an object points to directly.
+func References(objectType string, data []byte) ([]string, error) {
+	object, err := ParseObject(objectType, data)
+	if err != nil {
+		return nil, err
+	}
+	switch o := object.(type) {
+	case Commit:
+		return append([]string{o.TreeID}, o.Parents...), nil
+	case Tree:
+		oids := []string{}
+		for _, entry := range o.Entries() {
+			oids = append(oids, entry.OID())
+		}
+		return oids, nil
+	case Tag:
+		return []string{o.Object}, nil
+	}
+	return nil, nil
+}
@@ -9,10 +9,37 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/tpbowden/jit/core"
 )
 
+// ObjectStore is where a repository keeps its objects. Database stores them
+// as loose files in the git layout; Memory keeps them in memory.
+type ObjectStore interface {
+	Store(object PersistableObject) error
+	Exists(oid string) bool
+	ReadObject(oid string) (string, []byte, error)
+	Load(oid string) (PersistableObject, error)
+	PrefixMatch(prefix string) ([]string, error)
+	ReadTreeRecursive(oid string) ([]TreeEntry, error)
+}
+
 type Database struct {
-	dbPath string
+	dbPath     string
+	durability core.Durability
+	observer   func(core.FileOp)
+}
+
+func (db *Database) SetDurability(durability core.Durability) {
+	db.durability = durability
+}
+
+// ObserveFileOps sets a function to be told about each change Store makes on
+// disk, or clears it when nil.
+func (db *Database) ObserveFileOps(observer func(core.FileOp)) {
+	db.observer = observer
 }
 
 type PersistableObject interface {
@@ -29,26 +56,127 @@ func ObjectID(object PersistableObject) string {
 	return fmt.Sprintf("%x", sha1.Sum([]byte(ObjectContent(object))))
 }
 
-func (db Database) Store(object PersistableObject) error {
-	hash := ObjectID(object)
-	content := ObjectContent(object)
-	path := filepath.Join(db.dbPath, hash[0:2], hash[2:])
-	_, err := os.Stat(path)
-	if !os.IsNotExist(err) {
-		return nil
+// isHex reports whether s is made only of lowercase hexadecimal digits, so
+// that an object ID taken from elsewhere can safely become part of a path.
+func isHex(s string) bool {
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
 	}
+	return true
+}
 
-	dirname := filepath.Dir(path)
+func validOID(oid string) bool {
+	return len(oid) == 40 && isHex(oid)
+}
 
-	if err := os.MkdirAll(dirname, os.ModePerm); err != nil {
-		log.Print("Failed to create object directory")
-		return err
+func (db Database) objectPath(oid string) string {
+	return filepath.Join(db.dbPath, oid[0:2], oid[2:])
+}
+
+func (db Database) Exists(oid string) bool {
+	if !validOID(oid) {
+		return false
+	}
+	_, err := os.Stat(db.objectPath(oid))
+	return err == nil
+}
+
+func (db Database) ReadObject(oid string) (string, []byte, error) {
+	if !validOID(oid) {
+		return "", nil, missingObject(oid)
+	}
+	f, err := os.Open(db.objectPath(oid))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil, missingObject(oid)
+		}
+		return "", nil, err
 	}
+	defer f.Close()
 
-	tmpFile, err := ioutil.TempFile(dirname, "tmp_object_*")
+	r, err := zlib.NewReader(f)
 	if err != nil {
-		log.Print("Failed to create temporary object")
-		return err
+		return "", nil, err
+	}
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", nil, err
+	}
+
+	null := bytes.IndexByte(content, 0)
+	space := bytes.IndexByte(content, ' ')
+	if null == -1 || space == -1 || space > null {
+		return "", nil, fmt.Errorf("Invalid object header for '%s'", oid)
+	}
+	size, err := strconv.Atoi(string(content[space+1 : null]))
+	if err != nil {
+		return "", nil, err
+	}
+	data := content[null+1:]
+	if size != len(data) {
+		return "", nil, fmt.Errorf("Object '%s' is corrupt", oid)
+	}
+
+	return string(content[:space]), data, nil
+}
+
+func ParseObject(objectType string, data []byte) (PersistableObject, error) {
+	switch objectType {
+	case "blob":
+		return ParseBlob(data)
+	case "tree":
+		return ParseTree(data)
+	case "commit":
+		return ParseCommit(data)
+	case "tag":
+		return ParseTag(data)
+	}
+	return nil, fmt.Errorf("Unknown object type '%s'", objectType)
+}
+
+func loadObject(store ObjectStore, oid string) (PersistableObject, error) {
+	objectType, data, err := store.ReadObject(oid)
+	if err != nil {
+		return nil, err
+	}
+	return ParseObject(objectType, data)
+}
+
+func (db Database) Load(oid string) (PersistableObject, error) {
+	return loadObject(db, oid)
+}
+
+func (db Database) PrefixMatch(prefix string) ([]string, error) {
+	if len(prefix) < 2 || !isHex(prefix) {
+		return nil, nil
+	}
+	files, err := ioutil.ReadDir(filepath.Join(db.dbPath, prefix[0:2]))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	matches := []string{}
+	for _, file := range files {
+		oid := prefix[0:2] + file.Name()
+		if len(oid) == 40 && strings.HasPrefix(oid, prefix) {
+			matches = append(matches, oid)
+		}
+	}
+	return matches, nil
+}
+
+func (db Database) Store(object PersistableObject) error {
+	hash := ObjectID(object)
+	content := ObjectContent(object)
+	path := db.objectPath(hash)
+	_, err := os.Stat(path)
+	if !os.IsNotExist(err) {
+		return nil
 	}
 
 	var b bytes.Buffer
@@ -61,18 +189,9 @@ func (db Database) Store(object PersistableObject) error {
 	w.Write([]byte(content))
 	w.Close()
 
-	if _, err := tmpFile.Write(b.Bytes()); err != nil {
-		log.Print("Failed to write temporary object")
-		return err
-	}
-
-	if err := tmpFile.Close(); err != nil {
-		log.Print("Failed to close temporary object")
-		return err
-	}
-
-	if err := os.Rename(tmpFile.Name(), path); err != nil {
-		log.Print("Failed to rename temporary object")
+	sync := db.durability != core.DurabilityNone
+	if err := core.WriteNewFile(path, "tmp_object_*", b.Bytes(), sync, db.observer); err != nil {
+		log.Print("Failed to write object")
 		return err
 	}
 
@@ -80,5 +199,5 @@ func (db Database) Store(object PersistableObject) error {
 }
 
 func New(dbPath string) Database {
-	return Database{dbPath}
+	return Database{dbPath: dbPath}
 }
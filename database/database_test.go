@@ -0,0 +1,93 @@
+package database_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tpbowden/jit/database"
+)
+
+func TestStoringAndLoadingATag(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db := database.New(dir)
+	author := database.NewAuthor("A. U. Thor", "author@example.com")
+	timestamp := time.Unix(1500000000, 0).In(time.FixedZone("", 3600))
+	commit := database.NewCommit(author, "4b825dc642cb6eb9a060e54bf8d69288fbee4904", "", "first\n", timestamp)
+	tag := database.NewTag(database.ObjectID(commit), "commit", "v1.0", author, "release\n", timestamp)
+
+	if err := db.Store(tag); err != nil {
+		t.Fatal(err)
+	}
+
+	object, err := db.Load(database.ObjectID(tag))
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, ok := object.(database.Tag)
+	if !ok {
+		t.Fatalf("Expected a tag, got %s", object.Type())
+	}
+	if database.ObjectID(loaded) != database.ObjectID(tag) {
+		t.Errorf("Tag did not round trip. Expected %q, got %q", tag.Data(), loaded.Data())
+	}
+	if loaded.Object != database.ObjectID(commit) || loaded.Name != "v1.0" {
+		t.Errorf("Unexpected tag contents %+v", loaded)
+	}
+}
+
+func TestLoadingAMissingObject(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	_, err = database.New(dir).Load("4b825dc642cb6eb9a060e54bf8d69288fbee4904")
+	if _, ok := err.(*database.MissingObject); !ok {
+		t.Fatalf("Expected MissingObject error, got %v", err)
+	}
+
+	// An ID that is not hex never leads outside the database.
+	name := "outside-the-object-database-0000000000"
+	if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	db := database.New(filepath.Join(dir, "objects"))
+	if db.Exists(".." + name) {
+		t.Error("Expected an ID that is not hex not to exist")
+	}
+	if _, _, err := db.ReadObject(".." + name); err == nil {
+		t.Error("Expected an ID that is not hex not to be read")
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := database.NewMemory()
+	blob := database.NewBlob([]byte("hello\n"))
+	oid := database.ObjectID(blob)
+
+	if _, err := store.Load(oid); err == nil {
+		t.Fatal("Expected a missing object error")
+	} else if _, ok := err.(*database.MissingObject); !ok {
+		t.Fatalf("Expected MissingObject error, got %v", err)
+	}
+
+	if err := store.Store(blob); err != nil {
+		t.Fatal(err)
+	}
+	objectType, data, err := store.ReadObject(oid)
+	if err != nil || objectType != "blob" || string(data) != "hello\n" {
+		t.Fatalf("Unexpected object %s %q, %v", objectType, data, err)
+	}
+	if matches, _ := store.PrefixMatch(oid[:7]); len(matches) != 1 || matches[0] != oid {
+		t.Fatalf("Unexpected prefix matches %v", matches)
+	}
+}
@@ -0,0 +1,15 @@
+package database
+
+import "fmt"
+
+type MissingObject struct {
+	oid string
+}
+
+func (e *MissingObject) Error() string {
+	return fmt.Sprintf("object '%s' not found", e.oid)
+}
+
+func missingObject(oid string) error {
+	return &MissingObject{oid}
+}
@@ -0,0 +1,78 @@
+package database
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+type memoryObject struct {
+	objectType string
+	data       []byte
+}
+
+// Memory is an ObjectStore that keeps objects in memory, for tests and for
+// embedding jit without touching the filesystem. It is safe for concurrent
+// use.
+type Memory struct {
+	mutex   sync.RWMutex
+	objects map[string]memoryObject
+}
+
+func (m *Memory) Store(object PersistableObject) error {
+	oid := ObjectID(object)
+	data := append([]byte(nil), object.Data()...)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, exists := m.objects[oid]; !exists {
+		m.objects[oid] = memoryObject{object.Type(), data}
+	}
+	return nil
+}
+
+func (m *Memory) Exists(oid string) bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	_, exists := m.objects[oid]
+	return exists
+}
+
+func (m *Memory) ReadObject(oid string) (string, []byte, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	object, exists := m.objects[oid]
+	if !exists {
+		return "", nil, missingObject(oid)
+	}
+	return object.objectType, append([]byte(nil), object.data...), nil
+}
+
+func (m *Memory) Load(oid string) (PersistableObject, error) {
+	return loadObject(m, oid)
+}
+
+func (m *Memory) PrefixMatch(prefix string) ([]string, error) {
+	if len(prefix) < 2 {
+		return nil, nil
+	}
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	matches := []string{}
+	for oid := range m.objects {
+		if strings.HasPrefix(oid, prefix) {
+			matches = append(matches, oid)
+		}
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+func (m *Memory) ReadTreeRecursive(oid string) ([]TreeEntry, error) {
+	return readTree(m, oid, "", nil)
+}
+
+func NewMemory() *Memory {
+	return &Memory{objects: map[string]memoryObject{}}
+}
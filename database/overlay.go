@@ -0,0 +1,60 @@
+package database
+
+import "sort"
+
+// Overlay reads objects from two stores but only writes to the upper one.
+// It lets objects that have not been checked yet, such as those received in
+// a pack, be read alongside the objects already in a repository.
+type Overlay struct {
+	upper ObjectStore
+	lower ObjectStore
+}
+
+func (o *Overlay) Store(object PersistableObject) error {
+	return o.upper.Store(object)
+}
+
+func (o *Overlay) Exists(oid string) bool {
+	return o.upper.Exists(oid) || o.lower.Exists(oid)
+}
+
+func (o *Overlay) ReadObject(oid string) (string, []byte, error) {
+	if o.upper.Exists(oid) {
+		return o.upper.ReadObject(oid)
+	}
+	return o.lower.ReadObject(oid)
+}
+
+func (o *Overlay) Load(oid string) (PersistableObject, error) {
+	return loadObject(o, oid)
+}
+
+func (o *Overlay) PrefixMatch(prefix string) ([]string, error) {
+	upper, err := o.upper.PrefixMatch(prefix)
+	if err != nil {
+		return nil, err
+	}
+	lower, err := o.lower.PrefixMatch(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	matches := []string{}
+	for _, oid := range append(upper, lower...) {
+		if !seen[oid] {
+			seen[oid] = true
+			matches = append(matches, oid)
+		}
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+func (o *Overlay) ReadTreeRecursive(oid string) ([]TreeEntry, error) {
+	return readTree(o, oid, "", nil)
+}
+
+func NewOverlay(upper, lower ObjectStore) *Overlay {
+	return &Overlay{upper: upper, lower: lower}
+}
@@ -0,0 +1,20 @@
+package database
+
+// Raw is an object of any type held as its serialised data, for copying
+// objects between stores without parsing them.
+type Raw struct {
+	objectType string
+	data       []byte
+}
+
+func (r Raw) Type() string {
+	return r.objectType
+}
+
+func (r Raw) Data() []byte {
+	return r.data
+}
+
+func NewRaw(objectType string, data []byte) Raw {
+	return Raw{objectType: objectType, data: data}
+}
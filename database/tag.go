@@ -0,0 +1,75 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+type Tag struct {
+	Object     string
+	ObjectType string
+	Name       string
+	Tagger     Author
+	Message    string
+	Timestamp  time.Time
+}
+
+func (t Tag) Type() string {
+	return "tag"
+}
+
+func (t Tag) Data() (result []byte) {
+	result = append(result, fmt.Sprintf("object %s\n", t.Object)...)
+	result = append(result, fmt.Sprintf("type %s\n", t.ObjectType)...)
+	result = append(result, fmt.Sprintf("tag %s\n", t.Name)...)
+	result = append(result, fmt.Sprintf("tagger %s\n", t.Tagger.Format(t.Timestamp))...)
+	result = append(result, fmt.Sprintf("\n%s", t.Message)...)
+
+	return result
+}
+
+func ParseTag(data []byte) (Tag, error) {
+	headers, message := parseHeaders(data)
+	for _, key := range []string{"object", "type", "tag"} {
+		if len(headers[key]) != 1 {
+			return Tag{}, errors.New("Invalid tag object")
+		}
+	}
+
+	tag := Tag{
+		Object:     headers["object"][0],
+		ObjectType: headers["type"][0],
+		Name:       headers["tag"][0],
+		Message:    message,
+	}
+
+	if len(headers["tagger"]) > 0 {
+		tagger, timestamp, err := ParseAuthor(headers["tagger"][0])
+		if err != nil {
+			return Tag{}, err
+		}
+		tag.Tagger = tagger
+		tag.Timestamp = timestamp
+	}
+
+	return tag, nil
+}
+
+func NewTag(
+	object string,
+	objectType string,
+	name string,
+	tagger Author,
+	message string,
+	timestamp time.Time,
+) Tag {
+	return Tag{
+		Object:     object,
+		ObjectType: objectType,
+		Name:       name,
+		Tagger:     tagger,
+		Message:    message,
+		Timestamp:  timestamp,
+	}
+}
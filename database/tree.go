@@ -1,7 +1,9 @@
 package database
 
 import (
+	"bytes"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"path/filepath"
 	"strconv"
@@ -93,6 +95,99 @@ func NewTree() *Tree {
 	}
 }
 
+type TreeEntry struct {
+	name string
+	oid  string
+	mode int32
+}
+
+// NewTreeEntry describes a file or subtree stored at path.
+func NewTreeEntry(path, oid string, mode int32) TreeEntry {
+	return TreeEntry{name: path, oid: oid, mode: mode}
+}
+
+func (e TreeEntry) Path() string {
+	return e.name
+}
+
+func (e TreeEntry) OID() string {
+	return e.oid
+}
+
+func (e TreeEntry) Mode() int32 {
+	return e.mode
+}
+
+func (e TreeEntry) IsTree() bool {
+	return e.mode == 040000
+}
+
+func (t Tree) Entries() (entries []TreeEntry) {
+	for _, key := range t.order {
+		node := t.nodes[key]
+		entries = append(entries, TreeEntry{
+			name: key,
+			oid:  node.oid(),
+			mode: node.mode(),
+		})
+	}
+	return entries
+}
+
+func ParseTree(data []byte) (Tree, error) {
+	tree := NewTree()
+	for len(data) > 0 {
+		space := bytes.IndexByte(data, ' ')
+		null := bytes.IndexByte(data, 0)
+		if space == -1 || null < space || len(data) < null+21 {
+			return Tree{}, errors.New("Invalid tree object")
+		}
+
+		mode, err := strconv.ParseInt(string(data[:space]), 8, 32)
+		if err != nil {
+			return Tree{}, err
+		}
+
+		var entry DatabaseEntry = TreeEntry{
+			name: string(data[space+1 : null]),
+			oid:  hex.EncodeToString(data[null+1 : null+21]),
+			mode: int32(mode),
+		}
+		tree.addNode(entry.Path(), Node{entry: &entry})
+		data = data[null+21:]
+	}
+	return *tree, nil
+}
+
+// ReadTreeRecursive lists every blob reachable from a tree, named by its full
+// path.
+func (db Database) ReadTreeRecursive(oid string) ([]TreeEntry, error) {
+	return readTree(db, oid, "", nil)
+}
+
+func readTree(store ObjectStore, oid, prefix string, result []TreeEntry) ([]TreeEntry, error) {
+	object, err := store.Load(oid)
+	if err != nil {
+		return nil, err
+	}
+	tree, ok := object.(Tree)
+	if !ok {
+		return nil, fmt.Errorf("Object '%s' is a %s, not a tree", oid, object.Type())
+	}
+
+	for _, entry := range tree.Entries() {
+		entry.name = filepath.Join(prefix, entry.name)
+		if entry.IsTree() {
+			if result, err = readTree(store, entry.oid, entry.name, result); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		result = append(result, entry)
+	}
+	return result, nil
+}
+
 type DatabaseEntry interface {
 	Path() string
 	OID() string
@@ -0,0 +1,93 @@
+package diff
+
+import "fmt"
+
+// Hunk is a run of edits together with the unchanged lines around them.
+type Hunk struct {
+	OldStart int
+	OldLines int
+	NewStart int
+	NewLines int
+	Edits    []Edit
+}
+
+func formatRange(start, lines int) string {
+	if lines == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, lines)
+}
+
+// Header returns the hunk's "@@ -a,b +c,d @@" line.
+func (h Hunk) Header() string {
+	return fmt.Sprintf("@@ -%s +%s @@", formatRange(h.OldStart, h.OldLines), formatRange(h.NewStart, h.NewLines))
+}
+
+// Hunks groups an edit script into hunks with the given number of context
+// lines, merging changes whose context would overlap.
+func Hunks(edits []Edit, context int) []Hunk {
+	hunks := []Hunk{}
+	for i := 0; i < len(edits); {
+		if edits[i].Kind == Equal {
+			i++
+			continue
+		}
+
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for end < len(edits) {
+			next := end
+			for next < len(edits) && edits[next].Kind == Equal {
+				next++
+			}
+			if next == len(edits) || next-end > 2*context {
+				break
+			}
+			for next < len(edits) && edits[next].Kind != Equal {
+				next++
+			}
+			end = next
+		}
+		stop := end + context
+		if stop > len(edits) {
+			stop = len(edits)
+		}
+
+		hunks = append(hunks, newHunk(edits, start, stop))
+		i = stop
+	}
+	return hunks
+}
+
+func newHunk(edits []Edit, start, stop int) Hunk {
+	hunk := Hunk{Edits: edits[start:stop]}
+	oldBefore, newBefore := 0, 0
+	for _, edit := range edits[:start] {
+		if edit.Kind != Insert {
+			oldBefore++
+		}
+		if edit.Kind != Delete {
+			newBefore++
+		}
+	}
+	for _, edit := range hunk.Edits {
+		if edit.Kind != Insert {
+			hunk.OldLines++
+		}
+		if edit.Kind != Delete {
+			hunk.NewLines++
+		}
+	}
+
+	hunk.OldStart, hunk.NewStart = oldBefore, newBefore
+	if hunk.OldLines > 0 {
+		hunk.OldStart++
+	}
+	if hunk.NewLines > 0 {
+		hunk.NewStart++
+	}
+	return hunk
+}
@@ -0,0 +1,116 @@
+package diff
+
+import "strings"
+
+// MergeResult is the outcome of a three-way merge of texts.
+type MergeResult struct {
+	// Text is the merged text, with conflict markers around any changes
+	// both sides made to the same lines.
+	Text string
+	// Conflicts counts the regions both sides changed differently.
+	Conflicts int
+}
+
+// Clean reports whether the merge needed no conflict markers.
+func (m MergeResult) Clean() bool {
+	return m.Conflicts == 0
+}
+
+// matches maps each line of a to the line of b it is left unchanged as.
+func matches(a, b []string) map[int]int {
+	result := map[int]int{}
+	for _, edit := range Myers(a, b) {
+		if edit.Kind == Equal {
+			result[edit.OldLine-1] = edit.NewLine - 1
+		}
+	}
+	return result
+}
+
+func sameLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Merge combines the changes ours and theirs each made to base, in the manner
+// of diff3. Base lines left alone by both sides divide the texts into chunks;
+// a chunk only one side changed takes that side's lines, and one both sides
+// changed differently is marked as a conflict, labelled with the given names.
+func Merge(base, ours, theirs, oursLabel, theirsLabel string) MergeResult {
+	o, a, b := Lines(base), Lines(ours), Lines(theirs)
+	matchA, matchB := matches(o, a), matches(o, b)
+
+	result := MergeResult{}
+	var text strings.Builder
+	emit := func(chunkO, chunkA, chunkB []string) {
+		switch {
+		case sameLines(chunkA, chunkB), sameLines(chunkO, chunkB):
+			text.WriteString(strings.Join(chunkA, ""))
+		case sameLines(chunkO, chunkA):
+			text.WriteString(strings.Join(chunkB, ""))
+		default:
+			result.Conflicts++
+			text.WriteString("<<<<<<< " + oursLabel + "\n")
+			writeConflictSide(&text, chunkA)
+			text.WriteString("=======\n")
+			writeConflictSide(&text, chunkB)
+			text.WriteString(">>>>>>> " + theirsLabel + "\n")
+		}
+	}
+
+	lineO, lineA, lineB := 0, 0, 0
+	for {
+		i := 0
+		for lineO+i < len(o) && lineA+i < len(a) && lineB+i < len(b) {
+			nextA, okA := matchA[lineO+i]
+			nextB, okB := matchB[lineO+i]
+			if !okA || !okB || nextA != lineA+i || nextB != lineB+i {
+				break
+			}
+			i++
+		}
+		if i > 0 {
+			text.WriteString(strings.Join(o[lineO:lineO+i], ""))
+			lineO, lineA, lineB = lineO+i, lineA+i, lineB+i
+			continue
+		}
+
+		next := lineO
+		for next < len(o) {
+			_, okA := matchA[next]
+			_, okB := matchB[next]
+			if okA && okB {
+				break
+			}
+			next++
+		}
+		endA, endB := len(a), len(b)
+		if next < len(o) {
+			endA, endB = matchA[next], matchB[next]
+		}
+		emit(o[lineO:next], a[lineA:endA], b[lineB:endB])
+		lineO, lineA, lineB = next, endA, endB
+		if next == len(o) {
+			break
+		}
+	}
+
+	result.Text = text.String()
+	return result
+}
+
+func writeConflictSide(text *strings.Builder, lines []string) {
+	for _, line := range lines {
+		text.WriteString(line)
+	}
+	if len(lines) > 0 && !strings.HasSuffix(lines[len(lines)-1], "\n") {
+		text.WriteString("\n")
+	}
+}
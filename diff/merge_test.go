@@ -0,0 +1,30 @@
+package diff_test
+
+import (
+	"testing"
+
+	"github.com/tpbowden/jit/diff"
+)
+
+func TestMergeCombinesSeparateChanges(t *testing.T) {
+	base := "1\n2\n3\n4\n5\n"
+	ours := "ONE\n2\n3\n4\n5\n"
+	theirs := "1\n2\n3\n4\nFIVE\nsix\n"
+
+	result := diff.Merge(base, ours, theirs, "ours", "theirs")
+	if !result.Clean() || result.Text != "ONE\n2\n3\n4\nFIVE\nsix\n" {
+		t.Fatalf("Unexpected merge %d %q", result.Conflicts, result.Text)
+	}
+}
+
+func TestMergeMarksConflicts(t *testing.T) {
+	base := "a\nb\nc\n"
+	ours := "a\nours\nc\n"
+	theirs := "a\ntheirs\nc\n"
+
+	result := diff.Merge(base, ours, theirs, "HEAD", "topic")
+	expected := "a\n<<<<<<< HEAD\nours\n=======\ntheirs\n>>>>>>> topic\nc\n"
+	if result.Conflicts != 1 || result.Text != expected {
+		t.Fatalf("Unexpected merge %d %q", result.Conflicts, result.Text)
+	}
+}
@@ -0,0 +1,106 @@
+// Package diff computes line-based differences between two texts using
+// Myers' algorithm and groups them into hunks for display.
+package diff
+
+import "strings"
+
+type Kind int
+
+const (
+	Equal Kind = iota
+	Insert
+	Delete
+)
+
+// Edit is one line of an edit script. OldLine and NewLine are 1-based line
+// numbers on either side, or 0 if the line does not exist on that side.
+type Edit struct {
+	Kind    Kind
+	OldLine int
+	NewLine int
+	Text    string
+}
+
+// Lines splits text into lines, each keeping its trailing newline. The last
+// line lacks one if the text does not end in a newline.
+func Lines(text string) []string {
+	lines := []string{}
+	for len(text) > 0 {
+		end := strings.IndexByte(text, '\n') + 1
+		if end == 0 {
+			end = len(text)
+		}
+		lines = append(lines, text[:end])
+		text = text[end:]
+	}
+	return lines
+}
+
+// shortestEdit runs the forward pass of Myers' algorithm, returning the
+// furthest reaching x position of every diagonal before each round.
+func shortestEdit(a, b []string) ([][]int, int) {
+	n, m := len(a), len(b)
+	offset := n + m
+	v := make([]int, 2*offset+2)
+	trace := [][]int{}
+
+	for d := 0; d <= n+m; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x, y = x+1, y+1
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return trace, offset
+			}
+		}
+	}
+	return trace, offset
+}
+
+// Myers returns a shortest edit script turning a into b.
+func Myers(a, b []string) []Edit {
+	trace, offset := shortestEdit(a, b)
+	x, y := len(a), len(b)
+	reversed := []Edit{}
+
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		var previousK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			previousK = k + 1
+		} else {
+			previousK = k - 1
+		}
+		previousX := v[offset+previousK]
+		previousY := previousX - previousK
+
+		for x > previousX && y > previousY {
+			reversed = append(reversed, Edit{Equal, x, y, a[x-1]})
+			x, y = x-1, y-1
+		}
+		if d > 0 {
+			if x == previousX {
+				reversed = append(reversed, Edit{Insert, 0, y, b[y-1]})
+			} else {
+				reversed = append(reversed, Edit{Delete, x, 0, a[x-1]})
+			}
+		}
+		x, y = previousX, previousY
+	}
+
+	edits := make([]Edit, len(reversed))
+	for i, edit := range reversed {
+		edits[len(reversed)-1-i] = edit
+	}
+	return edits
+}
@@ -0,0 +1,76 @@
+package diff_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tpbowden/jit/diff"
+)
+
+func render(edits []diff.Edit) string {
+	symbols := map[diff.Kind]string{diff.Equal: " ", diff.Insert: "+", diff.Delete: "-"}
+	result := ""
+	for _, edit := range edits {
+		result += symbols[edit.Kind] + edit.Text
+	}
+	return result
+}
+
+func TestMyersFindsAShortestEditScript(t *testing.T) {
+	a := diff.Lines("A\nB\nC\nA\nB\nB\nA\n")
+	b := diff.Lines("C\nB\nA\nB\nA\nC\n")
+
+	edits := diff.Myers(a, b)
+	changes := 0
+	for _, edit := range edits {
+		if edit.Kind != diff.Equal {
+			changes++
+		}
+	}
+	if changes != 5 {
+		t.Fatalf("Expected 5 changes, got %d:\n%s", changes, render(edits))
+	}
+
+	before, after := "", ""
+	for _, edit := range edits {
+		if edit.Kind != diff.Insert {
+			before += edit.Text
+		}
+		if edit.Kind != diff.Delete {
+			after += edit.Text
+		}
+	}
+	if before != strings.Join(a, "") || after != strings.Join(b, "") {
+		t.Fatalf("Edit script does not reproduce both sides:\n%s", render(edits))
+	}
+}
+
+func TestLinesKeepsMissingFinalNewline(t *testing.T) {
+	lines := diff.Lines("one\ntwo")
+	if len(lines) != 2 || lines[1] != "two" {
+		t.Fatalf("Unexpected lines %q", lines)
+	}
+}
+
+func TestHunksMergeNearbyChanges(t *testing.T) {
+	a := diff.Lines("1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n16\n17\n18\n19\n20\n")
+	b := diff.Lines("1\nTWO\n3\n4\n5\n6\n7\n8\nNINE\n10\n11\n12\n13\n14\n15\n16\n17\n18\n19\n20\nextra\n")
+
+	hunks := diff.Hunks(diff.Myers(a, b), 3)
+	if len(hunks) != 2 {
+		t.Fatalf("Expected 2 hunks, got %d", len(hunks))
+	}
+	if header := hunks[0].Header(); header != "@@ -1,12 +1,12 @@" {
+		t.Fatalf("Unexpected header %s", header)
+	}
+	if header := hunks[1].Header(); header != "@@ -18,3 +18,4 @@" {
+		t.Fatalf("Unexpected header %s", header)
+	}
+}
+
+func TestHunksForNewFile(t *testing.T) {
+	hunks := diff.Hunks(diff.Myers(nil, diff.Lines("only\n")), 3)
+	if len(hunks) != 1 || hunks[0].Header() != "@@ -0,0 +1 @@" {
+		t.Fatalf("Unexpected hunks %v", hunks)
+	}
+}
@@ -6,8 +6,12 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
 
 	"github.com/tpbowden/jit/core"
 )
@@ -19,6 +23,9 @@ type Index struct {
 	lockfile  *core.Lockfile
 	changed   bool
 	parents   map[string]*Set
+	mtime     int32
+	mtimeNsec int32
+	version   int
 }
 
 type IndexHeader struct {
@@ -27,26 +34,46 @@ type IndexHeader struct {
 	Entries   uint32
 }
 
-func readHeader(f *os.File) (int, error) {
-	headerBytes := make([]byte, 12)
+func readHeader(data []byte) (int, int, error) {
 	header := &IndexHeader{}
-
-	if _, err := f.Read(headerBytes); err != nil {
-		return 0, err
+	if len(data) < 12 {
+		return 0, 0, errors.New("Index file is too short")
 	}
-	if err := binary.Read(bytes.NewBuffer(headerBytes), binary.BigEndian, header); err != nil {
-		return 0, err
+	if err := binary.Read(bytes.NewBuffer(data[:12]), binary.BigEndian, header); err != nil {
+		return 0, 0, err
 	}
 
 	if header.Signature != [4]byte{'D', 'I', 'R', 'C'} {
-		return 0, errors.New("Invalid index header signature")
+		return 0, 0, errors.New("Invalid index header signature")
 	}
 
-	if header.Version != 2 {
-		return 0, errors.New("Invalid index version")
+	if header.Version < 2 || header.Version > 4 {
+		return 0, 0, fmt.Errorf("Unsupported index version %d", header.Version)
 	}
 
-	return int(header.Entries), nil
+	return int(header.Version), int(header.Entries), nil
+}
+
+// skipExtensions checks the extensions that follow the index entries. Optional
+// extensions, whose signatures start with an upper case letter, only cache
+// data jit can do without and are dropped; any other extension is required
+// for correctness and cannot be ignored.
+func skipExtensions(data []byte) error {
+	for len(data) > 0 {
+		if len(data) < 8 {
+			return errors.New("Index extension header is truncated")
+		}
+		signature := string(data[:4])
+		size := binary.BigEndian.Uint32(data[4:8])
+		if uint64(len(data)-8) < uint64(size) {
+			return fmt.Errorf("Index extension '%s' is truncated", signature)
+		}
+		if signature[0] < 'A' || signature[0] > 'Z' {
+			return fmt.Errorf("Unsupported required index extension '%s'", signature)
+		}
+		data = data[8+size:]
+	}
+	return nil
 }
 
 func parentDirs(path string) (result []string) {
@@ -58,32 +85,61 @@ func parentDirs(path string) (result []string) {
 	return result
 }
 
-func (i *Index) storeEntry(path string, e IndexEntry) {
-	i.order.Add(path)
-	i.entries[path] = e
+// entryKey identifies an entry by its path and stage. Merged entries are
+// keyed by their path alone, and a NUL, which cannot appear in a path, sorts
+// the stages of a conflicted path in the order git stores them.
+func entryKey(path string, stage int) string {
+	if stage == 0 {
+		return path
+	}
+	return path + "\x00" + strconv.Itoa(stage)
+}
 
-	for _, dir := range parentDirs(path) {
+func (i *Index) storeEntry(e IndexEntry) {
+	key := entryKey(e.path, e.Stage())
+	i.order.Add(key)
+	i.entries[key] = e
+
+	for _, dir := range parentDirs(e.path) {
 		if _, exists := i.parents[dir]; !exists {
 			i.parents[dir] = NewSet()
 		}
-		i.parents[dir].Add(path)
+		i.parents[dir].Add(key)
 	}
 }
 
-func (i *Index) removeEntry(path string) {
-	if exists := i.order.Remove(path); !exists {
+func (i *Index) removeEntry(key string) {
+	entry, exists := i.entries[key]
+	if !exists {
 		return
 	}
-	delete(i.entries, path)
+	i.order.Remove(key)
+	delete(i.entries, key)
 
-	for _, parent := range parentDirs(path) {
-		i.parents[parent].Remove(path)
+	for _, parent := range parentDirs(entry.path) {
+		i.parents[parent].Remove(key)
+	}
+}
+
+// removePath removes every stage of path, reporting whether any existed.
+func (i *Index) removePath(path string) bool {
+	removed := false
+	for stage := 0; stage <= 3; stage++ {
+		if _, exists := i.entries[entryKey(path, stage)]; exists {
+			i.removeEntry(entryKey(path, stage))
+			removed = true
+		}
 	}
+	return removed
 }
 
+// discardConflicts removes the entries that e replaces: other stages of its
+// path, files where its parent directories would go, and files inside the
+// directory its path would replace.
 func (i *Index) discardConflicts(e IndexEntry) {
+	i.removePath(e.Path())
 	for _, dir := range parentDirs(e.Path()) {
-		i.removeEntry(dir)
+		i.removePath(dir)
 	}
 
 	parents, exists := i.parents[e.Path()]
@@ -94,6 +150,23 @@ func (i *Index) discardConflicts(e IndexEntry) {
 	}
 }
 
+// SetLockTimeout sets how long LoadForUpdate waits for a lock held elsewhere.
+func (i *Index) SetLockTimeout(timeout time.Duration) {
+	i.lockfile.Timeout = timeout
+}
+
+// SetDurability decides whether WriteUpdates flushes the index to stable
+// storage before renaming it into place.
+func (i *Index) SetDurability(durability core.Durability) {
+	i.lockfile.Sync = durability == core.DurabilityAll
+}
+
+// ObserveFileOps sets a function to be told about each change WriteUpdates
+// makes on disk, or clears it when nil.
+func (i *Index) ObserveFileOps(observer func(core.FileOp)) {
+	i.lockfile.Observer = observer
+}
+
 func (i *Index) ReleaseLock() error {
 	if err := i.lockfile.Rollback(); err != nil {
 		return err
@@ -107,18 +180,167 @@ func (i *Index) Add(path, oid string, stat os.FileInfo) error {
 		return err
 	}
 	i.discardConflicts(entry)
-	i.storeEntry(path, entry)
+	i.storeEntry(entry)
 	i.changed = true
 	return nil
 }
 
-func (i Index) Entries() (entries []IndexEntry) {
-	for _, path := range i.order.Entries() {
+// AddFromDatabase stages an entry read from a tree, which has no stat data.
+func (i *Index) AddFromDatabase(path, oid string, mode int32) {
+	entry := IndexEntry{
+		fileInfo: IndexFileInfo{Mode: mode},
+		oid:      oid,
+		flags:    pathFlags(path),
+		path:     path,
+	}
+	i.discardConflicts(entry)
+	i.storeEntry(entry)
+	i.changed = true
+}
+
+// AddConflict replaces path with the base, our and their versions of a file
+// that could not be merged, as stages 1, 2 and 3. Versions with an empty
+// object ID, because the file did not exist on that side, are left out.
+func (i *Index) AddConflict(path string, oids [3]string, modes [3]int32) {
+	i.discardConflicts(IndexEntry{path: path})
+	for n, oid := range oids {
+		if oid == "" {
+			continue
+		}
+		stage := n + 1
+		i.storeEntry(IndexEntry{
+			fileInfo: IndexFileInfo{Mode: modes[n]},
+			oid:      oid,
+			flags:    pathFlags(path) | uint16(stage<<stageShift),
+			path:     path,
+		})
+	}
+	i.changed = true
+}
+
+// Conflicted reports whether any path has unmerged stages.
+func (i *Index) Conflicted() bool {
+	return len(i.ConflictPaths()) > 0
+}
+
+// ConflictPaths lists the paths with unmerged stages, sorted.
+func (i *Index) ConflictPaths() []string {
+	paths := []string{}
+	for _, key := range i.order.Entries() {
+		entry := i.entries[key]
+		if entry.Stage() != 0 && (len(paths) == 0 || paths[len(paths)-1] != entry.path) {
+			paths = append(paths, entry.path)
+		}
+	}
+	return paths
+}
+
+// IsConflicted reports whether path has unmerged stages.
+func (i *Index) IsConflicted(path string) bool {
+	for stage := 1; stage <= 3; stage++ {
+		if _, exists := i.entries[entryKey(path, stage)]; exists {
+			return true
+		}
+	}
+	return false
+}
+
+// ConflictEntry returns one stage of a conflicted path.
+func (i *Index) ConflictEntry(path string, stage int) (IndexEntry, bool) {
+	entry, exists := i.entries[entryKey(path, stage)]
+	return entry, exists
+}
+
+// Remove removes every stage of path.
+func (i *Index) Remove(path string) {
+	if i.removePath(path) {
+		i.changed = true
+	}
+}
+
+func (i *Index) SetSkipWorktree(path string, skip bool) {
+	entry, exists := i.entries[path]
+	if !exists || entry.SkipWorktree() == skip {
+		return
+	}
+	entry.setExtendedFlag(skipWorktreeFlag, skip)
+	i.entries[path] = entry
+	i.changed = true
+}
+
+// Entry returns the merged entry for path, which a conflicted path lacks.
+func (i *Index) Entry(path string) (IndexEntry, bool) {
+	entry, exists := i.entries[path]
+	return entry, exists
+}
+
+// EntriesUnder returns the entries stored inside the directory dir.
+func (i *Index) EntriesUnder(dir string) (entries []IndexEntry) {
+	children, exists := i.parents[dir]
+	if !exists {
+		return nil
+	}
+	paths := children.Entries()
+	sort.Strings(paths)
+	for _, path := range paths {
 		entries = append(entries, i.entries[path])
 	}
 	return entries
 }
 
+// IsRacilyClean reports whether an entry's file was modified no earlier than
+// the index itself was written. Such a file may have changed again within the
+// timestamp granularity, so its stat data cannot prove it unchanged.
+func (i *Index) IsRacilyClean(entry IndexEntry) bool {
+	if i.mtime == 0 && i.mtimeNsec == 0 {
+		return false
+	}
+	return entry.modifiedSince(i.mtime, i.mtimeNsec)
+}
+
+// UpdateEntryStat refreshes the stat data stored for an entry whose content is
+// known to be unchanged.
+func (i *Index) UpdateEntryStat(entry IndexEntry, stat os.FileInfo) {
+	info := statInfo(stat)
+	info.Mode = entry.fileInfo.Mode
+	entry.fileInfo = info
+	i.entries[entryKey(entry.path, entry.Stage())] = entry
+	i.changed = true
+}
+
+// EntryModified reports whether the file described by stat differs from the
+// index entry. Stat data is trusted where it can be; otherwise hash is called
+// to compute the file's object ID. Entries found unchanged by hashing get
+// fresh stat data, so WriteUpdates should be called afterwards.
+func (i *Index) EntryModified(entry IndexEntry, stat os.FileInfo, hash func() (string, error)) (bool, error) {
+	if !entry.StatMatch(stat) {
+		return true, nil
+	}
+	if entry.TimesMatch(stat) && !i.IsRacilyClean(entry) && !entry.smudged() {
+		return false, nil
+	}
+
+	oid, err := hash()
+	if err != nil {
+		return false, err
+	}
+	if oid != entry.oid {
+		return true, nil
+	}
+
+	i.UpdateEntryStat(entry, stat)
+	return false, nil
+}
+
+// Entries returns every entry, including the stages of conflicted paths,
+// sorted by path and then stage.
+func (i Index) Entries() (entries []IndexEntry) {
+	for _, key := range i.order.Entries() {
+		entries = append(entries, i.entries[key])
+	}
+	return entries
+}
+
 func (i *Index) Load() error {
 	f, err := os.OpenFile(i.indexPath, os.O_RDONLY, 0644)
 	if err != nil {
@@ -127,60 +349,50 @@ func (i *Index) Load() error {
 		}
 		return err
 	}
+	defer f.Close()
 
-	entries, err := readHeader(f)
+	stat, err := f.Stat()
 	if err != nil {
 		return err
 	}
+	info := statInfo(stat)
+	i.mtime, i.mtimeNsec = info.Mtime, info.MtimeNsec
 
-	for j := 0; j < entries; j++ {
-		entry := make([]byte, 64)
-		if _, err := f.Read(entry); err != nil {
-			return err
-		}
-
-		for entry[len(entry)-1] != 0 {
-			next := make([]byte, 8)
-			if _, err := f.Read(next); err != nil {
-				return err
-			}
-			entry = append(entry, next...)
-		}
-
-		info := &IndexFileInfo{}
-		if err := binary.Read(bytes.NewBuffer(entry), binary.BigEndian, info); err != nil {
-			return err
-		}
-
-		oid := entry[40:60]
-		flags := int16(0)
-		if err := binary.Read(bytes.NewBuffer(entry[60:62]), binary.BigEndian, &flags); err != nil {
-			return err
-		}
-
-		path := bytes.Trim(entry[62:], "\000")
-		i.storeEntry(string(path), IndexEntry{
-			fileInfo: *info,
-			path:     string(path),
-			oid:      fmt.Sprintf("%x", oid),
-			flags:    flags,
-		})
+	content, err := ioutil.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	if len(content) < 20 {
+		return errors.New("Index file is too short")
 	}
-	data, err := i.data()
+
+	data, checksum := content[:len(content)-20], content[len(content)-20:]
 	digest := sha1.Sum(data)
-	checksum := make([]byte, 20)
+	if bytes.Compare(digest[:], checksum) != 0 {
+		return errors.New("Checksum does not match value stored on disk")
+	}
 
-	if _, err := f.Read(checksum); err != nil {
+	version, entries, err := readHeader(data)
+	if err != nil {
 		return err
 	}
 
-	if bytes.Compare(digest[:], checksum) != 0 {
-		return errors.New("Checksum does not match value stored on disk")
+	offset := 12
+	previous := ""
+	for j := 0; j < entries; j++ {
+		entry, size, err := parseIndexEntry(data[offset:], version, previous)
+		if err != nil {
+			return err
+		}
+		i.storeEntry(entry)
+		previous = entry.path
+		offset += size
 	}
 
-	if err := f.Close(); err != nil {
+	if err := skipExtensions(data[offset:]); err != nil {
 		return err
 	}
+	i.version = version
 
 	return nil
 }
@@ -202,27 +414,73 @@ func (i *Index) Clear() {
 	i.order = NewSortedSet()
 	i.changed = false
 	i.parents = map[string]*Set{}
+	i.mtime = 0
+	i.mtimeNsec = 0
+	i.version = 2
+}
+
+// SetVersion chooses the on-disk format used by WriteUpdates. Version 4
+// compresses path names; versions 2 and 3 are otherwise picked automatically
+// depending on whether any entry needs extended flags.
+func (i *Index) SetVersion(version int) error {
+	if version < 2 || version > 4 {
+		return fmt.Errorf("Unsupported index version %d", version)
+	}
+	if version != i.version {
+		i.version = version
+		i.changed = true
+	}
+	return nil
 }
 
-func (i *Index) data() ([]byte, error) {
+func (i *Index) writeVersion() int {
+	if i.version == 4 {
+		return 4
+	}
+	for _, entry := range i.entries {
+		if entry.extendedFlags != 0 {
+			return 3
+		}
+	}
+	return 2
+}
+
+// data encodes the index for writing at the given time. Entries whose files
+// were modified no earlier than that, or than the index was last written, may
+// change again without their stat data showing it. They are written smudged,
+// with no size, so that they are hashed rather than trusted when next checked,
+// however much newer the index file itself has become by then.
+func (i *Index) data(now time.Time) ([]byte, error) {
 	result := new(bytes.Buffer)
+	version := i.writeVersion()
 	header := IndexHeader{
 		Signature: [4]byte{'D', 'I', 'R', 'C'},
-		Version:   2,
+		Version:   uint32(version),
 		Entries:   uint32(len(i.entries)),
 	}
 	if err := binary.Write(result, binary.BigEndian, header); err != nil {
 		return nil, err
 	}
 
+	previous := ""
 	for _, entry := range i.Entries() {
-		data, err := entry.Data()
+		if i.IsRacilyClean(entry) || entry.modifiedSince(int32(now.Unix()), int32(now.Nanosecond())) {
+			entry.fileInfo.Size = 0
+		}
+		var data []byte
+		var err error
+		if version == 4 {
+			data, err = entry.CompressedData(previous)
+		} else {
+			data, err = entry.Data()
+		}
 		if err != nil {
 			return nil, err
 		}
 		if _, err := result.Write(data); err != nil {
 			return nil, err
 		}
+		previous = entry.path
 	}
 	return result.Bytes(), nil
 
@@ -240,7 +498,7 @@ func (i *Index) WriteUpdates() error {
 		return err
 	}
 
-	result, err := i.data()
+	result, err := i.data(time.Now())
 	if err != nil {
 		return err
 	}
@@ -267,5 +525,6 @@ func New(indexPath string) *Index {
 		order:     NewSortedSet(),
 		changed:   false,
 		parents:   map[string]*Set{},
+		version:   2,
 	}
 }
@@ -4,8 +4,8 @@ import (
 	"bytes"
 	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"os"
-	"syscall"
 )
 
 type IndexFileInfo struct {
@@ -21,11 +21,22 @@ type IndexFileInfo struct {
 	Size      int32
 }
 
+const (
+	extendedFlag     = 0x4000
+	stageMask        = 0x3000
+	stageShift       = 12
+	nameMask         = 0x0fff
+	skipWorktreeFlag = 0x4000
+	intentToAddFlag  = 0x2000
+	entryHeaderSize  = 62
+)
+
 type IndexEntry struct {
-	fileInfo IndexFileInfo
-	oid      string
-	flags    int16
-	path     string
+	fileInfo      IndexFileInfo
+	oid           string
+	flags         uint16
+	extendedFlags uint16
+	path          string
 }
 
 func (e IndexEntry) Path() string {
@@ -40,7 +51,33 @@ func (e IndexEntry) Mode() int32 {
 	return e.fileInfo.Mode
 }
 
-func (e IndexEntry) Data() ([]byte, error) {
+// Stage is 0 for a merged entry, or 1, 2 or 3 for the base, our and their
+// versions of a path with a merge conflict.
+func (e IndexEntry) Stage() int {
+	return int(e.flags&stageMask) >> stageShift
+}
+
+// SkipWorktree reports whether the entry is excluded from the workspace, as
+// in a sparse checkout.
+func (e IndexEntry) SkipWorktree() bool {
+	return e.extendedFlags&skipWorktreeFlag != 0
+}
+
+// IntentToAdd reports whether the path was recorded with "add -N", with no
+// content staged yet.
+func (e IndexEntry) IntentToAdd() bool {
+	return e.extendedFlags&intentToAddFlag != 0
+}
+
+func (e *IndexEntry) setExtendedFlag(flag uint16, set bool) {
+	if set {
+		e.extendedFlags |= flag
+	} else {
+		e.extendedFlags &^= flag
+	}
+}
+
+func (e IndexEntry) header() ([]byte, error) {
 	buf := new(bytes.Buffer)
 	if err := binary.Write(buf, binary.BigEndian, e.fileInfo); err != nil {
 		return nil, err
@@ -55,9 +92,29 @@ func (e IndexEntry) Data() ([]byte, error) {
 		return nil, err
 	}
 
-	if err := binary.Write(buf, binary.BigEndian, e.flags); err != nil {
+	flags := e.flags &^ extendedFlag
+	if e.extendedFlags != 0 {
+		flags |= extendedFlag
+	}
+	if err := binary.Write(buf, binary.BigEndian, flags); err != nil {
 		return nil, err
 	}
+	if e.extendedFlags != 0 {
+		if err := binary.Write(buf, binary.BigEndian, e.extendedFlags); err != nil {
+			return nil, err
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Data encodes the entry for index versions 2 and 3.
+func (e IndexEntry) Data() ([]byte, error) {
+	header, err := e.header()
+	if err != nil {
+		return nil, err
+	}
+	buf := bytes.NewBuffer(header)
 
 	if _, err := buf.Write(append([]byte(e.path), 0)); err != nil {
 		return nil, err
@@ -72,37 +129,160 @@ func (e IndexEntry) Data() ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-func NewIndexEntry(path, oid string, stat os.FileInfo) (result IndexEntry, err error) {
-	info := stat.Sys().(*syscall.Stat_t)
-	var flags int16
-	var mode int32
-	if len([]byte(path)) >= 0xfff {
-		flags = 0xfff
-	} else {
-		flags = int16(len([]byte(path)))
+// CompressedData encodes the entry for index version 4, where each path is
+// stored as the number of bytes to drop from the end of the previous entry's
+// path followed by the suffix to append. Entries are not padded.
+func (e IndexEntry) CompressedData(previous string) ([]byte, error) {
+	header, err := e.header()
+	if err != nil {
+		return nil, err
+	}
+
+	common := 0
+	for common < len(previous) && common < len(e.path) && previous[common] == e.path[common] {
+		common++
+	}
+
+	result := append(header, encodeOffset(len(previous)-common)...)
+	result = append(result, e.path[common:]...)
+	return append(result, 0), nil
+}
+
+// encodeOffset writes a number in the variable length encoding git uses for
+// version 4 path prefixes, where each continuation adds one before shifting.
+func encodeOffset(value int) []byte {
+	buf := []byte{byte(value & 0x7f)}
+	for value >>= 7; value != 0; value >>= 7 {
+		value--
+		buf = append([]byte{byte(0x80 | (value & 0x7f))}, buf...)
+	}
+	return buf
+}
+
+func decodeOffset(data []byte) (int, int, error) {
+	value := 0
+	for i, c := range data {
+		if i > 0 {
+			value++
+		}
+		value = value<<7 | int(c&0x7f)
+		if c&0x80 == 0 {
+			return value, i + 1, nil
+		}
+	}
+	return 0, 0, errors.New("Index entry path is truncated")
+}
+
+// parseIndexEntry decodes the entry at the start of data, returning it along
+// with the number of bytes it occupied.
+func parseIndexEntry(data []byte, version int, previous string) (IndexEntry, int, error) {
+	if len(data) < entryHeaderSize {
+		return IndexEntry{}, 0, errors.New("Index entry is truncated")
+	}
+
+	entry := IndexEntry{}
+	if err := binary.Read(bytes.NewBuffer(data[:40]), binary.BigEndian, &entry.fileInfo); err != nil {
+		return IndexEntry{}, 0, err
 	}
+	entry.oid = hex.EncodeToString(data[40:60])
+	entry.flags = binary.BigEndian.Uint16(data[60:62])
 
+	offset := entryHeaderSize
+	if entry.flags&extendedFlag != 0 {
+		if version < 3 || len(data) < offset+2 {
+			return IndexEntry{}, 0, errors.New("Invalid extended flags in index entry")
+		}
+		entry.extendedFlags = binary.BigEndian.Uint16(data[offset : offset+2])
+		offset += 2
+	}
+
+	if version == 4 {
+		strip, size, err := decodeOffset(data[offset:])
+		if err != nil {
+			return IndexEntry{}, 0, err
+		}
+		if strip > len(previous) {
+			return IndexEntry{}, 0, errors.New("Invalid path prefix in index entry")
+		}
+		offset += size
+		end := bytes.IndexByte(data[offset:], 0)
+		if end == -1 {
+			return IndexEntry{}, 0, errors.New("Index entry path is truncated")
+		}
+		entry.path = previous[:len(previous)-strip] + string(data[offset:offset+end])
+		return entry, offset + end + 1, nil
+	}
+
+	end := bytes.IndexByte(data[offset:], 0)
+	if end == -1 {
+		return IndexEntry{}, 0, errors.New("Index entry path is truncated")
+	}
+	entry.path = string(data[offset : offset+end])
+	size := (offset + end + 8) &^ 7
+	if size > len(data) {
+		return IndexEntry{}, 0, errors.New("Index entry is truncated")
+	}
+	return entry, size, nil
+}
+
+func pathFlags(path string) uint16 {
+	if len([]byte(path)) >= nameMask {
+		return nameMask
+	}
+	return uint16(len([]byte(path)))
+}
+
+func modeForStat(stat os.FileInfo) int32 {
 	if stat.Mode()&0111 == 0 {
-		mode = 0100644
-	} else {
-		mode = 0100755
+		return 0100644
+	}
+	return 0100755
+}
+
+// StatMatch reports whether the size and mode recorded for the entry agree
+// with the file's stat data. Entries restored from a tree have no size.
+func (e IndexEntry) StatMatch(stat os.FileInfo) bool {
+	sizeMatches := e.fileInfo.Size == 0 || e.fileInfo.Size == int32(stat.Size())
+	return sizeMatches && e.fileInfo.Mode == modeForStat(stat)
+}
+
+// emptyBlobOID is the ID of the blob with no content, the only one a file with
+// no size can hold.
+const emptyBlobOID = "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391"
+
+// smudged reports whether the entry has no size recorded although its content
+// is not empty, so that its stat data cannot be trusted.
+func (e IndexEntry) smudged() bool {
+	return e.fileInfo.Size == 0 && e.oid != emptyBlobOID
+}
+
+// modifiedSince reports whether the entry's file was modified no earlier than
+// the given time, in seconds and nanoseconds.
+func (e IndexEntry) modifiedSince(mtime, mtimeNsec int32) bool {
+	if e.fileInfo.Mtime != mtime {
+		return e.fileInfo.Mtime > mtime
 	}
+	return e.fileInfo.MtimeNsec >= mtimeNsec
+}
+
+// TimesMatch reports whether the file's ctime and mtime are the ones recorded
+// when the entry was staged.
+func (e IndexEntry) TimesMatch(stat os.FileInfo) bool {
+	info := statInfo(stat)
+	return e.fileInfo.Ctime == info.Ctime &&
+		e.fileInfo.CtimeNsec == info.CtimeNsec &&
+		e.fileInfo.Mtime == info.Mtime &&
+		e.fileInfo.MtimeNsec == info.MtimeNsec
+}
+
+func NewIndexEntry(path, oid string, stat os.FileInfo) (result IndexEntry, err error) {
+	info := statInfo(stat)
+	info.Mode = modeForStat(stat)
 
 	return IndexEntry{
-		fileInfo: IndexFileInfo{
-			Mtime:     int32(info.Mtimespec.Sec),
-			MtimeNsec: int32(info.Mtimespec.Nsec),
-			Ctime:     int32(info.Ctimespec.Sec),
-			CtimeNsec: int32(info.Ctimespec.Nsec),
-			Dev:       info.Dev,
-			Ino:       uint32(info.Ino),
-			Mode:      mode,
-			Uid:       info.Uid,
-			Gid:       info.Gid,
-			Size:      int32(info.Size),
-		},
-		oid:   oid,
-		flags: flags,
-		path:  path,
+		fileInfo: info,
+		oid:      oid,
+		flags:    pathFlags(path),
+		path:     path,
 	}, nil
 }
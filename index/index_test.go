@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/tpbowden/jit/index"
 )
@@ -106,3 +107,304 @@ func TestRecursivelyReplacingADirectoryWithAFile(t *testing.T) {
 	expected := []string{"alice.txt", "nested"}
 	compareFileList(t, i, expected)
 }
+
+func TestRacilyCleanEntriesAreRehashed(t *testing.T) {
+	if err := setup(); err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(tempFile, future, future); err != nil {
+		t.Fatal(err)
+	}
+	stat, err := os.Stat(tempFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	i := index.New(indexFile)
+	if err := i.LoadForUpdate(); err != nil {
+		t.Fatal(err)
+	}
+	i.Add("test.go", sha(), stat)
+	if err := i.WriteUpdates(); err != nil {
+		t.Fatal(err)
+	}
+
+	i = index.New(indexFile)
+	if err := i.Load(); err != nil {
+		t.Fatal(err)
+	}
+	entry, _ := i.Entry("test.go")
+	if !i.IsRacilyClean(entry) {
+		t.Fatal("Expected an entry modified after the index to be racily clean")
+	}
+
+	hashed := 0
+	modified, err := i.EntryModified(entry, stat, func() (string, error) {
+		hashed++
+		return sha(), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if modified || hashed != 1 {
+		t.Errorf("Expected the entry to be hashed once and found unchanged, got modified=%t hashed=%d", modified, hashed)
+	}
+}
+
+func TestEntriesWithMatchingStatAreNotRehashed(t *testing.T) {
+	if err := setup(); err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	past := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(tempFile, past, past); err != nil {
+		t.Fatal(err)
+	}
+	stat, err := os.Stat(tempFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	i := index.New(indexFile)
+	if err := i.LoadForUpdate(); err != nil {
+		t.Fatal(err)
+	}
+	i.Add("test.go", sha(), stat)
+	if err := i.WriteUpdates(); err != nil {
+		t.Fatal(err)
+	}
+
+	i = index.New(indexFile)
+	if err := i.Load(); err != nil {
+		t.Fatal(err)
+	}
+	entry, _ := i.Entry("test.go")
+	modified, err := i.EntryModified(entry, stat, func() (string, error) {
+		t.Error("Expected stat data to be trusted")
+		return "", nil
+	})
+	if err != nil || modified {
+		t.Errorf("Expected the entry to be unchanged, got modified=%t err=%v", modified, err)
+	}
+}
+
+func TestRacilyCleanEntriesAreSmudgedWhenRewritten(t *testing.T) {
+	if err := setup(); err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	// The file and the index are written within the same second, and
+	// filesystems with coarse timestamps record nothing finer.
+	tick := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(tempFile, tick, tick); err != nil {
+		t.Fatal(err)
+	}
+	stat, err := os.Stat(tempFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := index.New(indexFile)
+	if err := i.LoadForUpdate(); err != nil {
+		t.Fatal(err)
+	}
+	i.Add("test.go", sha(), stat)
+	if err := i.WriteUpdates(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(indexFile, tick, tick); err != nil {
+		t.Fatal(err)
+	}
+
+	// Adding an unrelated file gives the index a newer timestamp.
+	otherFile := filepath.Join(tempDir, "other.go")
+	if err := ioutil.WriteFile(otherFile, []byte("other"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	otherStat, err := os.Stat(otherFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i = index.New(indexFile)
+	if err := i.LoadForUpdate(); err != nil {
+		t.Fatal(err)
+	}
+	i.Add("other.go", sha(), otherStat)
+	if err := i.WriteUpdates(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first file changes within the same tick as it was staged, keeping
+	// its size, so its stat data is just as it was.
+	if err := ioutil.WriteFile(tempFile, []byte("more data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	i = index.New(indexFile)
+	if err := i.Load(); err != nil {
+		t.Fatal(err)
+	}
+	entry, _ := i.Entry("test.go")
+	hashed := 0
+	modified, err := i.EntryModified(entry, stat, func() (string, error) {
+		hashed++
+		return "0000000000000000000000000000000000000000", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !modified || hashed != 1 {
+		t.Errorf("Expected the entry to be hashed and found modified, got modified=%t hashed=%d", modified, hashed)
+	}
+}
+
+func writeIndex(t *testing.T, i *index.Index) []byte {
+	if err := i.WriteUpdates(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(indexFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestReadingAndWritingVersionFour(t *testing.T) {
+	if err := setup(); err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	i := index.New(indexFile)
+	if err := i.LoadForUpdate(); err != nil {
+		t.Fatal(err)
+	}
+	i.Add("lib/deep/one.go", sha(), stat)
+	i.Add("lib/deep/two.go", sha(), stat)
+	i.Add("lib/three.go", sha(), stat)
+	if err := i.SetVersion(4); err != nil {
+		t.Fatal(err)
+	}
+	data := writeIndex(t, i)
+	if data[7] != 4 {
+		t.Fatalf("Expected version 4 to be written, got %d", data[7])
+	}
+
+	i = index.New(indexFile)
+	if err := i.Load(); err != nil {
+		t.Fatal(err)
+	}
+	compareFileList(t, i, []string{"lib/deep/one.go", "lib/deep/two.go", "lib/three.go"})
+}
+
+func TestExtendedFlagsUpgradeToVersionThree(t *testing.T) {
+	if err := setup(); err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	i := index.New(indexFile)
+	if err := i.LoadForUpdate(); err != nil {
+		t.Fatal(err)
+	}
+	i.Add("alice.txt", sha(), stat)
+	i.Add("bob.txt", sha(), stat)
+	i.SetSkipWorktree("bob.txt", true)
+	data := writeIndex(t, i)
+	if data[7] != 3 {
+		t.Fatalf("Expected version 3 to be written, got %d", data[7])
+	}
+
+	i = index.New(indexFile)
+	if err := i.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if entry, _ := i.Entry("bob.txt"); !entry.SkipWorktree() {
+		t.Error("Expected bob.txt to keep its skip-worktree flag")
+	}
+	if entry, _ := i.Entry("alice.txt"); entry.SkipWorktree() {
+		t.Error("Expected alice.txt not to be skip-worktree")
+	}
+}
+
+func withExtension(t *testing.T, signature string) {
+	i := index.New(indexFile)
+	if err := i.LoadForUpdate(); err != nil {
+		t.Fatal(err)
+	}
+	i.Add("alice.txt", sha(), stat)
+	data := writeIndex(t, i)
+
+	data = append(data[:len(data)-20], signature...)
+	data = append(data, 0, 0, 0, 3, 'a', 'b', 'c')
+	checksum := sha1.Sum(data)
+	if err := ioutil.WriteFile(indexFile, append(data, checksum[:]...), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOptionalExtensionsAreSkipped(t *testing.T) {
+	if err := setup(); err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	withExtension(t, "TREE")
+	i := index.New(indexFile)
+	if err := i.Load(); err != nil {
+		t.Fatal(err)
+	}
+	compareFileList(t, i, []string{"alice.txt"})
+}
+
+func TestRequiredExtensionsAreRejected(t *testing.T) {
+	if err := setup(); err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	withExtension(t, "link")
+	if err := index.New(indexFile).Load(); err == nil {
+		t.Fatal("Expected an unknown required extension to be rejected")
+	}
+}
+
+func TestConflictStagesRoundTrip(t *testing.T) {
+	if err := setup(); err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	i := index.New(indexFile)
+	if err := i.LoadForUpdate(); err != nil {
+		t.Fatal(err)
+	}
+	i.Add("alice.txt", sha(), stat)
+	i.Add("bob.txt", sha(), stat)
+	i.AddConflict("alice.txt", [3]string{sha(), sha(), ""}, [3]int32{0100644, 0100755, 0})
+	writeIndex(t, i)
+
+	i = index.New(indexFile)
+	if err := i.Load(); err != nil {
+		t.Fatal(err)
+	}
+	compareFileList(t, i, []string{"alice.txt", "alice.txt", "bob.txt"})
+	if _, exists := i.Entry("alice.txt"); exists {
+		t.Error("Expected alice.txt to have no merged entry")
+	}
+	if entry, exists := i.ConflictEntry("alice.txt", 2); !exists || entry.Stage() != 2 || entry.Mode() != 0100755 {
+		t.Errorf("Expected our version of alice.txt at stage 2, got %v", entry)
+	}
+	if paths := i.ConflictPaths(); len(paths) != 1 || paths[0] != "alice.txt" {
+		t.Errorf("Unexpected conflicts %v", paths)
+	}
+
+	i.Add("alice.txt", sha(), stat)
+	if i.Conflicted() {
+		t.Error("Expected adding alice.txt to resolve its conflict")
+	}
+}
@@ -0,0 +1,21 @@
+package index
+
+import (
+	"os"
+	"syscall"
+)
+
+func statInfo(stat os.FileInfo) IndexFileInfo {
+	info := stat.Sys().(*syscall.Stat_t)
+	return IndexFileInfo{
+		Mtime:     int32(info.Mtim.Sec),
+		MtimeNsec: int32(info.Mtim.Nsec),
+		Ctime:     int32(info.Ctim.Sec),
+		CtimeNsec: int32(info.Ctim.Nsec),
+		Dev:       int32(info.Dev),
+		Ino:       uint32(info.Ino),
+		Uid:       info.Uid,
+		Gid:       info.Gid,
+		Size:      int32(info.Size),
+	}
+}
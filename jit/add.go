@@ -0,0 +1,67 @@
+package jit
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/tpbowden/jit/database"
+)
+
+// Add stores the contents of the files in the working tree matching a
+// pathspec, and stages them in the index. Patterns are relative to the top
+// of the working tree, and absolute paths inside it are accepted too. Every
+// pattern must match at least one file. Files outside a sparse checkout are
+// ignored.
+func (r *Repository) Add(ctx context.Context, paths ...string) error {
+	if err := r.repo.Index.LoadForUpdate(); err != nil {
+		return err
+	}
+	if err := r.add(ctx, paths); err != nil {
+		r.repo.Index.ReleaseLock()
+		return err
+	}
+	return r.repo.Index.WriteUpdates()
+}
+
+func (r *Repository) add(ctx context.Context, args []string) error {
+	spec, err := r.pathspec(args)
+	if err != nil {
+		return err
+	}
+	files, err := r.repo.Workspace.ListFiles()
+	if err != nil {
+		return err
+	}
+	paths, slashed := []string{}, []string{}
+	for _, path := range files {
+		slashed = append(slashed, filepath.ToSlash(path))
+		if spec.Match(filepath.ToSlash(path)) {
+			paths = append(paths, path)
+		}
+	}
+	if err := spec.Check(slashed); err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		data, err := r.repo.Workspace.ReadBlob(path)
+		if err != nil {
+			return err
+		}
+		stat, err := r.repo.Workspace.StatFile(path)
+		if err != nil {
+			return err
+		}
+		blob := database.NewBlob(data)
+		if err := r.repo.Database.Store(blob); err != nil {
+			return err
+		}
+		if err := r.repo.Index.Add(path, database.ObjectID(blob), stat); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,492 @@
+package jit
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+// The refs a bisection marks commits with, in git's layout: a single bad
+// commit, and one ref per good or skipped commit named after its ID.
+const (
+	bisectBad    = "refs/bisect/bad"
+	bisectPrefix = "refs/bisect/"
+)
+
+type BisectOptions struct {
+	// Bad is a commit known to have the regression, and Good commits known
+	// not to. Either may be left empty and marked later.
+	Bad  string
+	Good []string
+}
+
+// BisectResult describes where a bisection stands after each step. While a
+// bad or good commit is still missing, Bad and Good show which are known.
+type BisectResult struct {
+	Bad  string
+	Good int
+	// Current is the commit checked out to be tested next. Remaining and
+	// Steps estimate how many commits are left to test after it, and how
+	// many tests that will take.
+	Current   *CommitInfo
+	Remaining int
+	Steps     int
+	// Culprit is the first bad commit, once found.
+	Culprit *CommitInfo
+	// Suspects lists the commits the first bad commit could be when only
+	// skipped commits are left to test.
+	Suspects []CommitInfo
+}
+
+// Finished reports whether the bisection has narrowed the range as far as
+// it can.
+func (b BisectResult) Finished() bool {
+	return b.Culprit != nil || len(b.Suspects) > 0
+}
+
+// BisectTest tests the commit checked out at each step of BisectRun,
+// returning 0 if it is good, 125 if it cannot be tested, and any other code
+// below 128 if it is bad.
+type BisectTest func(ctx context.Context, step *BisectResult) (int, error)
+
+func (r *Repository) bisectPath(name string) string {
+	return r.gitPath("BISECT_" + name)
+}
+
+func (r *Repository) readBisectFile(name string) (string, error) {
+	data, err := ioutil.ReadFile(r.bisectPath(name))
+	if os.IsNotExist(err) {
+		return "", &NoBisect{}
+	}
+	return strings.TrimSuffix(string(data), "\n"), err
+}
+
+func (r *Repository) appendBisectLog(line string) error {
+	file, err := os.OpenFile(r.bisectPath("LOG"), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.WriteString(line + "\n"); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// BisectStart begins a binary search for the commit that introduced a
+// regression, recording where HEAD was so BisectReset can return to it. Once
+// a bad and a good commit are known, the commit halfway between them is
+// checked out. Starting again while bisecting discards the marks made so far.
+func (r *Repository) BisectStart(ctx context.Context, options BisectOptions) (*BisectResult, error) {
+	marks := [][2]string{}
+	if options.Bad != "" {
+		marks = append(marks, [2]string{"bad", options.Bad})
+	}
+	for _, good := range options.Good {
+		marks = append(marks, [2]string{"good", good})
+	}
+	oids := []string{}
+	for _, mark := range marks {
+		oid, err := r.repo.ResolveRevision(mark[1])
+		if err != nil {
+			return nil, err
+		}
+		oids = append(oids, oid)
+	}
+
+	if err := r.startBisect(); err != nil {
+		return nil, err
+	}
+	for i, mark := range marks {
+		if err := r.markBisect(mark[0], oids[i]); err != nil {
+			return nil, err
+		}
+	}
+	return r.bisectNext(ctx)
+}
+
+// startBisect clears any previous marks and records where HEAD is, unless
+// already bisecting, along with the start of a new log.
+func (r *Repository) startBisect() error {
+	start, err := r.readBisectFile("START")
+	if _, ok := err.(*NoBisect); ok {
+		ref, err := r.repo.Refs.CurrentRef()
+		if err != nil {
+			return err
+		}
+		if start = strings.TrimPrefix(ref, "refs/heads/"); ref == "HEAD" {
+			if start, err = r.repo.Refs.ReadHead(); err != nil {
+				return err
+			}
+		}
+	} else if err != nil {
+		return err
+	}
+	if err := r.clearBisect(); err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(r.bisectPath("START"), []byte(start+"\n"), 0644); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(r.bisectPath("TERMS"), []byte("bad\ngood\n"), 0644); err != nil {
+		return err
+	}
+	return r.appendBisectLog("git bisect start")
+}
+
+// BisectMark marks commits as good, bad or skipped, HEAD if none are given,
+// and checks out the next commit to test.
+func (r *Repository) BisectMark(ctx context.Context, term string, revisions ...string) (*BisectResult, error) {
+	if _, err := r.readBisectFile("START"); err != nil {
+		return nil, err
+	}
+	if len(revisions) == 0 {
+		revisions = []string{"HEAD"}
+	}
+	for _, revision := range revisions {
+		oid, err := r.repo.ResolveRevision(revision)
+		if err != nil {
+			return nil, err
+		}
+		if err := r.markBisect(term, oid); err != nil {
+			return nil, err
+		}
+	}
+	return r.bisectNext(ctx)
+}
+
+func (r *Repository) markBisect(term, oid string) error {
+	ref := bisectBad
+	switch term {
+	case "bad":
+	case "good", "skip":
+		ref = bisectPrefix + term + "-" + oid
+	default:
+		return &InvalidBisectTerm{Term: term}
+	}
+	commit, err := r.loadCommit(oid)
+	if err != nil {
+		return err
+	}
+	if err := r.repo.Refs.UpdateRef(ref, oid); err != nil {
+		return err
+	}
+	info := commitInfo(oid, commit)
+	return r.appendBisectLog("# " + term + ": [" + oid + "] " + info.Summary() + "\ngit bisect " + term + " " + oid)
+}
+
+// bisectMarks returns the bad commit and the good and skipped ones.
+func (r *Repository) bisectMarks() (string, map[string][]string, error) {
+	bad, err := r.repo.Refs.ReadRef(bisectBad)
+	if err != nil {
+		return "", nil, err
+	}
+	refs, err := r.repo.Refs.ListRefs(bisectPrefix)
+	if err != nil {
+		return "", nil, err
+	}
+	marks := map[string][]string{}
+	for _, ref := range refs {
+		name := strings.TrimPrefix(ref, bisectPrefix)
+		if dash := strings.Index(name, "-"); dash != -1 {
+			marks[name[:dash]] = append(marks[name[:dash]], name[dash+1:])
+		}
+	}
+	return bad, marks, nil
+}
+
+// bisectCandidates returns the commits reachable from bad but not from any
+// good commit, in the order they are reached from bad, along with each one's
+// parents among them.
+func (r *Repository) bisectCandidates(ctx context.Context, bad string, good []string) ([]string, map[string][]string, error) {
+	excluded := map[string]bool{}
+	queue := append([]string{}, good...)
+	for len(queue) > 0 {
+		oid := queue[0]
+		queue = queue[1:]
+		if excluded[oid] {
+			continue
+		}
+		excluded[oid] = true
+		commit, err := r.loadCommit(oid)
+		if err != nil {
+			return nil, nil, err
+		}
+		queue = append(queue, commit.Parents...)
+	}
+
+	candidates, parents := []string{}, map[string][]string{}
+	queue = []string{bad}
+	for len(queue) > 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+		oid := queue[0]
+		queue = queue[1:]
+		if _, seen := parents[oid]; seen || excluded[oid] {
+			continue
+		}
+		commit, err := r.loadCommit(oid)
+		if err != nil {
+			return nil, nil, err
+		}
+		candidates, parents[oid] = append(candidates, oid), []string{}
+		for _, parent := range commit.Parents {
+			if !excluded[parent] {
+				parents[oid] = append(parents[oid], parent)
+				queue = append(queue, parent)
+			}
+		}
+	}
+	return candidates, parents, nil
+}
+
+// bisectSteps estimates how many more tests a range of candidates will
+// take, the same way git does.
+func bisectSteps(all int) int {
+	if all < 3 {
+		return 0
+	}
+	n := 0
+	for 1<<uint(n+1) <= all {
+		n++
+	}
+	if e := 1 << uint(n); e < 3*(all-e) {
+		return n
+	}
+	return n - 1
+}
+
+// bisectNext narrows the range with the marks made so far. It checks out the
+// candidate that splits the rest most evenly, weighing each by how many
+// candidates it can reach and preferring the lighter of two that split them
+// equally well, or records the result once no untested
+// candidates are left.
+func (r *Repository) bisectNext(ctx context.Context) (*BisectResult, error) {
+	bad, marks, err := r.bisectMarks()
+	if err != nil {
+		return nil, err
+	}
+	result := &BisectResult{Bad: bad, Good: len(marks["good"])}
+	if bad == "" || len(marks["good"]) == 0 {
+		return result, nil
+	}
+	candidates, parents, err := r.bisectCandidates(ctx, bad, marks["good"])
+	if err != nil {
+		return nil, err
+	}
+	skipped := map[string]bool{}
+	for _, oid := range marks["skip"] {
+		skipped[oid] = true
+	}
+
+	all, best, bestScore, bestWeight := len(candidates), "", -1, 0
+	for _, oid := range candidates {
+		if oid == bad || skipped[oid] {
+			continue
+		}
+		reached, queue := map[string]bool{}, []string{oid}
+		for len(queue) > 0 {
+			next := queue[0]
+			queue = queue[1:]
+			if !reached[next] {
+				reached[next] = true
+				queue = append(queue, parents[next]...)
+			}
+		}
+		score := len(reached)
+		if all-score < score {
+			score = all - score
+		}
+		if score > bestScore || score == bestScore && len(reached) < bestWeight {
+			best, bestScore, bestWeight = oid, score, len(reached)
+		}
+	}
+
+	if best == "" {
+		for _, oid := range candidates {
+			commit, err := r.loadCommit(oid)
+			if err != nil {
+				return nil, err
+			}
+			info := commitInfo(oid, commit)
+			if oid == bad && all == 1 {
+				result.Culprit = &info
+				return result, r.appendBisectLog("# first bad commit: [" + oid + "] " + info.Summary())
+			}
+			result.Suspects = append(result.Suspects, info)
+		}
+		sort.SliceStable(result.Suspects, func(i, j int) bool {
+			return result.Suspects[i].OID == bad && result.Suspects[j].OID != bad
+		})
+		return result, r.appendBisectLog("# only skipped commits left to test")
+	}
+
+	if err := r.checkoutBisect(ctx, best); err != nil {
+		return nil, err
+	}
+	commit, err := r.loadCommit(best)
+	if err != nil {
+		return nil, err
+	}
+	info := commitInfo(best, commit)
+	result.Current, result.Remaining, result.Steps = &info, all-bestWeight-1, bisectSteps(all)
+	return result, nil
+}
+
+// checkoutBisect detaches HEAD at the next commit to test.
+func (r *Repository) checkoutBisect(ctx context.Context, oid string) error {
+	head, err := r.repo.Refs.ReadHead()
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(r.bisectPath("EXPECTED_REV"), []byte(oid+"\n"), 0644); err != nil {
+		return err
+	}
+	if head == oid {
+		return nil
+	}
+	ref, err := r.repo.Refs.CurrentRef()
+	if err != nil {
+		return err
+	}
+	from := strings.TrimPrefix(ref, "refs/heads/")
+	if ref == "HEAD" {
+		from = head
+	}
+	return r.fastForward(ctx, head, oid, "checkout: moving from "+from+" to "+oid)
+}
+
+// BisectReset ends a bisection, checking out the branch or commit HEAD was
+// at when it started, or the given revision instead.
+func (r *Repository) BisectReset(ctx context.Context, revision string) (*CheckoutResult, error) {
+	start, err := r.readBisectFile("START")
+	if err != nil {
+		return nil, err
+	}
+	if revision == "" {
+		revision = start
+	}
+	result, err := r.Checkout(ctx, revision)
+	if err != nil {
+		return nil, err
+	}
+	return result, r.clearBisect()
+}
+
+func (r *Repository) clearBisect() error {
+	refs, err := r.repo.Refs.ListRefs(bisectPrefix)
+	if err != nil {
+		return err
+	}
+	for _, ref := range refs {
+		if err := r.repo.Refs.DeleteRef(ref); err != nil {
+			return err
+		}
+	}
+	for _, name := range []string{"EXPECTED_REV", "LOG", "TERMS", "START"} {
+		if err := os.Remove(r.bisectPath(name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// BisectLog returns the log of the current bisection, which BisectReplay
+// can use to repeat it.
+func (r *Repository) BisectLog() (string, error) {
+	log, err := r.readBisectFile("LOG")
+	if err != nil {
+		return "", err
+	}
+	return log + "\n", nil
+}
+
+// BisectReplay starts a bisection again from a log, making the marks it
+// records and then checking out the next commit to test.
+func (r *Repository) BisectReplay(ctx context.Context, log string) (*BisectResult, error) {
+	commands := [][]string{}
+	for _, line := range strings.Split(log, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) < 3 || fields[0] != "git" && fields[0] != "jit" || fields[1] != "bisect" {
+			return nil, &InvalidBisectLog{Line: line}
+		}
+		commands = append(commands, fields[2:])
+	}
+	if len(commands) == 0 || commands[0][0] != "start" {
+		return nil, &InvalidBisectLog{Line: strings.SplitN(log, "\n", 2)[0]}
+	}
+
+	for _, command := range commands {
+		oids := []string{}
+		for _, revision := range command[1:] {
+			oid, err := r.repo.ResolveRevision(revision)
+			if err != nil {
+				return nil, err
+			}
+			oids = append(oids, oid)
+		}
+		if command[0] == "start" {
+			if err := r.startBisect(); err != nil {
+				return nil, err
+			}
+			for i, oid := range oids {
+				term := "good"
+				if i == 0 {
+					term = "bad"
+				}
+				if err := r.markBisect(term, oid); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+		for _, oid := range oids {
+			if err := r.markBisect(command[0], oid); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return r.bisectNext(ctx)
+}
+
+// BisectRun automates a bisection, calling test on each commit checked out
+// and marking it by the code returned until the first bad commit is found.
+// A code of 128 or more stops the run with a BisectRunFailed error.
+func (r *Repository) BisectRun(ctx context.Context, test BisectTest) (*BisectResult, error) {
+	if _, err := r.readBisectFile("START"); err != nil {
+		return nil, err
+	}
+	result, err := r.bisectNext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for result.Current != nil {
+		code, err := test(ctx, result)
+		if err != nil {
+			return nil, err
+		}
+		term := "bad"
+		switch {
+		case code == 0:
+			term = "good"
+		case code == 125:
+			term = "skip"
+		case code < 0 || code >= 128:
+			return nil, &BisectRunFailed{Code: code}
+		}
+		if result, err = r.BisectMark(ctx, term, result.Current.OID); err != nil {
+			return nil, err
+		}
+	}
+	if !result.Finished() {
+		return nil, &NoBisectRange{}
+	}
+	return result, nil
+}
@@ -0,0 +1,106 @@
+package jit_test
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/tpbowden/jit/jit"
+)
+
+// history makes a commit for each of count versions of n.txt, numbered from
+// one, and returns their IDs.
+func history(t *testing.T, repo *jit.Repository, count int) []string {
+	oids := []string{}
+	for i := 1; i <= count; i++ {
+		writeFile(t, repo, "n.txt", strconv.Itoa(i)+"\n")
+		oids = append(oids, commit(t, repo, "c"+strconv.Itoa(i)+"\n").OID)
+	}
+	return oids
+}
+
+func TestBisectRunFindsFirstBadCommit(t *testing.T) {
+	repo, cleanup := setup(t)
+	defer cleanup()
+	ctx := context.Background()
+	oids := history(t, repo, 10)
+
+	result, err := repo.BisectStart(ctx, jit.BisectOptions{Bad: "HEAD", Good: []string{oids[0]}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Current == nil || result.Current.OID != oids[4] || result.Remaining != 4 || result.Steps != 2 {
+		t.Fatalf("Unexpected first step %+v", result)
+	}
+
+	tested := 0
+	result, err = repo.BisectRun(ctx, func(ctx context.Context, step *jit.BisectResult) (int, error) {
+		tested++
+		if n, _ := strconv.Atoi(strings.TrimSpace(readFile(t, repo, "n.txt"))); n >= 7 {
+			return 1, nil
+		}
+		return 0, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Culprit == nil || result.Culprit.OID != oids[6] || tested != 3 {
+		t.Fatalf("Unexpected result %+v after %d tests", result, tested)
+	}
+
+	log, err := repo.BisectLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(log, "# first bad commit: ["+oids[6]+"] c7\n") {
+		t.Fatalf("Unexpected log %q", log)
+	}
+	if _, err := repo.BisectReset(ctx, ""); err != nil {
+		t.Fatal(err)
+	}
+	if headOID(t, repo, "HEAD") != oids[9] || readFile(t, repo, "n.txt") != "10\n" {
+		t.Fatal("Expected master to be checked out again")
+	}
+	if _, err := repo.BisectLog(); err == nil {
+		t.Fatal("Expected an error")
+	} else if _, ok := err.(*jit.NoBisect); !ok {
+		t.Fatalf("Expected NoBisect, got %v", err)
+	}
+}
+
+func TestBisectReplayAndSkip(t *testing.T) {
+	repo, cleanup := setup(t)
+	defer cleanup()
+	ctx := context.Background()
+	oids := history(t, repo, 4)
+
+	result, err := repo.BisectStart(ctx, jit.BisectOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Current != nil || result.Bad != "" || result.Good != 0 {
+		t.Fatalf("Expected to wait for marks, got %+v", result)
+	}
+	if result, err = repo.BisectReplay(ctx, "git bisect start\ngit bisect bad "+oids[3]+"\n# comment\ngit bisect good "+oids[0]+"\n"); err != nil {
+		t.Fatal(err)
+	}
+	if result.Current == nil || result.Current.OID != oids[1] {
+		t.Fatalf("Unexpected step %+v", result)
+	}
+
+	if result, err = repo.BisectMark(ctx, "skip"); err != nil {
+		t.Fatal(err)
+	}
+	if result, err = repo.BisectMark(ctx, "skip"); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Suspects) != 3 || result.Suspects[0].OID != oids[3] || !result.Finished() {
+		t.Fatalf("Expected only skipped commits to be left, got %+v", result)
+	}
+	if _, err := repo.BisectReplay(ctx, "git bisect start\nrm -rf /\n"); err == nil {
+		t.Fatal("Expected an error")
+	} else if _, ok := err.(*jit.InvalidBisectLog); !ok {
+		t.Fatalf("Expected InvalidBisectLog, got %v", err)
+	}
+}
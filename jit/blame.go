@@ -0,0 +1,305 @@
+package jit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/tpbowden/jit/database"
+	"github.com/tpbowden/jit/diff"
+)
+
+// NotCommittedOID is the commit blame attributes lines to that have been
+// changed in the working tree since HEAD.
+const NotCommittedOID = "0000000000000000000000000000000000000000"
+
+type BlameOptions struct {
+	// Path is the file to blame, relative to the top of the working tree.
+	Path string
+	// Revision is the commit whose version of the file is blamed. If empty,
+	// the working tree's version is blamed.
+	Revision string
+	// Start and End limit the result to a range of lines, counting from 1
+	// and inclusive. Zero leaves that end of the range open.
+	Start int
+	End   int
+	// Renames follows the file back through commits that renamed it.
+	Renames bool
+}
+
+// BlameLine attributes one line of a file to the commit that introduced it.
+// Number is the line's position in the file blamed, and OriginalNumber its
+// position in Path as of that commit. Previous and PreviousPath name the
+// parent's version of the file the commit changed, if it had one.
+type BlameLine struct {
+	Number         int
+	OriginalNumber int
+	OID            string
+	Path           string
+	Previous       string
+	PreviousPath   string
+	Text           string
+}
+
+// Blame is the result of blaming a file. Commits describes each commit the
+// lines are attributed to, other than NotCommittedOID.
+type Blame struct {
+	Path    string
+	Lines   []BlameLine
+	Commits map[string]CommitInfo
+}
+
+// blameSuspect is a version of a file that some lines of the result may have
+// come from. lines holds the indexes of those lines in the result, and
+// numbers their positions in this version.
+type blameSuspect struct {
+	oid     string
+	path    string
+	when    time.Time
+	data    []byte
+	lines   []int
+	numbers []int
+}
+
+// blamer walks the history of a file, passing each line back to a parent
+// whenever the parent has the same line, until it reaches the commit that
+// introduced it.
+type blamer struct {
+	repo    *Repository
+	renames bool
+	finder  *renameFinder
+	result  *Blame
+	pending map[string]*blameSuspect
+	trees   map[string]map[string]database.TreeEntry
+}
+
+// Blame attributes each line of a file to the commit that last changed it,
+// diffing each version against its parents to follow lines as they move.
+// Blaming the working tree attributes lines changed since HEAD to
+// NotCommittedOID.
+func (r *Repository) Blame(ctx context.Context, options BlameOptions) (*Blame, error) {
+	path, err := r.relativePath(options.Path)
+	if err != nil {
+		return nil, err
+	}
+	path = filepath.ToSlash(path)
+	b := &blamer{
+		repo:    r,
+		renames: options.Renames,
+		finder:  r.newRenameFinder(RenameOptions{}),
+		result:  &Blame{Path: path, Commits: map[string]CommitInfo{}},
+		pending: map[string]*blameSuspect{},
+		trees:   map[string]map[string]database.TreeEntry{},
+	}
+
+	revision, suspect := options.Revision, &blameSuspect{oid: NotCommittedOID, path: path}
+	if revision == "" {
+		revision = "HEAD"
+	}
+	oid, err := r.repo.ResolveRevision(revision)
+	if err != nil {
+		return nil, err
+	}
+	entry, exists, err := b.lookup(oid, path)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, &NoSuchPath{Path: path, Revision: revision}
+	}
+	if options.Revision == "" {
+		suspect.data, err = r.repo.Workspace.ReadBlob(path)
+		if os.IsNotExist(err) {
+			return nil, &NoSuchPath{Path: path, Revision: revision}
+		}
+		suspect.when = time.Now()
+	} else {
+		suspect.oid = oid
+		_, suspect.data, err = r.repo.Database.ReadObject(entry.OID())
+		if err == nil {
+			var commit database.Commit
+			commit, err = r.loadCommit(oid)
+			suspect.when = commit.CommitTime
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	lines := diff.Lines(string(suspect.data))
+	start, end := options.Start, options.End
+	if start == 0 {
+		start = 1
+	}
+	if end == 0 {
+		end = len(lines)
+	}
+	if options.Start < 0 || options.Start > len(lines) || options.End > len(lines) || options.End != 0 && options.End < start {
+		return nil, &InvalidLineRange{Path: path, Lines: len(lines)}
+	}
+	for number := start; number <= end; number++ {
+		suspect.lines = append(suspect.lines, len(b.result.Lines))
+		suspect.numbers = append(suspect.numbers, number)
+		b.result.Lines = append(b.result.Lines, BlameLine{Number: number, Text: lines[number-1]})
+	}
+	b.pending[suspect.oid+"\x00"+path] = suspect
+
+	for len(b.pending) > 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := b.next(oid); err != nil {
+			return nil, err
+		}
+	}
+	return b.result, nil
+}
+
+// next takes the most recent suspect, breaking ties by ID so the walk is
+// repeatable, and passes its lines on to its parents, keeping those none of
+// them have. head is the commit the working tree is compared against.
+func (b *blamer) next(head string) error {
+	var suspect *blameSuspect
+	for _, candidate := range b.pending {
+		if suspect == nil || candidate.when.After(suspect.when) ||
+			candidate.when.Equal(suspect.when) && candidate.oid+candidate.path < suspect.oid+suspect.path {
+			suspect = candidate
+		}
+	}
+	delete(b.pending, suspect.oid+"\x00"+suspect.path)
+
+	parents := []string{head}
+	if suspect.oid != NotCommittedOID {
+		commit, err := b.repo.loadCommit(suspect.oid)
+		if err != nil {
+			return err
+		}
+		b.result.Commits[suspect.oid] = commitInfo(suspect.oid, commit)
+		parents = commit.Parents
+	}
+
+	previous, previousPath := "", ""
+	for _, parent := range parents {
+		if len(suspect.lines) == 0 {
+			break
+		}
+		path, err := b.passToParent(suspect, parent)
+		if err != nil {
+			return err
+		}
+		if previous == "" && path != "" {
+			previous, previousPath = parent, path
+		}
+	}
+	for i, index := range suspect.lines {
+		line := &b.result.Lines[index]
+		line.OID, line.Path, line.OriginalNumber = suspect.oid, suspect.path, suspect.numbers[i]
+		line.Previous, line.PreviousPath = previous, previousPath
+	}
+	return nil
+}
+
+// passToParent hands the suspect's lines that are unchanged in a parent to
+// that parent's version of the file, leaving the rest with the suspect. It
+// returns the file's path in the parent, or an empty string if the parent
+// does not have it.
+func (b *blamer) passToParent(suspect *blameSuspect, parent string) (string, error) {
+	path := suspect.path
+	entry, exists, err := b.lookup(parent, path)
+	if err != nil {
+		return "", err
+	}
+	if !exists && b.renames && suspect.oid != NotCommittedOID {
+		if path, err = b.findRename(suspect, parent); err != nil || path == "" {
+			return "", err
+		}
+		entry, exists, err = b.lookup(parent, path)
+		if err != nil {
+			return "", err
+		}
+	}
+	if !exists {
+		return "", nil
+	}
+
+	target := b.pending[parent+"\x00"+path]
+	if target == nil {
+		commit, err := b.repo.loadCommit(parent)
+		if err != nil {
+			return "", err
+		}
+		target = &blameSuspect{oid: parent, path: path, when: commit.CommitTime}
+		if _, target.data, err = b.repo.repo.Database.ReadObject(entry.OID()); err != nil {
+			return "", err
+		}
+		b.pending[parent+"\x00"+path] = target
+	}
+
+	origins := map[int]int{}
+	for _, edit := range diff.Myers(diff.Lines(string(target.data)), diff.Lines(string(suspect.data))) {
+		if edit.Kind == diff.Equal {
+			origins[edit.NewLine] = edit.OldLine
+		}
+	}
+	lines, numbers := []int{}, []int{}
+	for i, number := range suspect.numbers {
+		if origin, found := origins[number]; found {
+			target.lines = append(target.lines, suspect.lines[i])
+			target.numbers = append(target.numbers, origin)
+		} else {
+			lines, numbers = append(lines, suspect.lines[i]), append(numbers, number)
+		}
+	}
+	suspect.lines, suspect.numbers = lines, numbers
+	if len(target.lines) == 0 {
+		delete(b.pending, parent+"\x00"+path)
+	}
+	return path, nil
+}
+
+// findRename returns the file a commit deleted from a parent that the
+// suspect's version was renamed from, if any.
+func (b *blamer) findRename(suspect *blameSuspect, parent string) (string, error) {
+	current, err := b.tree(suspect.oid)
+	if err != nil {
+		return "", err
+	}
+	previous, err := b.tree(parent)
+	if err != nil {
+		return "", err
+	}
+
+	before, after := entryPaths(previous), map[string]string{suspect.path: current[suspect.path].OID()}
+	for path, entry := range previous {
+		if _, kept := current[path]; kept {
+			after[path] = entry.OID()
+		}
+	}
+	renames, err := b.finder.find(before, after)
+	if err != nil || len(renames) == 0 {
+		return "", err
+	}
+	return renames[0].From, nil
+}
+
+func (b *blamer) tree(oid string) (map[string]database.TreeEntry, error) {
+	if entries, cached := b.trees[oid]; cached {
+		return entries, nil
+	}
+	entries, err := b.repo.treeEntries(oid)
+	if err != nil {
+		return nil, err
+	}
+	b.trees[oid] = entries
+	return entries, nil
+}
+
+func (b *blamer) lookup(oid, path string) (database.TreeEntry, bool, error) {
+	entries, err := b.tree(oid)
+	if err != nil {
+		return database.TreeEntry{}, false, err
+	}
+	entry, exists := entries[path]
+	return entry, exists, nil
+}
@@ -0,0 +1,70 @@
+package jit_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/tpbowden/jit/jit"
+)
+
+func TestBlameAttributesLinesToCommits(t *testing.T) {
+	repo, cleanup := setup(t)
+	defer cleanup()
+
+	writeFile(t, repo, "a.txt", "one\ntwo\nthree\n")
+	first := commit(t, repo, "first\n")
+	writeFile(t, repo, "a.txt", "zero\none\nTWO\nthree\n")
+	second := commit(t, repo, "second\n")
+	writeFile(t, repo, "a.txt", "zero\none\nTWO\nthree\nfour\n")
+
+	blame, err := repo.Blame(context.Background(), jit.BlameOptions{Path: "a.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []struct {
+		oid      string
+		original int
+	}{
+		{second.OID, 1}, {first.OID, 1}, {second.OID, 3}, {first.OID, 3}, {jit.NotCommittedOID, 5},
+	}
+	if len(blame.Lines) != len(expected) {
+		t.Fatalf("Unexpected lines %+v", blame.Lines)
+	}
+	for i, line := range blame.Lines {
+		if line.OID != expected[i].oid || line.OriginalNumber != expected[i].original || line.Number != i+1 {
+			t.Fatalf("Unexpected line %d: %+v", i+1, line)
+		}
+	}
+	if blame.Commits[first.OID].Summary() != "first" || len(blame.Commits) != 2 {
+		t.Fatalf("Unexpected commits %v", blame.Commits)
+	}
+}
+
+func TestBlameLimitsLinesToRange(t *testing.T) {
+	repo, cleanup := setup(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	writeFile(t, repo, "a.txt", "one\ntwo\nthree\n")
+	first := commit(t, repo, "first\n")
+	writeFile(t, repo, "a.txt", "one\ntwo\nthree\nfour\n")
+	commit(t, repo, "second\n")
+
+	blame, err := repo.Blame(ctx, jit.BlameOptions{Path: "a.txt", Revision: "HEAD~1", Start: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blame.Lines) != 2 || blame.Lines[0].Number != 2 || blame.Lines[1].OID != first.OID || blame.Lines[1].Previous != "" {
+		t.Fatalf("Unexpected lines %+v", blame.Lines)
+	}
+	if _, err := repo.Blame(ctx, jit.BlameOptions{Path: "a.txt", Start: 2, End: 5}); err == nil {
+		t.Fatal("Expected an error")
+	} else if _, ok := err.(*jit.InvalidLineRange); !ok {
+		t.Fatalf("Expected InvalidLineRange, got %v", err)
+	}
+	if _, err := repo.Blame(ctx, jit.BlameOptions{Path: "b.txt"}); err == nil {
+		t.Fatal("Expected an error")
+	} else if _, ok := err.(*jit.NoSuchPath); !ok {
+		t.Fatalf("Expected NoSuchPath, got %v", err)
+	}
+}
@@ -0,0 +1,264 @@
+package jit
+
+import (
+	"context"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tpbowden/jit/core"
+	"github.com/tpbowden/jit/database"
+)
+
+// CheckoutResult describes the HEAD a checkout moved from and to. Branch
+// fields are empty when HEAD is or was detached.
+type CheckoutResult struct {
+	Branch         string
+	OID            string
+	PreviousBranch string
+	PreviousOID    string
+}
+
+// Detached reports whether the checkout left HEAD detached.
+func (c CheckoutResult) Detached() bool {
+	return c.Branch == ""
+}
+
+// Checkout switches to a branch, or detaches HEAD at any other revision, and
+// updates the index and working tree to match. It refuses to overwrite local
+// changes or untracked files, returning a CheckoutConflict.
+func (r *Repository) Checkout(ctx context.Context, target string) (*CheckoutResult, error) {
+	result := &CheckoutResult{}
+	ref, err := r.repo.Refs.CurrentRef()
+	if err != nil {
+		return nil, err
+	}
+	if ref != "HEAD" {
+		result.PreviousBranch = strings.TrimPrefix(ref, "refs/heads/")
+	}
+	if result.PreviousOID, err = r.repo.Refs.ReadHead(); err != nil {
+		return nil, err
+	}
+
+	// Only a valid branch name is looked up as one, so that the target is
+	// never read as a path of its own.
+	branch := ""
+	if core.ValidRefName("refs/heads/" + target) {
+		if branch, err = r.repo.Refs.ReadRef("refs/heads/" + target); err != nil {
+			return nil, err
+		}
+	}
+	if branch != "" {
+		result.Branch, result.OID = target, branch
+	} else if result.OID, err = r.repo.ResolveRevision(target); err != nil {
+		return nil, err
+	}
+
+	if err := r.repo.Index.LoadForUpdate(); err != nil {
+		return nil, err
+	}
+	if err := r.migrate(ctx, result.PreviousOID, result.OID); err != nil {
+		r.repo.Index.ReleaseLock()
+		return nil, err
+	}
+	if err := r.repo.Index.WriteUpdates(); err != nil {
+		return nil, err
+	}
+
+	if result.Branch != "" {
+		err = r.repo.Refs.SetHead("refs/heads/" + result.Branch)
+	} else {
+		err = r.repo.Refs.UpdateRef("HEAD", result.OID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	from := result.PreviousBranch
+	if from == "" {
+		from = result.PreviousOID
+	}
+	identity := r.identity.at(time.Now())
+	err = r.repo.Refs.AppendReflog("HEAD", core.ReflogEntry{
+		OldOID:   result.PreviousOID,
+		NewOID:   result.OID,
+		Identity: identity.author().Format(identity.When),
+		Message:  "checkout: moving from " + from + " to " + target,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// migrate moves the index and working tree from one commit's tree to
+// another's, only touching files that differ between the two.
+func (r *Repository) migrate(ctx context.Context, from, to string) error {
+	current, err := r.treeEntries(from)
+	if err != nil {
+		return err
+	}
+	target, err := r.treeEntries(to)
+	if err != nil {
+		return err
+	}
+
+	changed := []string{}
+	for path, entry := range current {
+		if other, exists := target[path]; !exists || other.OID() != entry.OID() || other.Mode() != entry.Mode() {
+			changed = append(changed, path)
+		}
+	}
+	for path := range target {
+		if _, exists := current[path]; !exists {
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(changed)
+
+	conflicts := []string{}
+	for _, path := range changed {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		conflict, err := r.checkoutConflict(path, current, target)
+		if err != nil {
+			return err
+		}
+		if conflict {
+			conflicts = append(conflicts, path)
+		}
+	}
+	if len(conflicts) > 0 {
+		return checkoutConflict(conflicts)
+	}
+
+	for _, path := range changed {
+		entry, exists := target[path]
+		if !exists {
+			if err := r.repo.Workspace.RemoveFile(path); err != nil {
+				return err
+			}
+			r.repo.Index.Remove(path)
+			continue
+		}
+		if skipped, err := r.skipSparse(path, entry); err != nil {
+			return err
+		} else if skipped {
+			continue
+		}
+
+		_, data, err := r.repo.Database.ReadObject(entry.OID())
+		if err != nil {
+			return err
+		}
+		if err := r.repo.Workspace.WriteBlob(path, data, entry.Mode()); err != nil {
+			return err
+		}
+		stat, err := r.repo.Workspace.StatFile(path)
+		if err != nil {
+			return err
+		}
+		if err := r.repo.Index.Add(path, entry.OID(), stat); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkoutConflict reports whether changing path would lose work: staged or
+// unstaged changes to a tracked file, or an untracked file in the way.
+func (r *Repository) checkoutConflict(path string, current, target map[string]database.TreeEntry) (bool, error) {
+	entry, tracked := r.repo.Index.Entry(path)
+	if !tracked {
+		if _, exists := current[path]; exists {
+			return true, nil
+		}
+		_, err := r.repo.Workspace.StatFile(path)
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return true, err
+	}
+
+	if targetEntry, exists := target[path]; exists && targetEntry.OID() == entry.OID() && targetEntry.Mode() == entry.Mode() {
+		return false, nil
+	}
+	if currentEntry, exists := current[path]; !exists || currentEntry.OID() != entry.OID() || currentEntry.Mode() != entry.Mode() {
+		return true, nil
+	}
+	if _, err := r.repo.Workspace.StatFile(path); os.IsNotExist(err) {
+		return false, nil
+	}
+	return r.workspaceModified(entry)
+}
+
+// resetHard makes the index and working tree match a commit, discarding any
+// changes to tracked files, without moving HEAD.
+func (r *Repository) resetHard(ctx context.Context, oid string) error {
+	if err := r.repo.Index.LoadForUpdate(); err != nil {
+		return err
+	}
+	if err := r.resetTo(ctx, oid); err != nil {
+		r.repo.Index.ReleaseLock()
+		return err
+	}
+	return r.repo.Index.WriteUpdates()
+}
+
+func (r *Repository) resetTo(ctx context.Context, oid string) error {
+	target, err := r.treeEntries(oid)
+	if err != nil {
+		return err
+	}
+	for _, entry := range r.repo.Index.Entries() {
+		if _, exists := target[entry.Path()]; !exists {
+			if err := r.repo.Workspace.RemoveFile(entry.Path()); err != nil {
+				return err
+			}
+			r.repo.Index.Remove(entry.Path())
+		}
+	}
+
+	for path, entry := range target {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if skipped, err := r.skipSparse(path, entry); err != nil {
+			return err
+		} else if skipped {
+			continue
+		}
+		if current, tracked := r.repo.Index.Entry(path); tracked && current.OID() == entry.OID() && current.Mode() == entry.Mode() {
+			_, err := r.repo.Workspace.StatFile(path)
+			if err == nil {
+				modified, err := r.workspaceModified(current)
+				if err != nil {
+					return err
+				}
+				if !modified {
+					continue
+				}
+			} else if !os.IsNotExist(err) {
+				return err
+			}
+		}
+
+		_, data, err := r.repo.Database.ReadObject(entry.OID())
+		if err != nil {
+			return err
+		}
+		if err := r.repo.Workspace.WriteBlob(path, data, entry.Mode()); err != nil {
+			return err
+		}
+		stat, err := r.repo.Workspace.StatFile(path)
+		if err != nil {
+			return err
+		}
+		if err := r.repo.Index.Add(path, entry.OID(), stat); err != nil {
+			return err
+		}
+	}
+	return nil
+}
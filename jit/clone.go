@@ -0,0 +1,145 @@
+package jit
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/tpbowden/jit/core"
+	"github.com/tpbowden/jit/remote"
+)
+
+type CloneOptions struct {
+	// Remote names the remote the source is recorded as, "origin" if empty.
+	Remote string
+	// Identity is recorded in the new repository's reflogs.
+	Identity Signature
+	// UploadPack is the program the smart protocol runs on the other side.
+	UploadPack string
+	// Progress receives progress messages from the remote.
+	Progress io.Writer
+	// SSHCommand is the command ssh URLs are reached through, ssh if empty.
+	SSHCommand string
+}
+
+// Clone copies the repository at url into a new directory, tracking its
+// branches as remote-tracking refs and checking out the branch its HEAD
+// points to. A relative url is taken from the current directory.
+func Clone(ctx context.Context, url, dir string, options CloneOptions) (*Repository, error) {
+	name := options.Remote
+	if name == "" {
+		name = "origin"
+	}
+	if !strings.Contains(url, ":") {
+		absolute, err := filepath.Abs(url)
+		if err != nil {
+			return nil, err
+		}
+		url = absolute
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err == nil && len(entries) > 0 {
+		return nil, destinationExists(dir)
+	} else if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	created := err != nil
+
+	conn, err := remote.Connect(ctx, url, remote.ConnectOptions{
+		UploadPack: options.UploadPack,
+		Progress:   options.Progress,
+		SSHCommand: options.SSHCommand,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	repo, err := Init(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	repo.SetIdentity(options.Identity)
+	if err := repo.clone(ctx, conn, name, url); err != nil {
+		if created {
+			os.RemoveAll(dir)
+		} else {
+			os.RemoveAll(filepath.Join(dir, ".git"))
+		}
+		return nil, err
+	}
+	return repo, nil
+}
+
+func (r *Repository) clone(ctx context.Context, conn remote.Connection, name, url string) error {
+	if err := r.AddRemote(name, url); err != nil {
+		return err
+	}
+	found, err := remote.Get(r.repo.Config, name)
+	if err != nil {
+		return err
+	}
+	if _, err := remote.Fetch(ctx, r.repo, conn, found, nil); err != nil {
+		return err
+	}
+
+	ad, err := conn.Refs(ctx)
+	if err != nil {
+		return err
+	}
+	branch := strings.TrimPrefix(ad.Head, "refs/heads/")
+	if branch == "" || branch == ad.Head {
+		return nil
+	}
+	if err := r.repo.Refs.SetHead(ad.Head); err != nil {
+		return err
+	}
+	oid, err := r.repo.Refs.ReadRef("refs/remotes/" + name + "/" + branch)
+	if err != nil || oid == "" {
+		return err
+	}
+
+	// Fetch LFS content before checking out, so files are written in full
+	// rather than as pointers, when the source is on disk.
+	if adapter, err := lfsAdapterFor(url); err == nil {
+		if _, err := r.lfsFetch(ctx, adapter, []string{oid}); err != nil {
+			return err
+		}
+	}
+
+	if err := r.repo.Index.LoadForUpdate(); err != nil {
+		return err
+	}
+	if err := r.migrate(ctx, "", oid); err != nil {
+		r.repo.Index.ReleaseLock()
+		return err
+	}
+	if err := r.repo.Index.WriteUpdates(); err != nil {
+		return err
+	}
+	if err := r.repo.Refs.UpdateRef(ad.Head, oid); err != nil {
+		return err
+	}
+
+	cfg := r.repo.Config
+	if err := cfg.OpenForUpdate(); err != nil {
+		return err
+	}
+	cfg.Set("branch."+branch+".remote", name)
+	cfg.Set("branch."+branch+".merge", ad.Head)
+	if err := cfg.Save(); err != nil {
+		return err
+	}
+
+	identity := r.identity.at(time.Now())
+	return r.repo.Refs.RecordHeadUpdate(core.ReflogEntry{
+		NewOID:   oid,
+		Identity: identity.author().Format(identity.When),
+		Message:  "clone: from " + url,
+	})
+}
@@ -0,0 +1,189 @@
+package jit
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/tpbowden/jit/core"
+	"github.com/tpbowden/jit/database"
+)
+
+type CommitOptions struct {
+	// Message is the commit message. When amending it defaults to the
+	// message of the commit being replaced.
+	Message string
+	// EditMessage, if set, is called with the proposed message once the
+	// commit is known not to be empty, and returns the message to use.
+	EditMessage func(ctx context.Context, message string) (string, error)
+	// Author defaults to the original author when amending, and to the
+	// repository's identity otherwise.
+	Author *Signature
+	// Committer defaults to the repository's identity.
+	Committer *Signature
+	// Amend replaces the current commit rather than adding a child of it.
+	Amend bool
+	// AllowEmpty permits a commit whose tree matches its parent's.
+	AllowEmpty bool
+}
+
+// CommitResult describes a newly created commit.
+type CommitResult struct {
+	OID     string
+	Parent  string
+	Message string
+}
+
+// Root reports whether the commit has no parent.
+func (c CommitResult) Root() bool {
+	return c.Parent == ""
+}
+
+// Summary returns the first line of the commit message.
+func (c CommitResult) Summary() string {
+	return strings.Split(c.Message, "\n")[0]
+}
+
+// Commit records the staged contents of the index as a new commit and moves
+// the current branch, or a detached HEAD, on to it. Committing concludes a
+// cherry-pick or revert stopped by a conflict.
+func (r *Repository) Commit(ctx context.Context, options CommitOptions) (*CommitResult, error) {
+	return r.commit(ctx, options, "commit")
+}
+
+// commit is Commit with the action recorded in the reflog, such as
+// "cherry-pick".
+func (r *Repository) commit(ctx context.Context, options CommitOptions, action string) (*CommitResult, error) {
+	if err := r.repo.Index.Load(); err != nil {
+		return nil, err
+	}
+	if paths := r.repo.Index.ConflictPaths(); len(paths) > 0 {
+		return nil, unmergedPaths(paths)
+	}
+	entries := r.indexTreeEntries()
+	tree, err := r.writeTree(entries)
+	if err != nil {
+		return nil, err
+	}
+
+	head, err := r.repo.Refs.ReadHead()
+	if err != nil {
+		return nil, err
+	}
+	author := r.identity
+	parent, message := head, options.Message
+	parents := []string{}
+	if options.Amend {
+		if head == "" {
+			return nil, &NothingToAmend{}
+		}
+		object, err := r.repo.Database.Load(head)
+		if err != nil {
+			return nil, err
+		}
+		previous := object.(database.Commit)
+		author = signature(previous.Author, previous.Timestamp)
+		parent, parents = previous.ParentID, previous.Parents
+		if message == "" {
+			message = previous.Message
+		}
+	}
+	if options.Author != nil {
+		author = *options.Author
+	}
+	committer := r.identity
+	if options.Committer != nil {
+		committer = *options.Committer
+	}
+
+	if !options.AllowEmpty {
+		unchanged := len(entries) == 0
+		if parent != "" {
+			object, err := r.repo.Database.Load(parent)
+			if err != nil {
+				return nil, err
+			}
+			unchanged = object.(database.Commit).TreeID == tree
+		}
+		if unchanged {
+			return nil, &NothingToCommit{Amend: options.Amend}
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if options.EditMessage != nil {
+		if message, err = options.EditMessage(ctx, message); err != nil {
+			return nil, err
+		}
+	}
+	if strings.TrimSpace(message) == "" {
+		return nil, &EmptyMessage{}
+	}
+
+	now := time.Now()
+	author, committer = author.at(now), committer.at(now)
+	if !options.Amend && parent != "" {
+		parents = []string{parent}
+	}
+	commit := database.NewMergeCommit(author.author(), tree, parents, message, author.When)
+	commit.Committer, commit.CommitTime = committer.author(), committer.When
+	if err := r.repo.Database.Store(commit); err != nil {
+		return nil, err
+	}
+	oid := database.ObjectID(commit)
+	if err := r.repo.Refs.UpdateHead(oid); err != nil {
+		return nil, err
+	}
+
+	logMessage := action + ": "
+	switch {
+	case options.Amend:
+		logMessage = action + " (amend): "
+	case parent == "":
+		logMessage = action + " (initial): "
+	}
+	err = r.repo.Refs.RecordHeadUpdate(core.ReflogEntry{
+		OldOID:   head,
+		NewOID:   oid,
+		Identity: commit.Committer.Format(commit.CommitTime),
+		Message:  logMessage + strings.Split(message, "\n")[0],
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := r.clearPickHead(); err != nil {
+		return nil, err
+	}
+
+	return &CommitResult{OID: oid, Parent: parent, Message: message}, nil
+}
+
+// indexTreeEntries lists the index entries a commit records, leaving out
+// files only intended to be added.
+func (r *Repository) indexTreeEntries() []database.DatabaseEntry {
+	entries := []database.DatabaseEntry{}
+	for _, entry := range r.repo.Index.Entries() {
+		if !entry.IntentToAdd() && entry.Stage() == 0 {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// writeTree stores the trees needed to record entries, returning the ID of
+// the root tree.
+func (r *Repository) writeTree(entries []database.DatabaseEntry) (string, error) {
+	tree := database.BuildTree(entries)
+	var storeErr error
+	tree.Traverse(func(t database.Tree) {
+		if storeErr == nil {
+			storeErr = r.repo.Database.Store(t)
+		}
+	})
+	if storeErr != nil {
+		return "", storeErr
+	}
+	return database.ObjectID(tree), nil
+}
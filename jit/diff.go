@@ -0,0 +1,401 @@
+package jit
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"sort"
+
+	"github.com/tpbowden/jit/attributes"
+	"github.com/tpbowden/jit/database"
+	"github.com/tpbowden/jit/diff"
+	"github.com/tpbowden/jit/pathspec"
+)
+
+// DefaultContext is the number of unchanged lines shown around each change.
+const DefaultContext = 3
+
+type DiffOptions struct {
+	// Cached compares HEAD with the index instead of the index with the
+	// working tree.
+	Cached bool
+	// Context is the number of unchanged lines kept around each change.
+	// Zero means DefaultContext; use a negative value for none.
+	Context int
+	// Paths is a pathspec limiting the comparison to the files it matches.
+	Paths []string
+	// Renames pairs deleted and added files into renames, and added files
+	// into copies if asked to. Nil turns detection off.
+	Renames *RenameOptions
+}
+
+// FileDiff describes the change to a single file. The OID and mode of a
+// side the file is missing from are empty. A renamed or copied file has the
+// path it came from in OldPath, and the percentage of lines the two share in
+// Similarity.
+type FileDiff struct {
+	Path       string
+	OldPath    string
+	Similarity int
+	Status     ChangeType
+	OldOID     string
+	NewOID     string
+	OldMode    int32
+	NewMode    int32
+	// Binary is set instead of Hunks being computed when either side
+	// looks like binary data.
+	Binary bool
+	Hunks  []diff.Hunk
+}
+
+// diffSide is one version of a file being compared.
+type diffSide struct {
+	oid  string
+	mode int32
+	data []byte
+}
+
+func isBinary(data []byte) bool {
+	if len(data) > 8000 {
+		data = data[:8000]
+	}
+	return bytes.IndexByte(data, 0) != -1
+}
+
+func workspaceMode(stat os.FileInfo) int32 {
+	if stat.Mode()&0111 != 0 {
+		return 0100755
+	}
+	return 0100644
+}
+
+func (r *Repository) blobSide(oid string, mode int32) (*diffSide, error) {
+	_, data, err := r.repo.Database.ReadObject(oid)
+	if err != nil {
+		return nil, err
+	}
+	return &diffSide{oid: oid, mode: mode, data: data}, nil
+}
+
+// Diff compares either the index with the working tree, or HEAD with the
+// index, and returns the changed files sorted by path.
+func (r *Repository) Diff(ctx context.Context, options DiffOptions) ([]FileDiff, error) {
+	spec, err := r.pathspec(options.Paths)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.repo.Index.Load(); err != nil {
+		return nil, err
+	}
+
+	pairs := map[string][2]*diffSide{}
+	if options.Cached {
+		err = r.indexChanges(spec, pairs)
+	} else {
+		err = r.workspaceChanges(ctx, spec, pairs)
+	}
+	if err != nil {
+		return nil, err
+	}
+	old := map[string]diffSide{}
+	if options.Renames != nil {
+		if old, err = r.diffBase(options.Cached, spec); err != nil {
+			return nil, err
+		}
+	}
+	return r.fileDiffs(ctx, old, pairs, options)
+}
+
+// DiffCommits compares the trees of two commits, returning the changed files
+// sorted by path. An empty from compares to before the first commit.
+func (r *Repository) DiffCommits(ctx context.Context, from, to string, options DiffOptions) ([]FileDiff, error) {
+	spec, err := r.pathspec(options.Paths)
+	if err != nil {
+		return nil, err
+	}
+	trees := [2]map[string]database.TreeEntry{}
+	for i, revision := range []string{from, to} {
+		oid := ""
+		if revision != "" {
+			if oid, err = r.repo.ResolveRevision(revision); err != nil {
+				return nil, err
+			}
+		}
+		entries, err := r.treeEntries(oid)
+		if err != nil {
+			return nil, err
+		}
+		trees[i] = entries
+	}
+
+	old, pairs := map[string]diffSide{}, map[string][2]*diffSide{}
+	for path, entry := range trees[0] {
+		if spec.Match(path) {
+			old[path] = diffSide{oid: entry.OID(), mode: entry.Mode()}
+		}
+	}
+	for _, paths := range trees {
+		for path := range paths {
+			before, after := lookupEntry(trees[0], path), lookupEntry(trees[1], path)
+			if sameEntry(before, after) || !spec.Match(path) {
+				continue
+			}
+			pair := [2]*diffSide{}
+			for i, entry := range []*database.TreeEntry{before, after} {
+				if entry == nil {
+					continue
+				}
+				side, err := r.blobSide(entry.OID(), entry.Mode())
+				if err != nil {
+					return nil, err
+				}
+				pair[i] = side
+			}
+			pairs[path] = pair
+		}
+	}
+	return r.fileDiffs(ctx, old, pairs, options)
+}
+
+// diffBase returns the files on the old side of a comparison between HEAD
+// and the index, or the index and the working tree, without their contents.
+func (r *Repository) diffBase(cached bool, spec *pathspec.Pathspec) (map[string]diffSide, error) {
+	old := map[string]diffSide{}
+	if !cached {
+		for _, entry := range r.repo.Index.Entries() {
+			if entry.Stage() == 0 && !entry.IntentToAdd() && spec.Match(entry.Path()) {
+				old[entry.Path()] = diffSide{oid: entry.OID(), mode: entry.Mode()}
+			}
+		}
+		return old, nil
+	}
+	head, err := r.repo.Refs.ReadHead()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := r.treeEntries(head)
+	if err != nil {
+		return nil, err
+	}
+	for path, entry := range entries {
+		if spec.Match(path) {
+			old[path] = diffSide{oid: entry.OID(), mode: entry.Mode()}
+		}
+	}
+	return old, nil
+}
+
+// pairRenames finds the renames and copies among the changed files in pairs,
+// given every file on the old side in old, and merges each into a single
+// pair under its new path.
+func (r *Repository) pairRenames(old map[string]diffSide, pairs map[string][2]*diffSide, options RenameOptions) (map[string]Rename, error) {
+	finder := r.newRenameFinder(options)
+	before, after := map[string]string{}, map[string]string{}
+	for path, side := range old {
+		before[path], after[path] = side.oid, side.oid
+	}
+	for path, pair := range pairs {
+		if pair[1] == nil {
+			delete(after, path)
+			continue
+		}
+		after[path] = pair[1].oid
+		finder.blobs[pair[1].oid] = pair[1].data
+	}
+	renames, err := finder.find(before, after)
+	if err != nil {
+		return nil, err
+	}
+
+	paired := map[string]Rename{}
+	for _, rename := range renames {
+		source := pairs[rename.From][0]
+		if source == nil {
+			side := old[rename.From]
+			if source, err = r.blobSide(side.oid, side.mode); err != nil {
+				return nil, err
+			}
+		}
+		pairs[rename.To] = [2]*diffSide{source, pairs[rename.To][1]}
+		paired[rename.To] = rename
+	}
+	for _, rename := range renames {
+		if !rename.Copy {
+			delete(pairs, rename.From)
+		}
+	}
+	return paired, nil
+}
+
+func (r *Repository) fileDiffs(ctx context.Context, old map[string]diffSide, pairs map[string][2]*diffSide, options DiffOptions) ([]FileDiff, error) {
+	renames := map[string]Rename{}
+	if options.Renames != nil {
+		var err error
+		if renames, err = r.pairRenames(old, pairs, *options.Renames); err != nil {
+			return nil, err
+		}
+	}
+
+	contextLines := options.Context
+	if contextLines == 0 {
+		contextLines = DefaultContext
+	} else if contextLines < 0 {
+		contextLines = 0
+	}
+
+	paths := []string{}
+	for path := range pairs {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	diffs := []FileDiff{}
+	for _, path := range paths {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		attrs, err := r.repo.Filter.Check(path)
+		if err != nil {
+			return nil, err
+		}
+		file := fileDiff(path, pairs[path][0], pairs[path][1], contextLines, attrs["diff"])
+		if rename, found := renames[path]; found {
+			file.OldPath, file.Similarity, file.Status = rename.From, rename.Similarity, Renamed
+			if rename.Copy {
+				file.Status = Copied
+			}
+		}
+		diffs = append(diffs, file)
+	}
+	return diffs, nil
+}
+
+func (r *Repository) indexChanges(spec *pathspec.Pathspec, pairs map[string][2]*diffSide) error {
+	head, err := r.repo.Refs.ReadHead()
+	if err != nil {
+		return err
+	}
+	headEntries, err := r.treeEntries(head)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range r.repo.Index.Entries() {
+		if !spec.Match(entry.Path()) || entry.IntentToAdd() || entry.Stage() != 0 {
+			continue
+		}
+		var before *diffSide
+		if headEntry, exists := headEntries[entry.Path()]; exists {
+			if headEntry.OID() == entry.OID() && headEntry.Mode() == entry.Mode() {
+				continue
+			}
+			if before, err = r.blobSide(headEntry.OID(), headEntry.Mode()); err != nil {
+				return err
+			}
+		}
+		after, err := r.blobSide(entry.OID(), entry.Mode())
+		if err != nil {
+			return err
+		}
+		pairs[entry.Path()] = [2]*diffSide{before, after}
+	}
+
+	for path, entry := range headEntries {
+		if _, tracked := r.repo.Index.Entry(path); tracked || r.repo.Index.IsConflicted(path) || !spec.Match(path) {
+			continue
+		}
+		before, err := r.blobSide(entry.OID(), entry.Mode())
+		if err != nil {
+			return err
+		}
+		pairs[path] = [2]*diffSide{before, nil}
+	}
+	return nil
+}
+
+func (r *Repository) workspaceChanges(ctx context.Context, spec *pathspec.Pathspec, pairs map[string][2]*diffSide) error {
+	for _, entry := range r.repo.Index.Entries() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !spec.Match(entry.Path()) || entry.Stage() != 0 || entry.SkipWorktree() {
+			continue
+		}
+
+		var before *diffSide
+		if !entry.IntentToAdd() {
+			var err error
+			if before, err = r.blobSide(entry.OID(), entry.Mode()); err != nil {
+				return err
+			}
+		}
+
+		stat, err := r.repo.Workspace.StatFile(entry.Path())
+		if os.IsNotExist(err) {
+			pairs[entry.Path()] = [2]*diffSide{before, nil}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if before != nil {
+			modified, err := r.workspaceModified(entry)
+			if err != nil {
+				return err
+			}
+			if !modified {
+				continue
+			}
+		}
+
+		data, err := r.repo.Workspace.ReadBlob(entry.Path())
+		if err != nil {
+			return err
+		}
+		after := &diffSide{
+			oid:  database.ObjectID(database.NewBlob(data)),
+			mode: workspaceMode(stat),
+			data: data,
+		}
+		if before != nil && before.oid == after.oid && before.mode == after.mode {
+			continue
+		}
+		pairs[entry.Path()] = [2]*diffSide{before, after}
+	}
+	return nil
+}
+
+// fileDiff compares two sides of a file. Binary files are not compared line
+// by line; the file's diff attribute overrides whether it looks binary,
+// treating it as binary when unset and as text when set.
+func fileDiff(path string, before, after *diffSide, contextLines int, diffAttr string) FileDiff {
+	result := FileDiff{Path: path, Status: Modified}
+	var a, b []byte
+	if before != nil {
+		result.OldOID, result.OldMode, a = before.oid, before.mode, before.data
+	} else {
+		result.Status = Added
+	}
+	if after != nil {
+		result.NewOID, result.NewMode, b = after.oid, after.mode, after.data
+	} else {
+		result.Status = Deleted
+	}
+
+	binary := isBinary(a) || isBinary(b)
+	switch diffAttr {
+	case attributes.Unset:
+		binary = true
+	case attributes.Set:
+		binary = false
+	}
+	if binary {
+		result.Binary = result.OldOID != result.NewOID
+		return result
+	}
+	if result.OldOID != result.NewOID {
+		edits := diff.Myers(diff.Lines(string(a)), diff.Lines(string(b)))
+		result.Hunks = diff.Hunks(edits, contextLines)
+	}
+	return result
+}
@@ -0,0 +1,444 @@
+package jit
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tpbowden/jit/attributes"
+	"github.com/tpbowden/jit/core"
+	"github.com/tpbowden/jit/lfs"
+	"github.com/tpbowden/jit/pathspec"
+	"github.com/tpbowden/jit/repository"
+	"github.com/tpbowden/jit/sparse"
+)
+
+// Errors raised by the lower layers that callers may want to handle.
+type (
+	MissingFile     = core.MissingFile
+	NoPermission    = core.NoPermission
+	LockDenied      = core.LockDenied
+	InvalidRevision = repository.InvalidRevision
+
+	InvalidPathspec   = pathspec.InvalidMagic
+	PathspecOutside   = pathspec.OutsideRepository
+	UnmatchedPathspec = pathspec.Unmatched
+
+	FilterFailed = attributes.FilterFailed
+
+	LFSMissingObject = lfs.MissingObject
+	LFSCorruptObject = lfs.CorruptObject
+
+	InvalidSparseDirectory = sparse.InvalidDirectory
+)
+
+type NotRepository struct {
+	path string
+}
+
+func (e *NotRepository) Error() string {
+	return fmt.Sprintf("not a jit repository: %s", e.path)
+}
+
+func notRepository(path string) error {
+	return &NotRepository{path}
+}
+
+// NothingToCommit is returned when a commit would record the same tree as
+// its parent and empty commits were not allowed.
+type NothingToCommit struct {
+	Amend bool
+}
+
+func (e *NothingToCommit) Error() string {
+	if e.Amend {
+		return "amending the most recent commit would make it empty"
+	}
+	return "nothing to commit, working tree clean"
+}
+
+type NothingToAmend struct{}
+
+func (e *NothingToAmend) Error() string {
+	return "You have nothing to amend."
+}
+
+type EmptyMessage struct{}
+
+func (e *EmptyMessage) Error() string {
+	return "Aborting commit due to empty commit message."
+}
+
+// CheckoutConflict lists the files whose local changes a checkout would
+// overwrite.
+type CheckoutConflict struct {
+	Paths []string
+}
+
+func (e *CheckoutConflict) Error() string {
+	return fmt.Sprintf(
+		"Your local changes to the following files would be overwritten by checkout:\n\t%s",
+		strings.Join(e.Paths, "\n\t"),
+	)
+}
+
+func checkoutConflict(paths []string) error {
+	return &CheckoutConflict{paths}
+}
+
+// UnmergedPaths lists the files left conflicted by a merge, which must be
+// resolved before committing.
+type UnmergedPaths struct {
+	Paths []string
+}
+
+func (e *UnmergedPaths) Error() string {
+	return "Committing is not possible because you have unmerged files."
+}
+
+func unmergedPaths(paths []string) error {
+	return &UnmergedPaths{paths}
+}
+
+// LocalChanges lists the files whose uncommitted changes, or untracked
+// files, a merge would overwrite.
+type LocalChanges struct {
+	Paths []string
+}
+
+func (e *LocalChanges) Error() string {
+	return fmt.Sprintf(
+		"Your local changes to the following files would be overwritten by merge:\n\t%s",
+		strings.Join(e.Paths, "\n\t"),
+	)
+}
+
+func localChanges(paths []string) error {
+	return &LocalChanges{paths}
+}
+
+type NoInitialCommit struct{}
+
+func (e *NoInitialCommit) Error() string {
+	return "You do not have the initial commit yet"
+}
+
+type NoLocalChanges struct{}
+
+func (e *NoLocalChanges) Error() string {
+	return "No local changes to save"
+}
+
+// InvalidStash is returned for a stash entry that does not exist.
+type InvalidStash struct {
+	Index int
+	// Count is the number of entries in the stash.
+	Count int
+}
+
+func (e *InvalidStash) Error() string {
+	if e.Count == 0 {
+		return "No stash entries found."
+	}
+	return fmt.Sprintf("stash@{%d} is not a valid reference", e.Index)
+}
+
+// NotStashCommit is returned when a stash entry does not name a commit made
+// by StashPush.
+type NotStashCommit struct {
+	OID string
+}
+
+func (e *NotStashCommit) Error() string {
+	return fmt.Sprintf("'%s' is not a stash-like commit", e.OID)
+}
+
+func notStashCommit(oid string) error {
+	return &NotStashCommit{oid}
+}
+
+// StashIndexConflict is returned when the index saved in a stash cannot be
+// restored over the current one without conflicts.
+type StashIndexConflict struct{}
+
+func (e *StashIndexConflict) Error() string {
+	return "Conflicts in index. Try without --index."
+}
+
+type SequenceInProgress struct{}
+
+func (e *SequenceInProgress) Error() string {
+	return "a cherry-pick or revert is already in progress"
+}
+
+type NoSequence struct{}
+
+func (e *NoSequence) Error() string {
+	return "no cherry-pick or revert in progress"
+}
+
+type MergeWithoutMainline struct {
+	OID string
+}
+
+func (e *MergeWithoutMainline) Error() string {
+	return fmt.Sprintf("commit %s is a merge but no -m option was given.", e.OID)
+}
+
+// InvalidMainline is returned when the mainline parent chosen for a commit
+// does not exist, or the commit is not a merge.
+type InvalidMainline struct {
+	OID      string
+	Mainline int
+}
+
+func (e *InvalidMainline) Error() string {
+	return fmt.Sprintf("commit %s does not have parent %d", e.OID, e.Mainline)
+}
+
+// DirtyIndex is returned when a cherry-pick or revert would commit changes
+// already staged in the index.
+type DirtyIndex struct {
+	Action string
+}
+
+func (e *DirtyIndex) Error() string {
+	if e.Action == "pick" {
+		return "your local changes would be overwritten by cherry-pick."
+	}
+	return "your local changes would be overwritten by revert."
+}
+
+type RebaseInProgress struct{}
+
+func (e *RebaseInProgress) Error() string {
+	return "a rebase is already in progress"
+}
+
+type NoRebase struct{}
+
+func (e *NoRebase) Error() string {
+	return "no rebase in progress"
+}
+
+// UncommittedChanges is returned when a rebase is started with changes to
+// tracked files, which replaying commits would overwrite.
+type UncommittedChanges struct{}
+
+func (e *UncommittedChanges) Error() string {
+	return "cannot rebase: You have uncommitted changes."
+}
+
+// EmptyTodo is returned when every line of an interactive rebase's todo list
+// was removed, which aborts the rebase.
+type EmptyTodo struct{}
+
+func (e *EmptyTodo) Error() string {
+	return "nothing to do"
+}
+
+// InvalidTodo is returned when a line of an edited todo list cannot be run.
+type InvalidTodo struct {
+	Line   string
+	Reason string
+}
+
+func (e *InvalidTodo) Error() string {
+	return fmt.Sprintf("%s: '%s'", e.Reason, e.Line)
+}
+
+type DetachedHead struct{}
+
+func (e *DetachedHead) Error() string {
+	return "You are not currently on a branch."
+}
+
+type DestinationExists struct {
+	path string
+}
+
+func (e *DestinationExists) Error() string {
+	return fmt.Sprintf("destination path '%s' already exists and is not an empty directory.", e.path)
+}
+
+func destinationExists(path string) error {
+	return &DestinationExists{path}
+}
+
+// NoSuchPath is returned when blaming a file that does not exist in the
+// revision blamed.
+type NoSuchPath struct {
+	Path     string
+	Revision string
+}
+
+func (e *NoSuchPath) Error() string {
+	return fmt.Sprintf("no such path '%s' in %s", e.Path, e.Revision)
+}
+
+// InvalidLineRange is returned when a range of lines to blame does not fit
+// within the file.
+type InvalidLineRange struct {
+	Path  string
+	Lines int
+}
+
+func (e *InvalidLineRange) Error() string {
+	return fmt.Sprintf("file %s has only %d lines", e.Path, e.Lines)
+}
+
+// NoBisect is returned when a bisect command other than start is used while
+// not bisecting.
+type NoBisect struct{}
+
+func (e *NoBisect) Error() string {
+	return "We are not bisecting."
+}
+
+// NoBisectRange is returned when running a bisection before both a bad and
+// a good commit are known.
+type NoBisectRange struct{}
+
+func (e *NoBisectRange) Error() string {
+	return "You need to give me at least one bad and one good revision."
+}
+
+type InvalidBisectTerm struct {
+	Term string
+}
+
+func (e *InvalidBisectTerm) Error() string {
+	return fmt.Sprintf("invalid command: '%s' is not a bisect term", e.Term)
+}
+
+// InvalidBisectLog is returned when replaying a log line that is not a
+// bisect command.
+type InvalidBisectLog struct {
+	Line string
+}
+
+func (e *InvalidBisectLog) Error() string {
+	return fmt.Sprintf("cannot replay bisect log line: '%s'", e.Line)
+}
+
+// BisectRunFailed is returned when the command run to test a commit exits
+// with a code that cannot mark it good, bad or skipped.
+type BisectRunFailed struct {
+	Code int
+}
+
+func (e *BisectRunFailed) Error() string {
+	return fmt.Sprintf("bisect run failed: exit code %d is < 0 or >= 128", e.Code)
+}
+
+// InvalidPattern is returned when a grep pattern is not a valid regular
+// expression.
+type InvalidPattern struct {
+	Pattern string
+	Reason  string
+}
+
+func (e *InvalidPattern) Error() string {
+	return fmt.Sprintf("command line, '%s': %s", e.Pattern, e.Reason)
+}
+
+// LFSUnsupported is returned when transferring LFS objects with a remote
+// that is not a repository on disk, the only kind there is an adapter for.
+type LFSUnsupported struct {
+	URL string
+}
+
+func (e *LFSUnsupported) Error() string {
+	return fmt.Sprintf("cannot transfer LFS objects with '%s': only repositories on disk are supported", e.URL)
+}
+
+// NotSparse is returned when listing or adding to the directories of a
+// sparse checkout in a working tree that is not sparse.
+type NotSparse struct{}
+
+func (e *NotSparse) Error() string {
+	return "this worktree is not sparse"
+}
+
+// ResetWithPaths is returned when a soft or hard reset is limited to paths,
+// which only a mixed reset can be.
+type ResetWithPaths struct{}
+
+func (e *ResetWithPaths) Error() string {
+	return "Cannot do soft or hard reset with paths."
+}
+
+// NotRecursive is returned when removing a directory without allowing
+// recursive removal.
+type NotRecursive struct {
+	Pathspec string
+}
+
+func (e *NotRecursive) Error() string {
+	return fmt.Sprintf("not removing '%s' recursively without -r", e.Pathspec)
+}
+
+// RemoveConflict lists the files Remove refused to delete because their
+// content would be lost, with the changes each one has.
+type RemoveConflict struct {
+	Paths    []string
+	Problems []string
+}
+
+func (e *RemoveConflict) Error() string {
+	lines := []string{}
+	for i, path := range e.Paths {
+		lines = append(lines, fmt.Sprintf("'%s' has %s", path, e.Problems[i]))
+	}
+	return strings.Join(lines, "\n")
+}
+
+type PathOutside struct {
+	Path string
+}
+
+func (e *PathOutside) Error() string {
+	return fmt.Sprintf("'%s' is outside repository", e.Path)
+}
+
+type NotDirectory struct {
+	Path string
+}
+
+func (e *NotDirectory) Error() string {
+	return fmt.Sprintf("destination '%s' is not a directory", e.Path)
+}
+
+// InvalidMove is returned when a file cannot be moved, with the reason why.
+type InvalidMove struct {
+	Reason      string
+	Source      string
+	Destination string
+}
+
+func (e *InvalidMove) Error() string {
+	return fmt.Sprintf("%s, source=%s, destination=%s", e.Reason, e.Source, e.Destination)
+}
+
+type InvalidTagName struct {
+	Name string
+}
+
+func (e *InvalidTagName) Error() string {
+	return fmt.Sprintf("'%s' is not a valid tag name.", e.Name)
+}
+
+type TagExists struct {
+	Name string
+}
+
+func (e *TagExists) Error() string {
+	return fmt.Sprintf("tag '%s' already exists", e.Name)
+}
+
+type TagNotFound struct {
+	Name string
+}
+
+func (e *TagNotFound) Error() string {
+	return fmt.Sprintf("tag '%s' not found.", e.Name)
+}
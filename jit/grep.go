@@ -0,0 +1,247 @@
+package jit
+
+import (
+	"context"
+	"os"
+	"regexp"
+	"regexp/syntax"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/tpbowden/jit/diff"
+)
+
+type GrepOptions struct {
+	Pattern string
+	// Extended reads Pattern as an extended regular expression in Go's
+	// syntax. Otherwise it is a basic one, where +, ?, |, braces and
+	// parentheses only have special meaning when escaped.
+	Extended   bool
+	IgnoreCase bool
+	// WordRegexp only matches whole words.
+	WordRegexp bool
+	// FilesWithMatches stops at the first match in each file.
+	FilesWithMatches bool
+	// Cached searches the index instead of the working tree, and Revision
+	// the tree of a commit instead of either.
+	Cached   bool
+	Revision string
+	// Paths is a pathspec limiting the search to the files it matches.
+	Paths []string
+}
+
+// GrepMatch is a line that matched, numbered from 1 and without its line
+// ending.
+type GrepMatch struct {
+	Path string
+	Line int
+	Text string
+}
+
+// grepFile is a file to search. The contents of files in the working tree
+// are read from there; everything else is read from the database.
+type grepFile struct {
+	path string
+	oid  string
+}
+
+var basicSpecials = "+?|(){}"
+
+// basicToExtended translates a basic regular expression into Go's syntax,
+// swapping the meaning of escaped and unescaped specials and turning the
+// \< and \> word anchors into \b.
+func basicToExtended(pattern string) string {
+	var result strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		char := pattern[i]
+		switch {
+		case char == '\\' && i+1 < len(pattern):
+			i++
+			next := pattern[i]
+			switch {
+			case strings.IndexByte(basicSpecials, next) != -1:
+				result.WriteByte(next)
+			case next == '<' || next == '>':
+				result.WriteString(`\b`)
+			default:
+				result.WriteByte('\\')
+				result.WriteByte(next)
+			}
+		case strings.IndexByte(basicSpecials, char) != -1:
+			result.WriteByte('\\')
+			result.WriteByte(char)
+		default:
+			result.WriteByte(char)
+		}
+	}
+	return result.String()
+}
+
+func grepPattern(options GrepOptions) (*regexp.Regexp, error) {
+	pattern := options.Pattern
+	if !options.Extended {
+		pattern = basicToExtended(pattern)
+	}
+	if options.IgnoreCase {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		reason := err.Error()
+		if syntaxErr, ok := err.(*syntax.Error); ok {
+			reason = syntaxErr.Code.String()
+		}
+		return nil, &InvalidPattern{Pattern: options.Pattern, Reason: reason}
+	}
+	return re, nil
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// matchesWord reports whether the pattern matches anywhere in the line with
+// a non-word character, or either end of the line, on both sides. Each
+// position a match starts at is tried in turn, so a match inside a longer
+// word does not hide a later whole-word one.
+func matchesWord(re *regexp.Regexp, line string) bool {
+	for start := 0; start <= len(line); {
+		loc := re.FindStringIndex(line[start:])
+		if loc == nil {
+			return false
+		}
+		from, to := start+loc[0], start+loc[1]
+		before, _ := utf8.DecodeLastRuneInString(line[:from])
+		after, _ := utf8.DecodeRuneInString(line[to:])
+		if (from == 0 || !isWordRune(before)) && (to == len(line) || !isWordRune(after)) {
+			return true
+		}
+		_, size := utf8.DecodeRuneInString(line[from:])
+		if size == 0 {
+			size = 1
+		}
+		start = from + size
+	}
+	return false
+}
+
+// Grep searches the tracked files in the working tree, the index or a
+// commit for lines matching a regular expression. Files are searched in
+// parallel, binary files are skipped, and the matches are returned sorted by
+// path and line.
+func (r *Repository) Grep(ctx context.Context, options GrepOptions) ([]GrepMatch, error) {
+	re, err := grepPattern(options)
+	if err != nil {
+		return nil, err
+	}
+	files, err := r.grepFiles(options)
+	if err != nil {
+		return nil, err
+	}
+
+	results, failures := make([][]GrepMatch, len(files)), make([]error, len(files))
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for worker := 0; worker < runtime.NumCPU(); worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				if failures[i] = ctx.Err(); failures[i] == nil {
+					results[i], failures[i] = r.grepFile(files[i], re, options)
+				}
+			}
+		}()
+	}
+	for i := range files {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+
+	matches := []GrepMatch{}
+	for i := range files {
+		if failures[i] != nil {
+			return nil, failures[i]
+		}
+		matches = append(matches, results[i]...)
+	}
+	return matches, nil
+}
+
+// grepFiles lists the files to search, sorted by path.
+func (r *Repository) grepFiles(options GrepOptions) ([]grepFile, error) {
+	spec, err := r.pathspec(options.Paths)
+	if err != nil {
+		return nil, err
+	}
+	files := []grepFile{}
+	if options.Revision != "" {
+		oid, err := r.repo.ResolveRevision(options.Revision)
+		if err != nil {
+			return nil, err
+		}
+		entries, err := r.treeEntries(oid)
+		if err != nil {
+			return nil, err
+		}
+		for path, entry := range entries {
+			if spec.Match(path) {
+				files = append(files, grepFile{path: path, oid: entry.OID()})
+			}
+		}
+	} else {
+		if err := r.repo.Index.Load(); err != nil {
+			return nil, err
+		}
+		seen := map[string]bool{}
+		for _, entry := range r.repo.Index.Entries() {
+			path := entry.Path()
+			if seen[path] || !spec.Match(path) || options.Cached && entry.Stage() != 0 {
+				continue
+			}
+			seen[path] = true
+			file := grepFile{path: path}
+			if options.Cached {
+				file.oid = entry.OID()
+			}
+			files = append(files, file)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].path < files[j].path
+	})
+	return files, nil
+}
+
+func (r *Repository) grepFile(file grepFile, re *regexp.Regexp, options GrepOptions) ([]GrepMatch, error) {
+	var data []byte
+	var err error
+	if file.oid == "" {
+		if data, err = r.repo.Workspace.ReadFile(file.path); os.IsNotExist(err) {
+			return nil, nil
+		}
+	} else {
+		_, data, err = r.repo.Database.ReadObject(file.oid)
+	}
+	if err != nil || isBinary(data) {
+		return nil, err
+	}
+
+	matches := []GrepMatch{}
+	for i, line := range diff.Lines(string(data)) {
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+		if options.WordRegexp && !matchesWord(re, line) || !options.WordRegexp && !re.MatchString(line) {
+			continue
+		}
+		matches = append(matches, GrepMatch{Path: file.path, Line: i + 1, Text: line})
+		if options.FilesWithMatches {
+			break
+		}
+	}
+	return matches, nil
+}
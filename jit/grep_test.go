@@ -0,0 +1,53 @@
+package jit_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/tpbowden/jit/jit"
+)
+
+func TestGrepSearchesWorkspaceIndexAndHistory(t *testing.T) {
+	repo, cleanup := setup(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	writeFile(t, repo, "a.txt", "Hello world\nhello_there\n")
+	writeFile(t, repo, "dir/b.txt", "say hello\n")
+	writeFile(t, repo, "bin.dat", "hello\x00\n")
+	first := commit(t, repo, "first\n")
+	writeFile(t, repo, "a.txt", "goodbye\n")
+
+	matches, err := repo.Grep(ctx, jit.GrepOptions{Pattern: "hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 1 || matches[0] != (jit.GrepMatch{Path: "dir/b.txt", Line: 1, Text: "say hello"}) {
+		t.Fatalf("Unexpected matches %+v", matches)
+	}
+
+	matches, err = repo.Grep(ctx, jit.GrepOptions{Pattern: "hello", IgnoreCase: true, WordRegexp: true, Cached: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 2 || matches[0].Text != "Hello world" || matches[1].Path != "dir/b.txt" {
+		t.Fatalf("Unexpected matches %+v", matches)
+	}
+
+	matches, err = repo.Grep(ctx, jit.GrepOptions{Pattern: "o+_", Extended: true, Revision: first.OID, Paths: []string{"a.txt"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 1 || matches[0].Line != 2 {
+		t.Fatalf("Unexpected matches %+v", matches)
+	}
+	if matches, err = repo.Grep(ctx, jit.GrepOptions{Pattern: "o+_", Revision: first.OID}); err != nil || len(matches) != 0 {
+		t.Fatalf("Expected + to be literal in a basic pattern, got %+v, %v", matches, err)
+	}
+
+	if _, err := repo.Grep(ctx, jit.GrepOptions{Pattern: "(", Extended: true}); err == nil {
+		t.Fatal("Expected an error")
+	} else if _, ok := err.(*jit.InvalidPattern); !ok {
+		t.Fatalf("Expected InvalidPattern, got %v", err)
+	}
+}
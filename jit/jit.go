@@ -0,0 +1,170 @@
+// Package jit is a library for working with jit repositories from Go
+// programs. Every operation takes a context that is checked between units of
+// work, returns structured results rather than printing, and reports
+// failures with the typed errors declared in errors.go.
+package jit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/tpbowden/jit/config"
+	"github.com/tpbowden/jit/core"
+	"github.com/tpbowden/jit/database"
+	"github.com/tpbowden/jit/pathspec"
+	"github.com/tpbowden/jit/repository"
+)
+
+// Signature identifies the author or committer of a commit.
+type Signature struct {
+	Name  string
+	Email string
+	When  time.Time
+}
+
+func (s Signature) author() database.Author {
+	return database.NewAuthor(s.Name, s.Email)
+}
+
+// at returns the signature with its time filled in if it was left unset.
+func (s Signature) at(now time.Time) Signature {
+	if s.When.IsZero() {
+		s.When = now
+	}
+	return s
+}
+
+func signature(author database.Author, when time.Time) Signature {
+	return Signature{Name: author.Name(), Email: author.Email(), When: when}
+}
+
+// Repository is an open repository with a working tree.
+type Repository struct {
+	dir      string
+	repo     *repository.Repository
+	identity Signature
+}
+
+// Dir returns the top of the repository's working tree.
+func (r *Repository) Dir() string {
+	return r.dir
+}
+
+// Config returns the repository's configuration.
+func (r *Repository) Config() *config.Config {
+	return r.repo.Config
+}
+
+// SetIdentity sets who commits and reflog entries are attributed to.
+func (r *Repository) SetIdentity(identity Signature) {
+	r.identity = identity
+}
+
+// Open opens the repository whose working tree is at dir.
+func Open(ctx context.Context, dir string) (*Repository, error) {
+	return open(ctx, dir, repository.Open)
+}
+
+// OpenWithStorage opens the repository whose working tree is at dir, keeping
+// its objects and refs in the given stores rather than in the .git directory,
+// which then only holds the index and config. Use database.NewMemory and
+// core.NewMemoryRefs to keep them in memory.
+func OpenWithStorage(ctx context.Context, dir string, objects database.ObjectStore, refs core.RefStore) (*Repository, error) {
+	return open(ctx, dir, func(gitDir string) (*repository.Repository, error) {
+		return repository.OpenWithStorage(gitDir, objects, refs)
+	})
+}
+
+func open(ctx context.Context, dir string, openRepository func(string) (*repository.Repository, error)) (*Repository, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	gitDir := filepath.Join(dir, ".git")
+	if stat, err := os.Stat(gitDir); err != nil || !stat.IsDir() {
+		return nil, notRepository(dir)
+	}
+
+	repo, err := openRepository(gitDir)
+	if err != nil {
+		return nil, err
+	}
+	return &Repository{dir: dir, repo: repo}, nil
+}
+
+// Init creates an empty repository in dir, or reinitialises an existing one,
+// and opens it.
+func Init(ctx context.Context, dir string) (*Repository, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	gitDir := filepath.Join(dir, ".git")
+	for _, name := range []string{"refs", "objects"} {
+		if err := os.MkdirAll(filepath.Join(gitDir, name), os.ModePerm); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := os.Stat(filepath.Join(gitDir, "HEAD")); os.IsNotExist(err) {
+		if err := core.NewRefs(gitDir).SetHead("refs/heads/master"); err != nil {
+			return nil, err
+		}
+	}
+	return Open(ctx, dir)
+}
+
+// treeEntries returns the files in a commit's tree keyed by path. The empty
+// commit ID stands for an unborn branch with no files.
+func (r *Repository) treeEntries(commitID string) (map[string]database.TreeEntry, error) {
+	result := map[string]database.TreeEntry{}
+	if commitID == "" {
+		return result, nil
+	}
+
+	object, err := r.repo.Database.Load(commitID)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := r.repo.Database.ReadTreeRecursive(object.(database.Commit).TreeID)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		result[entry.Path()] = entry
+	}
+	return result, nil
+}
+
+// relativePath turns a path given relative to the working tree, or an
+// absolute one inside it, into a path relative to the working tree.
+func (r *Repository) relativePath(path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(r.dir, path)
+	}
+	return filepath.Rel(r.dir, path)
+}
+
+// pathspec parses the paths given to an operation as a pathspec relative to
+// the top of the working tree. Absolute paths are made relative first.
+func (r *Repository) pathspec(args []string) (*pathspec.Pathspec, error) {
+	patterns := []string{}
+	for _, arg := range args {
+		if filepath.IsAbs(arg) {
+			relative, err := filepath.Rel(r.dir, arg)
+			if err != nil {
+				return nil, err
+			}
+			arg = filepath.ToSlash(relative)
+		}
+		patterns = append(patterns, arg)
+	}
+	return pathspec.Parse(patterns, "")
+}
@@ -0,0 +1,477 @@
+package jit_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tpbowden/jit/core"
+	"github.com/tpbowden/jit/database"
+	"github.com/tpbowden/jit/jit"
+)
+
+func setup(t *testing.T) (*jit.Repository, func()) {
+	dir, err := ioutil.TempDir("", "jit_lib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := jit.Init(context.Background(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo.SetIdentity(jit.Signature{Name: "A. U. Thor", Email: "author@example.com"})
+	return repo, func() { os.RemoveAll(dir) }
+}
+
+func writeFile(t *testing.T, repo *jit.Repository, name, contents string) {
+	path := filepath.Join(repo.Dir(), name)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func commit(t *testing.T, repo *jit.Repository, message string) *jit.CommitResult {
+	if err := repo.Add(context.Background(), "."); err != nil {
+		t.Fatal(err)
+	}
+	result, err := repo.Commit(context.Background(), jit.CommitOptions{Message: message})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestOpenRejectsNonRepository(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jit_lib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err := jit.Open(context.Background(), dir); err == nil {
+		t.Fatal("Expected an error")
+	} else if _, ok := err.(*jit.NotRepository); !ok {
+		t.Fatalf("Expected NotRepository, got %v", err)
+	}
+}
+
+func TestCommitAndLog(t *testing.T) {
+	repo, cleanup := setup(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	writeFile(t, repo, "a.txt", "one\n")
+	first := commit(t, repo, "first\n")
+	if !first.Root() {
+		t.Fatal("Expected a root commit")
+	}
+
+	if _, err := repo.Commit(ctx, jit.CommitOptions{Message: "again\n"}); err == nil {
+		t.Fatal("Expected an error")
+	} else if _, ok := err.(*jit.NothingToCommit); !ok {
+		t.Fatalf("Expected NothingToCommit, got %v", err)
+	}
+
+	writeFile(t, repo, "a.txt", "two\n")
+	second := commit(t, repo, "second\n")
+
+	commits, err := repo.Log(ctx, jit.LogOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commits) != 2 || commits[0].OID != second.OID || commits[1].OID != first.OID {
+		t.Fatalf("Unexpected log %v", commits)
+	}
+	if commits[0].Author.Name != "A. U. Thor" || commits[0].Parents[0] != first.OID {
+		t.Fatalf("Unexpected commit %v", commits[0])
+	}
+
+	commits, err = repo.Log(ctx, jit.LogOptions{Revision: "HEAD", MaxCount: 1})
+	if err != nil || len(commits) != 1 {
+		t.Fatalf("Expected one commit, got %v, %v", commits, err)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	repo, cleanup := setup(t)
+	defer cleanup()
+
+	writeFile(t, repo, "a.txt", "one\n")
+	writeFile(t, repo, "b.txt", "one\n")
+	commit(t, repo, "first\n")
+
+	writeFile(t, repo, "a.txt", "two\n")
+	os.Remove(filepath.Join(repo.Dir(), "b.txt"))
+	writeFile(t, repo, "new/c.txt", "three\n")
+
+	status, err := repo.Status(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []jit.StatusEntry{
+		{Path: "a.txt", Index: jit.Unmodified, Workspace: jit.Modified},
+		{Path: "b.txt", Index: jit.Unmodified, Workspace: jit.Deleted},
+	}
+	if len(status.Entries) != 2 || status.Entries[0] != expected[0] || status.Entries[1] != expected[1] {
+		t.Fatalf("Unexpected entries %v", status.Entries)
+	}
+	if len(status.Untracked) != 1 || status.Untracked[0] != "new/" {
+		t.Fatalf("Unexpected untracked files %v", status.Untracked)
+	}
+	if status.Branch != "master" || status.Staged() {
+		t.Fatalf("Unexpected status %v", status)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	repo, cleanup := setup(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	writeFile(t, repo, "a.txt", "1\n2\n3\n")
+	commit(t, repo, "first\n")
+	writeFile(t, repo, "a.txt", "1\nTWO\n3\n")
+
+	diffs, err := repo.Diff(ctx, jit.DiffOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 1 || diffs[0].Status != jit.Modified || len(diffs[0].Hunks) != 1 {
+		t.Fatalf("Unexpected diff %v", diffs)
+	}
+	if header := diffs[0].Hunks[0].Header(); header != "@@ -1,3 +1,3 @@" {
+		t.Fatalf("Unexpected header %s", header)
+	}
+
+	if diffs, err = repo.Diff(ctx, jit.DiffOptions{Cached: true}); err != nil || len(diffs) != 0 {
+		t.Fatalf("Expected no staged changes, got %v, %v", diffs, err)
+	}
+	repo.Add(ctx, "a.txt")
+	if diffs, err = repo.Diff(ctx, jit.DiffOptions{Cached: true}); err != nil || len(diffs) != 1 {
+		t.Fatalf("Expected a staged change, got %v, %v", diffs, err)
+	}
+}
+
+func TestCheckout(t *testing.T) {
+	repo, cleanup := setup(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	writeFile(t, repo, "a.txt", "one\n")
+	first := commit(t, repo, "first\n")
+	writeFile(t, repo, "a.txt", "two\n")
+	writeFile(t, repo, "dir/b.txt", "two\n")
+	commit(t, repo, "second\n")
+
+	result, err := repo.Checkout(ctx, first.OID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Detached() || result.PreviousBranch != "master" {
+		t.Fatalf("Unexpected result %v", result)
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(repo.Dir(), "a.txt")); string(data) != "one\n" {
+		t.Fatalf("Unexpected contents %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(repo.Dir(), "dir")); !os.IsNotExist(err) {
+		t.Fatal("Expected dir to be removed")
+	}
+
+	branchDir := filepath.Join(repo.Dir(), ".git", "refs", "heads", "feature")
+	if err := os.MkdirAll(branchDir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(branchDir, "x"), []byte(first.OID+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, target := range []string{"../../config", "feature"} {
+		if _, err := repo.Checkout(ctx, target); err == nil {
+			t.Fatalf("Expected checking out %s to fail", target)
+		} else if _, ok := err.(*jit.InvalidRevision); !ok {
+			t.Fatalf("Expected InvalidRevision for %s, got %v", target, err)
+		}
+	}
+
+	writeFile(t, repo, "a.txt", "local\n")
+	if _, err := repo.Checkout(ctx, "master"); err == nil {
+		t.Fatal("Expected a conflict")
+	} else if conflict, ok := err.(*jit.CheckoutConflict); !ok || conflict.Paths[0] != "a.txt" {
+		t.Fatalf("Expected CheckoutConflict, got %v", err)
+	}
+
+	writeFile(t, repo, "a.txt", "one\n")
+	if result, err = repo.Checkout(ctx, "master"); err != nil || result.Branch != "master" {
+		t.Fatalf("Unexpected result %v, %v", result, err)
+	}
+	status, err := repo.Status(ctx)
+	if err != nil || !status.Clean() {
+		t.Fatalf("Expected a clean status, got %v, %v", status, err)
+	}
+}
+
+func TestCancelledContext(t *testing.T) {
+	repo, cleanup := setup(t)
+	defer cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	writeFile(t, repo, "a.txt", "one\n")
+	if err := repo.Add(ctx, "."); err != context.Canceled {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+	status, err := repo.Status(context.Background())
+	if err != nil || len(status.Untracked) != 1 {
+		t.Fatalf("Expected nothing to be staged, got %v, %v", status, err)
+	}
+}
+
+func TestInMemoryStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jit_lib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, ".git"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	objects, refs := database.NewMemory(), core.NewMemoryRefs()
+	repo, err := jit.OpenWithStorage(ctx, dir, objects, refs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo.SetIdentity(jit.Signature{Name: "A. U. Thor", Email: "author@example.com"})
+
+	writeFile(t, repo, "a.txt", "one\n")
+	first := commit(t, repo, "first\n")
+	writeFile(t, repo, "a.txt", "two\n")
+	second := commit(t, repo, "second\n")
+
+	if oid, _ := refs.ReadRef("refs/heads/master"); oid != second.OID {
+		t.Fatalf("Expected master at %s, got %s", second.OID, oid)
+	}
+	if !objects.Exists(first.OID) {
+		t.Fatal("Expected the commit in the memory store")
+	}
+	// The locks directory records who holds the index lock.
+	entries, _ := ioutil.ReadDir(filepath.Join(dir, ".git"))
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if strings.Join(names, " ") != "index locks" {
+		t.Fatalf("Expected only the index on disk, got %v", names)
+	}
+
+	if _, err := repo.Checkout(ctx, "HEAD^"); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(dir, "a.txt")); string(data) != "one\n" {
+		t.Fatalf("Unexpected contents %q", data)
+	}
+	reflog, _ := refs.ReadReflog("HEAD")
+	if len(reflog) != 3 {
+		t.Fatalf("Expected 3 reflog entries, got %v", reflog)
+	}
+}
+
+func TestStatusAndLogLimitedByPathspec(t *testing.T) {
+	repo, cleanup := setup(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	writeFile(t, repo, "a.txt", "one\n")
+	writeFile(t, repo, "lib/b.go", "one\n")
+	first := commit(t, repo, "first\n")
+	writeFile(t, repo, "a.txt", "two\n")
+	second := commit(t, repo, "second\n")
+
+	commits, err := repo.Log(ctx, jit.LogOptions{Paths: []string{"*.go"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commits) != 1 || commits[0].OID != first.OID {
+		t.Fatalf("Unexpected log %v", commits)
+	}
+	if commits, err = repo.Log(ctx, jit.LogOptions{Paths: []string{":!lib"}}); err != nil || len(commits) != 2 || commits[0].OID != second.OID {
+		t.Fatalf("Unexpected log %v, %v", commits, err)
+	}
+
+	writeFile(t, repo, "a.txt", "three\n")
+	writeFile(t, repo, "lib/b.go", "two\n")
+	writeFile(t, repo, "new/c.go", "one\n")
+	writeFile(t, repo, "new/d.txt", "one\n")
+	status, err := repo.Status(ctx, ":(glob)**/*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Entries) != 1 || status.Entries[0].Path != "lib/b.go" {
+		t.Fatalf("Unexpected entries %v", status.Entries)
+	}
+	if len(status.Untracked) != 1 || status.Untracked[0] != "new/c.go" {
+		t.Fatalf("Unexpected untracked files %v", status.Untracked)
+	}
+
+	if _, err := repo.Status(ctx, ":(nope)a.txt"); err == nil {
+		t.Fatal("Expected an error")
+	} else if _, ok := err.(*jit.InvalidPathspec); !ok {
+		t.Fatalf("Expected InvalidPathspec, got %v", err)
+	}
+}
+
+func TestResetRemoveAndMove(t *testing.T) {
+	repo, cleanup := setup(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	writeFile(t, repo, "a.txt", "one\n")
+	first := commit(t, repo, "first\n")
+	writeFile(t, repo, "a.txt", "two\n")
+	writeFile(t, repo, "dir/b.txt", "new\n")
+	second := commit(t, repo, "second\n")
+
+	if _, err := repo.Reset(ctx, jit.ResetOptions{Mode: jit.ResetHard, Paths: []string{"a.txt"}}); err == nil {
+		t.Fatal("Expected a hard reset with paths to fail")
+	} else if _, ok := err.(*jit.ResetWithPaths); !ok {
+		t.Fatalf("Expected ResetWithPaths, got %v", err)
+	}
+	result, err := repo.Reset(ctx, jit.ResetOptions{Revision: "HEAD^"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.OID != first.OID || result.PreviousOID != second.OID || result.Summary() != "first" {
+		t.Fatalf("Unexpected result %+v", result)
+	}
+	if status := porcelain(t, repo); status["a.txt"] != " M" {
+		t.Fatalf("Unexpected status %v", status)
+	}
+	if _, err := repo.Reset(ctx, jit.ResetOptions{Revision: "ORIG_HEAD", Mode: jit.ResetHard}); err != nil {
+		t.Fatal(err)
+	}
+	if status := porcelain(t, repo); len(status) != 0 {
+		t.Fatalf("Expected a clean tree, got %v", status)
+	}
+
+	writeFile(t, repo, "a.txt", "three\n")
+	if _, err := repo.Remove(ctx, jit.RemoveOptions{Paths: []string{"dir"}}); err == nil {
+		t.Fatal("Expected removing a directory without Recursive to fail")
+	} else if _, ok := err.(*jit.NotRecursive); !ok {
+		t.Fatalf("Expected NotRecursive, got %v", err)
+	}
+	if _, err := repo.Remove(ctx, jit.RemoveOptions{Paths: []string{"a.txt"}}); err == nil {
+		t.Fatal("Expected removing a modified file to fail")
+	} else if conflict, ok := err.(*jit.RemoveConflict); !ok || conflict.Problems[0] != "local modifications" {
+		t.Fatalf("Expected RemoveConflict, got %v", err)
+	}
+	removed, err := repo.Remove(ctx, jit.RemoveOptions{Paths: []string{"dir"}, Recursive: true})
+	if err != nil || len(removed) != 1 || removed[0] != filepath.Join("dir", "b.txt") {
+		t.Fatalf("Unexpected removal %v, %v", removed, err)
+	}
+
+	if err := repo.Move(ctx, jit.MoveOptions{Sources: []string{"a.txt"}, Destination: "c.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Move(ctx, jit.MoveOptions{Sources: []string{"a.txt"}, Destination: "d.txt"}); err == nil {
+		t.Fatal("Expected moving an untracked file to fail")
+	} else if _, ok := err.(*jit.InvalidMove); !ok {
+		t.Fatalf("Expected InvalidMove, got %v", err)
+	}
+	if err := repo.Move(ctx, jit.MoveOptions{Sources: []string{"c.txt"}, Destination: "../c.txt"}); err == nil {
+		t.Fatal("Expected moving outside the repository to fail")
+	} else if _, ok := err.(*jit.PathOutside); !ok {
+		t.Fatalf("Expected PathOutside, got %v", err)
+	}
+	status := porcelain(t, repo)
+	if len(status) != 2 || status["c.txt"] != "RM" || status["dir/b.txt"] != "D " {
+		t.Fatalf("Unexpected status %v", status)
+	}
+}
+
+func TestTags(t *testing.T) {
+	repo, cleanup := setup(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	writeFile(t, repo, "a.txt", "one\n")
+	first := commit(t, repo, "first\n")
+	if _, err := repo.CreateTag(ctx, "v1.0", jit.TagOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	annotated, err := repo.CreateTag(ctx, "v1.1", jit.TagOptions{Message: "release"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if annotated.OID == first.OID {
+		t.Fatal("Expected an annotated tag object")
+	}
+	if _, err := repo.CreateTag(ctx, "v1.0", jit.TagOptions{}); err == nil {
+		t.Fatal("Expected an existing tag to be refused")
+	} else if _, ok := err.(*jit.TagExists); !ok {
+		t.Fatalf("Expected TagExists, got %v", err)
+	}
+	if _, err := repo.CreateTag(ctx, "bad..name", jit.TagOptions{}); err == nil {
+		t.Fatal("Expected an invalid name to be refused")
+	} else if _, ok := err.(*jit.InvalidTagName); !ok {
+		t.Fatalf("Expected InvalidTagName, got %v", err)
+	}
+
+	writeFile(t, repo, "a.txt", "two\n")
+	second := commit(t, repo, "second\n")
+	result, err := repo.CreateTag(ctx, "v1.0", jit.TagOptions{Force: true})
+	if err != nil || result.OID != second.OID || result.PreviousOID != first.OID {
+		t.Fatalf("Unexpected result %+v, %v", result, err)
+	}
+
+	if names, err := repo.Tags("v1.*"); err != nil || len(names) != 2 {
+		t.Fatalf("Unexpected tags %v, %v", names, err)
+	}
+	if oid, err := repo.DeleteTag("v1.0"); err != nil || oid != second.OID {
+		t.Fatalf("Unexpected deletion %s, %v", oid, err)
+	}
+	if _, err := repo.DeleteTag("../../HEAD"); err == nil {
+		t.Fatal("Expected an invalid name not to be found")
+	} else if _, ok := err.(*jit.TagNotFound); !ok {
+		t.Fatalf("Expected TagNotFound, got %v", err)
+	}
+	if names, _ := repo.Tags(); len(names) != 1 || names[0] != "v1.1" {
+		t.Fatalf("Unexpected tags %v", names)
+	}
+}
+
+func TestStatusPathspecLimitsRenames(t *testing.T) {
+	repo, cleanup := setup(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	writeFile(t, repo, "a/f.txt", "one\n")
+	commit(t, repo, "first\n")
+	if err := repo.Move(ctx, jit.MoveOptions{Sources: []string{"a/f.txt"}, Destination: "b/g.txt"}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]jit.StatusEntry{
+		"a": {Path: filepath.Join("a", "f.txt"), Index: jit.Deleted, Workspace: jit.Unmodified},
+		"b": {Path: filepath.Join("b", "g.txt"), Index: jit.Added, Workspace: jit.Unmodified},
+		"":  {Path: filepath.Join("b", "g.txt"), OrigPath: filepath.Join("a", "f.txt"), Index: jit.Renamed, Workspace: jit.Unmodified},
+	}
+	for path, entry := range expected {
+		paths := []string{}
+		if path != "" {
+			paths = append(paths, path)
+		}
+		status, err := repo.Status(ctx, paths...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(status.Entries) != 1 || status.Entries[0] != entry {
+			t.Fatalf("Unexpected entries for %q: %v", path, status.Entries)
+		}
+	}
+}
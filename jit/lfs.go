@@ -0,0 +1,335 @@
+package jit
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/tpbowden/jit/attributes"
+	"github.com/tpbowden/jit/lfs"
+	"github.com/tpbowden/jit/repository"
+)
+
+// lfsAttributes are the attributes LFSTrack gives each pattern.
+const lfsAttributes = "filter=lfs diff=lfs merge=lfs -text"
+
+// LFSFile is a tracked file stored as an LFS pointer. Present is set if its
+// content is in the local store, and CheckedOut if the working tree holds
+// the content rather than the pointer.
+type LFSFile struct {
+	Path       string
+	Pointer    lfs.Pointer
+	Present    bool
+	CheckedOut bool
+}
+
+type LFSOptions struct {
+	// Remote is a configured remote or a repository path, "origin" if empty.
+	// lfs.url overrides where its objects are transferred to and from.
+	Remote string
+	// Revisions choose the commits whose files are transferred, HEAD if
+	// empty. Fetching takes the files in each commit's tree, and pushing
+	// those in every commit reachable from them.
+	Revisions []string
+}
+
+// LFSTransferResult counts the objects a fetch or push needed and how many
+// of them it had to copy.
+type LFSTransferResult struct {
+	Objects     int
+	Transferred int
+}
+
+func (r *Repository) lfsStore() *lfs.Store {
+	return lfs.NewStore(r.gitPath(""))
+}
+
+// LFSTrack adds patterns to the top-level .gitattributes so that matching
+// files are stored with LFS, returning the patterns that were not already
+// tracked. The attributes file is not staged.
+func (r *Repository) LFSTrack(patterns ...string) ([]string, error) {
+	tracked, err := r.LFSTracked()
+	if err != nil {
+		return nil, err
+	}
+	existing := map[string]bool{}
+	for _, pattern := range tracked {
+		existing[pattern] = true
+	}
+
+	path := filepath.Join(r.dir, attributes.FileName)
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	added := []string{}
+	for _, pattern := range patterns {
+		if existing[pattern] {
+			continue
+		}
+		existing[pattern] = true
+		if len(data) > 0 && data[len(data)-1] != '\n' {
+			data = append(data, '\n')
+		}
+		data = append(data, pattern+" "+lfsAttributes+"\n"...)
+		added = append(added, pattern)
+	}
+	if len(added) == 0 {
+		return added, nil
+	}
+	return added, ioutil.WriteFile(path, data, 0644)
+}
+
+// LFSTracked lists the patterns the top-level .gitattributes stores with LFS.
+func (r *Repository) LFSTracked() ([]string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(r.dir, attributes.FileName))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	patterns := []string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		for _, field := range fields[1:] {
+			if field == "filter=lfs" {
+				patterns = append(patterns, fields[0])
+				break
+			}
+		}
+	}
+	return patterns, nil
+}
+
+// LFSFiles lists the files in the index whose filter attribute is lfs and
+// which are stored as pointers, sorted by path.
+func (r *Repository) LFSFiles(ctx context.Context) ([]LFSFile, error) {
+	if err := r.repo.Index.Load(); err != nil {
+		return nil, err
+	}
+	store := r.lfsStore()
+	files := []LFSFile{}
+	for _, entry := range r.repo.Index.Entries() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if entry.Stage() != 0 {
+			continue
+		}
+		attrs, err := r.repo.Filter.Check(entry.Path())
+		if err != nil {
+			return nil, err
+		}
+		if attrs["filter"] != "lfs" {
+			continue
+		}
+		_, data, err := r.repo.Database.ReadObject(entry.OID())
+		if err != nil {
+			return nil, err
+		}
+		pointer, ok := lfs.ParsePointer(data)
+		if !ok {
+			continue
+		}
+		file := LFSFile{Path: entry.Path(), Pointer: pointer, Present: store.Has(pointer)}
+		if raw, err := r.repo.Workspace.ReadFile(entry.Path()); err == nil {
+			_, isPointer := lfs.ParsePointer(raw)
+			file.CheckedOut = !isPointer
+		}
+		files = append(files, file)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+	return files, nil
+}
+
+// lfsAdapter returns the adapter for transferring objects with a remote.
+// Only repositories on disk can be reached.
+func (r *Repository) lfsAdapter(name string) (lfs.Adapter, error) {
+	if name == "" {
+		name = "origin"
+	}
+	url, exists := r.repo.Config.Get("lfs.url")
+	if !exists {
+		found, err := r.lookupRemote(name)
+		if err != nil {
+			return nil, err
+		}
+		url = found.URL
+	}
+	return lfsAdapterFor(r.resolveURL(url))
+}
+
+func lfsAdapterFor(url string) (lfs.Adapter, error) {
+	path := strings.TrimPrefix(url, "file://")
+	if strings.Contains(path, ":") {
+		return nil, &LFSUnsupported{URL: url}
+	}
+	gitDir, _, ok := repository.Discover(path)
+	if !ok {
+		return nil, notRepository(path)
+	}
+	return &lfs.LocalAdapter{Remote: lfs.NewStore(gitDir)}, nil
+}
+
+// lfsPointers finds the pointers in the trees of the given commits, leaving
+// out duplicates.
+func (r *Repository) lfsPointers(ctx context.Context, commits []string) ([]lfs.Pointer, error) {
+	pointers, seen := []lfs.Pointer{}, map[string]bool{}
+	for _, commit := range commits {
+		entries, err := r.treeEntries(commit)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			if seen[entry.OID()] {
+				continue
+			}
+			seen[entry.OID()] = true
+			_, data, err := r.repo.Database.ReadObject(entry.OID())
+			if err != nil {
+				return nil, err
+			}
+			if pointer, ok := lfs.ParsePointer(data); ok && !seen[pointer.OID] {
+				seen[pointer.OID] = true
+				pointers = append(pointers, pointer)
+			}
+		}
+	}
+	return pointers, nil
+}
+
+func (r *Repository) lfsRevisions(revisions []string) ([]string, error) {
+	if len(revisions) == 0 {
+		revisions = []string{"HEAD"}
+	}
+	oids := []string{}
+	for _, revision := range revisions {
+		oid, err := r.repo.ResolveRevision(revision)
+		if err != nil {
+			return nil, err
+		}
+		oids = append(oids, oid)
+	}
+	return oids, nil
+}
+
+// LFSFetch downloads the content of the LFS files in the given commits into
+// the local store.
+func (r *Repository) LFSFetch(ctx context.Context, options LFSOptions) (*LFSTransferResult, error) {
+	adapter, err := r.lfsAdapter(options.Remote)
+	if err != nil {
+		return nil, err
+	}
+	commits, err := r.lfsRevisions(options.Revisions)
+	if err != nil {
+		return nil, err
+	}
+	return r.lfsFetch(ctx, adapter, commits)
+}
+
+func (r *Repository) lfsFetch(ctx context.Context, adapter lfs.Adapter, commits []string) (*LFSTransferResult, error) {
+	pointers, err := r.lfsPointers(ctx, commits)
+	if err != nil {
+		return nil, err
+	}
+	copied, err := adapter.Download(ctx, r.lfsStore(), pointers)
+	if err != nil {
+		return nil, err
+	}
+	return &LFSTransferResult{Objects: len(pointers), Transferred: copied}, nil
+}
+
+// LFSPush uploads the content of the LFS files in every commit reachable
+// from the given ones that the remote does not already have.
+func (r *Repository) LFSPush(ctx context.Context, options LFSOptions) (*LFSTransferResult, error) {
+	adapter, err := r.lfsAdapter(options.Remote)
+	if err != nil {
+		return nil, err
+	}
+	tips, err := r.lfsRevisions(options.Revisions)
+	if err != nil {
+		return nil, err
+	}
+	commits := []string{}
+	for _, tip := range tips {
+		reachable, err := r.repo.CommitRange("", tip)
+		if err != nil {
+			return nil, err
+		}
+		commits = append(commits, reachable...)
+	}
+	pointers, err := r.lfsPointers(ctx, commits)
+	if err != nil {
+		return nil, err
+	}
+	copied, err := adapter.Upload(ctx, r.lfsStore(), pointers)
+	if err != nil {
+		return nil, err
+	}
+	return &LFSTransferResult{Objects: len(pointers), Transferred: copied}, nil
+}
+
+// LFSCheckout replaces the pointers left in the working tree for files whose
+// content is now in the local store, returning the paths it wrote.
+func (r *Repository) LFSCheckout(ctx context.Context) ([]string, error) {
+	files, err := r.LFSFiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.repo.Index.LoadForUpdate(); err != nil {
+		return nil, err
+	}
+	written, err := r.lfsCheckout(files)
+	if err != nil {
+		r.repo.Index.ReleaseLock()
+		return nil, err
+	}
+	return written, r.repo.Index.WriteUpdates()
+}
+
+func (r *Repository) lfsCheckout(files []LFSFile) ([]string, error) {
+	written := []string{}
+	for _, file := range files {
+		entry, tracked := r.repo.Index.Entry(file.Path)
+		if !file.Present || file.CheckedOut || !tracked {
+			continue
+		}
+		_, data, err := r.repo.Database.ReadObject(entry.OID())
+		if err != nil {
+			return nil, err
+		}
+		if err := r.repo.Workspace.WriteBlob(file.Path, data, entry.Mode()); err != nil {
+			return nil, err
+		}
+		stat, err := r.repo.Workspace.StatFile(file.Path)
+		if err != nil {
+			return nil, err
+		}
+		r.repo.Index.UpdateEntryStat(entry, stat)
+		written = append(written, file.Path)
+	}
+	return written, nil
+}
+
+// LFSPull fetches the content of the LFS files in the given commits and
+// checks out any that were left as pointers.
+func (r *Repository) LFSPull(ctx context.Context, options LFSOptions) (*LFSTransferResult, []string, error) {
+	result, err := r.LFSFetch(ctx, options)
+	if err != nil {
+		return nil, nil, err
+	}
+	written, err := r.LFSCheckout(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return result, written, nil
+}
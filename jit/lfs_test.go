@@ -0,0 +1,98 @@
+package jit_test
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tpbowden/jit/jit"
+)
+
+func TestLFSStoresPointersAndClonesContent(t *testing.T) {
+	source, cleanup := setup(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	if added, err := source.LFSTrack("*.bin", "*.bin"); err != nil || len(added) != 1 {
+		t.Fatalf("Unexpected tracked patterns %v, %v", added, err)
+	}
+	content := strings.Repeat("large\n", 1000)
+	writeFile(t, source, "data.bin", content)
+	writeFile(t, source, "a.txt", "one\n")
+	commit(t, source, "first\n")
+
+	files, err := source.LFSFiles(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Path != "data.bin" || !files[0].Present || !files[0].CheckedOut {
+		t.Fatalf("Unexpected LFS files %v", files)
+	}
+	if files[0].Pointer.Size != int64(len(content)) {
+		t.Fatalf("Unexpected pointer %v", files[0].Pointer)
+	}
+
+	cloned, cleanupClone := clone(t, source)
+	defer cleanupClone()
+	data, err := ioutil.ReadFile(filepath.Join(cloned.Dir(), "data.bin"))
+	if err != nil || string(data) != content {
+		t.Fatalf("Expected the content to be checked out, got %d bytes, %v", len(data), err)
+	}
+	status, err := cloned.Status(ctx)
+	if err != nil || !status.Clean() {
+		t.Fatalf("Expected a clean clone, got %#v, %v", status, err)
+	}
+
+	writeFile(t, cloned, "data.bin", "changed\n")
+	commit(t, cloned, "second\n")
+	result, err := cloned.LFSPush(ctx, jit.LFSOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Objects != 2 || result.Transferred != 1 {
+		t.Fatalf("Unexpected push result %v", result)
+	}
+	if result, err = cloned.LFSPush(ctx, jit.LFSOptions{}); err != nil || result.Transferred != 0 {
+		t.Fatalf("Expected nothing to push, got %v, %v", result, err)
+	}
+}
+
+func TestLFSPullChecksOutFetchedContent(t *testing.T) {
+	source, cleanup := setup(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	source.LFSTrack("*.bin")
+	writeFile(t, source, "a.txt", "one\n")
+	commit(t, source, "first\n")
+	cloned, cleanupClone := clone(t, source)
+	defer cleanupClone()
+
+	writeFile(t, source, "data.bin", "large\n")
+	commit(t, source, "second\n")
+	if _, err := cloned.Fetch(ctx, jit.FetchOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cloned.Checkout(ctx, "origin/master"); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(cloned.Dir(), "data.bin")); !strings.HasPrefix(string(data), "version ") {
+		t.Fatalf("Expected a pointer to be checked out, got %q", data)
+	}
+	if _, err := cloned.LFSFetch(ctx, jit.LFSOptions{Remote: "nowhere"}); err == nil {
+		t.Fatal("Expected an error")
+	}
+
+	result, written, err := cloned.LFSPull(ctx, jit.LFSOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Transferred != 1 || len(written) != 1 || written[0] != "data.bin" {
+		t.Fatalf("Unexpected pull %v, %v", result, written)
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(cloned.Dir(), "data.bin")); string(data) != "large\n" {
+		t.Fatalf("Unexpected contents %q", data)
+	}
+}
@@ -0,0 +1,112 @@
+package jit
+
+import (
+	"context"
+	"strings"
+
+	"github.com/tpbowden/jit/database"
+	"github.com/tpbowden/jit/pathspec"
+)
+
+type LogOptions struct {
+	// Revision is where the history starts, HEAD if empty.
+	Revision string
+	// MaxCount limits the number of commits returned if positive.
+	MaxCount int
+	// Paths is a pathspec limiting the history to commits that change the
+	// files it matches, compared with their first parent.
+	Paths []string
+}
+
+// CommitInfo describes a commit in the history.
+type CommitInfo struct {
+	OID       string
+	Tree      string
+	Parents   []string
+	Author    Signature
+	Committer Signature
+	Message   string
+}
+
+// Summary returns the first line of the commit message.
+func (c CommitInfo) Summary() string {
+	return strings.Split(c.Message, "\n")[0]
+}
+
+func commitInfo(oid string, commit database.Commit) CommitInfo {
+	return CommitInfo{
+		OID:       oid,
+		Tree:      commit.TreeID,
+		Author:    signature(commit.Author, commit.Timestamp),
+		Committer: signature(commit.Committer, commit.CommitTime),
+		Message:   commit.Message,
+		Parents:   commit.Parents,
+	}
+}
+
+// Log walks the history backwards from a revision, newest commit first.
+func (r *Repository) Log(ctx context.Context, options LogOptions) ([]CommitInfo, error) {
+	spec, err := r.pathspec(options.Paths)
+	if err != nil {
+		return nil, err
+	}
+	revision := options.Revision
+	if revision == "" {
+		revision = "HEAD"
+	}
+
+	oid := ""
+	head, err := r.repo.Refs.ReadHead()
+	if err != nil {
+		return nil, err
+	}
+	if revision != "HEAD" || head != "" {
+		if oid, err = r.repo.ResolveRevision(revision); err != nil {
+			return nil, err
+		}
+	}
+
+	commits := []CommitInfo{}
+	for oid != "" && (options.MaxCount <= 0 || len(commits) < options.MaxCount) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		object, err := r.repo.Database.Load(oid)
+		if err != nil {
+			return nil, err
+		}
+		commit := object.(database.Commit)
+		touched := true
+		if !spec.Empty() {
+			if touched, err = r.touchesPaths(oid, commit.ParentID, spec); err != nil {
+				return nil, err
+			}
+		}
+		if touched {
+			commits = append(commits, commitInfo(oid, commit))
+		}
+		oid = commit.ParentID
+	}
+	return commits, nil
+}
+
+// touchesPaths reports whether any file matching a pathspec differs between
+// a commit and its parent, which is empty for a root commit.
+func (r *Repository) touchesPaths(oid, parent string, spec *pathspec.Pathspec) (bool, error) {
+	trees := [2]map[string]database.TreeEntry{}
+	for i, commit := range []string{parent, oid} {
+		entries, err := r.treeEntries(commit)
+		if err != nil {
+			return false, err
+		}
+		trees[i] = entries
+	}
+	for _, entries := range trees {
+		for path := range entries {
+			if spec.Match(path) && !sameEntry(lookupEntry(trees[0], path), lookupEntry(trees[1], path)) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
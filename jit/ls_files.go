@@ -0,0 +1,112 @@
+package jit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+)
+
+type ListFilesOptions struct {
+	// Cached lists the files in the index. It is the default when none of
+	// the other kinds are asked for.
+	Cached bool
+	// Deleted lists tracked files missing from the working tree, and
+	// Modified those that differ from the index there, deleted ones
+	// included.
+	Deleted  bool
+	Modified bool
+	// Others lists the untracked files in the working tree.
+	Others bool
+	// Paths is a pathspec limiting the listing to the files it matches.
+	Paths []string
+}
+
+// FileEntry is a file listed by ListFiles. Untracked files have no mode, ID
+// or stage.
+type FileEntry struct {
+	Path    string
+	Mode    int32
+	OID     string
+	Stage   int
+	Tracked bool
+}
+
+// ListFiles lists files in the index and the working tree. As in git, the
+// untracked files come first, then the files in the index in order, then
+// those deleted or modified, so a path can appear more than once when
+// several kinds are asked for.
+func (r *Repository) ListFiles(ctx context.Context, options ListFilesOptions) ([]FileEntry, error) {
+	spec, err := r.pathspec(options.Paths)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.repo.Index.Load(); err != nil {
+		return nil, err
+	}
+	if !options.Deleted && !options.Modified && !options.Others {
+		options.Cached = true
+	}
+
+	files := []FileEntry{}
+	if options.Others {
+		paths, err := r.repo.Workspace.ListFiles()
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range paths {
+			_, tracked := r.repo.Index.Entry(path)
+			if !tracked && !r.repo.Index.IsConflicted(path) && spec.Match(filepath.ToSlash(path)) {
+				files = append(files, FileEntry{Path: path})
+			}
+		}
+	}
+
+	entries := r.repo.Index.Entries()
+	for _, entry := range entries {
+		if options.Cached && spec.Match(filepath.ToSlash(entry.Path())) {
+			files = append(files, FileEntry{
+				Path:    entry.Path(),
+				Mode:    entry.Mode(),
+				OID:     entry.OID(),
+				Stage:   entry.Stage(),
+				Tracked: true,
+			})
+		}
+	}
+
+	if !options.Deleted && !options.Modified {
+		return files, nil
+	}
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if entry.SkipWorktree() || !spec.Match(filepath.ToSlash(entry.Path())) {
+			continue
+		}
+		file := FileEntry{Path: entry.Path(), Mode: entry.Mode(), OID: entry.OID(), Stage: entry.Stage(), Tracked: true}
+		_, err := r.repo.Workspace.StatFile(entry.Path())
+		if missing := os.IsNotExist(err); missing {
+			if options.Deleted {
+				files = append(files, file)
+			}
+			if options.Modified {
+				files = append(files, file)
+			}
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if !options.Modified {
+			continue
+		}
+		modified, err := r.workspaceModified(entry)
+		if err != nil {
+			return nil, err
+		}
+		if modified {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,292 @@
+package jit
+
+import (
+	"context"
+	"os"
+	"sort"
+
+	"github.com/tpbowden/jit/database"
+	"github.com/tpbowden/jit/diff"
+)
+
+// mergeOutcome is how a three-way merge leaves one path. A clean merge has
+// the resulting entry, or none if the path is deleted; a conflict keeps the
+// base, our and their versions, any of which may be missing, along with the
+// contents to leave in the working tree.
+type mergeOutcome struct {
+	entry    *database.TreeEntry
+	conflict bool
+	stages   [3]*database.TreeEntry
+	data     []byte
+}
+
+func sameEntry(a, b *database.TreeEntry) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.OID() == b.OID() && a.Mode() == b.Mode()
+}
+
+func lookupEntry(entries map[string]database.TreeEntry, path string) *database.TreeEntry {
+	if entry, exists := entries[path]; exists {
+		return &entry
+	}
+	return nil
+}
+
+func entryPaths(entries map[string]database.TreeEntry) map[string]string {
+	oids := map[string]string{}
+	for path, entry := range entries {
+		oids[path] = entry.OID()
+	}
+	return oids
+}
+
+// moveEntry returns a copy of entries with the entry at from moved to to.
+func moveEntry(entries map[string]database.TreeEntry, from, to string) map[string]database.TreeEntry {
+	moved := map[string]database.TreeEntry{}
+	for path, entry := range entries {
+		if path != from {
+			moved[path] = entry
+		}
+	}
+	if entry, exists := entries[from]; exists {
+		moved[to] = database.NewTreeEntry(to, entry.OID(), entry.Mode())
+	}
+	return moved
+}
+
+// mergeTrees merges the changes theirs made to base into ours, returning the
+// outcome for every path where the result differs from ours. Files both sides
+// changed are merged line by line, with conflict markers naming the sides by
+// the labels given. Files either side renamed are merged under their new
+// name, so changes the other side made to them follow the rename, unless
+// merge.renames, or failing that diff.renames, turns rename detection off.
+func (r *Repository) mergeTrees(ctx context.Context, base, ours, theirs map[string]database.TreeEntry, oursLabel, theirsLabel string) (map[string]mergeOutcome, error) {
+	options, err := r.renameOptions("merge.renames", "diff.renames")
+	if err != nil {
+		return nil, err
+	}
+	ourRenames, theirRenames := []Rename{}, []Rename{}
+	if options != nil {
+		options.Copies = false
+		finder := r.newRenameFinder(*options)
+		if ourRenames, err = finder.find(entryPaths(base), entryPaths(ours)); err != nil {
+			return nil, err
+		}
+		if theirRenames, err = finder.find(entryPaths(base), entryPaths(theirs)); err != nil {
+			return nil, err
+		}
+	}
+
+	realOurs, moved := ours, map[string]string{}
+	renamedByUs := map[string]string{}
+	for _, rename := range ourRenames {
+		renamedByUs[rename.From] = rename.To
+	}
+	for _, rename := range theirRenames {
+		if to, renamed := renamedByUs[rename.From]; renamed {
+			if to == rename.To {
+				base = moveEntry(base, rename.From, rename.To)
+			}
+			delete(renamedByUs, rename.From)
+			continue
+		}
+		if _, exists := ours[rename.From]; !exists || lookupEntry(ours, rename.To) != nil {
+			continue
+		}
+		base = moveEntry(base, rename.From, rename.To)
+		ours = moveEntry(ours, rename.From, rename.To)
+		moved[rename.From] = rename.To
+	}
+	for from, to := range renamedByUs {
+		if _, exists := theirs[from]; !exists || lookupEntry(theirs, to) != nil {
+			continue
+		}
+		base = moveEntry(base, from, to)
+		theirs = moveEntry(theirs, from, to)
+	}
+
+	outcomes, err := r.mergeEntries(ctx, base, ours, theirs, oursLabel, theirsLabel)
+	if err != nil {
+		return nil, err
+	}
+	for from, to := range moved {
+		if _, changed := outcomes[from]; !changed {
+			outcomes[from] = mergeOutcome{}
+		}
+		if _, changed := outcomes[to]; !changed && lookupEntry(realOurs, to) == nil {
+			outcomes[to] = mergeOutcome{entry: lookupEntry(ours, to)}
+		}
+	}
+	return outcomes, nil
+}
+
+func (r *Repository) mergeEntries(ctx context.Context, base, ours, theirs map[string]database.TreeEntry, oursLabel, theirsLabel string) (map[string]mergeOutcome, error) {
+	paths := map[string]bool{}
+	for _, entries := range []map[string]database.TreeEntry{base, ours, theirs} {
+		for path := range entries {
+			paths[path] = true
+		}
+	}
+
+	outcomes := map[string]mergeOutcome{}
+	for path := range paths {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		b, o, t := lookupEntry(base, path), lookupEntry(ours, path), lookupEntry(theirs, path)
+		switch {
+		case sameEntry(o, t), sameEntry(b, t):
+			continue
+		case sameEntry(b, o):
+			outcomes[path] = mergeOutcome{entry: t}
+			continue
+		}
+
+		outcome, err := r.mergeFile(path, b, o, t, oursLabel, theirsLabel)
+		if err != nil {
+			return nil, err
+		}
+		outcomes[path] = outcome
+	}
+	return outcomes, nil
+}
+
+// mergeFile merges a path both sides changed. A file one side deleted and the
+// other modified is a conflict, leaving the modified version in place.
+func (r *Repository) mergeFile(path string, base, ours, theirs *database.TreeEntry, oursLabel, theirsLabel string) (mergeOutcome, error) {
+	conflict := mergeOutcome{conflict: true, stages: [3]*database.TreeEntry{base, ours, theirs}}
+	if ours == nil || theirs == nil {
+		survivor := ours
+		if survivor == nil {
+			survivor = theirs
+		}
+		_, data, err := r.repo.Database.ReadObject(survivor.OID())
+		conflict.data = data
+		return conflict, err
+	}
+
+	contents := [3]string{}
+	for i, entry := range conflict.stages {
+		if entry == nil {
+			continue
+		}
+		_, data, err := r.repo.Database.ReadObject(entry.OID())
+		if err != nil {
+			return mergeOutcome{}, err
+		}
+		contents[i] = string(data)
+	}
+	result := diff.Merge(contents[0], contents[1], contents[2], oursLabel, theirsLabel)
+	if !result.Clean() {
+		conflict.data = []byte(result.Text)
+		return conflict, nil
+	}
+
+	mode := ours.Mode()
+	if base != nil && base.Mode() == ours.Mode() {
+		mode = theirs.Mode()
+	}
+	blob := database.NewBlob([]byte(result.Text))
+	if err := r.repo.Database.Store(blob); err != nil {
+		return mergeOutcome{}, err
+	}
+	entry := database.NewTreeEntry(path, database.ObjectID(blob), mode)
+	return mergeOutcome{entry: &entry}, nil
+}
+
+// checkMergeTargets refuses a merge that would overwrite uncommitted changes
+// to a tracked file, or an untracked file, at any of the paths it changes.
+func (r *Repository) checkMergeTargets(outcomes map[string]mergeOutcome) error {
+	paths := []string{}
+	for path := range outcomes {
+		entry, tracked := r.repo.Index.Entry(path)
+		_, err := r.repo.Workspace.StatFile(path)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if !tracked {
+			paths = append(paths, path)
+			continue
+		}
+		modified, err := r.workspaceModified(entry)
+		if err != nil {
+			return err
+		}
+		if modified {
+			paths = append(paths, path)
+		}
+	}
+	if len(paths) > 0 {
+		sort.Strings(paths)
+		return localChanges(paths)
+	}
+	return nil
+}
+
+// writeMerge updates the working tree and index with the outcome of a merge,
+// recording conflicts as unmerged stages in the index.
+func (r *Repository) writeMerge(ctx context.Context, outcomes map[string]mergeOutcome) error {
+	paths := []string{}
+	for path := range outcomes {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		outcome := outcomes[path]
+		switch {
+		case outcome.conflict:
+			oids, modes := [3]string{}, [3]int32{}
+			for i, entry := range outcome.stages {
+				if entry != nil {
+					oids[i], modes[i] = entry.OID(), entry.Mode()
+				}
+			}
+			mode := modes[1]
+			if mode == 0 {
+				mode = modes[2]
+			}
+			if err := r.repo.Workspace.WriteBlob(path, outcome.data, mode); err != nil {
+				return err
+			}
+			r.repo.Index.AddConflict(path, oids, modes)
+		case outcome.entry == nil:
+			if err := r.repo.Workspace.RemoveFile(path); err != nil {
+				return err
+			}
+			r.repo.Index.Remove(path)
+		default:
+			// Files already skipped by a sparse checkout stay out of the
+			// working tree, but others are written so no changes are lost.
+			if current, tracked := r.repo.Index.Entry(path); tracked && current.SkipWorktree() {
+				if skipped, err := r.skipSparse(path, *outcome.entry); err != nil {
+					return err
+				} else if skipped {
+					continue
+				}
+			}
+			_, data, err := r.repo.Database.ReadObject(outcome.entry.OID())
+			if err != nil {
+				return err
+			}
+			if err := r.repo.Workspace.WriteBlob(path, data, outcome.entry.Mode()); err != nil {
+				return err
+			}
+			stat, err := r.repo.Workspace.StatFile(path)
+			if err != nil {
+				return err
+			}
+			if err := r.repo.Index.Add(path, outcome.entry.OID(), stat); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package jit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tpbowden/jit/index"
+)
+
+type MoveOptions struct {
+	// Sources are the tracked files or directories to move, and Destination
+	// where they go. With more than one source the destination must be an
+	// existing directory, which a single source is moved into too. Paths are
+	// relative to the top of the working tree, and absolute paths inside it
+	// are accepted too.
+	Sources     []string
+	Destination string
+	// Force overwrites a file already at the destination.
+	Force bool
+}
+
+// Move renames files in the working tree and the index together. It fails
+// with an InvalidMove if a source is not tracked or the destination exists.
+func (r *Repository) Move(ctx context.Context, options MoveOptions) error {
+	if err := r.repo.Index.LoadForUpdate(); err != nil {
+		return err
+	}
+	if err := r.move(ctx, options); err != nil {
+		r.repo.Index.ReleaseLock()
+		return err
+	}
+	return r.repo.Index.WriteUpdates()
+}
+
+func (r *Repository) move(ctx context.Context, options MoveOptions) error {
+	paths := []string{}
+	for _, arg := range append(options.Sources, options.Destination) {
+		path, err := r.relativePath(arg)
+		if err != nil || path == ".." || strings.HasPrefix(path, ".."+string(filepath.Separator)) {
+			return &PathOutside{arg}
+		}
+		paths = append(paths, path)
+	}
+	sources, destination := paths[:len(paths)-1], paths[len(paths)-1]
+
+	stat, err := os.Stat(filepath.Join(r.dir, destination))
+	intoDirectory := err == nil && stat.IsDir()
+	if len(sources) > 1 && !intoDirectory {
+		return &NotDirectory{destination}
+	}
+
+	for _, source := range sources {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		target := destination
+		if intoDirectory {
+			target = filepath.Join(destination, filepath.Base(source))
+		}
+		if err := r.moveEntries(source, target, options.Force); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Repository) moveEntries(source, target string, force bool) error {
+	entries := r.repo.Index.EntriesUnder(source)
+	entry, tracked := r.repo.Index.Entry(source)
+	if tracked {
+		entries = []index.IndexEntry{entry}
+	}
+	if len(entries) == 0 {
+		return &InvalidMove{"not under version control", source, target}
+	}
+	if insidePath(target, source) {
+		return &InvalidMove{"can not move directory into itself", source, target}
+	}
+
+	if _, err := os.Lstat(filepath.Join(r.dir, target)); err == nil {
+		if !force || !tracked {
+			return &InvalidMove{"destination exists", source, target}
+		}
+		if err := os.Remove(filepath.Join(r.dir, target)); err != nil {
+			return err
+		}
+	}
+
+	// Files with local modifications are staged without stat data, so that
+	// the modifications still show once they have moved.
+	modified := map[string]bool{}
+	for _, entry := range entries {
+		var err error
+		if modified[entry.Path()], err = r.workspaceModified(entry); err != nil {
+			return err
+		}
+	}
+	if err := r.repo.Workspace.MoveFile(source, target); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		rel, err := filepath.Rel(source, entry.Path())
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(target, rel)
+		r.repo.Index.Remove(entry.Path())
+		if modified[entry.Path()] {
+			r.repo.Index.AddFromDatabase(path, entry.OID(), entry.Mode())
+			continue
+		}
+		stat, err := r.repo.Workspace.StatFile(path)
+		if err != nil {
+			return err
+		}
+		if err := r.repo.Index.Add(path, entry.OID(), stat); err != nil {
+			return err
+		}
+	}
+	return nil
+}
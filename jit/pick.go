@@ -0,0 +1,412 @@
+package jit
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tpbowden/jit/core"
+	"github.com/tpbowden/jit/database"
+)
+
+type SequenceOptions struct {
+	// Revisions name the commits to apply, each either a single revision or
+	// a range written "from..to", which takes the commits reachable from to
+	// but not from from, oldest first.
+	Revisions []string
+	// Mainline is the parent, counting from 1, whose changes are applied
+	// when the commit is a merge.
+	Mainline int
+}
+
+// SequenceResult lists the commits a cherry-pick or revert created. When a
+// step stops, Stopped is the commit it was applying and Conflicts lists the
+// paths left unmerged; a step that stops without conflicts would have made
+// an empty commit. The state is saved so the sequence can be continued,
+// skipped past or aborted.
+type SequenceResult struct {
+	Commits   []CommitResult
+	Stopped   *CommitInfo
+	Conflicts []string
+}
+
+// CherryPick applies the changes each commit introduced on top of HEAD,
+// committing each in turn with the original author and message.
+func (r *Repository) CherryPick(ctx context.Context, options SequenceOptions) (*SequenceResult, error) {
+	return r.startSequence(ctx, "pick", options)
+}
+
+// Revert applies the reverse of the changes each commit introduced, making
+// a new commit for each.
+func (r *Repository) Revert(ctx context.Context, options SequenceOptions) (*SequenceResult, error) {
+	return r.startSequence(ctx, "revert", options)
+}
+
+func (r *Repository) startSequence(ctx context.Context, action string, options SequenceOptions) (*SequenceResult, error) {
+	if seq, err := r.loadSequence(); err != nil {
+		return nil, err
+	} else if seq != nil {
+		return nil, &SequenceInProgress{}
+	}
+	if pickHead, _, err := r.readPickHead(); err != nil {
+		return nil, err
+	} else if pickHead != "" {
+		return nil, &SequenceInProgress{}
+	}
+
+	head, err := r.repo.Refs.ReadHead()
+	if err != nil {
+		return nil, err
+	}
+	seq := &sequence{head: head, mainline: options.Mainline}
+	for _, revision := range options.Revisions {
+		oids, err := r.resolveRange(revision)
+		if err != nil {
+			return nil, err
+		}
+		if action == "revert" {
+			for i, j := 0, len(oids)-1; i < j; i, j = i+1, j-1 {
+				oids[i], oids[j] = oids[j], oids[i]
+			}
+		}
+		for _, oid := range oids {
+			commit, err := r.loadCommit(oid)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := pickParent(oid, commit, options.Mainline); err != nil {
+				return nil, err
+			}
+			subject := strings.Split(commit.Message, "\n")[0]
+			seq.steps = append(seq.steps, sequenceStep{action: action, oid: oid, subject: subject})
+		}
+	}
+	return r.runSequence(ctx, seq, &SequenceResult{})
+}
+
+// resolveRange resolves a single revision, or a range "from..to" with either
+// side defaulting to HEAD, oldest commit first.
+func (r *Repository) resolveRange(revision string) ([]string, error) {
+	parts := strings.SplitN(revision, "..", 2)
+	if len(parts) == 1 {
+		oid, err := r.repo.ResolveRevision(revision)
+		return []string{oid}, err
+	}
+	for i, part := range parts {
+		if part == "" {
+			parts[i] = "HEAD"
+		}
+	}
+	exclude, err := r.repo.ResolveRevision(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	include, err := r.repo.ResolveRevision(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	return r.repo.CommitRange(exclude, include)
+}
+
+func (r *Repository) loadCommit(oid string) (database.Commit, error) {
+	object, err := r.repo.Database.Load(oid)
+	if err != nil {
+		return database.Commit{}, err
+	}
+	return object.(database.Commit), nil
+}
+
+// pickParent returns the parent a commit's changes are taken relative to,
+// which is empty for a root commit.
+func pickParent(oid string, commit database.Commit, mainline int) (string, error) {
+	switch {
+	case len(commit.Parents) > 1 && mainline == 0:
+		return "", &MergeWithoutMainline{OID: oid}
+	case len(commit.Parents) <= 1 && mainline != 0:
+		return "", &InvalidMainline{OID: oid, Mainline: mainline}
+	case mainline > len(commit.Parents) || mainline < 0:
+		return "", &InvalidMainline{OID: oid, Mainline: mainline}
+	case mainline > 0:
+		return commit.Parents[mainline-1], nil
+	case len(commit.Parents) == 1:
+		return commit.Parents[0], nil
+	}
+	return "", nil
+}
+
+// runSequence applies the remaining steps, saving the state and stopping at
+// the first that conflicts or would make an empty commit.
+func (r *Repository) runSequence(ctx context.Context, seq *sequence, result *SequenceResult) (*SequenceResult, error) {
+	for len(seq.steps) > 0 {
+		step := seq.steps[0]
+		commit, conflicts, err := r.applyStep(ctx, seq, step)
+		if err != nil {
+			return nil, err
+		}
+		if commit == nil {
+			stopped, err := r.loadCommit(step.oid)
+			if err != nil {
+				return nil, err
+			}
+			info := commitInfo(step.oid, stopped)
+			result.Stopped, result.Conflicts = &info, conflicts
+			return result, r.saveSequence(seq)
+		}
+		result.Commits = append(result.Commits, *commit)
+		seq.steps = seq.steps[1:]
+	}
+	return result, r.clearSequence()
+}
+
+// applyStep merges one commit's changes into HEAD and commits them. If the
+// merge conflicts, or the changes are already present, it returns no commit
+// and leaves the message and the commit being applied for a later commit.
+func (r *Repository) applyStep(ctx context.Context, seq *sequence, step sequenceStep) (*CommitResult, []string, error) {
+	commit, err := r.loadCommit(step.oid)
+	if err != nil {
+		return nil, nil, err
+	}
+	parent, err := pickParent(step.oid, commit, seq.mainline)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	message, options := commit.Message, CommitOptions{}
+	action, ref := "cherry-pick", cherryPickHead
+	author := signature(commit.Author, commit.Timestamp)
+	options.Author = &author
+	if step.action == "revert" {
+		message = "Revert \"" + step.subject + "\"\n\nThis reverts commit " + step.oid
+		if seq.mainline > 0 {
+			message += ", reversing\nchanges made to " + parent
+		}
+		message += ".\n"
+		options.Author = nil
+		action, ref = "revert", revertHead
+	}
+	options.Message = message
+
+	conflicts, err := r.applyChanges(ctx, step, parent)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(conflicts) == 0 {
+		result, err := r.commit(ctx, options, action)
+		if _, empty := err.(*NothingToCommit); !empty {
+			return result, nil, err
+		}
+	}
+	if err := r.repo.Refs.UpdateRef(ref, step.oid); err != nil {
+		return nil, nil, err
+	}
+	return nil, conflicts, ioutil.WriteFile(r.gitPath("MERGE_MSG"), []byte(message), 0644)
+}
+
+// applyChanges merges the changes a step's commit made relative to parent
+// into HEAD, or their reverse for a revert, returning the conflicted paths.
+func (r *Repository) applyChanges(ctx context.Context, step sequenceStep, parent string) ([]string, error) {
+	base, err := r.treeEntries(parent)
+	if err != nil {
+		return nil, err
+	}
+	theirs, err := r.treeEntries(step.oid)
+	if err != nil {
+		return nil, err
+	}
+	label := step.oid[0:7] + " (" + step.subject + ")"
+	if step.action == "revert" {
+		base, theirs = theirs, base
+		label = "parent of " + label
+	}
+
+	if err := r.repo.Index.LoadForUpdate(); err != nil {
+		return nil, err
+	}
+	conflicts, err := r.mergeStep(ctx, step, base, theirs, label)
+	if err != nil {
+		r.repo.Index.ReleaseLock()
+		return nil, err
+	}
+	return conflicts, r.repo.Index.WriteUpdates()
+}
+
+// mergeStep merges base to theirs into HEAD, in the working tree and the
+// index, returning the conflicted paths. The index must match HEAD.
+func (r *Repository) mergeStep(ctx context.Context, step sequenceStep, base, theirs map[string]database.TreeEntry, label string) ([]string, error) {
+	if paths := r.repo.Index.ConflictPaths(); len(paths) > 0 {
+		return nil, unmergedPaths(paths)
+	}
+	head, err := r.repo.Refs.ReadHead()
+	if err != nil {
+		return nil, err
+	}
+	clean, err := r.indexMatches(head)
+	if err != nil {
+		return nil, err
+	}
+	if !clean {
+		return nil, &DirtyIndex{Action: step.action}
+	}
+	ours, err := r.treeEntries(head)
+	if err != nil {
+		return nil, err
+	}
+
+	outcomes, err := r.mergeTrees(ctx, base, ours, theirs, "HEAD", label)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.checkMergeTargets(outcomes); err != nil {
+		return nil, err
+	}
+	if err := r.writeMerge(ctx, outcomes); err != nil {
+		return nil, err
+	}
+
+	conflicts := []string{}
+	for path, outcome := range outcomes {
+		if outcome.conflict {
+			conflicts = append(conflicts, path)
+		}
+	}
+	sort.Strings(conflicts)
+	return conflicts, nil
+}
+
+// indexMatches reports whether the staged entries of the loaded index are
+// exactly those of a commit's tree.
+func (r *Repository) indexMatches(oid string) (bool, error) {
+	entries, err := r.treeEntries(oid)
+	if err != nil {
+		return false, err
+	}
+	staged := r.indexTreeEntries()
+	if len(staged) != len(entries) {
+		return false, nil
+	}
+	for _, entry := range staged {
+		other, exists := entries[entry.Path()]
+		if !exists || other.OID() != entry.OID() || other.Mode() != entry.Mode() {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// SequenceContinue commits the resolution of the step that stopped, unless
+// it has already been committed, and carries on with the remaining steps.
+func (r *Repository) SequenceContinue(ctx context.Context) (*SequenceResult, error) {
+	seq, err := r.loadSequence()
+	if err != nil {
+		return nil, err
+	} else if seq == nil || len(seq.steps) == 0 {
+		return nil, &NoSequence{}
+	}
+
+	result := &SequenceResult{}
+	pickHead, ref, err := r.readPickHead()
+	if err != nil {
+		return nil, err
+	}
+	if pickHead != "" {
+		message, err := ioutil.ReadFile(r.gitPath("MERGE_MSG"))
+		if err != nil {
+			return nil, err
+		}
+		options := CommitOptions{Message: string(message)}
+		action := "revert"
+		if ref == cherryPickHead {
+			commit, err := r.loadCommit(pickHead)
+			if err != nil {
+				return nil, err
+			}
+			author := signature(commit.Author, commit.Timestamp)
+			options.Author, action = &author, "cherry-pick"
+		}
+		commit, err := r.commit(ctx, options, action)
+		if err != nil {
+			return nil, err
+		}
+		result.Commits = append(result.Commits, *commit)
+	}
+	if err := os.Remove(r.gitPath("MERGE_MSG")); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	seq.steps = seq.steps[1:]
+	return r.runSequence(ctx, seq, result)
+}
+
+// SequenceSkip discards the changes of the step that stopped and carries on
+// with the remaining steps.
+func (r *Repository) SequenceSkip(ctx context.Context) (*SequenceResult, error) {
+	seq, err := r.loadSequence()
+	if err != nil {
+		return nil, err
+	} else if seq == nil || len(seq.steps) == 0 {
+		return nil, &NoSequence{}
+	}
+
+	head, err := r.repo.Refs.ReadHead()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.resetHard(ctx, head); err != nil {
+		return nil, err
+	}
+	if err := r.clearPickHead(); err != nil {
+		return nil, err
+	}
+	seq.steps = seq.steps[1:]
+	return r.runSequence(ctx, seq, &SequenceResult{})
+}
+
+// SequenceAbort discards the sequence, returning HEAD, the index and the
+// working tree to where they were before it started. A branch that was
+// unborn when the sequence started is deleted, leaving it unborn again.
+func (r *Repository) SequenceAbort(ctx context.Context) error {
+	seq, err := r.loadSequence()
+	if err != nil {
+		return err
+	} else if seq == nil {
+		return &NoSequence{}
+	}
+
+	head, err := r.repo.Refs.ReadHead()
+	if err != nil {
+		return err
+	}
+	if err := r.resetHard(ctx, seq.head); err != nil {
+		return err
+	}
+	if head != "" && seq.head == "" {
+		ref, err := r.repo.Refs.CurrentRef()
+		if err != nil {
+			return err
+		}
+		if ref != "HEAD" {
+			if err := r.repo.Refs.DeleteRef(ref); err != nil {
+				return err
+			}
+		}
+	} else if head != seq.head {
+		if err := r.repo.Refs.UpdateHead(seq.head); err != nil {
+			return err
+		}
+		identity := r.identity.at(time.Now())
+		err = r.repo.Refs.RecordHeadUpdate(core.ReflogEntry{
+			OldOID:   head,
+			NewOID:   seq.head,
+			Identity: identity.author().Format(identity.When),
+			Message:  "reset: moving to " + seq.head,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return r.clearSequence()
+}
@@ -0,0 +1,174 @@
+package jit_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tpbowden/jit/jit"
+)
+
+func TestCherryPickRange(t *testing.T) {
+	repo, cleanup := setup(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	writeFile(t, repo, "a.txt", "one\ntwo\nthree\n")
+	commit(t, repo, "first\n")
+	if _, err := repo.Checkout(ctx, headOID(t, repo, "HEAD")); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, repo, "a.txt", "ONE\ntwo\nthree\n")
+	second := commit(t, repo, "second\n")
+	writeFile(t, repo, "b.txt", "new\n")
+	third := commit(t, repo, "third\n")
+
+	if _, err := repo.Checkout(ctx, "master"); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, repo, "a.txt", "one\ntwo\nTHREE\n")
+	commit(t, repo, "fourth\n")
+
+	result, err := repo.CherryPick(ctx, jit.SequenceOptions{Revisions: []string{second.OID + "~1.." + third.OID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Commits) != 2 || result.Stopped != nil {
+		t.Fatalf("Unexpected result %+v", result)
+	}
+	if contents := readFile(t, repo, "a.txt"); contents != "ONE\ntwo\nTHREE\n" {
+		t.Fatalf("Unexpected contents %q", contents)
+	}
+	commits, err := repo.Log(ctx, jit.LogOptions{MaxCount: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if commits[0].Summary() != "third" || commits[1].Summary() != "second" {
+		t.Fatalf("Unexpected history %v", commits)
+	}
+}
+
+func TestRevertStopsOnConflictAndContinues(t *testing.T) {
+	repo, cleanup := setup(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	writeFile(t, repo, "a.txt", "one\n")
+	commit(t, repo, "first\n")
+	writeFile(t, repo, "a.txt", "two\n")
+	second := commit(t, repo, "second\n")
+	writeFile(t, repo, "a.txt", "three\n")
+	commit(t, repo, "third\n")
+
+	result, err := repo.Revert(ctx, jit.SequenceOptions{Revisions: []string{second.OID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Stopped == nil || result.Stopped.OID != second.OID || len(result.Conflicts) != 1 {
+		t.Fatalf("Expected the revert to stop, got %+v", result)
+	}
+	if _, err := repo.Revert(ctx, jit.SequenceOptions{Revisions: []string{"HEAD"}}); err == nil {
+		t.Fatal("Expected an error")
+	} else if _, ok := err.(*jit.SequenceInProgress); !ok {
+		t.Fatalf("Expected SequenceInProgress, got %v", err)
+	}
+
+	writeFile(t, repo, "a.txt", "one\n")
+	if err := repo.Add(ctx, "a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	result, err = repo.SequenceContinue(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Commits) != 1 || result.Commits[0].Summary() != `Revert "second"` {
+		t.Fatalf("Unexpected result %+v", result)
+	}
+	if _, err := repo.SequenceContinue(ctx); err == nil {
+		t.Fatal("Expected an error")
+	} else if _, ok := err.(*jit.NoSequence); !ok {
+		t.Fatalf("Expected NoSequence, got %v", err)
+	}
+}
+
+func TestCherryPickAbortRestoresHead(t *testing.T) {
+	repo, cleanup := setup(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	writeFile(t, repo, "a.txt", "one\n")
+	commit(t, repo, "first\n")
+	writeFile(t, repo, "a.txt", "two\n")
+	writeFile(t, repo, "b.txt", "two\n")
+	second := commit(t, repo, "second\n")
+	writeFile(t, repo, "a.txt", "three\n")
+	third := commit(t, repo, "third\n")
+	if _, err := repo.Checkout(ctx, second.OID+"~1"); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, repo, "a.txt", "other\n")
+	commit(t, repo, "other\n")
+	head := headOID(t, repo, "HEAD")
+
+	result, err := repo.CherryPick(ctx, jit.SequenceOptions{Revisions: []string{second.OID, third.OID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Commits) != 0 || result.Stopped == nil || result.Stopped.OID != second.OID {
+		t.Fatalf("Expected the first pick to stop, got %+v", result)
+	}
+	if err := repo.SequenceAbort(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if status := porcelain(t, repo); len(status) != 0 {
+		t.Fatalf("Expected a clean tree, got %v", status)
+	}
+	if contents := readFile(t, repo, "a.txt"); contents != "other\n" {
+		t.Fatalf("Unexpected contents %q", contents)
+	}
+	if headOID(t, repo, "HEAD") != head {
+		t.Fatal("Expected HEAD to be restored")
+	}
+}
+
+func TestCherryPickAbortOnAnUnbornBranch(t *testing.T) {
+	repo, cleanup := setup(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	writeFile(t, repo, "a.txt", "one\n")
+	first := commit(t, repo, "first\n")
+	writeFile(t, repo, "a.txt", "two\n")
+	commit(t, repo, "second\n")
+	writeFile(t, repo, "a.txt", "three\n")
+	third := commit(t, repo, "third\n")
+
+	gitDir := filepath.Join(repo.Dir(), ".git")
+	if err := ioutil.WriteFile(filepath.Join(gitDir, "HEAD"), []byte("ref: refs/heads/orphan\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(filepath.Join(gitDir, "index"))
+	os.Remove(filepath.Join(repo.Dir(), "a.txt"))
+
+	result, err := repo.CherryPick(ctx, jit.SequenceOptions{Revisions: []string{first.OID, third.OID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Commits) != 1 || result.Stopped == nil || result.Stopped.OID != third.OID {
+		t.Fatalf("Expected the second pick to stop, got %+v", result)
+	}
+	if err := repo.SequenceAbort(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(gitDir, "refs", "heads", "orphan")); !os.IsNotExist(err) {
+		t.Fatalf("Expected the branch to be unborn again, got %v", err)
+	}
+	if status := porcelain(t, repo); len(status) != 0 {
+		t.Fatalf("Expected a clean tree, got %v", status)
+	}
+	if _, err := os.Stat(filepath.Join(repo.Dir(), "a.txt")); !os.IsNotExist(err) {
+		t.Fatal("Expected the picked file to be removed")
+	}
+}
@@ -0,0 +1,534 @@
+package jit
+
+import (
+	"context"
+	"io/ioutil"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tpbowden/jit/core"
+)
+
+type RebaseOptions struct {
+	// Upstream is the revision the current branch is rebased on. Commits
+	// reachable from it are not replayed.
+	Upstream string
+	// Onto is where the commits are replayed, Upstream if empty.
+	Onto string
+	// Interactive passes the todo list through EditTodo before starting.
+	Interactive bool
+	RebaseHooks
+}
+
+// RebaseHooks are called while a rebase runs, so must be given again to
+// continue or skip.
+type RebaseHooks struct {
+	// EditTodo is called with the proposed todo list of an interactive
+	// rebase, commented with instructions, and returns the list to run.
+	EditTodo func(ctx context.Context, todo string) (string, error)
+	// EditMessage, if set, is called with the message of each commit that is
+	// reworded or squashed, and returns the message to use.
+	EditMessage func(ctx context.Context, message string) (string, error)
+	// Exec runs the command of an exec step. It defaults to running it with
+	// sh -c from the top of the working tree, without input or output.
+	Exec func(ctx context.Context, command string) error
+}
+
+// RebaseResult lists the commits a rebase made. When it stops, Stopped is
+// the commit it was replaying: Conflicts lists the paths left unmerged, or
+// Edit is set if an edit step stopped to let it be amended. FailedExec is
+// the command of an exec step that failed. Otherwise the rebase finished,
+// and the branch it was started on, if any, has been moved to the result.
+type RebaseResult struct {
+	Branch     string
+	Onto       string
+	Commits    []CommitResult
+	Stopped    *CommitInfo
+	Conflicts  []string
+	Edit       bool
+	FailedExec string
+}
+
+// Finished reports whether the rebase ran to completion.
+func (r RebaseResult) Finished() bool {
+	return r.Stopped == nil && r.FailedExec == ""
+}
+
+// Rebase replays the commits on HEAD that are not reachable from an upstream
+// on to a new base, oldest first, using the same machinery as cherry-pick.
+// Merge commits are left out. HEAD is detached while the rebase runs, and the
+// state is saved under .git/rebase-merge after every step, so a rebase
+// stopped by a conflict or an edit can be carried on by a later process.
+func (r *Repository) Rebase(ctx context.Context, options RebaseOptions) (*RebaseResult, error) {
+	if state, err := r.loadRebase(); err != nil {
+		return nil, err
+	} else if state != nil {
+		return nil, &RebaseInProgress{}
+	}
+
+	head, err := r.repo.ResolveRevision("HEAD")
+	if err != nil {
+		return nil, err
+	}
+	upstream, err := r.repo.ResolveRevision(options.Upstream)
+	if err != nil {
+		return nil, err
+	}
+	ontoName, onto := options.Upstream, upstream
+	if options.Onto != "" {
+		ontoName = options.Onto
+		if onto, err = r.repo.ResolveRevision(options.Onto); err != nil {
+			return nil, err
+		}
+	}
+	status, err := r.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(status.Entries) > 0 || len(status.Conflicts) > 0 {
+		return nil, &UncommittedChanges{}
+	}
+
+	ref, err := r.repo.Refs.CurrentRef()
+	if err != nil {
+		return nil, err
+	}
+	state := &rebaseState{headName: ref, onto: onto, origHead: head, interactive: options.Interactive}
+	if ref == "HEAD" {
+		state.headName = detachedHeadName
+	}
+
+	oids, err := r.repo.CommitRange(upstream, head)
+	if err != nil {
+		return nil, err
+	}
+	for _, oid := range oids {
+		commit, err := r.loadCommit(oid)
+		if err != nil {
+			return nil, err
+		}
+		if len(commit.Parents) > 1 {
+			continue
+		}
+		subject := strings.Split(commit.Message, "\n")[0]
+		state.todo = append(state.todo, sequenceStep{action: "pick", oid: oid, subject: subject})
+	}
+
+	if options.Interactive && options.EditTodo != nil {
+		if state.todo, err = r.editTodo(ctx, state, upstream, options.EditTodo); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := r.repo.Index.LoadForUpdate(); err != nil {
+		return nil, err
+	}
+	if err := r.migrate(ctx, head, onto); err != nil {
+		r.repo.Index.ReleaseLock()
+		return nil, err
+	}
+	if err := r.repo.Index.WriteUpdates(); err != nil {
+		return nil, err
+	}
+	if err := r.moveHead(head, onto, "rebase (start): checkout "+ontoName); err != nil {
+		return nil, err
+	}
+	if err := r.saveRebase(state); err != nil {
+		return nil, err
+	}
+	return r.runRebase(ctx, state, options.RebaseHooks, &RebaseResult{})
+}
+
+// editTodo passes the todo list through the editor hook and reads back the
+// steps to run, aborting the rebase if there are none.
+func (r *Repository) editTodo(ctx context.Context, state *rebaseState, upstream string, edit func(context.Context, string) (string, error)) ([]sequenceStep, error) {
+	count := "1 command"
+	if len(state.todo) != 1 {
+		count = strconv.Itoa(len(state.todo)) + " commands"
+	}
+	todo := formatTodo(state.todo, true)
+	if len(state.todo) == 0 {
+		todo = "noop\n"
+	}
+	todo += "\n# Rebase " + upstream[0:7] + ".." + state.origHead[0:7] + " onto " + state.onto[0:7] + " (" + count + ")\n" + todoHelp
+
+	steps, err := r.readEditedTodo(ctx, todo, edit)
+	if err != nil {
+		if clearErr := r.clearRebase(); clearErr != nil {
+			return nil, clearErr
+		}
+		return nil, err
+	}
+	return steps, nil
+}
+
+func (r *Repository) readEditedTodo(ctx context.Context, todo string, edit func(context.Context, string) (string, error)) ([]sequenceStep, error) {
+	edited, err := edit(ctx, todo)
+	if err != nil {
+		return nil, err
+	}
+	steps, err := r.parseTodo(strings.Replace(edited, "noop\n", "", 1))
+	if err != nil {
+		return nil, err
+	}
+	if len(steps) == 0 {
+		return nil, &EmptyTodo{}
+	}
+	return steps, checkTodo(steps)
+}
+
+// moveHead detaches HEAD at a commit, logging the move.
+func (r *Repository) moveHead(from, to, message string) error {
+	if err := r.repo.Refs.UpdateRef("HEAD", to); err != nil {
+		return err
+	}
+	identity := r.identity.at(time.Now())
+	return r.repo.Refs.AppendReflog("HEAD", core.ReflogEntry{
+		OldOID:   from,
+		NewOID:   to,
+		Identity: identity.author().Format(identity.When),
+		Message:  message,
+	})
+}
+
+// runRebase runs the remaining steps, moving each to the done list before it
+// runs, and finishes the rebase once none are left. A step refused because it
+// would overwrite local changes goes back on the todo list to be retried.
+func (r *Repository) runRebase(ctx context.Context, state *rebaseState, hooks RebaseHooks, result *RebaseResult) (*RebaseResult, error) {
+	result.Branch, result.Onto = state.branch(), state.onto
+	for len(state.todo) > 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		step := state.todo[0]
+		state.todo, state.done = state.todo[1:], append(state.done, step)
+		if err := r.saveRebase(state); err != nil {
+			return nil, err
+		}
+		stopped, err := r.rebaseStep(ctx, step, hooks, result)
+		switch err.(type) {
+		case nil:
+		case *CheckoutConflict, *LocalChanges, *DirtyIndex:
+			state.todo, state.done = append([]sequenceStep{step}, state.todo...), state.done[:len(state.done)-1]
+			if saveErr := r.saveRebase(state); saveErr != nil {
+				return nil, saveErr
+			}
+			return nil, err
+		default:
+			return nil, err
+		}
+		if stopped {
+			return result, nil
+		}
+	}
+	return result, r.finishRebase(state)
+}
+
+// rebaseStep runs a single step, reporting whether the rebase has to stop.
+func (r *Repository) rebaseStep(ctx context.Context, step sequenceStep, hooks RebaseHooks, result *RebaseResult) (bool, error) {
+	switch step.action {
+	case "drop":
+		return false, nil
+	case "exec":
+		run := hooks.Exec
+		if run == nil {
+			run = r.execCommand
+		}
+		if err := run(ctx, step.subject); err != nil {
+			result.FailedExec = step.subject
+			return true, nil
+		}
+		return false, nil
+	}
+
+	commit, err := r.loadCommit(step.oid)
+	if err != nil {
+		return false, err
+	}
+	head, err := r.repo.Refs.ReadHead()
+	if err != nil {
+		return false, err
+	}
+	info := commitInfo(step.oid, commit)
+
+	if (step.action == "pick" || step.action == "edit") && commit.ParentID == head && head != "" {
+		if err := r.fastForward(ctx, head, step.oid, "rebase: fast-forward"); err != nil {
+			return false, err
+		}
+	} else {
+		message, err := r.stepMessage(step, commit.Message)
+		if err != nil {
+			return false, err
+		}
+		conflicts, err := r.applyChanges(ctx, sequenceStep{action: "pick", oid: step.oid, subject: step.subject}, commit.ParentID)
+		if err != nil {
+			return false, err
+		}
+		if len(conflicts) > 0 {
+			if err := r.writeRebaseFile("stopped-sha", step.oid); err != nil {
+				return false, err
+			}
+			if err := r.writeRebaseFile("message", message); err != nil {
+				return false, err
+			}
+			result.Stopped, result.Conflicts = &info, conflicts
+			return true, nil
+		}
+		made, err := r.commitStep(ctx, step, message, hooks)
+		if _, empty := err.(*NothingToCommit); err != nil && !empty {
+			return false, err
+		}
+		if made != nil {
+			result.Commits = append(result.Commits, *made)
+		}
+	}
+
+	if step.action != "edit" {
+		return false, nil
+	}
+	head, err = r.repo.Refs.ReadHead()
+	if err != nil {
+		return false, err
+	}
+	if err := r.writeRebaseFile("stopped-sha", step.oid); err != nil {
+		return false, err
+	}
+	if err := r.writeRebaseFile("amend", head); err != nil {
+		return false, err
+	}
+	result.Stopped, result.Edit = &info, true
+	return true, nil
+}
+
+// stepMessage returns the message a step commits with: the commit's own, or
+// for a squash the message of HEAD followed by the commit's, or for a fixup
+// HEAD's alone.
+func (r *Repository) stepMessage(step sequenceStep, message string) (string, error) {
+	if step.action != "squash" && step.action != "fixup" {
+		return message, nil
+	}
+	head, err := r.repo.Refs.ReadHead()
+	if err != nil {
+		return "", err
+	}
+	previous, err := r.loadCommit(head)
+	if err != nil {
+		return "", err
+	}
+	if step.action == "fixup" {
+		return previous.Message, nil
+	}
+	return strings.TrimRight(previous.Message, "\n") + "\n\n" + message, nil
+}
+
+// commitStep commits the changes a step applied: a squash or fixup amends
+// HEAD, keeping its author, and anything else is committed with the original
+// author.
+func (r *Repository) commitStep(ctx context.Context, step sequenceStep, message string, hooks RebaseHooks) (*CommitResult, error) {
+	options := CommitOptions{Message: message}
+	switch step.action {
+	case "squash", "fixup":
+		options.Amend = true
+	default:
+		commit, err := r.loadCommit(step.oid)
+		if err != nil {
+			return nil, err
+		}
+		author := signature(commit.Author, commit.Timestamp)
+		options.Author = &author
+	}
+	if step.action == "reword" || step.action == "squash" {
+		options.EditMessage = hooks.EditMessage
+	}
+	return r.commit(ctx, options, "rebase ("+step.action+")")
+}
+
+// fastForward moves a detached HEAD, the index and the working tree from one
+// commit to another that follows it.
+func (r *Repository) fastForward(ctx context.Context, from, to, message string) error {
+	if err := r.repo.Index.LoadForUpdate(); err != nil {
+		return err
+	}
+	if err := r.migrate(ctx, from, to); err != nil {
+		r.repo.Index.ReleaseLock()
+		return err
+	}
+	if err := r.repo.Index.WriteUpdates(); err != nil {
+		return err
+	}
+	return r.moveHead(from, to, message)
+}
+
+func (r *Repository) execCommand(ctx context.Context, command string) error {
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Dir = r.dir
+	return cmd.Run()
+}
+
+func (r *Repository) writeRebaseFile(name, contents string) error {
+	if !strings.HasSuffix(contents, "\n") {
+		contents += "\n"
+	}
+	return ioutil.WriteFile(r.rebasePath(name), []byte(contents), 0644)
+}
+
+// finishRebase moves the branch being rebased to the result and checks it
+// out again.
+func (r *Repository) finishRebase(state *rebaseState) error {
+	head, err := r.repo.Refs.ReadHead()
+	if err != nil {
+		return err
+	}
+	if branch := state.branch(); branch != "" {
+		identity := r.identity.at(time.Now())
+		entry := core.ReflogEntry{
+			OldOID:   state.origHead,
+			NewOID:   head,
+			Identity: identity.author().Format(identity.When),
+			Message:  "rebase (finish): " + branch + " onto " + state.onto,
+		}
+		if err := r.repo.Refs.UpdateRef(branch, head); err != nil {
+			return err
+		}
+		if err := r.repo.Refs.AppendReflog(branch, entry); err != nil {
+			return err
+		}
+		if err := r.repo.Refs.SetHead(branch); err != nil {
+			return err
+		}
+		entry.OldOID, entry.Message = head, "rebase (finish): returning to "+branch
+		if err := r.repo.Refs.AppendReflog("HEAD", entry); err != nil {
+			return err
+		}
+	}
+	return r.clearRebase()
+}
+
+// RebaseContinue commits the changes staged after the rebase stopped, and
+// carries on with the remaining steps. After a conflict the resolution is
+// committed with the message of the step that stopped, unless it has already
+// been committed; after an edit any staged changes amend the commit.
+func (r *Repository) RebaseContinue(ctx context.Context, hooks RebaseHooks) (*RebaseResult, error) {
+	state, err := r.loadRebase()
+	if err != nil {
+		return nil, err
+	} else if state == nil {
+		return nil, &NoRebase{}
+	}
+
+	result := &RebaseResult{}
+	stopped, err := r.readRebaseFile("stopped-sha")
+	if err != nil {
+		return nil, err
+	}
+	if err := r.repo.Index.Load(); err != nil {
+		return nil, err
+	}
+	if paths := r.repo.Index.ConflictPaths(); len(paths) > 0 {
+		return nil, unmergedPaths(paths)
+	}
+	head, err := r.repo.Refs.ReadHead()
+	if err != nil {
+		return nil, err
+	}
+	clean, err := r.indexMatches(head)
+	if err != nil {
+		return nil, err
+	}
+	if !clean {
+		if stopped == "" || len(state.done) == 0 {
+			return nil, &UncommittedChanges{}
+		}
+		made, err := r.commitResolution(ctx, state.done[len(state.done)-1], hooks)
+		if err != nil {
+			return nil, err
+		}
+		result.Commits = append(result.Commits, *made)
+	}
+	if err := r.clearRebaseStop(); err != nil {
+		return nil, err
+	}
+	return r.runRebase(ctx, state, hooks, result)
+}
+
+// commitResolution commits the changes staged while stopped at a step,
+// amending the commit an edit step stopped on.
+func (r *Repository) commitResolution(ctx context.Context, step sequenceStep, hooks RebaseHooks) (*CommitResult, error) {
+	amend, err := r.readRebaseFile("amend")
+	if err != nil {
+		return nil, err
+	}
+	if amend != "" {
+		return r.commit(ctx, CommitOptions{Amend: true}, "rebase (edit)")
+	}
+	message, err := ioutil.ReadFile(r.rebasePath("message"))
+	if err != nil {
+		return nil, err
+	}
+	return r.commitStep(ctx, step, string(message), hooks)
+}
+
+// RebaseSkip discards the changes of the step the rebase stopped at and
+// carries on with the remaining steps.
+func (r *Repository) RebaseSkip(ctx context.Context, hooks RebaseHooks) (*RebaseResult, error) {
+	state, err := r.loadRebase()
+	if err != nil {
+		return nil, err
+	} else if state == nil {
+		return nil, &NoRebase{}
+	}
+
+	head, err := r.repo.Refs.ReadHead()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.resetHard(ctx, head); err != nil {
+		return nil, err
+	}
+	if err := r.clearRebaseStop(); err != nil {
+		return nil, err
+	}
+	return r.runRebase(ctx, state, hooks, &RebaseResult{})
+}
+
+// RebaseAbort discards the rebase, checking out the branch it was started
+// on, or the commit HEAD was detached at, as it was before.
+func (r *Repository) RebaseAbort(ctx context.Context) error {
+	state, err := r.loadRebase()
+	if err != nil {
+		return err
+	} else if state == nil {
+		return &NoRebase{}
+	}
+
+	head, err := r.repo.Refs.ReadHead()
+	if err != nil {
+		return err
+	}
+	if err := r.resetHard(ctx, state.origHead); err != nil {
+		return err
+	}
+	message := "rebase (abort): returning to " + state.origHead
+	if branch := state.branch(); branch != "" {
+		message = "rebase (abort): returning to " + branch
+		if err := r.repo.Refs.SetHead(branch); err != nil {
+			return err
+		}
+	} else if err := r.repo.Refs.UpdateRef("HEAD", state.origHead); err != nil {
+		return err
+	}
+
+	identity := r.identity.at(time.Now())
+	err = r.repo.Refs.AppendReflog("HEAD", core.ReflogEntry{
+		OldOID:   head,
+		NewOID:   state.origHead,
+		Identity: identity.author().Format(identity.When),
+		Message:  message,
+	})
+	if err != nil {
+		return err
+	}
+	return r.clearRebase()
+}
@@ -0,0 +1,227 @@
+package jit
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const detachedHeadName = "detached HEAD"
+
+// todoActions maps the commands of a todo list, and their abbreviations, to
+// the action run.
+var todoActions = map[string]string{
+	"p": "pick", "pick": "pick",
+	"r": "reword", "reword": "reword",
+	"e": "edit", "edit": "edit",
+	"s": "squash", "squash": "squash",
+	"f": "fixup", "fixup": "fixup",
+	"d": "drop", "drop": "drop",
+	"x": "exec", "exec": "exec",
+}
+
+const todoHelp = `
+# Commands:
+# p, pick <commit> = use commit
+# r, reword <commit> = use commit, but edit the commit message
+# e, edit <commit> = use commit, but stop for amending
+# s, squash <commit> = use commit, but meld into previous commit
+# f, fixup <commit> = like "squash", but discard this commit's log message
+# x, exec <command> = run command (the rest of the line) using shell
+# d, drop <commit> = remove commit
+#
+# These lines can be re-ordered; they are executed from top to bottom.
+#
+# If you remove a line here THAT COMMIT WILL BE LOST.
+#
+# However, if you remove everything, the rebase will be aborted.
+#
+`
+
+// rebaseState is a rebase in progress, saved under .git/rebase-merge in
+// git's layout: head-name holds the branch being rebased, onto the commit
+// the steps are replayed on, orig-head where the branch started, and
+// git-rebase-todo and done the steps still to run and those already run.
+// The steps are sequenceSteps, with the command of an exec step held as its
+// subject.
+type rebaseState struct {
+	headName    string
+	onto        string
+	origHead    string
+	interactive bool
+	todo        []sequenceStep
+	done        []sequenceStep
+}
+
+// branch returns the ref being rebased, or an empty string if HEAD was
+// detached.
+func (s *rebaseState) branch() string {
+	if s.headName == detachedHeadName {
+		return ""
+	}
+	return s.headName
+}
+
+func (r *Repository) rebasePath(name string) string {
+	return filepath.Join(r.gitPath("rebase-merge"), name)
+}
+
+// loadRebase reads the saved rebase state, returning nil if there is none.
+func (r *Repository) loadRebase() (*rebaseState, error) {
+	headName, err := ioutil.ReadFile(r.rebasePath("head-name"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	state := &rebaseState{headName: strings.TrimSpace(string(headName))}
+	if state.onto, err = r.readRebaseFile("onto"); err != nil {
+		return nil, err
+	}
+	if state.origHead, err = r.readRebaseFile("orig-head"); err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(r.rebasePath("interactive")); err == nil {
+		state.interactive = true
+	}
+
+	for _, name := range []string{"git-rebase-todo", "done"} {
+		data, err := ioutil.ReadFile(r.rebasePath(name))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		steps, err := r.parseTodo(string(data))
+		if err != nil {
+			return nil, err
+		}
+		if name == "done" {
+			state.done = steps
+		} else {
+			state.todo = steps
+		}
+	}
+	return state, nil
+}
+
+func (r *Repository) saveRebase(state *rebaseState) error {
+	if err := os.MkdirAll(r.gitPath("rebase-merge"), os.ModePerm); err != nil {
+		return err
+	}
+	files := map[string]string{
+		"head-name":       state.headName + "\n",
+		"onto":            state.onto + "\n",
+		"orig-head":       state.origHead + "\n",
+		"git-rebase-todo": formatTodo(state.todo, false),
+		"done":            formatTodo(state.done, false),
+	}
+	if state.interactive {
+		files["interactive"] = ""
+	}
+	for name, contents := range files {
+		if err := ioutil.WriteFile(r.rebasePath(name), []byte(contents), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readRebaseFile returns the trimmed contents of a state file, or an empty
+// string if it does not exist.
+func (r *Repository) readRebaseFile(name string) (string, error) {
+	data, err := ioutil.ReadFile(r.rebasePath(name))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	return strings.TrimSpace(string(data)), err
+}
+
+// clearRebaseStop removes the files describing the step a rebase stopped
+// at: stopped-sha names its commit, message holds the message to commit a
+// conflict resolution with, and amend the commit an edit step stopped on.
+func (r *Repository) clearRebaseStop() error {
+	for _, name := range []string{"stopped-sha", "message", "amend"} {
+		if err := os.Remove(r.rebasePath(name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Repository) clearRebase() error {
+	return os.RemoveAll(r.gitPath("rebase-merge"))
+}
+
+// formatTodo writes steps as todo list lines, with abbreviated commit IDs for
+// a list to be edited.
+func formatTodo(steps []sequenceStep, abbreviate bool) string {
+	todo := ""
+	for _, step := range steps {
+		if step.action == "exec" {
+			todo += "exec " + step.subject + "\n"
+			continue
+		}
+		oid := step.oid
+		if abbreviate {
+			oid = oid[0:7]
+		}
+		todo += step.action + " " + oid + " " + step.subject + "\n"
+	}
+	return todo
+}
+
+// parseTodo reads a todo list, skipping blank lines and comments, and
+// resolves each commit to its full ID.
+func (r *Repository) parseTodo(todo string) ([]sequenceStep, error) {
+	steps := []sequenceStep{}
+	for _, line := range strings.Split(todo, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		action, ok := todoActions[fields[0]]
+		if !ok {
+			return nil, &InvalidTodo{Line: line, Reason: "invalid command"}
+		}
+		if len(fields) < 2 {
+			return nil, &InvalidTodo{Line: line, Reason: "missing argument"}
+		}
+		if action == "exec" {
+			command := strings.TrimSpace(strings.TrimPrefix(line, fields[0]))
+			steps = append(steps, sequenceStep{action: action, subject: command})
+			continue
+		}
+
+		oid, err := r.repo.ResolveRevision(fields[1])
+		if err != nil {
+			return nil, &InvalidTodo{Line: line, Reason: "could not parse commit"}
+		}
+		commit, err := r.loadCommit(oid)
+		if err != nil {
+			return nil, err
+		}
+		subject := strings.Split(commit.Message, "\n")[0]
+		steps = append(steps, sequenceStep{action: action, oid: oid, subject: subject})
+	}
+	return steps, nil
+}
+
+// checkTodo makes sure each squash and fixup has an earlier commit to meld
+// into.
+func checkTodo(steps []sequenceStep) error {
+	picked := false
+	for _, step := range steps {
+		switch step.action {
+		case "squash", "fixup":
+			if !picked {
+				line := strings.TrimSpace(formatTodo([]sequenceStep{step}, true))
+				return &InvalidTodo{Line: line, Reason: fmt.Sprintf("cannot '%s' without a previous commit", step.action)}
+			}
+		case "pick", "reword", "edit":
+			picked = true
+		}
+	}
+	return nil
+}
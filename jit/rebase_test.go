@@ -0,0 +1,151 @@
+package jit_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/tpbowden/jit/jit"
+)
+
+// diverge makes three commits on master, after one made on a detached HEAD
+// from the same base, and returns the ID of that upstream commit.
+func diverge(t *testing.T, repo *jit.Repository) string {
+	ctx := context.Background()
+	writeFile(t, repo, "a.txt", "one\ntwo\nthree\n")
+	base := commit(t, repo, "base\n")
+	if _, err := repo.Checkout(ctx, base.OID); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, repo, "a.txt", "one\ntwo\nTHREE\n")
+	upstream := commit(t, repo, "upstream\n")
+
+	if _, err := repo.Checkout(ctx, "master"); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, repo, "a.txt", "ONE\ntwo\nthree\n")
+	commit(t, repo, "first\n")
+	writeFile(t, repo, "b.txt", "b\n")
+	commit(t, repo, "second\n")
+	writeFile(t, repo, "c.txt", "c\n")
+	commit(t, repo, "third\n")
+	return upstream.OID
+}
+
+func summaries(t *testing.T, repo *jit.Repository, count int) string {
+	commits, err := repo.Log(context.Background(), jit.LogOptions{MaxCount: count})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := []string{}
+	for _, commit := range commits {
+		lines = append(lines, commit.Summary())
+	}
+	return strings.Join(lines, ",")
+}
+
+func TestRebaseReplaysCommitsOntoUpstream(t *testing.T) {
+	repo, cleanup := setup(t)
+	defer cleanup()
+	upstream := diverge(t, repo)
+
+	result, err := repo.Rebase(context.Background(), jit.RebaseOptions{Upstream: upstream})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Finished() || len(result.Commits) != 3 || result.Branch != "refs/heads/master" {
+		t.Fatalf("Unexpected result %+v", result)
+	}
+	if history := summaries(t, repo, 5); history != "third,second,first,upstream,base" {
+		t.Fatalf("Unexpected history %s", history)
+	}
+	if contents := readFile(t, repo, "a.txt"); contents != "ONE\ntwo\nTHREE\n" {
+		t.Fatalf("Unexpected contents %q", contents)
+	}
+	if headOID(t, repo, "refs/heads/master") != headOID(t, repo, "HEAD") {
+		t.Fatal("Expected master to be checked out at the result")
+	}
+}
+
+func TestInteractiveRebaseRunsEditedTodo(t *testing.T) {
+	repo, cleanup := setup(t)
+	defer cleanup()
+	upstream := diverge(t, repo)
+
+	executed := []string{}
+	hooks := jit.RebaseHooks{
+		EditTodo: func(ctx context.Context, todo string) (string, error) {
+			lines := strings.Split(todo, "\n")
+			return "reword" + strings.TrimPrefix(lines[0], "pick") + "\n" +
+				"fixup" + strings.TrimPrefix(lines[1], "pick") + "\n" +
+				"exec make test\n" +
+				"drop" + strings.TrimPrefix(lines[2], "pick") + "\n", nil
+		},
+		EditMessage: func(ctx context.Context, message string) (string, error) {
+			return "reworded\n", nil
+		},
+		Exec: func(ctx context.Context, command string) error {
+			executed = append(executed, command)
+			return nil
+		},
+	}
+	result, err := repo.Rebase(context.Background(), jit.RebaseOptions{Upstream: upstream, Interactive: true, RebaseHooks: hooks})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Finished() {
+		t.Fatalf("Unexpected result %+v", result)
+	}
+	if history := summaries(t, repo, 3); history != "reworded,upstream,base" {
+		t.Fatalf("Unexpected history %s", history)
+	}
+	if readFile(t, repo, "b.txt") != "b\n" || len(executed) != 1 || executed[0] != "make test" {
+		t.Fatalf("Expected second to be melded in and the command run, got %v", executed)
+	}
+	if status := porcelain(t, repo); len(status) != 0 {
+		t.Fatalf("Expected third to be dropped, got %v", status)
+	}
+}
+
+func TestRebaseStopsOnConflictAndAborts(t *testing.T) {
+	repo, cleanup := setup(t)
+	defer cleanup()
+	ctx := context.Background()
+	upstream := diverge(t, repo)
+	writeFile(t, repo, "a.txt", "ONE\ntwo\nthree!\n")
+	commit(t, repo, "fourth\n")
+	head := headOID(t, repo, "HEAD")
+
+	result, err := repo.Rebase(ctx, jit.RebaseOptions{Upstream: upstream})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Stopped == nil || result.Stopped.Summary() != "fourth" || len(result.Conflicts) != 1 || len(result.Commits) != 3 {
+		t.Fatalf("Expected the rebase to stop, got %+v", result)
+	}
+	if _, err := repo.Rebase(ctx, jit.RebaseOptions{Upstream: upstream}); err == nil {
+		t.Fatal("Expected an error")
+	} else if _, ok := err.(*jit.RebaseInProgress); !ok {
+		t.Fatalf("Expected RebaseInProgress, got %v", err)
+	}
+	if _, err := repo.RebaseContinue(ctx, jit.RebaseHooks{}); err == nil {
+		t.Fatal("Expected an error")
+	} else if _, ok := err.(*jit.UnmergedPaths); !ok {
+		t.Fatalf("Expected UnmergedPaths, got %v", err)
+	}
+
+	if err := repo.RebaseAbort(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if headOID(t, repo, "HEAD") != head || headOID(t, repo, "refs/heads/master") != head {
+		t.Fatal("Expected master to be restored")
+	}
+	if status := porcelain(t, repo); len(status) != 0 {
+		t.Fatalf("Expected a clean tree, got %v", status)
+	}
+	if err := repo.RebaseAbort(ctx); err == nil {
+		t.Fatal("Expected an error")
+	} else if _, ok := err.(*jit.NoRebase); !ok {
+		t.Fatalf("Expected NoRebase, got %v", err)
+	}
+}
@@ -0,0 +1,188 @@
+package jit
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tpbowden/jit/remote"
+)
+
+// Remotes lists the configured remotes, sorted by name.
+func (r *Repository) Remotes() ([]remote.Remote, error) {
+	return remote.List(r.repo.Config)
+}
+
+// AddRemote configures a remote that fetches all of its branches into
+// refs/remotes/<name>/.
+func (r *Repository) AddRemote(name, url string) error {
+	return remote.Add(r.repo.Config, name, url)
+}
+
+// RemoveRemote deletes a remote's configuration and its remote-tracking refs.
+func (r *Repository) RemoveRemote(name string) error {
+	if err := remote.Remove(r.repo.Config, name); err != nil {
+		return err
+	}
+	names, err := r.repo.Refs.ListRefs("refs/remotes/" + name + "/")
+	if err != nil {
+		return err
+	}
+	for _, ref := range names {
+		if err := r.repo.Refs.DeleteRef(ref); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lookupRemote finds a configured remote by name, or treats the name as a
+// URL or the path of a repository. Relative paths are taken from the working
+// tree.
+func (r *Repository) lookupRemote(name string) (remote.Remote, error) {
+	found, err := remote.Get(r.repo.Config, name)
+	if _, ok := err.(*remote.UnknownRemote); ok {
+		if strings.Contains(name, ":") {
+			return remote.Remote{URL: name}, nil
+		}
+		if _, statErr := os.Stat(r.resolveURL(name)); statErr != nil {
+			return found, err
+		}
+		return remote.Remote{URL: name}, nil
+	}
+	return found, err
+}
+
+func (r *Repository) resolveURL(url string) string {
+	if strings.Contains(url, ":") || filepath.IsAbs(url) {
+		return url
+	}
+	return filepath.Join(r.dir, url)
+}
+
+func parseRefspecs(specs []string) ([]remote.Refspec, error) {
+	refspecs := []remote.Refspec{}
+	for _, spec := range specs {
+		refspec, err := remote.ParseRefspec(spec)
+		if err != nil {
+			return nil, err
+		}
+		refspecs = append(refspecs, refspec)
+	}
+	return refspecs, nil
+}
+
+type FetchOptions struct {
+	// Remote is a configured remote or a repository path, "origin" if empty.
+	Remote string
+	// Refspecs override the remote's configured fetch refspecs.
+	Refspecs []string
+	// Progress receives progress messages from the remote.
+	Progress io.Writer
+	// SSHCommand is the command ssh URLs are reached through, ssh if empty.
+	SSHCommand string
+}
+
+type PushOptions struct {
+	// Remote is a configured remote or a repository path, "origin" if empty.
+	Remote string
+	// Refspecs default to pushing the current branch to the same name.
+	Refspecs []string
+	// Force allows updates that are not fast-forwards.
+	Force bool
+	// Progress receives progress messages from the remote.
+	Progress io.Writer
+	// SSHCommand is the command ssh URLs are reached through, ssh if empty.
+	SSHCommand string
+}
+
+// TransferResult lists how a fetch or push changed each ref it considered.
+type TransferResult struct {
+	URL     string
+	Changes []remote.RefChange
+}
+
+// Rejected reports whether any ref update was refused.
+func (t TransferResult) Rejected() bool {
+	for _, change := range t.Changes {
+		if change.Status == remote.RefRejected {
+			return true
+		}
+	}
+	return false
+}
+
+// connect opens a connection to the named remote, filling in the programs it
+// is configured to run on the other side.
+func (r *Repository) connect(ctx context.Context, name string, options remote.ConnectOptions) (remote.Remote, remote.Connection, error) {
+	if name == "" {
+		name = "origin"
+	}
+	found, err := r.lookupRemote(name)
+	if err != nil {
+		return found, nil, err
+	}
+	options.UploadPack, options.ReceivePack = found.UploadPack, found.ReceivePack
+	conn, err := remote.Connect(ctx, r.resolveURL(found.URL), options)
+	return found, conn, err
+}
+
+// Fetch copies refs and the objects they need from a remote.
+func (r *Repository) Fetch(ctx context.Context, options FetchOptions) (*TransferResult, error) {
+	refspecs, err := parseRefspecs(options.Refspecs)
+	if err != nil {
+		return nil, err
+	}
+	found, conn, err := r.connect(ctx, options.Remote, remote.ConnectOptions{
+		Progress:   options.Progress,
+		SSHCommand: options.SSHCommand,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	changes, err := remote.Fetch(ctx, r.repo, conn, found, refspecs)
+	if err != nil {
+		return nil, err
+	}
+	return &TransferResult{URL: found.URL, Changes: changes}, nil
+}
+
+// Push updates refs on a remote. Updates that are not fast-forwards are
+// refused, and reported as rejected, unless forced.
+func (r *Repository) Push(ctx context.Context, options PushOptions) (*TransferResult, error) {
+	specs := options.Refspecs
+	if len(specs) == 0 {
+		ref, err := r.repo.Refs.CurrentRef()
+		if err != nil {
+			return nil, err
+		}
+		if ref == "HEAD" {
+			return nil, &DetachedHead{}
+		}
+		specs = []string{ref + ":" + ref}
+	}
+	refspecs, err := parseRefspecs(specs)
+	if err != nil {
+		return nil, err
+	}
+
+	found, conn, err := r.connect(ctx, options.Remote, remote.ConnectOptions{
+		Push:       true,
+		Progress:   options.Progress,
+		SSHCommand: options.SSHCommand,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	changes, err := remote.Push(ctx, r.repo, conn, found, refspecs, options.Force)
+	if err != nil {
+		return nil, err
+	}
+	return &TransferResult{URL: found.URL, Changes: changes}, nil
+}
@@ -0,0 +1,150 @@
+package jit_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tpbowden/jit/jit"
+	"github.com/tpbowden/jit/remote"
+)
+
+func clone(t *testing.T, source *jit.Repository) (*jit.Repository, func()) {
+	dir, err := ioutil.TempDir("", "jit_clone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity := jit.Signature{Name: "A. U. Thor", Email: "author@example.com"}
+	repo, err := jit.Clone(context.Background(), source.Dir(), filepath.Join(dir, "cloned"), jit.CloneOptions{Identity: identity})
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return repo, func() { os.RemoveAll(dir) }
+}
+
+func headOID(t *testing.T, repo *jit.Repository, revision string) string {
+	commits, err := repo.Log(context.Background(), jit.LogOptions{Revision: revision, MaxCount: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return commits[0].OID
+}
+
+func TestCloneChecksOutTheRemoteHead(t *testing.T) {
+	source, cleanup := setup(t)
+	defer cleanup()
+	writeFile(t, source, "dir/a.txt", "one\n")
+	result := commit(t, source, "first\n")
+
+	cloned, cleanupClone := clone(t, source)
+	defer cleanupClone()
+
+	data, err := ioutil.ReadFile(filepath.Join(cloned.Dir(), "dir", "a.txt"))
+	if err != nil || string(data) != "one\n" {
+		t.Fatalf("Unexpected workspace file %q, %v", data, err)
+	}
+	if oid := headOID(t, cloned, "origin/master"); oid != result.OID {
+		t.Fatalf("Expected origin/master at %s, got %s", result.OID, oid)
+	}
+	if merge, _ := cloned.Config().Get("branch.master.merge"); merge != "refs/heads/master" {
+		t.Fatalf("Unexpected upstream %q", merge)
+	}
+
+	status, err := cloned.Status(context.Background())
+	if err != nil || !status.Clean() {
+		t.Fatalf("Expected a clean clone, got %#v, %v", status, err)
+	}
+}
+
+func TestFetchUpdatesRemoteTrackingRefs(t *testing.T) {
+	source, cleanup := setup(t)
+	defer cleanup()
+	writeFile(t, source, "a.txt", "one\n")
+	commit(t, source, "first\n")
+
+	cloned, cleanupClone := clone(t, source)
+	defer cleanupClone()
+
+	writeFile(t, source, "a.txt", "two\n")
+	second := commit(t, source, "second\n")
+
+	result, err := cloned.Fetch(context.Background(), jit.FetchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Changes) != 1 || result.Changes[0].Status != remote.RefFastForward {
+		t.Fatalf("Unexpected changes %#v", result.Changes)
+	}
+	if oid := headOID(t, cloned, "origin/master"); oid != second.OID {
+		t.Fatalf("Expected origin/master at %s, got %s", second.OID, oid)
+	}
+	if oid := headOID(t, cloned, "master"); oid == second.OID {
+		t.Fatal("Expected the local branch to be left alone")
+	}
+}
+
+func TestPushRejectsNonFastForward(t *testing.T) {
+	source, cleanup := setup(t)
+	defer cleanup()
+	ctx := context.Background()
+	writeFile(t, source, "a.txt", "one\n")
+	commit(t, source, "first\n")
+
+	cloned, cleanupClone := clone(t, source)
+	defer cleanupClone()
+	push := jit.PushOptions{Refspecs: []string{"master:topic"}}
+
+	writeFile(t, cloned, "a.txt", "two\n")
+	mine := commit(t, cloned, "mine\n")
+	if result, err := cloned.Push(ctx, push); err != nil || result.Rejected() {
+		t.Fatalf("Expected the push to succeed, got %#v, %v", result, err)
+	}
+	if oid := headOID(t, source, "topic"); oid != mine.OID {
+		t.Fatalf("Expected topic at %s, got %s", mine.OID, oid)
+	}
+
+	if _, err := cloned.Commit(ctx, jit.CommitOptions{Message: "rewritten\n", Amend: true}); err != nil {
+		t.Fatal(err)
+	}
+	result, err := cloned.Push(ctx, push)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Rejected() || result.Changes[0].Reason != "non-fast-forward" {
+		t.Fatalf("Expected a non-fast-forward rejection, got %#v", result.Changes)
+	}
+	if oid := headOID(t, source, "topic"); oid != mine.OID {
+		t.Fatal("Expected the remote ref to be unchanged")
+	}
+
+	push.Force = true
+	if result, err := cloned.Push(ctx, push); err != nil || result.Rejected() {
+		t.Fatalf("Expected the forced push to succeed, got %#v, %v", result, err)
+	}
+	if headOID(t, source, "topic") != headOID(t, cloned, "master") {
+		t.Fatal("Expected the remote ref to be forced")
+	}
+}
+
+func TestPushRefusesCheckedOutBranch(t *testing.T) {
+	source, cleanup := setup(t)
+	defer cleanup()
+	writeFile(t, source, "a.txt", "one\n")
+	commit(t, source, "first\n")
+
+	cloned, cleanupClone := clone(t, source)
+	defer cleanupClone()
+	writeFile(t, cloned, "a.txt", "two\n")
+	commit(t, cloned, "second\n")
+
+	result, err := cloned.Push(context.Background(), jit.PushOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Rejected() || result.Changes[0].Reason != "branch is currently checked out" {
+		t.Fatalf("Expected a rejection, got %#v", result.Changes)
+	}
+}
@@ -0,0 +1,257 @@
+package jit
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/tpbowden/jit/diff"
+)
+
+// DefaultRenameThreshold is the similarity, as a percentage, two files need
+// for one to be reported as renamed or copied from the other.
+const DefaultRenameThreshold = 50
+
+// DefaultRenameLimit is how many added files, and how many files they may have
+// come from, rename detection compares by content before giving up on all but
+// identical files.
+const DefaultRenameLimit = 1000
+
+type RenameOptions struct {
+	// Threshold is the percentage of lines a pair of files must share, out
+	// of the lines in the larger file. Zero means DefaultRenameThreshold.
+	Threshold int
+	// Copies also pairs added files with the files they were copied from,
+	// which may be kept or modified.
+	Copies bool
+	// Limit caps the number of files compared by content, as for
+	// DefaultRenameLimit. Beyond it only identical files are paired. Zero
+	// means DefaultRenameLimit, and a negative limit compares every file.
+	Limit int
+}
+
+// Rename pairs a file with the one it was renamed or copied from. Similarity
+// is the percentage of lines they share, 100 for identical contents.
+type Rename struct {
+	From       string
+	To         string
+	Similarity int
+	Copy       bool
+}
+
+// renameFinder pairs the files added between two versions of a tree with the
+// files they came from. It caches the lines of each blob it compares, and can
+// be given the contents of blobs that are not in the database.
+type renameFinder struct {
+	repo    *Repository
+	options RenameOptions
+	blobs   map[string][]byte
+	lines   map[string][]string
+}
+
+func (r *Repository) newRenameFinder(options RenameOptions) *renameFinder {
+	if options.Threshold <= 0 {
+		options.Threshold = DefaultRenameThreshold
+	}
+	if options.Limit == 0 {
+		options.Limit = DefaultRenameLimit
+	}
+	return &renameFinder{repo: r, options: options, blobs: map[string][]byte{}, lines: map[string][]string{}}
+}
+
+// renameOptions reads whether rename detection is enabled from the first of
+// the config keys given that is set, such as diff.renames, which may be a
+// boolean or "copies". Detection is enabled by default, and nil is returned
+// if it is turned off. The limit comes from the first matching renameLimit
+// key that is set, such as diff.renameLimit, where zero means no limit.
+func (r *Repository) renameOptions(keys ...string) (*RenameOptions, error) {
+	options := &RenameOptions{}
+	for _, key := range keys {
+		value, exists := r.repo.Config.Get(key)
+		if !exists {
+			continue
+		}
+		if value == "copies" || value == "copy" {
+			options.Copies = true
+			break
+		}
+		enabled, err := r.repo.Config.GetBool(key, true)
+		if err != nil || !enabled {
+			return nil, err
+		}
+		break
+	}
+	for _, key := range keys {
+		limitKey := strings.TrimSuffix(key, "s") + "Limit"
+		if _, exists := r.repo.Config.Get(limitKey); !exists {
+			continue
+		}
+		limit, err := r.repo.Config.GetInt(limitKey, 0)
+		if err != nil {
+			return nil, err
+		}
+		if options.Limit = limit; limit <= 0 {
+			options.Limit = -1
+		}
+		break
+	}
+	return options, nil
+}
+
+// DefaultRenames returns the rename detection diff.renames configures for
+// diff and log, or nil if it is turned off.
+func (r *Repository) DefaultRenames() (*RenameOptions, error) {
+	return r.renameOptions("diff.renames")
+}
+
+func (f *renameFinder) blobLines(oid string) ([]string, error) {
+	if lines, cached := f.lines[oid]; cached {
+		return lines, nil
+	}
+	data, known := f.blobs[oid]
+	if !known {
+		var err error
+		if _, data, err = f.repo.repo.Database.ReadObject(oid); err != nil {
+			return nil, err
+		}
+	}
+	var lines []string
+	if !isBinary(data) {
+		lines = diff.Lines(string(data))
+	}
+	f.lines[oid] = lines
+	return lines, nil
+}
+
+// similarity returns the percentage of lines two blobs share, out of the
+// lines in the larger one. Binary and empty blobs are only similar if
+// identical.
+func (f *renameFinder) similarity(a, b string) (int, error) {
+	if a == b {
+		return 100, nil
+	}
+	linesA, err := f.blobLines(a)
+	if err != nil {
+		return 0, err
+	}
+	linesB, err := f.blobLines(b)
+	if err != nil {
+		return 0, err
+	}
+	if len(linesA) == 0 || len(linesB) == 0 {
+		return 0, nil
+	}
+	total, shortest := len(linesA), len(linesB)
+	if shortest > total {
+		total, shortest = shortest, total
+	}
+	// The files cannot share more lines than the shorter one has, so
+	// there is no need to compare them if that would not be enough.
+	if shortest*100/total < f.options.Threshold {
+		return 0, nil
+	}
+	shared := 0
+	for _, edit := range diff.Myers(linesA, linesB) {
+		if edit.Kind == diff.Equal {
+			shared++
+		}
+	}
+	return shared * 100 / total, nil
+}
+
+// find pairs the files in after but not before with the files in before
+// but not after, both given as paths mapped to blob IDs. Identical contents
+// are matched first, and then the remaining pairs from most similar down to
+// the threshold, unless there are more files left on either side than the
+// limit. Each deleted file is renamed at most once; when looking for copies,
+// any file in before may be the source of any number of them.
+func (f *renameFinder) find(before, after map[string]string) ([]Rename, error) {
+	added, deleted, sources := []string{}, []string{}, []string{}
+	for path := range after {
+		if _, exists := before[path]; !exists {
+			added = append(added, path)
+		}
+	}
+	for path := range before {
+		if _, exists := after[path]; !exists {
+			deleted = append(deleted, path)
+		} else if f.options.Copies {
+			sources = append(sources, path)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(deleted)
+	sort.Strings(sources)
+	sources = append(deleted, sources...)
+
+	renames := []Rename{}
+	paired, renamed := map[string]bool{}, map[string]bool{}
+	for _, to := range added {
+		for _, from := range deleted {
+			if !renamed[from] && before[from] == after[to] {
+				renames = append(renames, Rename{From: from, To: to, Similarity: 100})
+				paired[to], renamed[from] = true, true
+				break
+			}
+		}
+		if paired[to] {
+			continue
+		}
+		for _, from := range sources {
+			if f.options.Copies && before[from] == after[to] {
+				renames = append(renames, Rename{From: from, To: to, Similarity: 100, Copy: true})
+				paired[to] = true
+				break
+			}
+		}
+	}
+
+	unpaired := []string{}
+	for _, to := range added {
+		if !paired[to] {
+			unpaired = append(unpaired, to)
+		}
+	}
+	limit := f.options.Limit
+	if limit > 0 && len(unpaired)*len(sources) > limit*limit {
+		unpaired = nil
+	}
+
+	candidates := []Rename{}
+	for _, to := range unpaired {
+		for i, from := range sources {
+			if i < len(deleted) && renamed[from] && !f.options.Copies {
+				continue
+			}
+			score, err := f.similarity(before[from], after[to])
+			if err != nil {
+				return nil, err
+			}
+			if score >= f.options.Threshold {
+				candidates = append(candidates, Rename{From: from, To: to, Similarity: score, Copy: i >= len(deleted)})
+			}
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Similarity > candidates[j].Similarity
+	})
+	for _, candidate := range candidates {
+		if paired[candidate.To] {
+			continue
+		}
+		if !candidate.Copy && renamed[candidate.From] {
+			if !f.options.Copies {
+				continue
+			}
+			candidate.Copy = true
+		}
+		renames = append(renames, candidate)
+		paired[candidate.To] = true
+		if !candidate.Copy {
+			renamed[candidate.From] = true
+		}
+	}
+	sort.Slice(renames, func(i, j int) bool {
+		return renames[i].To < renames[j].To
+	})
+	return renames, nil
+}
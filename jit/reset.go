@@ -0,0 +1,172 @@
+package jit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/tpbowden/jit/core"
+	"github.com/tpbowden/jit/database"
+)
+
+// ResetMode chooses how much a reset updates besides HEAD.
+type ResetMode int
+
+const (
+	// ResetMixed resets the index but leaves the working tree alone.
+	ResetMixed ResetMode = iota
+	// ResetSoft only moves HEAD.
+	ResetSoft
+	// ResetHard resets both the index and the working tree.
+	ResetHard
+)
+
+type ResetOptions struct {
+	// Revision is the commit to reset to, HEAD if empty.
+	Revision string
+	Mode     ResetMode
+	// Paths limits a mixed reset to the index entries inside them, leaving
+	// HEAD where it is. They are relative to the top of the working tree,
+	// and absolute paths inside it are accepted too. Paths outside it give a
+	// PathspecOutside error.
+	Paths []string
+}
+
+// ResetResult describes the commit HEAD was reset to. OID is empty when
+// resetting an unborn branch.
+type ResetResult struct {
+	OID         string
+	PreviousOID string
+	Message     string
+}
+
+// Summary returns the first line of the commit message.
+func (r ResetResult) Summary() string {
+	return strings.Split(r.Message, "\n")[0]
+}
+
+// Reset moves HEAD, and the branch it is on, to a commit, resetting the
+// index and working tree to match as the mode asks. The commit HEAD was at
+// is saved as ORIG_HEAD. Files outside a sparse checkout are left out of
+// the working tree and marked skip-worktree.
+func (r *Repository) Reset(ctx context.Context, options ResetOptions) (*ResetResult, error) {
+	if len(options.Paths) > 0 && options.Mode != ResetMixed {
+		return nil, &ResetWithPaths{}
+	}
+	for _, path := range options.Paths {
+		root, err := r.relativePath(path)
+		if err != nil || root == ".." || strings.HasPrefix(root, ".."+string(filepath.Separator)) {
+			return nil, &PathspecOutside{Pathspec: path}
+		}
+	}
+	revision := options.Revision
+	if revision == "" {
+		revision = "HEAD"
+	}
+
+	head, err := r.repo.Refs.ReadHead()
+	if err != nil {
+		return nil, err
+	}
+	result := &ResetResult{PreviousOID: head}
+	if revision != "HEAD" || head != "" {
+		if result.OID, err = r.repo.ResolveRevision(revision); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := r.repo.Index.LoadForUpdate(); err != nil {
+		return nil, err
+	}
+	if err := r.reset(ctx, result.OID, options); err != nil {
+		r.repo.Index.ReleaseLock()
+		return nil, err
+	}
+	if err := r.repo.Index.WriteUpdates(); err != nil {
+		return nil, err
+	}
+	if len(options.Paths) > 0 || result.OID == "" {
+		return result, nil
+	}
+
+	if head != "" {
+		if err := r.repo.Refs.UpdateRef("ORIG_HEAD", head); err != nil {
+			return nil, err
+		}
+	}
+	if err := r.repo.Refs.UpdateHead(result.OID); err != nil {
+		return nil, err
+	}
+	identity := r.identity.at(time.Now())
+	if err := r.repo.Refs.RecordHeadUpdate(core.ReflogEntry{
+		OldOID:   head,
+		NewOID:   result.OID,
+		Identity: identity.author().Format(identity.When),
+		Message:  "reset: moving to " + revision,
+	}); err != nil {
+		return nil, err
+	}
+
+	object, err := r.repo.Database.Load(result.OID)
+	if err != nil {
+		return nil, err
+	}
+	result.Message = object.(database.Commit).Message
+	return result, nil
+}
+
+func (r *Repository) reset(ctx context.Context, oid string, options ResetOptions) error {
+	entries, err := r.treeEntries(oid)
+	if err != nil {
+		return err
+	}
+	if len(options.Paths) > 0 {
+		for _, path := range options.Paths {
+			root, err := r.relativePath(path)
+			if err != nil {
+				return err
+			}
+			r.resetIndex(entries, root)
+		}
+		return nil
+	}
+
+	switch options.Mode {
+	case ResetMixed:
+		r.resetIndex(entries, ".")
+	case ResetHard:
+		return r.resetTo(ctx, oid)
+	}
+	return nil
+}
+
+// resetIndex replaces the index entries inside root with the matching
+// entries from the target tree. Files outside a sparse checkout that are
+// missing from the working tree are marked skip-worktree.
+func (r *Repository) resetIndex(entries map[string]database.TreeEntry, root string) {
+	for _, entry := range r.repo.Index.Entries() {
+		if insidePath(entry.Path(), root) {
+			r.repo.Index.Remove(entry.Path())
+		}
+	}
+	for path, entry := range entries {
+		if !insidePath(path, root) {
+			continue
+		}
+		r.repo.Index.AddFromDatabase(path, entry.OID(), entry.Mode())
+		if r.repo.Sparse == nil || r.repo.Sparse.Includes(filepath.ToSlash(path)) {
+			continue
+		}
+		if _, err := r.repo.Workspace.StatFile(path); os.IsNotExist(err) {
+			r.repo.Index.SetSkipWorktree(path, true)
+		}
+	}
+}
+
+// insidePath reports whether path is root or inside it. The root "." holds
+// every path.
+func insidePath(path, root string) bool {
+	return root == "." || path == root || strings.HasPrefix(path, root+string(filepath.Separator))
+}
@@ -0,0 +1,134 @@
+package jit
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/tpbowden/jit/index"
+	"github.com/tpbowden/jit/pathspec"
+)
+
+type RemoveOptions struct {
+	// Paths is a pathspec relative to the top of the working tree. Every
+	// pattern must match at least one tracked file.
+	Paths []string
+	// Cached only removes the files from the index, keeping them in the
+	// working tree.
+	Cached bool
+	// Recursive allows patterns naming a directory to remove the files
+	// inside it.
+	Recursive bool
+	// Force skips the check that no content would be lost.
+	Force bool
+}
+
+// Remove stops tracking the files matching a pathspec and deletes them from
+// the working tree, returning their paths. Unless forced, it refuses with a
+// RemoveConflict to remove files staged with changes relative to HEAD or
+// modified in the working tree.
+func (r *Repository) Remove(ctx context.Context, options RemoveOptions) ([]string, error) {
+	if err := r.repo.Index.LoadForUpdate(); err != nil {
+		return nil, err
+	}
+	removed, err := r.remove(ctx, options)
+	if err != nil {
+		r.repo.Index.ReleaseLock()
+		return nil, err
+	}
+	return removed, r.repo.Index.WriteUpdates()
+}
+
+func (r *Repository) remove(ctx context.Context, options RemoveOptions) ([]string, error) {
+	spec, err := r.pathspec(options.Paths)
+	if err != nil {
+		return nil, err
+	}
+	entries := []index.IndexEntry{}
+	for _, entry := range r.repo.Index.Entries() {
+		if entry.Stage() == 0 && spec.Match(filepath.ToSlash(entry.Path())) {
+			entries = append(entries, entry)
+		}
+	}
+	for _, pattern := range spec.Patterns() {
+		if pattern.Magic&pathspec.Exclude != 0 {
+			continue
+		}
+		matched, nested := false, false
+		for _, entry := range entries {
+			path := filepath.ToSlash(entry.Path())
+			if pattern.Match(path) {
+				matched = true
+				nested = nested || !pattern.Wildcard && path != pattern.Path
+			}
+		}
+		if !matched {
+			return nil, &UnmatchedPathspec{Pathspec: pattern.Original}
+		}
+		if nested && !options.Recursive {
+			return nil, &NotRecursive{pattern.Original}
+		}
+	}
+	if !options.Force {
+		if err := r.checkRemovable(entries, options.Cached); err != nil {
+			return nil, err
+		}
+	}
+
+	removed := []string{}
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		r.repo.Index.Remove(entry.Path())
+		if !options.Cached {
+			if err := r.repo.Workspace.RemoveFile(entry.Path()); err != nil {
+				return nil, err
+			}
+		}
+		removed = append(removed, entry.Path())
+	}
+	return removed, nil
+}
+
+// checkRemovable returns a RemoveConflict listing the entries whose content
+// would be lost: those staged with changes relative to HEAD, or modified in
+// the working tree.
+func (r *Repository) checkRemovable(entries []index.IndexEntry, cached bool) error {
+	head, err := r.repo.Refs.ReadHead()
+	if err != nil {
+		return err
+	}
+	headEntries, err := r.treeEntries(head)
+	if err != nil {
+		return err
+	}
+
+	conflict := &RemoveConflict{}
+	for _, entry := range entries {
+		headEntry, inHead := headEntries[entry.Path()]
+		staged := !inHead || headEntry.OID() != entry.OID() || headEntry.Mode() != entry.Mode()
+		unstaged, err := r.workspaceModified(entry)
+		if err != nil {
+			return err
+		}
+
+		problem := ""
+		switch {
+		case staged && unstaged:
+			problem = "staged content different from both the file and the HEAD"
+		case cached:
+		case staged:
+			problem = "changes staged in the index"
+		case unstaged:
+			problem = "local modifications"
+		}
+		if problem != "" {
+			conflict.Paths = append(conflict.Paths, entry.Path())
+			conflict.Problems = append(conflict.Problems, problem)
+		}
+	}
+	if len(conflict.Paths) > 0 {
+		return conflict
+	}
+	return nil
+}
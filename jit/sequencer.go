@@ -0,0 +1,151 @@
+package jit
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/tpbowden/jit/config"
+)
+
+// The refs naming the commit a stopped cherry-pick or revert was applying.
+// Committing clears them.
+const (
+	cherryPickHead = "CHERRY_PICK_HEAD"
+	revertHead     = "REVERT_HEAD"
+)
+
+// sequenceStep is one commit to cherry-pick or revert.
+type sequenceStep struct {
+	action  string
+	oid     string
+	subject string
+}
+
+// sequence is the state of a series of cherry-picks or reverts. It is saved
+// under .git/sequencer when a step stops, in git's layout: head holds the
+// commit HEAD started at, todo the remaining steps beginning with the one
+// that stopped, and opts the options in config format.
+type sequence struct {
+	head     string
+	steps    []sequenceStep
+	mainline int
+}
+
+func (r *Repository) gitPath(name string) string {
+	return filepath.Join(r.dir, ".git", name)
+}
+
+func (r *Repository) sequencerPath(name string) string {
+	return filepath.Join(r.gitPath("sequencer"), name)
+}
+
+// loadSequence reads the saved sequencer state, returning nil if there is
+// none.
+func (r *Repository) loadSequence() (*sequence, error) {
+	head, err := ioutil.ReadFile(r.sequencerPath("head"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	seq := &sequence{head: strings.TrimSpace(string(head))}
+
+	todo, err := ioutil.ReadFile(r.sequencerPath("todo"))
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(string(todo), "\n") {
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) < 2 {
+			continue
+		}
+		step := sequenceStep{action: fields[0], oid: fields[1]}
+		if len(fields) == 3 {
+			step.subject = fields[2]
+		}
+		if step.action != "pick" && step.action != "revert" {
+			return nil, fmt.Errorf("Invalid line in %s: %s", r.sequencerPath("todo"), line)
+		}
+		seq.steps = append(seq.steps, step)
+	}
+
+	opts := config.New(r.sequencerPath("opts"))
+	if err := opts.Open(); err != nil {
+		return nil, err
+	}
+	if seq.mainline, err = opts.GetInt("options.mainline", 0); err != nil {
+		return nil, err
+	}
+	return seq, nil
+}
+
+func (r *Repository) saveSequence(seq *sequence) error {
+	if err := os.MkdirAll(r.gitPath("sequencer"), os.ModePerm); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(r.sequencerPath("head"), []byte(seq.head+"\n"), 0644); err != nil {
+		return err
+	}
+	todo := ""
+	for _, step := range seq.steps {
+		todo += step.action + " " + step.oid + " " + step.subject + "\n"
+	}
+	if err := ioutil.WriteFile(r.sequencerPath("todo"), []byte(todo), 0644); err != nil {
+		return err
+	}
+	if seq.mainline == 0 {
+		return nil
+	}
+
+	opts := config.New(r.sequencerPath("opts"))
+	if err := opts.OpenForUpdate(); err != nil {
+		return err
+	}
+	if err := opts.Set("options.mainline", strconv.Itoa(seq.mainline)); err != nil {
+		opts.ReleaseLock()
+		return err
+	}
+	return opts.Save()
+}
+
+// clearSequence removes the sequencer state along with the message and ref
+// left for the step that stopped.
+func (r *Repository) clearSequence() error {
+	if err := r.clearPickHead(); err != nil {
+		return err
+	}
+	if err := os.Remove(r.gitPath("MERGE_MSG")); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.RemoveAll(r.gitPath("sequencer"))
+}
+
+// readPickHead returns the commit a stopped step was applying and the ref
+// naming it, if any.
+func (r *Repository) readPickHead() (string, string, error) {
+	for _, ref := range []string{cherryPickHead, revertHead} {
+		oid, err := r.repo.Refs.ReadRef(ref)
+		if err != nil || oid != "" {
+			return oid, ref, err
+		}
+	}
+	return "", "", nil
+}
+
+func (r *Repository) clearPickHead() error {
+	for _, ref := range []string{cherryPickHead, revertHead} {
+		if oid, err := r.repo.Refs.ReadRef(ref); err != nil {
+			return err
+		} else if oid == "" {
+			continue
+		}
+		if err := r.repo.Refs.DeleteRef(ref); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package jit
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/tpbowden/jit/database"
+	"github.com/tpbowden/jit/repository"
+	"github.com/tpbowden/jit/sparse"
+)
+
+// SparseCheckoutResult lists the files outside a sparse checkout's cone that
+// were left in the working tree, rather than skipped, because they have
+// changes that removing them would lose.
+type SparseCheckoutResult struct {
+	Kept []string
+}
+
+// SparseCheckoutList returns the directories a sparse checkout includes,
+// relative to the top of the working tree.
+func (r *Repository) SparseCheckoutList() ([]string, error) {
+	if r.repo.Sparse == nil {
+		return nil, &NotSparse{}
+	}
+	return r.repo.Sparse.Dirs(), nil
+}
+
+// SparseCheckoutSet turns on a cone-mode sparse checkout including the given
+// directories, relative to the top of the working tree, along with the files
+// at the top and in the directories leading to them. Other files are removed
+// from the working tree and marked skip-worktree in the index, so they stay
+// in commits.
+func (r *Repository) SparseCheckoutSet(ctx context.Context, dirs ...string) (*SparseCheckoutResult, error) {
+	cone, err := sparse.NewCone(dirs)
+	if err != nil {
+		return nil, err
+	}
+	return r.sparseCheckout(ctx, cone)
+}
+
+// SparseCheckoutAdd includes more directories in a sparse checkout.
+func (r *Repository) SparseCheckoutAdd(ctx context.Context, dirs ...string) (*SparseCheckoutResult, error) {
+	if r.repo.Sparse == nil {
+		return nil, &NotSparse{}
+	}
+	cone, err := r.repo.Sparse.Add(dirs...)
+	if err != nil {
+		return nil, err
+	}
+	return r.sparseCheckout(ctx, cone)
+}
+
+// SparseCheckoutDisable restores every skipped file to the working tree and
+// turns the sparse checkout off. Its patterns are kept in
+// .git/info/sparse-checkout.
+func (r *Repository) SparseCheckoutDisable(ctx context.Context) (*SparseCheckoutResult, error) {
+	return r.sparseCheckout(ctx, nil)
+}
+
+func (r *Repository) sparseCheckout(ctx context.Context, cone *sparse.Cone) (*SparseCheckoutResult, error) {
+	if err := r.repo.Index.LoadForUpdate(); err != nil {
+		return nil, err
+	}
+	result, err := r.applySparse(ctx, cone)
+	if err == nil {
+		err = r.saveSparse(cone)
+	}
+	if err != nil {
+		r.repo.Index.ReleaseLock()
+		return nil, err
+	}
+	r.repo.SetSparse(cone)
+	return result, r.repo.Index.WriteUpdates()
+}
+
+// applySparse brings the working tree and the skip-worktree flags in the
+// index into line with a cone, or restores every file if cone is nil.
+// Skipped files already back in the working tree are left as they are.
+func (r *Repository) applySparse(ctx context.Context, cone *sparse.Cone) (*SparseCheckoutResult, error) {
+	result := &SparseCheckoutResult{Kept: []string{}}
+	for _, entry := range r.repo.Index.Entries() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if entry.Stage() != 0 {
+			continue
+		}
+		included := cone == nil || cone.Includes(filepath.ToSlash(entry.Path()))
+
+		switch {
+		case included && entry.SkipWorktree():
+			if _, err := r.repo.Workspace.StatFile(entry.Path()); err == nil {
+				r.repo.Index.SetSkipWorktree(entry.Path(), false)
+				continue
+			} else if !os.IsNotExist(err) {
+				return nil, err
+			}
+			_, data, err := r.repo.Database.ReadObject(entry.OID())
+			if err != nil {
+				return nil, err
+			}
+			if err := r.repo.Workspace.WriteBlob(entry.Path(), data, entry.Mode()); err != nil {
+				return nil, err
+			}
+			stat, err := r.repo.Workspace.StatFile(entry.Path())
+			if err != nil {
+				return nil, err
+			}
+			if err := r.repo.Index.Add(entry.Path(), entry.OID(), stat); err != nil {
+				return nil, err
+			}
+		case !included && !entry.SkipWorktree():
+			modified, err := r.workspaceModified(entry)
+			if err != nil {
+				return nil, err
+			}
+			if modified {
+				result.Kept = append(result.Kept, entry.Path())
+				continue
+			}
+			if err := r.repo.Workspace.RemoveFile(entry.Path()); err != nil {
+				return nil, err
+			}
+			r.repo.Index.SetSkipWorktree(entry.Path(), true)
+		}
+	}
+	return result, nil
+}
+
+// saveSparse writes a cone's patterns and turns on core.sparseCheckout and
+// core.sparseCheckoutCone, or turns both off if cone is nil.
+func (r *Repository) saveSparse(cone *sparse.Cone) error {
+	if cone != nil {
+		path := repository.SparseCheckoutFile(r.gitPath(""))
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(path, cone.Encode(), 0644); err != nil {
+			return err
+		}
+	}
+
+	cfg := r.repo.Config
+	if err := cfg.OpenForUpdate(); err != nil {
+		return err
+	}
+	for _, key := range []string{"core.sparseCheckout", "core.sparseCheckoutCone"} {
+		err := cfg.Unset(key)
+		if cone != nil {
+			err = cfg.Set(key, "true")
+		}
+		if err != nil {
+			cfg.ReleaseLock()
+			return err
+		}
+	}
+	return cfg.Save()
+}
+
+// skipSparse stages a file outside a sparse checkout's cone as skip-worktree
+// rather than writing it to the working tree. It returns false, having done
+// nothing, for a file inside the cone.
+func (r *Repository) skipSparse(path string, entry database.TreeEntry) (bool, error) {
+	if r.repo.Sparse == nil || r.repo.Sparse.Includes(filepath.ToSlash(path)) {
+		return false, nil
+	}
+	if err := r.repo.Workspace.RemoveFile(path); err != nil {
+		return false, err
+	}
+	r.repo.Index.AddFromDatabase(path, entry.OID(), entry.Mode())
+	r.repo.Index.SetSkipWorktree(path, true)
+	return true, nil
+}
@@ -0,0 +1,90 @@
+package jit_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/tpbowden/jit/jit"
+)
+
+func TestSparseCheckoutSkipsFilesOutsideTheCone(t *testing.T) {
+	repo, cleanup := setup(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	writeFile(t, repo, "top.txt", "top\n")
+	writeFile(t, repo, "app/main.go", "main\n")
+	writeFile(t, repo, "lib/util.go", "util\n")
+	writeFile(t, repo, "docs/guide.md", "guide\n")
+	commit(t, repo, "first\n")
+
+	if _, err := repo.SparseCheckoutList(); err == nil {
+		t.Fatal("Expected an error")
+	} else if _, ok := err.(*jit.NotSparse); !ok {
+		t.Fatalf("Expected NotSparse, got %v", err)
+	}
+
+	writeFile(t, repo, "docs/guide.md", "changed\n")
+	result, err := repo.SparseCheckoutSet(ctx, "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result.Kept, []string{"docs/guide.md"}) {
+		t.Fatalf("Unexpected kept files %v", result.Kept)
+	}
+	if _, err := os.Stat(filepath.Join(repo.Dir(), "lib")); !os.IsNotExist(err) {
+		t.Fatal("Expected lib to be removed")
+	}
+	writeFile(t, repo, "docs/guide.md", "guide\n")
+	if result, err = repo.SparseCheckoutSet(ctx, "app"); err != nil || len(result.Kept) != 0 {
+		t.Fatalf("Unexpected result %v, %v", result, err)
+	}
+
+	writeFile(t, repo, "app/new.go", "new\n")
+	writeFile(t, repo, "lib/stray.go", "stray\n")
+	status, err := repo.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Entries) != 0 || !reflect.DeepEqual(status.Untracked, []string{"app/new.go"}) {
+		t.Fatalf("Unexpected status %v", status)
+	}
+	commit(t, repo, "second\n")
+
+	files, err := repo.ListFiles(ctx, jit.ListFilesOptions{Cached: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := []string{}
+	for _, file := range files {
+		paths = append(paths, file.Path)
+	}
+	if !reflect.DeepEqual(paths, []string{"app/main.go", "app/new.go", "docs/guide.md", "lib/util.go", "top.txt"}) {
+		t.Fatalf("Expected skipped files to stay committed, got %v", paths)
+	}
+
+	if result, err = repo.SparseCheckoutAdd(ctx, "lib"); err != nil || len(result.Kept) != 0 {
+		t.Fatalf("Unexpected result %v, %v", result, err)
+	}
+	if dirs, err := repo.SparseCheckoutList(); err != nil || !reflect.DeepEqual(dirs, []string{"app", "lib"}) {
+		t.Fatalf("Unexpected dirs %v, %v", dirs, err)
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(repo.Dir(), "lib", "util.go")); string(data) != "util\n" {
+		t.Fatalf("Unexpected contents %q", data)
+	}
+
+	if _, err := repo.SparseCheckoutDisable(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(repo.Dir(), "docs", "guide.md")); string(data) != "guide\n" {
+		t.Fatalf("Unexpected contents %q", data)
+	}
+	status, err = repo.Status(ctx)
+	if err != nil || len(status.Entries) != 0 || !reflect.DeepEqual(status.Untracked, []string{"lib/stray.go"}) {
+		t.Fatalf("Unexpected status %v, %v", status, err)
+	}
+}
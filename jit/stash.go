@@ -0,0 +1,396 @@
+package jit
+
+import (
+	"context"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tpbowden/jit/core"
+	"github.com/tpbowden/jit/database"
+	"github.com/tpbowden/jit/index"
+)
+
+// stashRef holds the most recent stash entry. Its reflog is the stack of
+// entries, oldest first.
+const stashRef = "refs/stash"
+
+// StashEntry is one entry on the stash stack.
+type StashEntry struct {
+	OID     string
+	Message string
+}
+
+type StashPushOptions struct {
+	// Message describes the entry, in place of the HEAD commit's subject.
+	Message string
+}
+
+type StashApplyOptions struct {
+	// Stash is the position of the entry on the stack, 0 being the newest.
+	Stash int
+	// Index restores the stashed index as well as the working tree, rather
+	// than leaving all of the changes unstaged.
+	Index bool
+}
+
+// StashApplyResult lists the paths left conflicted by applying a stash
+// entry, and for a pop, the entry that was dropped. Entries are only
+// dropped when they apply cleanly.
+type StashApplyResult struct {
+	Conflicts []string
+	Dropped   *StashEntry
+}
+
+// StashList returns the stash entries, newest first.
+func (r *Repository) StashList() ([]StashEntry, error) {
+	log, err := r.repo.Refs.ReadReflog(stashRef)
+	if err != nil {
+		return nil, err
+	}
+	entries := []StashEntry{}
+	for i := len(log) - 1; i >= 0; i-- {
+		entries = append(entries, StashEntry{OID: log[i].NewOID, Message: log[i].Message})
+	}
+	return entries, nil
+}
+
+func (r *Repository) stashEntry(n int) (StashEntry, error) {
+	entries, err := r.StashList()
+	if err != nil {
+		return StashEntry{}, err
+	}
+	if n < 0 || n >= len(entries) {
+		return StashEntry{}, &InvalidStash{Index: n, Count: len(entries)}
+	}
+	return entries[n], nil
+}
+
+// StashPush saves the index and the changes to tracked files in the working
+// tree as a stash entry, then resets both to match HEAD. The entry is a
+// commit of the working tree whose parents are HEAD and a commit of the index.
+func (r *Repository) StashPush(ctx context.Context, options StashPushOptions) (*StashEntry, error) {
+	if err := r.repo.Index.LoadForUpdate(); err != nil {
+		return nil, err
+	}
+	entry, err := r.stashPush(ctx, options)
+	if err != nil {
+		r.repo.Index.ReleaseLock()
+		return nil, err
+	}
+	if err := r.repo.Index.WriteUpdates(); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+func (r *Repository) stashPush(ctx context.Context, options StashPushOptions) (*StashEntry, error) {
+	if paths := r.repo.Index.ConflictPaths(); len(paths) > 0 {
+		return nil, unmergedPaths(paths)
+	}
+	status, err := r.status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if status.Head == "" {
+		return nil, &NoInitialCommit{}
+	}
+	if len(status.Entries) == 0 {
+		return nil, &NoLocalChanges{}
+	}
+
+	object, err := r.repo.Database.Load(status.Head)
+	if err != nil {
+		return nil, err
+	}
+	branch := status.Branch
+	if branch == "" {
+		branch = "(no branch)"
+	}
+	subject := strings.Split(object.(database.Commit).Message, "\n")[0]
+	description := branch + ": " + status.Head[0:7] + " " + subject
+
+	indexTree, err := r.writeTree(r.indexTreeEntries())
+	if err != nil {
+		return nil, err
+	}
+	workTree, err := r.workspaceTree(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	identity := r.identity.at(time.Now())
+	author := identity.author()
+	indexCommit := database.NewCommit(author, indexTree, status.Head, "index on "+description+"\n", identity.When)
+	if err := r.repo.Database.Store(indexCommit); err != nil {
+		return nil, err
+	}
+	message := "WIP on " + description
+	if options.Message != "" {
+		message = "On " + branch + ": " + options.Message
+	}
+	parents := []string{status.Head, database.ObjectID(indexCommit)}
+	workCommit := database.NewMergeCommit(author, workTree, parents, message+"\n", identity.When)
+	if err := r.repo.Database.Store(workCommit); err != nil {
+		return nil, err
+	}
+
+	oid := database.ObjectID(workCommit)
+	previous, err := r.repo.Refs.ReadRef(stashRef)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.repo.Refs.UpdateRef(stashRef, oid); err != nil {
+		return nil, err
+	}
+	err = r.repo.Refs.AppendReflog(stashRef, core.ReflogEntry{
+		OldOID:   previous,
+		NewOID:   oid,
+		Identity: author.Format(identity.When),
+		Message:  message,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.resetChanges(status); err != nil {
+		return nil, err
+	}
+	return &StashEntry{OID: oid, Message: message}, nil
+}
+
+// workspaceTree stores the tracked files as they are in the working tree,
+// returning the ID of a tree holding them. Deleted files are left out, and
+// files skipped by a sparse checkout are kept as they are in the index.
+func (r *Repository) workspaceTree(ctx context.Context) (string, error) {
+	entries := []database.DatabaseEntry{}
+	for _, entry := range r.repo.Index.Entries() {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		if entry.SkipWorktree() {
+			entries = append(entries, entry)
+			continue
+		}
+		stat, err := r.repo.Workspace.StatFile(entry.Path())
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return "", err
+		}
+		modified, err := r.workspaceModified(entry)
+		if err != nil {
+			return "", err
+		}
+		if !modified {
+			entries = append(entries, entry)
+			continue
+		}
+
+		data, err := r.repo.Workspace.ReadBlob(entry.Path())
+		if err != nil {
+			return "", err
+		}
+		blob := database.NewBlob(data)
+		if err := r.repo.Database.Store(blob); err != nil {
+			return "", err
+		}
+		current, err := index.NewIndexEntry(entry.Path(), database.ObjectID(blob), stat)
+		if err != nil {
+			return "", err
+		}
+		entries = append(entries, current)
+	}
+	return r.writeTree(entries)
+}
+
+// resetChanges puts every changed path in status back as it is in HEAD, in
+// both the index and the working tree.
+func (r *Repository) resetChanges(status *Status) error {
+	headEntries, err := r.treeEntries(status.Head)
+	if err != nil {
+		return err
+	}
+	for _, change := range status.Entries {
+		entry, exists := headEntries[change.Path]
+		if !exists {
+			if err := r.repo.Workspace.RemoveFile(change.Path); err != nil {
+				return err
+			}
+			r.repo.Index.Remove(change.Path)
+			continue
+		}
+
+		_, data, err := r.repo.Database.ReadObject(entry.OID())
+		if err != nil {
+			return err
+		}
+		if err := r.repo.Workspace.WriteBlob(change.Path, data, entry.Mode()); err != nil {
+			return err
+		}
+		stat, err := r.repo.Workspace.StatFile(change.Path)
+		if err != nil {
+			return err
+		}
+		if err := r.repo.Index.Add(change.Path, entry.OID(), stat); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StashApply merges the changes saved in a stash entry into the working
+// tree, through a three-way merge against the commit they were made on.
+// Files the stash added are staged; other changes are left unstaged unless
+// the stashed index is restored too.
+func (r *Repository) StashApply(ctx context.Context, options StashApplyOptions) (*StashApplyResult, error) {
+	stash, err := r.stashEntry(options.Stash)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.repo.Index.LoadForUpdate(); err != nil {
+		return nil, err
+	}
+	conflicts, err := r.stashApply(ctx, stash.OID, options.Index)
+	if err != nil {
+		r.repo.Index.ReleaseLock()
+		return nil, err
+	}
+	if err := r.repo.Index.WriteUpdates(); err != nil {
+		return nil, err
+	}
+	return &StashApplyResult{Conflicts: conflicts}, nil
+}
+
+// StashPop applies a stash entry and drops it from the stack if it applied
+// without conflicts.
+func (r *Repository) StashPop(ctx context.Context, options StashApplyOptions) (*StashApplyResult, error) {
+	result, err := r.StashApply(ctx, options)
+	if err != nil || len(result.Conflicts) > 0 {
+		return result, err
+	}
+	if result.Dropped, err = r.StashDrop(options.Stash); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (r *Repository) stashApply(ctx context.Context, oid string, restoreIndex bool) ([]string, error) {
+	if paths := r.repo.Index.ConflictPaths(); len(paths) > 0 {
+		return nil, unmergedPaths(paths)
+	}
+	object, err := r.repo.Database.Load(oid)
+	if err != nil {
+		return nil, err
+	}
+	stash := object.(database.Commit)
+	if len(stash.Parents) < 2 {
+		return nil, notStashCommit(oid)
+	}
+
+	base, err := r.treeEntries(stash.Parents[0])
+	if err != nil {
+		return nil, err
+	}
+	theirs, err := r.treeEntries(oid)
+	if err != nil {
+		return nil, err
+	}
+	ours := map[string]database.TreeEntry{}
+	for _, entry := range r.indexTreeEntries() {
+		ours[entry.Path()] = database.NewTreeEntry(entry.Path(), entry.OID(), entry.Mode())
+	}
+
+	outcomes, err := r.mergeTrees(ctx, base, ours, theirs, "Updated upstream", "Stashed changes")
+	if err != nil {
+		return nil, err
+	}
+	staged := map[string]mergeOutcome{}
+	if restoreIndex {
+		stashedIndex, err := r.treeEntries(stash.Parents[1])
+		if err != nil {
+			return nil, err
+		}
+		if staged, err = r.mergeTrees(ctx, base, ours, stashedIndex, "Updated upstream", "Stashed changes"); err != nil {
+			return nil, err
+		}
+		for _, outcome := range staged {
+			if outcome.conflict {
+				return nil, &StashIndexConflict{}
+			}
+		}
+	}
+
+	if err := r.checkMergeTargets(outcomes); err != nil {
+		return nil, err
+	}
+	if err := r.writeMerge(ctx, outcomes); err != nil {
+		return nil, err
+	}
+
+	conflicts := []string{}
+	for path, outcome := range outcomes {
+		if outcome.conflict {
+			conflicts = append(conflicts, path)
+			continue
+		}
+		want := lookupEntry(ours, path)
+		if restored, exists := staged[path]; exists {
+			want = restored.entry
+		} else if want == nil {
+			continue
+		}
+		r.stageEntry(path, want, outcome.entry)
+	}
+	for path, restored := range staged {
+		if _, merged := outcomes[path]; !merged {
+			r.stageEntry(path, restored.entry, lookupEntry(ours, path))
+		}
+	}
+	sort.Strings(conflicts)
+	return conflicts, nil
+}
+
+// stageEntry sets the index entry for path to want, given the entry it
+// currently holds.
+func (r *Repository) stageEntry(path string, want, current *database.TreeEntry) {
+	switch {
+	case sameEntry(want, current):
+	case want == nil:
+		r.repo.Index.Remove(path)
+	default:
+		r.repo.Index.AddFromDatabase(path, want.OID(), want.Mode())
+	}
+}
+
+// StashDrop removes an entry from the stash stack, deleting refs/stash once
+// the stack is empty.
+func (r *Repository) StashDrop(n int) (*StashEntry, error) {
+	stash, err := r.stashEntry(n)
+	if err != nil {
+		return nil, err
+	}
+	log, err := r.repo.Refs.ReadReflog(stashRef)
+	if err != nil {
+		return nil, err
+	}
+
+	position := len(log) - 1 - n
+	if position+1 < len(log) {
+		log[position+1].OldOID = log[position].OldOID
+	}
+	log = append(log[:position], log[position+1:]...)
+	if err := r.repo.Refs.WriteReflog(stashRef, log); err != nil {
+		return nil, err
+	}
+	if len(log) == 0 {
+		err = r.repo.Refs.DeleteRef(stashRef)
+	} else {
+		err = r.repo.Refs.UpdateRef(stashRef, log[len(log)-1].NewOID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &stash, nil
+}
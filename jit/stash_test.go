@@ -0,0 +1,156 @@
+package jit_test
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/tpbowden/jit/jit"
+)
+
+func readFile(t *testing.T, repo *jit.Repository, name string) string {
+	data, err := ioutil.ReadFile(filepath.Join(repo.Dir(), name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func porcelain(t *testing.T, repo *jit.Repository) map[string]string {
+	status, err := repo.Status(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := map[string]string{}
+	for _, entry := range status.Entries {
+		result[entry.Path] = string([]byte{byte(entry.Index), byte(entry.Workspace)})
+	}
+	for _, conflict := range status.Conflicts {
+		result[conflict.Path] = conflict.Code
+	}
+	return result
+}
+
+func TestStashPushAndPopWithIndex(t *testing.T) {
+	repo, cleanup := setup(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	writeFile(t, repo, "a.txt", "one\n")
+	writeFile(t, repo, "b.txt", "one\n")
+	commit(t, repo, "first\n")
+
+	writeFile(t, repo, "a.txt", "staged\n")
+	writeFile(t, repo, "c.txt", "new\n")
+	if err := repo.Add(ctx, "."); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, repo, "b.txt", "unstaged\n")
+
+	entry, err := repo.StashPush(ctx, jit.StashPushOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Message != "WIP on master: "+headOID(t, repo, "HEAD")[0:7]+" first" {
+		t.Fatalf("Unexpected message %q", entry.Message)
+	}
+	if status := porcelain(t, repo); len(status) != 0 {
+		t.Fatalf("Expected a clean tree, got %v", status)
+	}
+	if _, err := repo.StashPush(ctx, jit.StashPushOptions{}); err == nil {
+		t.Fatal("Expected an error")
+	} else if _, ok := err.(*jit.NoLocalChanges); !ok {
+		t.Fatalf("Expected NoLocalChanges, got %v", err)
+	}
+
+	result, err := repo.StashPop(ctx, jit.StashApplyOptions{Index: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Dropped == nil || result.Dropped.OID != entry.OID {
+		t.Fatalf("Expected the entry to be dropped, got %v", result.Dropped)
+	}
+	status := porcelain(t, repo)
+	if len(status) != 3 || status["a.txt"] != "M " || status["b.txt"] != " M" || status["c.txt"] != "A " {
+		t.Fatalf("Unexpected status %v", status)
+	}
+	if entries, _ := repo.StashList(); len(entries) != 0 {
+		t.Fatalf("Expected an empty stash, got %v", entries)
+	}
+}
+
+func TestStashApplyReportsConflicts(t *testing.T) {
+	repo, cleanup := setup(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	writeFile(t, repo, "a.txt", "one\ntwo\nthree\n")
+	commit(t, repo, "first\n")
+	writeFile(t, repo, "a.txt", "one\nstashed\nthree\n")
+	if _, err := repo.StashPush(ctx, jit.StashPushOptions{Message: "edit"}); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, repo, "a.txt", "one\ncommitted\nthree\n")
+	commit(t, repo, "second\n")
+
+	result, err := repo.StashPop(ctx, jit.StashApplyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Conflicts) != 1 || result.Conflicts[0] != "a.txt" || result.Dropped != nil {
+		t.Fatalf("Unexpected result %+v", result)
+	}
+	expected := "one\n<<<<<<< Updated upstream\ncommitted\n=======\nstashed\n>>>>>>> Stashed changes\nthree\n"
+	if contents := readFile(t, repo, "a.txt"); contents != expected {
+		t.Fatalf("Unexpected contents %q", contents)
+	}
+	if status := porcelain(t, repo); status["a.txt"] != "UU" {
+		t.Fatalf("Unexpected status %v", status)
+	}
+	if _, err := repo.Commit(ctx, jit.CommitOptions{Message: "resolved\n"}); err == nil {
+		t.Fatal("Expected an error")
+	} else if _, ok := err.(*jit.UnmergedPaths); !ok {
+		t.Fatalf("Expected UnmergedPaths, got %v", err)
+	}
+	if entries, _ := repo.StashList(); len(entries) != 1 || entries[0].Message != "On master: edit" {
+		t.Fatalf("Expected the entry to be kept, got %v", entries)
+	}
+}
+
+func TestStashDropKeepsTheRestOfTheStack(t *testing.T) {
+	repo, cleanup := setup(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	writeFile(t, repo, "a.txt", "one\n")
+	commit(t, repo, "first\n")
+	oids := []string{}
+	for _, contents := range []string{"two\n", "three\n", "four\n"} {
+		writeFile(t, repo, "a.txt", contents)
+		entry, err := repo.StashPush(ctx, jit.StashPushOptions{Message: contents})
+		if err != nil {
+			t.Fatal(err)
+		}
+		oids = append(oids, entry.OID)
+	}
+
+	if _, err := repo.StashDrop(1); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := repo.StashList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].OID != oids[2] || entries[1].OID != oids[0] {
+		t.Fatalf("Unexpected stash %v", entries)
+	}
+	if headOID(t, repo, "refs/stash") != oids[2] {
+		t.Fatal("Expected refs/stash to name the newest entry")
+	}
+	if _, err := repo.StashDrop(2); err == nil {
+		t.Fatal("Expected an error")
+	} else if _, ok := err.(*jit.InvalidStash); !ok {
+		t.Fatalf("Expected InvalidStash, got %v", err)
+	}
+}
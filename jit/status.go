@@ -0,0 +1,333 @@
+package jit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/tpbowden/jit/database"
+	"github.com/tpbowden/jit/index"
+	"github.com/tpbowden/jit/pathspec"
+)
+
+// ChangeType is the status code of a file on one side of a comparison.
+type ChangeType byte
+
+const (
+	Unmodified ChangeType = ' '
+	Added      ChangeType = 'A'
+	Modified   ChangeType = 'M'
+	Deleted    ChangeType = 'D'
+	Renamed    ChangeType = 'R'
+	Copied     ChangeType = 'C'
+)
+
+var conflictCodes = map[[3]bool]string{
+	{true, false, false}: "DD",
+	{false, true, false}: "AU",
+	{true, true, false}:  "UD",
+	{false, false, true}: "UA",
+	{true, false, true}:  "DU",
+	{false, true, true}:  "AA",
+	{true, true, true}:   "UU",
+}
+
+// Conflict is a path left unmerged in the index. Code is the two-letter
+// status git gives it, such as "UU" when both sides modified the file or
+// "UD" when they deleted it.
+type Conflict struct {
+	Path string
+	Code string
+}
+
+// StatusEntry records how a tracked file differs between HEAD and the index,
+// and between the index and the working tree. A file staged as renamed or
+// copied has the path it came from in OrigPath.
+type StatusEntry struct {
+	Path      string
+	OrigPath  string
+	Index     ChangeType
+	Workspace ChangeType
+}
+
+type Status struct {
+	// Branch is the checked out branch, or empty if HEAD is detached.
+	Branch string
+	Head   string
+	// Entries lists the changed files, sorted by path.
+	Entries []StatusEntry
+	// Conflicts lists the unmerged paths, sorted.
+	Conflicts []Conflict
+	// Untracked lists untracked files, with wholly untracked directories
+	// collapsed to a single path ending in a separator.
+	Untracked []string
+}
+
+// Staged reports whether any changes are staged in the index.
+func (s Status) Staged() bool {
+	for _, entry := range s.Entries {
+		if entry.Index != Unmodified {
+			return true
+		}
+	}
+	return false
+}
+
+// Clean reports whether there are no changes and no untracked files.
+func (s Status) Clean() bool {
+	return len(s.Entries) == 0 && len(s.Conflicts) == 0 && len(s.Untracked) == 0
+}
+
+// workspaceModified reports whether the file at an entry's path differs from
+// the content staged in the index. Missing files count as unmodified. The file
+// is only hashed when its stat data cannot be trusted.
+func (r *Repository) workspaceModified(entry index.IndexEntry) (bool, error) {
+	stat, err := r.repo.Workspace.StatFile(entry.Path())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	if stat.IsDir() {
+		return true, nil
+	}
+
+	return r.repo.Index.EntryModified(entry, stat, func() (string, error) {
+		data, err := r.repo.Workspace.ReadBlob(entry.Path())
+		if err != nil {
+			return "", err
+		}
+		return database.ObjectID(database.NewBlob(data)), nil
+	})
+}
+
+// Status compares HEAD, the index and the working tree, limited to the files
+// matching a pathspec if any paths are given. Stat data refreshed along the
+// way is written back to the index. Staged renames are detected among the
+// files the pathspec matches unless turned off by status.renames or
+// diff.renames. Files outside a sparse checkout are neither reported as
+// deleted nor listed as untracked.
+func (r *Repository) Status(ctx context.Context, paths ...string) (*Status, error) {
+	spec, err := r.pathspec(paths)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.repo.Index.LoadForUpdate(); err != nil {
+		return nil, err
+	}
+	status, err := r.status(ctx)
+	if err == nil && !spec.Empty() {
+		err = r.limitStatus(status, spec)
+	}
+	if err == nil {
+		err = r.stagedRenames(status, spec)
+	}
+	if err != nil {
+		r.repo.Index.ReleaseLock()
+		return nil, err
+	}
+	if err := r.repo.Index.WriteUpdates(); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// limitStatus drops everything from a status that a pathspec does not
+// match. A collapsed untracked directory the pathspec does not match as a
+// whole is replaced by the files inside it that it does match.
+func (r *Repository) limitStatus(status *Status, spec *pathspec.Pathspec) error {
+	entries := []StatusEntry{}
+	for _, entry := range status.Entries {
+		if spec.Match(filepath.ToSlash(entry.Path)) {
+			entries = append(entries, entry)
+		}
+	}
+	conflicts := []Conflict{}
+	for _, conflict := range status.Conflicts {
+		if spec.Match(filepath.ToSlash(conflict.Path)) {
+			conflicts = append(conflicts, conflict)
+		}
+	}
+	untracked := []string{}
+	for _, path := range status.Untracked {
+		dir := strings.TrimSuffix(path, string(filepath.Separator))
+		if spec.Match(filepath.ToSlash(dir)) {
+			untracked = append(untracked, path)
+			continue
+		}
+		if dir == path {
+			continue
+		}
+		files, err := r.repo.Workspace.ListFilesRelative(filepath.Join(r.dir, dir))
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			if spec.Match(filepath.ToSlash(file)) {
+				untracked = append(untracked, file)
+			}
+		}
+	}
+	sort.Strings(untracked)
+	status.Entries, status.Conflicts, status.Untracked = entries, conflicts, untracked
+	return nil
+}
+
+// stagedRenames merges the entries for files staged as deleted and added
+// into a single entry for each rename, and marks added files that are copies.
+// Only files the pathspec matches are paired, as in Diff.
+func (r *Repository) stagedRenames(status *Status, spec *pathspec.Pathspec) error {
+	options, err := r.renameOptions("status.renames", "diff.renames")
+	if err != nil || options == nil {
+		return err
+	}
+	headEntries, err := r.treeEntries(status.Head)
+	if err != nil {
+		return err
+	}
+	before, after := map[string]string{}, map[string]string{}
+	for path, entry := range headEntries {
+		if spec.Match(filepath.ToSlash(path)) {
+			before[path] = entry.OID()
+		}
+	}
+	for _, entry := range r.repo.Index.Entries() {
+		if entry.Stage() == 0 && !entry.IntentToAdd() && spec.Match(filepath.ToSlash(entry.Path())) {
+			after[entry.Path()] = entry.OID()
+		}
+	}
+	renames, err := r.newRenameFinder(*options).find(before, after)
+	if err != nil || len(renames) == 0 {
+		return err
+	}
+
+	paired, removed := map[string]Rename{}, map[string]bool{}
+	for _, rename := range renames {
+		paired[rename.To] = rename
+		if !rename.Copy {
+			removed[rename.From] = true
+		}
+	}
+	entries := []StatusEntry{}
+	for _, entry := range status.Entries {
+		if removed[entry.Path] {
+			continue
+		}
+		if rename, found := paired[entry.Path]; found {
+			entry.OrigPath, entry.Index = rename.From, Renamed
+			if rename.Copy {
+				entry.Index = Copied
+			}
+		}
+		entries = append(entries, entry)
+	}
+	status.Entries = entries
+	return nil
+}
+
+func (r *Repository) status(ctx context.Context) (*Status, error) {
+	status := &Status{}
+	ref, err := r.repo.Refs.CurrentRef()
+	if err != nil {
+		return nil, err
+	}
+	if ref != "HEAD" {
+		status.Branch = strings.TrimPrefix(ref, "refs/heads/")
+	}
+	if status.Head, err = r.repo.Refs.ReadHead(); err != nil {
+		return nil, err
+	}
+	headEntries, err := r.treeEntries(status.Head)
+	if err != nil {
+		return nil, err
+	}
+
+	conflicted := map[string]bool{}
+	for _, path := range r.repo.Index.ConflictPaths() {
+		conflicted[path] = true
+		stages := [3]bool{}
+		for stage := 1; stage <= 3; stage++ {
+			_, stages[stage-1] = r.repo.Index.ConflictEntry(path, stage)
+		}
+		status.Conflicts = append(status.Conflicts, Conflict{Path: path, Code: conflictCodes[stages]})
+	}
+
+	changes := map[string]*StatusEntry{}
+	change := func(path string) *StatusEntry {
+		if _, exists := changes[path]; !exists {
+			changes[path] = &StatusEntry{Path: path, Index: Unmodified, Workspace: Unmodified}
+		}
+		return changes[path]
+	}
+
+	for _, entry := range r.repo.Index.Entries() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if entry.Stage() != 0 {
+			continue
+		}
+		headEntry, inHead := headEntries[entry.Path()]
+		switch {
+		case !inHead:
+			change(entry.Path()).Index = Added
+		case headEntry.OID() != entry.OID() || headEntry.Mode() != entry.Mode():
+			change(entry.Path()).Index = Modified
+		}
+		if entry.SkipWorktree() {
+			continue
+		}
+
+		if _, err := r.repo.Workspace.StatFile(entry.Path()); os.IsNotExist(err) {
+			change(entry.Path()).Workspace = Deleted
+			continue
+		}
+		modified, err := r.workspaceModified(entry)
+		if err != nil {
+			return nil, err
+		}
+		if modified {
+			change(entry.Path()).Workspace = Modified
+		}
+	}
+
+	for path := range headEntries {
+		if _, tracked := r.repo.Index.Entry(path); !tracked && !conflicted[path] {
+			change(path).Index = Deleted
+		}
+	}
+	for _, entry := range changes {
+		status.Entries = append(status.Entries, *entry)
+	}
+	sort.Slice(status.Entries, func(i, j int) bool {
+		return status.Entries[i].Path < status.Entries[j].Path
+	})
+
+	files, err := r.repo.Workspace.ListFiles()
+	if err != nil {
+		return nil, err
+	}
+	untracked := map[string]bool{}
+	for _, path := range files {
+		if _, tracked := r.repo.Index.Entry(path); tracked || conflicted[path] {
+			continue
+		}
+		collapsed := path
+		for dir := filepath.Dir(path); dir != "."; dir = filepath.Dir(dir) {
+			if len(r.repo.Index.EntriesUnder(dir)) > 0 {
+				break
+			}
+			collapsed = dir + string(filepath.Separator)
+		}
+		untracked[collapsed] = true
+	}
+	for path := range untracked {
+		status.Untracked = append(status.Untracked, path)
+	}
+	sort.Strings(status.Untracked)
+
+	return status, nil
+}
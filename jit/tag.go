@@ -0,0 +1,112 @@
+package jit
+
+import (
+	"context"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/tpbowden/jit/core"
+	"github.com/tpbowden/jit/database"
+)
+
+type TagOptions struct {
+	// Revision is the commit to tag, HEAD if empty.
+	Revision string
+	// Message makes an annotated tag object holding it. Without one the tag
+	// is a lightweight ref to the commit.
+	Message string
+	// Force replaces an existing tag of the same name.
+	Force bool
+}
+
+// TagResult describes the object a tag points to, and the one it pointed to
+// before if it was replaced.
+type TagResult struct {
+	OID         string
+	PreviousOID string
+}
+
+// Tags lists the names of the tags matching any of the glob patterns, or
+// every tag if none are given.
+func (r *Repository) Tags(patterns ...string) ([]string, error) {
+	refs, err := r.repo.Refs.ListRefs("refs/tags/")
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, ref := range refs {
+		name := strings.TrimPrefix(ref, "refs/tags/")
+		matched := len(patterns) == 0
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, name); ok {
+				matched = true
+				break
+			}
+		}
+		if matched {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// CreateTag tags a commit. An existing tag is only replaced when forced,
+// otherwise a TagExists error is returned.
+func (r *Repository) CreateTag(ctx context.Context, name string, options TagOptions) (*TagResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	ref := "refs/tags/" + name
+	if !core.ValidRefName(ref) {
+		return nil, &InvalidTagName{name}
+	}
+
+	result := &TagResult{}
+	var err error
+	if result.PreviousOID, err = r.repo.Refs.ReadRef(ref); err != nil {
+		return nil, err
+	}
+	if result.PreviousOID != "" && !options.Force {
+		return nil, &TagExists{name}
+	}
+
+	revision := options.Revision
+	if revision == "" {
+		revision = "HEAD"
+	}
+	if result.OID, err = r.repo.ResolveRevision(revision); err != nil {
+		return nil, err
+	}
+
+	if options.Message != "" {
+		identity := r.identity.at(time.Now())
+		tag := database.NewTag(result.OID, "commit", name, identity.author(), options.Message+"\n", identity.When)
+		if err := r.repo.Database.Store(tag); err != nil {
+			return nil, err
+		}
+		result.OID = database.ObjectID(tag)
+	}
+
+	if err := r.repo.Refs.UpdateRef(ref, result.OID); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// DeleteTag removes a tag, returning the object it pointed to. A TagNotFound
+// error is returned if there is no such tag.
+func (r *Repository) DeleteTag(name string) (string, error) {
+	ref := "refs/tags/" + name
+	if !core.ValidRefName(ref) {
+		return "", &TagNotFound{name}
+	}
+	oid, err := r.repo.Refs.ReadRef(ref)
+	if err != nil {
+		return "", err
+	} else if oid == "" {
+		return "", &TagNotFound{name}
+	}
+	return oid, r.repo.Refs.DeleteRef(ref)
+}
@@ -0,0 +1,34 @@
+package lfs
+
+// Driver is the filter driver for files with the filter=lfs attribute. It
+// cleans files into pointers, keeping their content in a store, and smudges
+// pointers back into content. A pointer whose content is not in the store
+// is checked out as it is, and cleaned back into itself, so the file shows
+// as unmodified until the content is fetched.
+type Driver struct {
+	store *Store
+}
+
+// NewDriver creates a driver keeping content in store.
+func NewDriver(store *Store) *Driver {
+	return &Driver{store: store}
+}
+
+func (d *Driver) Clean(path string, data []byte) ([]byte, error) {
+	if _, ok := ParsePointer(data); ok {
+		return data, nil
+	}
+	pointer, err := d.store.Put(data)
+	if err != nil {
+		return nil, err
+	}
+	return pointer.Encode(), nil
+}
+
+func (d *Driver) Smudge(path string, data []byte) ([]byte, error) {
+	pointer, ok := ParsePointer(data)
+	if !ok || !d.store.Has(pointer) {
+		return data, nil
+	}
+	return d.store.Get(pointer)
+}
@@ -0,0 +1,31 @@
+package lfs
+
+import "fmt"
+
+// MissingObject is returned when the content a pointer names is not in a
+// store.
+type MissingObject struct {
+	OID string
+}
+
+func (e *MissingObject) Error() string {
+	return fmt.Sprintf("LFS object not found: %s", e.OID)
+}
+
+func missingObject(oid string) error {
+	return &MissingObject{oid}
+}
+
+// CorruptObject is returned when stored content does not match the size or
+// hash its pointer gives.
+type CorruptObject struct {
+	OID string
+}
+
+func (e *CorruptObject) Error() string {
+	return fmt.Sprintf("LFS object is corrupt: %s", e.OID)
+}
+
+func corruptObject(oid string) error {
+	return &CorruptObject{oid}
+}
@@ -0,0 +1,73 @@
+package lfs_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/tpbowden/jit/lfs"
+)
+
+func TestPointerRoundTrip(t *testing.T) {
+	pointer := lfs.Pointer{OID: "4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393", Size: 12345}
+	parsed, ok := lfs.ParsePointer(pointer.Encode())
+	if !ok || parsed != pointer {
+		t.Fatalf("Unexpected pointer %v, %v", parsed, ok)
+	}
+	for _, data := range []string{
+		"",
+		"hello\n",
+		"version https://git-lfs.github.com/spec/v1\nsize 12\n",
+		"version https://git-lfs.github.com/spec/v1\noid sha256:xyz\nsize 12\n",
+		"version https://git-lfs.github.com/spec/v1\noid 4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393\nsize 12\n",
+	} {
+		if _, ok := lfs.ParsePointer([]byte(data)); ok {
+			t.Fatalf("Expected %q not to parse", data)
+		}
+	}
+}
+
+func TestStoreAndTransfer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jit_lfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	local, remote := lfs.NewStore(dir+"/local"), lfs.NewStore(dir+"/remote")
+
+	driver := lfs.NewDriver(local)
+	cleaned, err := driver.Clean("a.bin", []byte("content\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pointer, ok := lfs.ParsePointer(cleaned)
+	if !ok || pointer.Size != 8 || !local.Has(pointer) {
+		t.Fatalf("Unexpected pointer %q", cleaned)
+	}
+	if again, _ := driver.Clean("a.bin", cleaned); string(again) != string(cleaned) {
+		t.Fatalf("Expected a pointer to clean to itself, got %q", again)
+	}
+	if smudged, err := driver.Smudge("a.bin", cleaned); err != nil || string(smudged) != "content\n" {
+		t.Fatalf("Unexpected smudged content %q, %v", smudged, err)
+	}
+
+	adapter := &lfs.LocalAdapter{Remote: remote}
+	ctx := context.Background()
+	if copied, err := adapter.Upload(ctx, local, []lfs.Pointer{pointer}); err != nil || copied != 1 {
+		t.Fatalf("Unexpected upload %d, %v", copied, err)
+	}
+	if copied, err := adapter.Upload(ctx, local, []lfs.Pointer{pointer}); err != nil || copied != 0 {
+		t.Fatalf("Expected nothing to upload, got %d, %v", copied, err)
+	}
+	if data, err := remote.Get(pointer); err != nil || string(data) != "content\n" {
+		t.Fatalf("Unexpected remote content %q, %v", data, err)
+	}
+
+	missing := lfs.Pointer{OID: pointer.OID[:63] + "0", Size: 8}
+	if _, err := adapter.Download(ctx, local, []lfs.Pointer{missing}); err == nil {
+		t.Fatal("Expected an error")
+	} else if _, ok := err.(*lfs.MissingObject); !ok {
+		t.Fatalf("Expected MissingObject, got %v", err)
+	}
+}
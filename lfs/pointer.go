@@ -0,0 +1,68 @@
+// Package lfs stores large files outside the object database in the way Git
+// LFS does. Such files are committed as small pointer blobs naming the
+// SHA-256 of their content, which is kept in .git/lfs/objects, and are
+// swapped back in when checked out.
+package lfs
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Version is the spec URL a pointer starts with.
+const Version = "https://git-lfs.github.com/spec/v1"
+
+// MaxPointerSize is the largest a pointer blob can be. Anything bigger is
+// never read as one.
+const MaxPointerSize = 1024
+
+var oidPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// Pointer stands in for a file's content in the object database.
+type Pointer struct {
+	OID  string
+	Size int64
+}
+
+// Encode returns the pointer as the text stored in its blob.
+func (p Pointer) Encode() []byte {
+	return []byte(fmt.Sprintf("version %s\noid sha256:%s\nsize %d\n", Version, p.OID, p.Size))
+}
+
+// ParsePointer reads the text of a pointer blob, returning false if data is
+// not one.
+func ParsePointer(data []byte) (Pointer, bool) {
+	if len(data) > MaxPointerSize {
+		return Pointer{}, false
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) < 3 || lines[0] != "version "+Version {
+		return Pointer{}, false
+	}
+
+	pointer, found := Pointer{}, 0
+	for _, line := range lines[1:] {
+		parts := strings.SplitN(line, " ", 2)
+		if len(parts) != 2 {
+			return Pointer{}, false
+		}
+		switch parts[0] {
+		case "oid":
+			pointer.OID = strings.TrimPrefix(parts[1], "sha256:")
+			if !oidPattern.MatchString(pointer.OID) || pointer.OID == parts[1] {
+				return Pointer{}, false
+			}
+			found++
+		case "size":
+			size, err := strconv.ParseInt(parts[1], 10, 64)
+			if err != nil || size < 0 {
+				return Pointer{}, false
+			}
+			pointer.Size = size
+			found++
+		}
+	}
+	return pointer, found == 2
+}
@@ -0,0 +1,82 @@
+package lfs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Store holds the content of large files under the lfs directory of a git
+// directory, each at objects/<first two>/<next two>/<oid> as Git LFS lays
+// them out.
+type Store struct {
+	dir string
+}
+
+// NewStore returns the store for the git directory at gitDir.
+func NewStore(gitDir string) *Store {
+	return &Store{dir: filepath.Join(gitDir, "lfs")}
+}
+
+// Path returns where the content with an ID is kept.
+func (s *Store) Path(oid string) string {
+	return filepath.Join(s.dir, "objects", oid[0:2], oid[2:4], oid)
+}
+
+// Has reports whether the store holds the content a pointer names.
+func (s *Store) Has(pointer Pointer) bool {
+	stat, err := os.Stat(s.Path(pointer.OID))
+	return err == nil && stat.Size() == pointer.Size
+}
+
+// Put stores content, returning the pointer that names it.
+func (s *Store) Put(data []byte) (Pointer, error) {
+	sum := sha256.Sum256(data)
+	pointer := Pointer{OID: hex.EncodeToString(sum[:]), Size: int64(len(data))}
+	if s.Has(pointer) {
+		return pointer, nil
+	}
+
+	path := s.Path(pointer.OID)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return pointer, err
+	}
+	tmpDir := filepath.Join(s.dir, "tmp")
+	if err := os.MkdirAll(tmpDir, os.ModePerm); err != nil {
+		return pointer, err
+	}
+	tmp, err := ioutil.TempFile(tmpDir, pointer.OID)
+	if err != nil {
+		return pointer, err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return pointer, err
+	}
+	return pointer, nil
+}
+
+// Get reads the content a pointer names, checking it has the expected size
+// and hash.
+func (s *Store) Get(pointer Pointer) ([]byte, error) {
+	data, err := ioutil.ReadFile(s.Path(pointer.OID))
+	if os.IsNotExist(err) {
+		return nil, missingObject(pointer.OID)
+	} else if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	if int64(len(data)) != pointer.Size || hex.EncodeToString(sum[:]) != pointer.OID {
+		return nil, corruptObject(pointer.OID)
+	}
+	return data, nil
+}
@@ -0,0 +1,49 @@
+package lfs
+
+import "context"
+
+// Adapter moves content between a local store and a remote one.
+type Adapter interface {
+	// Download copies the content each pointer names into local, and
+	// Upload copies it from local. Both skip content the other side already
+	// has and return how many objects they copied.
+	Download(ctx context.Context, local *Store, pointers []Pointer) (int, error)
+	Upload(ctx context.Context, local *Store, pointers []Pointer) (int, error)
+}
+
+// LocalAdapter transfers content to and from the store of a repository on
+// the same filesystem.
+type LocalAdapter struct {
+	Remote *Store
+}
+
+func (a *LocalAdapter) Download(ctx context.Context, local *Store, pointers []Pointer) (int, error) {
+	return copyObjects(ctx, a.Remote, local, pointers)
+}
+
+func (a *LocalAdapter) Upload(ctx context.Context, local *Store, pointers []Pointer) (int, error) {
+	return copyObjects(ctx, local, a.Remote, pointers)
+}
+
+// copyObjects copies content between stores, checking each object as it is
+// read so corrupt content is never passed on.
+func copyObjects(ctx context.Context, from, to *Store, pointers []Pointer) (int, error) {
+	copied := 0
+	for _, pointer := range pointers {
+		if err := ctx.Err(); err != nil {
+			return copied, err
+		}
+		if to.Has(pointer) {
+			continue
+		}
+		data, err := from.Get(pointer)
+		if err != nil {
+			return copied, err
+		}
+		if _, err := to.Put(data); err != nil {
+			return copied, err
+		}
+		copied++
+	}
+	return copied, nil
+}
@@ -0,0 +1,33 @@
+package pathspec
+
+import "fmt"
+
+// InvalidMagic is returned for a magic signature that is not recognised, or
+// for magic that cannot be combined.
+type InvalidMagic struct {
+	Magic    string
+	Pathspec string
+}
+
+func (e *InvalidMagic) Error() string {
+	return fmt.Sprintf("Unimplemented pathspec magic '%s' in '%s'", e.Magic, e.Pathspec)
+}
+
+// OutsideRepository is returned for a pattern that climbs out of the working
+// tree.
+type OutsideRepository struct {
+	Pathspec string
+}
+
+func (e *OutsideRepository) Error() string {
+	return fmt.Sprintf("%s: '%s' is outside repository", e.Pathspec, e.Pathspec)
+}
+
+// Unmatched is returned by Check for a pattern that chose no paths.
+type Unmatched struct {
+	Pathspec string
+}
+
+func (e *Unmatched) Error() string {
+	return fmt.Sprintf("pathspec '%s' did not match any files", e.Pathspec)
+}
@@ -0,0 +1,207 @@
+// Package pathspec parses and matches the patterns commands use to choose
+// files, in git's syntax. A pattern is a path, which also matches everything
+// inside it when it names a directory, or a glob. It may start with magic
+// signatures: either ":(top,exclude,icase,literal,glob)" in long form, or
+// short ones such as ":/" for top and ":!" or ":^" for exclude.
+package pathspec
+
+import (
+	"path"
+	"strings"
+)
+
+// Magic changes how a pattern is matched.
+type Magic int
+
+const (
+	// Top makes the pattern relative to the top of the working tree rather
+	// than the current directory.
+	Top Magic = 1 << iota
+	// Literal turns off globbing.
+	Literal
+	// Glob stops * from matching a slash, leaving that to **.
+	Glob
+	// IgnoreCase matches regardless of case.
+	IgnoreCase
+	// Exclude removes the paths the pattern matches from the result.
+	Exclude
+)
+
+var magicWords = map[string]Magic{
+	"top":     Top,
+	"literal": Literal,
+	"glob":    Glob,
+	"icase":   IgnoreCase,
+	"exclude": Exclude,
+}
+
+var magicChars = map[byte]Magic{
+	'/': Top,
+	'!': Exclude,
+	'^': Exclude,
+}
+
+// Pattern is one parsed pathspec. Path is relative to the top of the
+// working tree, slash separated, and empty if it covers the whole tree.
+type Pattern struct {
+	Original string
+	Path     string
+	Magic    Magic
+	// Wildcard is set if Path contains glob characters to expand.
+	Wildcard bool
+	// Directory is set if the pattern ended in a slash, so only matches the
+	// contents of a directory.
+	Directory bool
+}
+
+// Pathspec is a set of patterns. A path matches it if it matches any pattern
+// that is not an exclude, or there are only excludes, and matches none of
+// the excludes.
+type Pathspec struct {
+	patterns []Pattern
+}
+
+// Parse reads each argument as a pattern. prefix is the current directory
+// relative to the top of the working tree, which patterns are relative to
+// unless they have the top magic.
+func Parse(args []string, prefix string) (*Pathspec, error) {
+	spec := &Pathspec{}
+	for _, arg := range args {
+		pattern, err := parsePattern(arg, prefix)
+		if err != nil {
+			return nil, err
+		}
+		spec.patterns = append(spec.patterns, pattern)
+	}
+	return spec, nil
+}
+
+func parsePattern(arg, prefix string) (Pattern, error) {
+	pattern, body := Pattern{Original: arg}, arg
+	switch {
+	case strings.HasPrefix(arg, ":("):
+		end := strings.IndexByte(arg, ')')
+		if end == -1 {
+			return pattern, &InvalidMagic{Magic: arg[2:], Pathspec: arg}
+		}
+		for _, word := range strings.Split(arg[2:end], ",") {
+			magic, known := magicWords[strings.TrimSpace(word)]
+			if !known {
+				return pattern, &InvalidMagic{Magic: word, Pathspec: arg}
+			}
+			pattern.Magic |= magic
+		}
+		body = arg[end+1:]
+	case strings.HasPrefix(arg, ":"):
+		i := 1
+		for ; i < len(arg); i++ {
+			magic, known := magicChars[arg[i]]
+			if !known {
+				break
+			}
+			pattern.Magic |= magic
+		}
+		if i < len(arg) && arg[i] == ':' {
+			i++
+		}
+		body = arg[i:]
+	}
+	if pattern.Magic&Literal != 0 && pattern.Magic&Glob != 0 {
+		return pattern, &InvalidMagic{Magic: "literal,glob", Pathspec: arg}
+	}
+
+	pattern.Directory = strings.HasSuffix(body, "/") && strings.Trim(body, "/") != ""
+	if pattern.Magic&Top == 0 {
+		body = prefix + "/" + body
+	}
+	cleaned := path.Clean(strings.TrimLeft(body, "/"))
+	if cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return pattern, &OutsideRepository{Pathspec: arg}
+	}
+	if cleaned != "." {
+		pattern.Path = cleaned
+	}
+	if pattern.Magic&IgnoreCase != 0 {
+		pattern.Path = strings.ToLower(pattern.Path)
+	}
+	pattern.Wildcard = pattern.Magic&Literal == 0 && strings.ContainsAny(pattern.Path, "*?[")
+	return pattern, nil
+}
+
+// Empty reports whether there are no patterns, so every path matches.
+func (p *Pathspec) Empty() bool {
+	return p == nil || len(p.patterns) == 0
+}
+
+// Patterns returns the parsed patterns in the order given.
+func (p *Pathspec) Patterns() []Pattern {
+	if p == nil {
+		return nil
+	}
+	return p.patterns
+}
+
+// Match reports whether a path, relative to the top of the working tree,
+// is chosen by the pathspec.
+func (p *Pathspec) Match(path string) bool {
+	if p.Empty() {
+		return true
+	}
+	included, includes := false, 0
+	for _, pattern := range p.patterns {
+		if pattern.Magic&Exclude != 0 {
+			if pattern.Match(path) {
+				return false
+			}
+			continue
+		}
+		includes++
+		included = included || pattern.Match(path)
+	}
+	return included || includes == 0
+}
+
+// Check returns an Unmatched error for the first pattern that is not an
+// exclude and matches none of the paths given. A pattern covering the whole
+// tree always counts as matched, since the tree may just be empty.
+func (p *Pathspec) Check(paths []string) error {
+	for _, pattern := range p.Patterns() {
+		if pattern.Magic&Exclude != 0 || pattern.Path == "" {
+			continue
+		}
+		found := false
+		for _, path := range paths {
+			if found = pattern.Match(path) && p.Match(path); found {
+				break
+			}
+		}
+		if !found {
+			return &Unmatched{Pathspec: pattern.Original}
+		}
+	}
+	return nil
+}
+
+// Match reports whether the pattern matches a path, or a directory the path
+// is inside.
+func (pattern Pattern) Match(path string) bool {
+	if pattern.Magic&IgnoreCase != 0 {
+		path = strings.ToLower(path)
+	}
+	if pattern.Path == "" {
+		return true
+	}
+	if !pattern.Wildcard {
+		return !pattern.Directory && path == pattern.Path || strings.HasPrefix(path, pattern.Path+"/")
+	}
+	pathname := pattern.Magic&Glob != 0
+	for end := len(path); end > 0; end = strings.LastIndexByte(path[:end], '/') {
+		if end == len(path) && pattern.Directory {
+			continue
+		}
+		if Wildmatch(pattern.Path, path[:end], pathname) {
+			return true
+		}
+	}
+	return false
+}
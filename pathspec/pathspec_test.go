@@ -0,0 +1,107 @@
+package pathspec_test
+
+import (
+	"testing"
+
+	"github.com/tpbowden/jit/pathspec"
+)
+
+var paths = []string{"README.md", "docs/guide.md", "docs/api/index.md", "src/main.go", "src/util/Strings.go"}
+
+func matching(t *testing.T, prefix string, args ...string) []string {
+	spec, err := pathspec.Parse(args, prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	matched := []string{}
+	for _, path := range paths {
+		if spec.Match(path) {
+			matched = append(matched, path)
+		}
+	}
+	return matched
+}
+
+func TestPathspecMatchesPathsAndGlobs(t *testing.T) {
+	cases := []struct {
+		prefix string
+		args   []string
+		want   []string
+	}{
+		{"", nil, paths},
+		{"", []string{"."}, paths},
+		{"", []string{"docs"}, []string{"docs/guide.md", "docs/api/index.md"}},
+		{"", []string{"doc"}, []string{}},
+		{"", []string{"*.md"}, []string{"README.md", "docs/guide.md", "docs/api/index.md"}},
+		{"", []string{":(glob)*.md"}, []string{"README.md"}},
+		{"", []string{":(glob)docs/**/*.md"}, []string{"docs/guide.md", "docs/api/index.md"}},
+		{"", []string{"src/[a-m]*"}, []string{"src/main.go"}},
+		{"", []string{":(literal)*.md"}, []string{}},
+		{"", []string{":(icase)src/util/strings.GO"}, []string{"src/util/Strings.go"}},
+		{"", []string{":!docs"}, []string{"README.md", "src/main.go", "src/util/Strings.go"}},
+		{"", []string{"src", ":^src/util"}, []string{"src/main.go"}},
+		{"", []string{"*.go", ":(exclude,glob)src/*.go"}, []string{"src/util/Strings.go"}},
+		{"docs", []string{"api"}, []string{"docs/api/index.md"}},
+		{"docs", []string{":/src/main.go"}, []string{"src/main.go"}},
+		{"docs", []string{"../README.md"}, []string{"README.md"}},
+	}
+	for _, c := range cases {
+		got := matching(t, c.prefix, c.args...)
+		if len(got) != len(c.want) {
+			t.Fatalf("%q in %q matched %v, expected %v", c.args, c.prefix, got, c.want)
+		}
+		for i := range got {
+			if got[i] != c.want[i] {
+				t.Fatalf("%q in %q matched %v, expected %v", c.args, c.prefix, got, c.want)
+			}
+		}
+	}
+}
+
+func TestPathspecErrors(t *testing.T) {
+	if _, err := pathspec.Parse([]string{":(bogus)x"}, ""); err == nil {
+		t.Fatal("Expected an error")
+	} else if _, ok := err.(*pathspec.InvalidMagic); !ok {
+		t.Fatalf("Expected InvalidMagic, got %v", err)
+	}
+	if _, err := pathspec.Parse([]string{"../x"}, ""); err == nil {
+		t.Fatal("Expected an error")
+	} else if _, ok := err.(*pathspec.OutsideRepository); !ok {
+		t.Fatalf("Expected OutsideRepository, got %v", err)
+	}
+
+	spec, err := pathspec.Parse([]string{"src", "*.txt"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := spec.Check(paths); err == nil {
+		t.Fatal("Expected an error")
+	} else if unmatched, ok := err.(*pathspec.Unmatched); !ok || unmatched.Pathspec != "*.txt" {
+		t.Fatalf("Expected *.txt to be unmatched, got %v", err)
+	}
+}
+
+func TestWildmatch(t *testing.T) {
+	cases := []struct {
+		pattern, name  string
+		pathname, want bool
+	}{
+		{"a*c", "abc", true, true},
+		{"a*c", "a/c", true, false},
+		{"a*c", "a/c", false, true},
+		{"a/**/c", "a/c", true, true},
+		{"a/**/c", "a/b/d/c", true, true},
+		{"a?c", "a/c", true, false},
+		{"[!a]x", "bx", true, true},
+		{"[!a]x", "ax", true, false},
+		{"[]]", "]", true, true},
+		{`\*`, "*", true, true},
+		{`\*`, "a", true, false},
+		{"[ab", "[ab", true, true},
+	}
+	for _, c := range cases {
+		if got := pathspec.Wildmatch(c.pattern, c.name, c.pathname); got != c.want {
+			t.Fatalf("Wildmatch(%q, %q, %v) = %v", c.pattern, c.name, c.pathname, got)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package pathspec
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Wildmatch reports whether name matches a glob pattern with *, ?, bracket
+// expressions and backslash escapes. If pathname is set, * and ? do not
+// match a slash, while ** matches any number of directories; otherwise *
+// matches across directories as it does in pathspecs by default.
+func Wildmatch(pattern, name string, pathname bool) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			double := strings.HasPrefix(pattern, "**")
+			pattern = strings.TrimLeft(pattern, "*")
+			crossing := !pathname || double
+			if double && pathname && strings.HasPrefix(pattern, "/") && Wildmatch(pattern[1:], name, pathname) {
+				return true
+			}
+			for i := 0; i <= len(name); i++ {
+				if Wildmatch(pattern, name[i:], pathname) {
+					return true
+				}
+				if i < len(name) && name[i] == '/' && !crossing {
+					return false
+				}
+			}
+			return false
+		case '?':
+			if name == "" || pathname && name[0] == '/' {
+				return false
+			}
+			_, size := utf8.DecodeRuneInString(name)
+			pattern, name = pattern[1:], name[size:]
+		case '[':
+			if name == "" || pathname && name[0] == '/' {
+				return false
+			}
+			char, size := utf8.DecodeRuneInString(name)
+			matched, rest, ok := matchClass(pattern[1:], char)
+			if !ok {
+				if name[0] != '[' {
+					return false
+				}
+				pattern, name = pattern[1:], name[1:]
+				continue
+			}
+			if !matched {
+				return false
+			}
+			pattern, name = rest, name[size:]
+		default:
+			if pattern[0] == '\\' && len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			if name == "" || name[0] != pattern[0] {
+				return false
+			}
+			pattern, name = pattern[1:], name[1:]
+		}
+	}
+	return name == ""
+}
+
+// matchClass matches a character against the bracket expression starting
+// just after its opening bracket, returning the pattern after the closing
+// one. ok is false if the expression is never closed, in which case the
+// bracket is an ordinary character.
+func matchClass(pattern string, char rune) (matched bool, rest string, ok bool) {
+	negate := false
+	if strings.HasPrefix(pattern, "!") || strings.HasPrefix(pattern, "^") {
+		negate, pattern = true, pattern[1:]
+	}
+	for first := true; len(pattern) > 0; first = false {
+		if pattern[0] == ']' && !first {
+			return matched != negate, pattern[1:], true
+		}
+		low, size := classChar(pattern)
+		pattern = pattern[size:]
+		high := low
+		if len(pattern) > 1 && pattern[0] == '-' && pattern[1] != ']' {
+			high, size = classChar(pattern[1:])
+			pattern = pattern[1+size:]
+		}
+		if low <= char && char <= high {
+			matched = true
+		}
+	}
+	return false, "", false
+}
+
+func classChar(pattern string) (rune, int) {
+	if pattern[0] == '\\' && len(pattern) > 1 {
+		char, size := utf8.DecodeRuneInString(pattern[1:])
+		return char, size + 1
+	}
+	return utf8.DecodeRuneInString(pattern)
+}
@@ -0,0 +1,77 @@
+package remote
+
+import "fmt"
+
+type UnknownRemote struct {
+	name string
+}
+
+func (e *UnknownRemote) Error() string {
+	return fmt.Sprintf("No such remote '%s'", e.name)
+}
+
+func unknownRemote(name string) error {
+	return &UnknownRemote{name}
+}
+
+type RemoteExists struct {
+	name string
+}
+
+func (e *RemoteExists) Error() string {
+	return fmt.Sprintf("remote %s already exists.", e.name)
+}
+
+func remoteExists(name string) error {
+	return &RemoteExists{name}
+}
+
+type InvalidRefspec struct {
+	spec string
+}
+
+func (e *InvalidRefspec) Error() string {
+	return fmt.Sprintf("invalid refspec '%s'", e.spec)
+}
+
+func invalidRefspec(spec string) error {
+	return &InvalidRefspec{spec}
+}
+
+type NoRepository struct {
+	url string
+}
+
+func (e *NoRepository) Error() string {
+	return fmt.Sprintf("'%s' does not appear to be a jit repository", e.url)
+}
+
+func noRepository(url string) error {
+	return &NoRepository{url}
+}
+
+type Unreachable struct {
+	url string
+	err error
+}
+
+func (e *Unreachable) Error() string {
+	return fmt.Sprintf("Could not read from remote repository '%s': %v", e.url, e.err)
+}
+
+func unreachable(url string, err error) error {
+	return &Unreachable{url, err}
+}
+
+type Unsupported struct {
+	url       string
+	operation string
+}
+
+func (e *Unsupported) Error() string {
+	return fmt.Sprintf("connection to '%s' was not opened to %s", e.url, e.operation)
+}
+
+func unsupported(url, operation string) error {
+	return &Unsupported{url, operation}
+}
@@ -0,0 +1,107 @@
+package remote
+
+import (
+	"context"
+
+	"github.com/tpbowden/jit/database"
+	"github.com/tpbowden/jit/repository"
+)
+
+// localConnection talks directly to a repository on the same filesystem.
+type localConnection struct {
+	repo *repository.Repository
+	bare bool
+}
+
+func connectLocal(url, path string) (Connection, error) {
+	gitDir, bare, ok := repository.Discover(path)
+	if !ok {
+		return nil, noRepository(url)
+	}
+
+	repo, err := repository.Open(gitDir)
+	if err != nil {
+		return nil, err
+	}
+	return &localConnection{repo: repo, bare: bare}, nil
+}
+
+func (l *localConnection) Refs(ctx context.Context) (Advertisement, error) {
+	ad := Advertisement{Refs: map[string]string{}}
+	names, err := l.repo.Refs.ListRefs("refs/")
+	if err != nil {
+		return ad, err
+	}
+	for _, name := range names {
+		oid, err := l.repo.Refs.ReadRef(name)
+		if err != nil {
+			return ad, err
+		}
+		ad.Refs[name] = oid
+	}
+
+	head, err := l.repo.Refs.CurrentRef()
+	if err != nil {
+		return ad, err
+	}
+	if head != "HEAD" {
+		ad.Head = head
+	}
+	if oid, err := l.repo.Refs.ReadHead(); err != nil {
+		return ad, err
+	} else if oid != "" {
+		ad.Refs["HEAD"] = oid
+	}
+	return ad, nil
+}
+
+func (l *localConnection) Fetch(ctx context.Context, local database.ObjectStore, wants, haves []string) error {
+	_, err := database.CopyObjects(ctx, l.repo.Database, local, wants)
+	return err
+}
+
+func (l *localConnection) Push(ctx context.Context, local database.ObjectStore, updates []RefUpdate) ([]error, error) {
+	tips := []string{}
+	for _, update := range updates {
+		tips = append(tips, update.New)
+	}
+	if _, err := database.CopyObjects(ctx, local, l.repo.Database, tips); err != nil {
+		return nil, err
+	}
+
+	head, err := l.repo.Refs.CurrentRef()
+	if err != nil {
+		return nil, err
+	}
+
+	results := []error{}
+	for _, update := range updates {
+		current, err := l.repo.Refs.ReadRef(update.Name)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case current != update.Old:
+			results = append(results, rejected(update.Name, "stale info"))
+			continue
+		case !l.bare && update.Name == head:
+			results = append(results, rejected(update.Name, "branch is currently checked out"))
+			continue
+		}
+
+		if update.New == "" {
+			err = l.repo.Refs.DeleteRef(update.Name)
+		} else {
+			err = l.repo.Refs.UpdateRef(update.Name, update.New)
+		}
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, nil)
+	}
+	return results, nil
+}
+
+func (l *localConnection) Close() error {
+	return nil
+}
@@ -0,0 +1,72 @@
+package remote
+
+import "strings"
+
+// Refspec maps refs on one side of a transfer to refs on the other, such as
+// "+refs/heads/*:refs/remotes/origin/*". A leading "+" allows updates that
+// are not fast-forwards.
+type Refspec struct {
+	Source      string
+	Destination string
+	Force       bool
+}
+
+func ParseRefspec(spec string) (Refspec, error) {
+	refspec := Refspec{}
+	if strings.HasPrefix(spec, "+") {
+		refspec.Force = true
+		spec = spec[1:]
+	}
+
+	parts := strings.SplitN(spec, ":", 2)
+	refspec.Source = parts[0]
+	refspec.Destination = parts[0]
+	if len(parts) == 2 {
+		refspec.Destination = parts[1]
+	}
+
+	if strings.Count(refspec.Source, "*") > 1 ||
+		strings.Count(refspec.Source, "*") != strings.Count(refspec.Destination, "*") ||
+		(refspec.Source == "" && refspec.Destination == "") {
+		return Refspec{}, invalidRefspec(spec)
+	}
+	return refspec, nil
+}
+
+func (r Refspec) String() string {
+	result := r.Source + ":" + r.Destination
+	if r.Force {
+		result = "+" + result
+	}
+	return result
+}
+
+// Match returns the destination that a source ref maps to, if the refspec
+// applies to it.
+func (r Refspec) Match(name string) (string, bool) {
+	star := strings.Index(r.Source, "*")
+	if star == -1 {
+		return r.Destination, name == r.Source
+	}
+
+	prefix, suffix := r.Source[:star], r.Source[star+1:]
+	if len(name) < len(prefix)+len(suffix) || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, suffix) {
+		return "", false
+	}
+	middle := name[len(prefix) : len(name)-len(suffix)]
+	return strings.Replace(r.Destination, "*", middle, 1), true
+}
+
+// expandRef turns a short name such as "master" into a full ref name,
+// preferring an existing ref.
+func expandRef(name string, exists func(string) bool) string {
+	if strings.HasPrefix(name, "refs/") || name == "HEAD" {
+		return name
+	}
+	for _, prefix := range []string{"refs/heads/", "refs/tags/"} {
+		if exists(prefix + name) {
+			return prefix + name
+		}
+	}
+	return "refs/heads/" + name
+}
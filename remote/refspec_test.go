@@ -0,0 +1,41 @@
+package remote_test
+
+import (
+	"testing"
+
+	"github.com/tpbowden/jit/remote"
+)
+
+func TestParseRefspec(t *testing.T) {
+	refspec, err := remote.ParseRefspec("+refs/heads/*:refs/remotes/origin/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !refspec.Force || refspec.Source != "refs/heads/*" || refspec.Destination != "refs/remotes/origin/*" {
+		t.Fatalf("Unexpected refspec %#v", refspec)
+	}
+	if refspec.String() != "+refs/heads/*:refs/remotes/origin/*" {
+		t.Fatalf("Unexpected string %q", refspec.String())
+	}
+
+	for _, spec := range []string{"refs/heads/*:refs/remotes/origin/master", "refs/*/*:refs/*/*", ":"} {
+		if _, err := remote.ParseRefspec(spec); err == nil {
+			t.Fatalf("Expected %q to be invalid", spec)
+		}
+	}
+}
+
+func TestRefspecMatch(t *testing.T) {
+	refspec, _ := remote.ParseRefspec("refs/heads/*:refs/remotes/origin/*")
+	if name, ok := refspec.Match("refs/heads/topic/one"); !ok || name != "refs/remotes/origin/topic/one" {
+		t.Fatalf("Unexpected match %q %v", name, ok)
+	}
+	if _, ok := refspec.Match("refs/tags/v1"); ok {
+		t.Fatal("Expected tags not to match")
+	}
+
+	exact, _ := remote.ParseRefspec("refs/heads/master:refs/heads/main")
+	if name, ok := exact.Match("refs/heads/master"); !ok || name != "refs/heads/main" {
+		t.Fatalf("Unexpected match %q %v", name, ok)
+	}
+}
@@ -0,0 +1,90 @@
+// Package remote manages the remotes configured for a repository and
+// transfers objects and refs between repositories.
+package remote
+
+import (
+	"github.com/tpbowden/jit/config"
+	"github.com/tpbowden/jit/core"
+)
+
+// Remote is another repository configured under remote.<name> in the config.
+// UploadPack and ReceivePack override the programs the smart protocol runs.
+type Remote struct {
+	Name        string
+	URL         string
+	Fetch       []Refspec
+	UploadPack  string
+	ReceivePack string
+}
+
+// DefaultFetch returns the refspec a new remote fetches with, which tracks
+// all of its branches under refs/remotes/<name>/.
+func DefaultFetch(name string) Refspec {
+	return Refspec{Source: "refs/heads/*", Destination: "refs/remotes/" + name + "/*", Force: true}
+}
+
+// Get reads the configuration of the named remote.
+func Get(cfg *config.Config, name string) (Remote, error) {
+	url, exists := cfg.Get("remote." + name + ".url")
+	if !exists {
+		return Remote{}, unknownRemote(name)
+	}
+
+	remote := Remote{Name: name, URL: url}
+	remote.UploadPack, _ = cfg.Get("remote." + name + ".uploadpack")
+	remote.ReceivePack, _ = cfg.Get("remote." + name + ".receivepack")
+	for _, spec := range cfg.GetAll("remote." + name + ".fetch") {
+		refspec, err := ParseRefspec(spec)
+		if err != nil {
+			return Remote{}, err
+		}
+		remote.Fetch = append(remote.Fetch, refspec)
+	}
+	return remote, nil
+}
+
+// List returns every configured remote, sorted by name.
+func List(cfg *config.Config) ([]Remote, error) {
+	remotes := []Remote{}
+	for _, name := range cfg.Subsections("remote") {
+		remote, err := Get(cfg, name)
+		if err != nil {
+			if _, ok := err.(*UnknownRemote); ok {
+				continue
+			}
+			return nil, err
+		}
+		remotes = append(remotes, remote)
+	}
+	return remotes, nil
+}
+
+// Add records a new remote with the default fetch refspec.
+func Add(cfg *config.Config, name, url string) error {
+	if !core.ValidRefName("refs/remotes/" + name) {
+		return invalidRefspec(name)
+	}
+	if err := cfg.OpenForUpdate(); err != nil {
+		return err
+	}
+	if _, exists := cfg.Get("remote." + name + ".url"); exists {
+		cfg.ReleaseLock()
+		return remoteExists(name)
+	}
+	cfg.Set("remote."+name+".url", url)
+	cfg.Set("remote."+name+".fetch", DefaultFetch(name).String())
+	return cfg.Save()
+}
+
+// Remove deletes a remote's configuration. Its remote-tracking refs are left
+// for the caller to delete.
+func Remove(cfg *config.Config, name string) error {
+	if err := cfg.OpenForUpdate(); err != nil {
+		return err
+	}
+	if !cfg.RemoveSection("remote." + name) {
+		cfg.ReleaseLock()
+		return unknownRemote(name)
+	}
+	return cfg.Save()
+}
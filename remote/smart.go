@@ -0,0 +1,216 @@
+package remote
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/tpbowden/jit/database"
+	"github.com/tpbowden/jit/transport"
+)
+
+// smartConnection talks to upload-pack or receive-pack running in another
+// process, either on this machine for file:// URLs or on another over ssh,
+// or to a smart HTTP server, in which case cmd is nil.
+type smartConnection struct {
+	url      string
+	cmd      *exec.Cmd
+	stdin    io.WriteCloser
+	fetch    *transport.FetchClient
+	push     *transport.PushClient
+	progress io.Writer
+}
+
+// parseSSH splits an ssh URL, either ssh://[user@]host[:port]/path or the
+// scp-style [user@]host:path, into its parts.
+func parseSSH(url string) (host, port, path string, ok bool) {
+	if strings.HasPrefix(url, "ssh://") {
+		rest := strings.TrimPrefix(url, "ssh://")
+		slash := strings.Index(rest, "/")
+		if slash <= 0 {
+			return "", "", "", false
+		}
+		host, path = rest[:slash], rest[slash:]
+		if colon := strings.LastIndex(host, ":"); colon != -1 {
+			host, port = host[:colon], host[colon+1:]
+		}
+		return host, port, path, true
+	}
+
+	colon := strings.Index(url, ":")
+	if strings.Contains(url, "://") || colon <= 0 || strings.Contains(url[:colon], "/") {
+		return "", "", "", false
+	}
+	return url[:colon], "", url[colon+1:], true
+}
+
+func shellQuote(arg string) string {
+	return "'" + strings.Replace(arg, "'", `'\''`, -1) + "'"
+}
+
+// smartCommand builds the command running program for url. Hosts and ports
+// beginning with a dash are refused so that they cannot be taken as options
+// by ssh.
+func smartCommand(ctx context.Context, url, program, ssh string) (*exec.Cmd, error) {
+	if strings.HasPrefix(url, "file://") {
+		return exec.CommandContext(ctx, "sh", "-c", program+` "$@"`, program, strings.TrimPrefix(url, "file://")), nil
+	}
+
+	host, port, path, _ := parseSSH(url)
+	if strings.HasPrefix(host, "-") {
+		return nil, unreachable(url, fmt.Errorf("strange hostname '%s' blocked", host))
+	}
+	if strings.HasPrefix(port, "-") {
+		return nil, unreachable(url, fmt.Errorf("strange port '%s' blocked", port))
+	}
+	if ssh == "" {
+		ssh = "ssh"
+	}
+	args := []string{"-c", ssh + ` "$@"`, ssh, "-o", "SendEnv=GIT_PROTOCOL"}
+	if port != "" {
+		args = append(args, "-p", port)
+	}
+	args = append(args, "--", host, program+" "+shellQuote(path))
+	return exec.CommandContext(ctx, "sh", args...), nil
+}
+
+func connectSmart(ctx context.Context, url string, options ConnectOptions) (Connection, error) {
+	program := options.UploadPack
+	if options.Push {
+		program = options.ReceivePack
+	}
+
+	cmd, err := smartCommand(ctx, url, program, options.SSHCommand)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Env = append(os.Environ(), "GIT_PROTOCOL=version=2")
+	cmd.Stderr = options.Progress
+	if cmd.Stderr == nil {
+		cmd.Stderr = ioutil.Discard
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	conn := &smartConnection{url: url, cmd: cmd, stdin: stdin, progress: options.Progress}
+	if options.Push {
+		conn.push, err = transport.NewPushClient(stdout, stdin)
+	} else {
+		conn.fetch, err = transport.NewFetchClient(stdout, stdin)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, unreachable(url, err)
+	}
+	return conn, nil
+}
+
+func connectHTTP(ctx context.Context, url string, options ConnectOptions) (Connection, error) {
+	conn := &smartConnection{url: url, progress: options.Progress}
+	var err error
+	if options.Push {
+		conn.push, err = transport.NewHTTPPushClient(ctx, url, options.HTTP)
+	} else {
+		conn.fetch, err = transport.NewHTTPFetchClient(ctx, url, options.HTTP)
+	}
+	if err != nil {
+		return nil, unreachable(url, err)
+	}
+	return conn, nil
+}
+
+func (s *smartConnection) Refs(ctx context.Context) (Advertisement, error) {
+	ad := Advertisement{Refs: map[string]string{}}
+	if s.push != nil {
+		for _, ref := range s.push.Refs() {
+			ad.Refs[ref.Name] = ref.OID
+		}
+		return ad, nil
+	}
+
+	refs, err := s.fetch.LsRefs(ctx, nil)
+	if err != nil {
+		return ad, err
+	}
+	for _, ref := range refs {
+		ad.Refs[ref.Name] = ref.OID
+		if ref.Name == "HEAD" {
+			ad.Head = ref.Symref
+		}
+	}
+	return ad, nil
+}
+
+func (s *smartConnection) Fetch(ctx context.Context, local database.ObjectStore, wants, haves []string) error {
+	if s.fetch == nil {
+		return unsupported(s.url, "fetch")
+	}
+	missing, seen := []string{}, map[string]bool{}
+	for _, oid := range wants {
+		if !seen[oid] && !local.Exists(oid) {
+			missing = append(missing, oid)
+		}
+		seen[oid] = true
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	received := database.NewOverlay(database.NewMemory(), local)
+	if _, err := s.fetch.Fetch(ctx, missing, haves, received, s.progress); err != nil {
+		return err
+	}
+	_, err := database.CopyObjects(ctx, received, local, missing)
+	return err
+}
+
+func (s *smartConnection) Push(ctx context.Context, local database.ObjectStore, updates []RefUpdate) ([]error, error) {
+	if s.push == nil {
+		return nil, unsupported(s.url, "push")
+	}
+	commands := []transport.Command{}
+	for _, update := range updates {
+		commands = append(commands, transport.Command{Name: update.Name, Old: update.Old, New: update.New})
+	}
+
+	reasons, err := s.push.Push(ctx, local, commands, s.progress)
+	if err != nil {
+		return nil, err
+	}
+	results := []error{}
+	for i, reason := range reasons {
+		if reason == "" {
+			results = append(results, nil)
+		} else {
+			results = append(results, rejected(updates[i].Name, reason))
+		}
+	}
+	return results, nil
+}
+
+func (s *smartConnection) Close() error {
+	if s.fetch != nil {
+		s.fetch.Close()
+	}
+	if s.push != nil {
+		s.push.Close()
+	}
+	if s.cmd == nil {
+		return nil
+	}
+	s.stdin.Close()
+	return s.cmd.Wait()
+}
@@ -0,0 +1,52 @@
+package remote_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tpbowden/jit/remote"
+)
+
+func TestSSHArguments(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jit_ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// The ssh command records its arguments and exits without speaking the
+	// protocol, so every connection fails once it has been run.
+	log := filepath.Join(dir, "args")
+	script := filepath.Join(dir, "ssh")
+	if err := ioutil.WriteFile(script, []byte("#!/bin/sh\nprintf '%s\\n' \"$@\" > '"+log+"'\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	options := remote.ConnectOptions{SSHCommand: script}
+
+	if _, err := remote.Connect(ctx, "ssh://example.com:2222/repo.git", options); err == nil {
+		t.Fatal("Expected the connection to fail")
+	}
+	args, err := ioutil.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "-o\nSendEnv=GIT_PROTOCOL\n-p\n2222\n--\nexample.com\ngit-upload-pack '/repo.git'\n"
+	if string(args) != expected {
+		t.Fatalf("Unexpected arguments %q", args)
+	}
+
+	os.Remove(log)
+	for _, url := range []string{"-oProxyCommand=touch pwned:repo.git", "ssh://-oProxyCommand=x/repo.git", "ssh://host:-oX/repo.git"} {
+		_, err := remote.Connect(ctx, url, options)
+		if _, ok := err.(*remote.Unreachable); !ok || !strings.Contains(err.Error(), "blocked") {
+			t.Fatalf("Expected %q to be blocked, got %v", url, err)
+		}
+	}
+	if _, err := os.Stat(log); !os.IsNotExist(err) {
+		t.Fatal("Expected ssh not to be run for a blocked host")
+	}
+}
@@ -0,0 +1,237 @@
+package remote
+
+import (
+	"context"
+	"sort"
+
+	"github.com/tpbowden/jit/repository"
+)
+
+type RefStatus int
+
+const (
+	RefUpToDate RefStatus = iota
+	RefCreated
+	RefFastForward
+	RefForced
+	RefDeleted
+	RefRejected
+)
+
+// RefChange records what a fetch or push did to one ref. Source names the ref
+// being copied and Destination the ref it was copied to.
+type RefChange struct {
+	Source      string
+	Destination string
+	Old         string
+	New         string
+	Status      RefStatus
+	Reason      string
+}
+
+// classify decides whether moving a ref from old to updated is allowed, given
+// that the object old names may be missing from repo.
+func classify(repo *repository.Repository, old, updated string, force bool) (RefStatus, string, error) {
+	switch {
+	case old == updated:
+		return RefUpToDate, "", nil
+	case updated == "":
+		return RefDeleted, "", nil
+	case old == "":
+		return RefCreated, "", nil
+	case !repo.Database.Exists(old):
+		if force {
+			return RefForced, "", nil
+		}
+		return RefRejected, "fetch first", nil
+	}
+
+	fastForward, err := repo.IsAncestor(old, updated)
+	switch {
+	case err != nil:
+		return RefRejected, "", err
+	case fastForward:
+		return RefFastForward, "", nil
+	case force:
+		return RefForced, "", nil
+	}
+	return RefRejected, "non-fast-forward", nil
+}
+
+// localTips lists the objects that repo's refs point to.
+func localTips(repo *repository.Repository) ([]string, error) {
+	names, err := repo.Refs.ListRefs("refs/")
+	if err != nil {
+		return nil, err
+	}
+	tips, seen := []string{}, map[string]bool{}
+	for _, name := range names {
+		oid, err := repo.Refs.ReadRef(name)
+		if err != nil {
+			return nil, err
+		}
+		if oid != "" && !seen[oid] {
+			seen[oid] = true
+			tips = append(tips, oid)
+		}
+	}
+	return tips, nil
+}
+
+// Fetch copies the remote refs matched by refspecs into repo, along with the
+// objects they need. If no refspecs are given the remote's configured ones
+// are used. Non-fast-forward updates are rejected unless the refspec that
+// produced them is forced.
+func Fetch(ctx context.Context, repo *repository.Repository, conn Connection, remote Remote, refspecs []Refspec) ([]RefChange, error) {
+	if len(refspecs) == 0 {
+		refspecs = remote.Fetch
+	}
+	ad, err := conn.Refs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for name := range ad.Refs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	changes := []RefChange{}
+	forced := []bool{}
+	wants := []string{}
+	for _, refspec := range refspecs {
+		source := expandRef(refspec.Source, func(name string) bool {
+			_, exists := ad.Refs[name]
+			return exists
+		})
+		for _, name := range names {
+			spec := refspec
+			spec.Source = source
+			destination, matched := spec.Match(name)
+			if !matched || destination == "" {
+				continue
+			}
+			destination = expandRef(destination, func(string) bool { return false })
+			old, err := repo.Refs.ReadRef(destination)
+			if err != nil {
+				return nil, err
+			}
+			changes = append(changes, RefChange{Source: name, Destination: destination, Old: old, New: ad.Refs[name]})
+			forced = append(forced, refspec.Force)
+			wants = append(wants, ad.Refs[name])
+		}
+	}
+
+	haves, err := localTips(repo)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.Fetch(ctx, repo.Database, wants, haves); err != nil {
+		return nil, err
+	}
+
+	for i, change := range changes {
+		status, reason, err := classify(repo, change.Old, change.New, forced[i])
+		if err != nil {
+			return nil, err
+		}
+		changes[i].Status, changes[i].Reason = status, reason
+		if status == RefUpToDate || status == RefRejected {
+			continue
+		}
+		if err := repo.Refs.UpdateRef(change.Destination, change.New); err != nil {
+			return nil, err
+		}
+	}
+	return changes, nil
+}
+
+// Push sends the local refs matched by refspecs to the remote. A refspec
+// with an empty source deletes the remote ref. Updates that are not
+// fast-forwards are rejected unless force is set or the refspec is forced.
+// Remote-tracking refs are updated to match whatever the remote accepted.
+func Push(ctx context.Context, repo *repository.Repository, conn Connection, remote Remote, refspecs []Refspec, force bool) ([]RefChange, error) {
+	ad, err := conn.Refs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []RefChange{}
+	updates := []RefUpdate{}
+	for _, refspec := range refspecs {
+		change := RefChange{}
+		if refspec.Source != "" {
+			change.Source = expandRef(refspec.Source, func(name string) bool {
+				oid, _ := repo.Refs.ReadRef(name)
+				return oid != ""
+			})
+			if change.New, err = repo.Refs.ReadRef(change.Source); err != nil {
+				return nil, err
+			}
+			if change.New == "" {
+				return nil, invalidRefspec(refspec.String())
+			}
+		}
+		change.Destination = expandRef(refspec.Destination, func(name string) bool {
+			_, exists := ad.Refs[name]
+			return exists
+		})
+		change.Old = ad.Refs[change.Destination]
+
+		status, reason, err := classify(repo, change.Old, change.New, force || refspec.Force)
+		if err != nil {
+			return nil, err
+		}
+		change.Status, change.Reason = status, reason
+		if status != RefUpToDate && status != RefRejected {
+			updates = append(updates, RefUpdate{Name: change.Destination, Old: change.Old, New: change.New})
+		}
+		changes = append(changes, change)
+	}
+	if len(updates) == 0 {
+		return changes, nil
+	}
+
+	results, err := conn.Push(ctx, repo.Database, updates)
+	if err != nil {
+		return nil, err
+	}
+	accepted := map[string]bool{}
+	for i, update := range updates {
+		if results[i] == nil {
+			accepted[update.Name] = true
+			continue
+		}
+		for j := range changes {
+			if changes[j].Destination == update.Name {
+				changes[j].Status = RefRejected
+				if reject, ok := results[i].(*Rejected); ok {
+					changes[j].Reason = reject.Reason
+				} else {
+					changes[j].Reason = results[i].Error()
+				}
+			}
+		}
+	}
+
+	for _, change := range changes {
+		if !accepted[change.Destination] {
+			continue
+		}
+		for _, refspec := range remote.Fetch {
+			tracking, matched := refspec.Match(change.Destination)
+			if !matched {
+				continue
+			}
+			if change.New == "" {
+				err = repo.Refs.DeleteRef(tracking)
+			} else {
+				err = repo.Refs.UpdateRef(tracking, change.New)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return changes, nil
+}
@@ -0,0 +1,92 @@
+package remote
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/tpbowden/jit/database"
+	"github.com/tpbowden/jit/transport"
+)
+
+// Advertisement is what a remote reports about its refs. Head is the ref
+// HEAD points to, or empty if HEAD is detached.
+type Advertisement struct {
+	Refs map[string]string
+	Head string
+}
+
+// RefUpdate asks a remote to move a ref from Old to New. An empty Old
+// creates the ref, and an empty New deletes it.
+type RefUpdate struct {
+	Name string
+	Old  string
+	New  string
+}
+
+// Rejected is the reason a remote refused a ref update.
+type Rejected struct {
+	Name   string
+	Reason string
+}
+
+func (e *Rejected) Error() string {
+	return fmt.Sprintf("%s: %s", e.Name, e.Reason)
+}
+
+func rejected(name, reason string) error {
+	return &Rejected{name, reason}
+}
+
+// Connection is an open link to another repository.
+type Connection interface {
+	// Refs lists the remote's refs by full name.
+	Refs(ctx context.Context) (Advertisement, error)
+	// Fetch copies the objects reachable from wants into local. Haves are
+	// objects local already has, which the remote may leave out.
+	Fetch(ctx context.Context, local database.ObjectStore, wants, haves []string) error
+	// Push sends the objects the updates need and applies them, returning
+	// a Rejected error, or nil, for each update in turn.
+	Push(ctx context.Context, local database.ObjectStore, updates []RefUpdate) ([]error, error)
+	Close() error
+}
+
+// ConnectOptions configures how Connect reaches a repository.
+type ConnectOptions struct {
+	// Push opens the connection for pushing rather than fetching.
+	Push bool
+	// UploadPack and ReceivePack are the programs run on the other side by
+	// the smart protocol, git-upload-pack and git-receive-pack if empty.
+	UploadPack  string
+	ReceivePack string
+	// Progress receives progress messages from the other side.
+	Progress io.Writer
+	// SSHCommand is the command ssh URLs are reached through, ssh if empty.
+	SSHCommand string
+	// HTTP configures connections to smart HTTP servers.
+	HTTP transport.HTTPOptions
+}
+
+// Connect opens a connection to the repository at url. Directory paths are
+// read directly, http:// and https:// URLs use smart HTTP, and file:// and
+// ssh URLs use the smart protocol by running upload-pack or receive-pack.
+func Connect(ctx context.Context, url string, options ConnectOptions) (Connection, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if options.UploadPack == "" {
+		options.UploadPack = "git-upload-pack"
+	}
+	if options.ReceivePack == "" {
+		options.ReceivePack = "git-receive-pack"
+	}
+
+	if strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") {
+		return connectHTTP(ctx, url, options)
+	}
+	if _, _, _, ok := parseSSH(url); ok || strings.HasPrefix(url, "file://") {
+		return connectSmart(ctx, url, options)
+	}
+	return connectLocal(url, url)
+}
@@ -0,0 +1,106 @@
+package repository
+
+import "github.com/tpbowden/jit/database"
+
+// IsAncestor reports whether ancestor is oid itself or can be reached from it
+// by following parent links.
+func (r *Repository) IsAncestor(ancestor, oid string) (bool, error) {
+	queue := []string{oid}
+	seen := map[string]bool{}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		if current == ancestor {
+			return true, nil
+		}
+		if seen[current] {
+			continue
+		}
+		seen[current] = true
+
+		object, err := r.Database.Load(current)
+		if err != nil {
+			return false, err
+		}
+		commit, ok := object.(database.Commit)
+		if !ok {
+			return false, nil
+		}
+		queue = append(queue, commit.Parents...)
+	}
+	return false, nil
+}
+
+func (r *Repository) loadCommit(oid string) (database.Commit, error) {
+	object, err := r.Database.Load(oid)
+	if err != nil {
+		return database.Commit{}, err
+	}
+	commit, ok := object.(database.Commit)
+	if !ok {
+		return database.Commit{}, invalidRevision(oid, "Object is a "+object.Type()+", not a commit")
+	}
+	return commit, nil
+}
+
+// ancestors returns oid and every commit reachable from it.
+func (r *Repository) ancestors(oid string) (map[string]bool, error) {
+	seen := map[string]bool{}
+	queue := []string{oid}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		if seen[current] {
+			continue
+		}
+		seen[current] = true
+		commit, err := r.loadCommit(current)
+		if err != nil {
+			return nil, err
+		}
+		queue = append(queue, commit.Parents...)
+	}
+	return seen, nil
+}
+
+// CommitRange lists the commits reachable from include but not from exclude,
+// which may be empty, ordered so that every commit follows its parents.
+func (r *Repository) CommitRange(exclude, include string) ([]string, error) {
+	excluded := map[string]bool{}
+	if exclude != "" {
+		var err error
+		if excluded, err = r.ancestors(exclude); err != nil {
+			return nil, err
+		}
+	}
+
+	type frame struct {
+		oid      string
+		expanded bool
+	}
+	order := []string{}
+	visited := map[string]bool{}
+	stack := []frame{{oid: include}}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if top.expanded {
+			order = append(order, top.oid)
+			continue
+		}
+		if visited[top.oid] || excluded[top.oid] {
+			continue
+		}
+		visited[top.oid] = true
+
+		commit, err := r.loadCommit(top.oid)
+		if err != nil {
+			return nil, err
+		}
+		stack = append(stack, frame{oid: top.oid, expanded: true})
+		for i := len(commit.Parents) - 1; i >= 0; i-- {
+			stack = append(stack, frame{oid: commit.Parents[i]})
+		}
+	}
+	return order, nil
+}
@@ -0,0 +1,28 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+)
+
+func isGitDir(path string) bool {
+	for _, name := range []string{"objects", "HEAD"} {
+		if _, err := os.Stat(filepath.Join(path, name)); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Discover finds the git directory of the repository at path, which is
+// either a working tree containing .git or a bare repository. It reports
+// whether the repository is bare, and ok is false if path is neither.
+func Discover(path string) (gitDir string, bare bool, ok bool) {
+	if gitDir := filepath.Join(path, ".git"); isGitDir(gitDir) {
+		return gitDir, false, true
+	}
+	if isGitDir(path) {
+		return path, true, true
+	}
+	return "", false, false
+}
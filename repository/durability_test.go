@@ -0,0 +1,309 @@
+package repository_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tpbowden/jit/core"
+	"github.com/tpbowden/jit/database"
+	"github.com/tpbowden/jit/repository"
+)
+
+// crashFS models which parts of a directory tree survive a power loss. File
+// contents only survive once flushed. Directory entries survive once the
+// directory is flushed, but the filesystem may also have journalled them on
+// its own, so a crash can leave either the flushed or the latest names.
+type crashFS struct {
+	root    string
+	files   map[string]*inode
+	dirs    map[string]bool
+	durable map[string]map[string]*inode
+}
+
+type inode struct {
+	data    []byte
+	durable []byte
+	dir     bool
+}
+
+func newCrashFS(t *testing.T, root string) *crashFS {
+	fs := &crashFS{
+		root:    root,
+		files:   map[string]*inode{},
+		dirs:    map[string]bool{},
+		durable: map[string]map[string]*inode{},
+	}
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			fs.dirs[path] = true
+			return nil
+		}
+		data, err := ioutil.ReadFile(path)
+		fs.files[path] = &inode{data: data, durable: data}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for dir := range fs.dirs {
+		fs.syncDir(dir)
+	}
+	return fs
+}
+
+func (fs *crashFS) syncDir(dir string) {
+	fs.durable[dir] = fs.entries(dir)
+}
+
+func (fs *crashFS) entries(dir string) map[string]*inode {
+	entries := map[string]*inode{}
+	for path, file := range fs.files {
+		if filepath.Dir(path) == dir {
+			entries[filepath.Base(path)] = file
+		}
+	}
+	for path := range fs.dirs {
+		if filepath.Dir(path) == dir && path != dir {
+			entries[filepath.Base(path)] = &inode{dir: true}
+		}
+	}
+	return entries
+}
+
+func (fs *crashFS) apply(op core.FileOp) {
+	switch op.Kind {
+	case core.OpCreate:
+		fs.files[op.Path] = &inode{}
+	case core.OpWrite:
+		file := fs.files[op.Path]
+		file.data = append(append([]byte(nil), file.data...), op.Data...)
+	case core.OpSync:
+		file := fs.files[op.Path]
+		file.durable = file.data
+	case core.OpRename:
+		fs.files[op.Target] = fs.files[op.Path]
+		delete(fs.files, op.Path)
+	case core.OpRemove:
+		delete(fs.files, op.Path)
+	case core.OpMkdir:
+		fs.dirs[op.Path] = true
+	case core.OpSyncDir:
+		fs.syncDir(op.Path)
+	}
+}
+
+// materialise writes out what would be on disk after a crash, with either
+// only the flushed directory entries or all of them.
+func (fs *crashFS) materialise(t *testing.T, dir, target string, journalled bool) {
+	if err := os.MkdirAll(target, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	entries := fs.durable[dir]
+	if journalled {
+		entries = fs.entries(dir)
+	}
+	for name, entry := range entries {
+		if entry.dir {
+			fs.materialise(t, filepath.Join(dir, name), filepath.Join(target, name), journalled)
+			continue
+		}
+		if err := ioutil.WriteFile(filepath.Join(target, name), entry.durable, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+var oidPattern = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+func checkReachable(repo *repository.Repository, oid string) error {
+	object, err := repo.Database.Load(oid)
+	if err != nil {
+		return err
+	}
+	entries, err := repo.Database.ReadTreeRecursive(object.(database.Commit).TreeID)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if _, _, err := repo.Database.ReadObject(entry.OID()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkObjects verifies that every object file that survived is intact, and
+// that any valid ref still points at a complete history.
+func checkObjects(repo *repository.Repository, gitDir string) error {
+	err := filepath.Walk(filepath.Join(gitDir, "objects"), func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || strings.HasPrefix(info.Name(), "tmp_") {
+			return err
+		}
+		oid := filepath.Base(filepath.Dir(path)) + info.Name()
+		_, _, err = repo.Database.ReadObject(oid)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	content, _ := ioutil.ReadFile(filepath.Join(gitDir, "refs", "heads", "master"))
+	if oid := strings.TrimSpace(string(content)); oidPattern.MatchString(oid) {
+		return checkReachable(repo, oid)
+	}
+	return nil
+}
+
+// checkRepository additionally requires refs and the index to be intact.
+func checkRepository(repo *repository.Repository, gitDir string) error {
+	if err := checkObjects(repo, gitDir); err != nil {
+		return err
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(gitDir, "refs", "heads", "master"))
+	if err != nil {
+		return err
+	}
+	if !oidPattern.MatchString(strings.TrimSpace(string(content))) {
+		return fmt.Errorf("refs/heads/master is corrupt: %q", content)
+	}
+
+	if err := repo.Index.Load(); err != nil {
+		return err
+	}
+	for _, entry := range repo.Index.Entries() {
+		if _, _, err := repo.Database.ReadObject(entry.OID()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func commitFiles(t *testing.T, repo *repository.Repository, root string, files map[string]string) {
+	if err := repo.Index.LoadForUpdate(); err != nil {
+		t.Fatal(err)
+	}
+	for name, contents := range files {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+		blob := database.NewBlob([]byte(contents))
+		if err := repo.Database.Store(blob); err != nil {
+			t.Fatal(err)
+		}
+		stat, err := os.Stat(filepath.Join(root, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		repo.Index.Add(name, database.ObjectID(blob), stat)
+	}
+	if err := repo.Index.WriteUpdates(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := []database.DatabaseEntry{}
+	for _, entry := range repo.Index.Entries() {
+		entries = append(entries, entry)
+	}
+	tree := database.BuildTree(entries)
+	tree.Traverse(func(t database.Tree) {
+		repo.Database.Store(t)
+	})
+
+	parent, err := repo.Refs.ReadHead()
+	if err != nil {
+		t.Fatal(err)
+	}
+	author := database.NewAuthor("A. U. Thor", "author@example.com")
+	commit := database.NewCommit(author, database.ObjectID(tree), parent, "commit\n", time.Now())
+	if err := repo.Database.Store(commit); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Refs.UpdateHead(database.ObjectID(commit)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// crashPoints runs two commits with the given durability, then simulates a
+// crash after every filesystem operation and returns the errors found by
+// check in each of the resulting repositories.
+func crashPoints(t *testing.T, durability core.Durability, check func(*repository.Repository, string) error) []error {
+	root, err := ioutil.TempDir("", "jit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	gitDir := filepath.Join(root, ".git")
+	for _, dir := range []string{"objects", "refs/heads"} {
+		if err := os.MkdirAll(filepath.Join(gitDir, dir), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	repo := repository.New(gitDir)
+	repo.SetDurability(durability)
+	if err := repo.Refs.SetHead("refs/heads/master"); err != nil {
+		t.Fatal(err)
+	}
+	commitFiles(t, repo, root, map[string]string{"a.txt": "one"})
+
+	fs := newCrashFS(t, root)
+	ops := []core.FileOp{}
+	repo.ObserveFileOps(func(op core.FileOp) {
+		ops = append(ops, op)
+	})
+	commitFiles(t, repo, root, map[string]string{"a.txt": "two", "b.txt": "three"})
+	commitFiles(t, repo, root, map[string]string{"b.txt": "four"})
+	repo.ObserveFileOps(nil)
+	if len(ops) == 0 {
+		t.Fatal("no file operations were observed")
+	}
+
+	failures := []error{}
+	for i := 0; i <= len(ops); i++ {
+		if i > 0 {
+			fs.apply(ops[i-1])
+		}
+
+		for _, journalled := range []bool{false, true} {
+			image, err := ioutil.TempDir("", "jit_crash")
+			if err != nil {
+				t.Fatal(err)
+			}
+			fs.materialise(t, root, image, journalled)
+			crashed := repository.New(filepath.Join(image, ".git"))
+			if err := check(crashed, filepath.Join(image, ".git")); err != nil {
+				failures = append(failures, fmt.Errorf("crash after op %d: %v", i, err))
+			}
+			os.RemoveAll(image)
+		}
+	}
+	return failures
+}
+
+func TestDurabilityAllSurvivesACrashAtAnyPoint(t *testing.T) {
+	for _, err := range crashPoints(t, core.DurabilityAll, checkRepository) {
+		t.Error(err)
+	}
+}
+
+func TestDurabilityObjectsKeepsObjectsIntact(t *testing.T) {
+	for _, err := range crashPoints(t, core.DurabilityObjects, checkObjects) {
+		t.Error(err)
+	}
+}
+
+func TestDurabilityNoneCanLoseData(t *testing.T) {
+	if failures := crashPoints(t, core.DurabilityNone, checkObjects); len(failures) == 0 {
+		t.Error("Expected the crash harness to find lost objects without flushing")
+	}
+}
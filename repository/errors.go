@@ -0,0 +1,16 @@
+package repository
+
+import "fmt"
+
+type InvalidRevision struct {
+	revision string
+	reason   string
+}
+
+func (e *InvalidRevision) Error() string {
+	return fmt.Sprintf("%s: '%s'", e.reason, e.revision)
+}
+
+func invalidRevision(revision, reason string) error {
+	return &InvalidRevision{revision, reason}
+}
@@ -1,25 +1,167 @@
 package repository
 
 import (
+	"io/ioutil"
+	"os"
 	"path/filepath"
+	"time"
 
+	"github.com/tpbowden/jit/attributes"
+	"github.com/tpbowden/jit/config"
 	"github.com/tpbowden/jit/core"
 	"github.com/tpbowden/jit/database"
 	"github.com/tpbowden/jit/index"
+	"github.com/tpbowden/jit/lfs"
+	"github.com/tpbowden/jit/sparse"
 )
 
 type Repository struct {
 	Index     *index.Index
 	Workspace core.Workspace
-	Database  database.Database
-	Refs      core.Refs
+	Database  database.ObjectStore
+	Refs      core.RefStore
+	Config    *config.Config
+	// Filter converts files between the working tree and the database as
+	// their attributes say.
+	Filter *attributes.Filter
+	// Sparse is the cone of a sparse checkout, or nil if the working tree
+	// holds every file.
+	Sparse *sparse.Cone
 }
 
+// New creates a repository that keeps its objects and refs in the git
+// directory at path.
 func New(path string) *Repository {
-	return &Repository{
+	db := database.New(filepath.Join(path, "objects"))
+	refs := core.NewRefs(path)
+	return NewWithStorage(path, &db, &refs)
+}
+
+// NewWithStorage creates a repository that keeps its objects and refs in the
+// given stores. The index and config are still read from the git directory
+// at path, and the working tree is its parent directory.
+func NewWithStorage(path string, objects database.ObjectStore, refs core.RefStore) *Repository {
+	repo := &Repository{
 		Index:     index.New(filepath.Join(path, "index")),
 		Workspace: core.NewWorkspace(filepath.Dir(path)),
-		Database:  database.New(filepath.Join(path, "objects")),
-		Refs:      core.NewRefs(path),
+		Database:  objects,
+		Refs:      refs,
+		Config:    config.New(filepath.Join(path, "config")),
+	}
+	repo.Filter = attributes.NewFilter(filepath.Dir(path), path, repo.Config)
+	repo.Filter.SetDriver("lfs", lfs.NewDriver(lfs.NewStore(path)))
+	repo.Workspace.SetFilter(repo.Filter)
+	return repo
+}
+
+type durable interface {
+	SetDurability(core.Durability)
+}
+
+type observable interface {
+	ObserveFileOps(func(core.FileOp))
+}
+
+type lockable interface {
+	SetLockTimeout(time.Duration)
+}
+
+// SetDurability sets how carefully the index, and any stores that write to
+// disk, flush their changes.
+func (r *Repository) SetDurability(durability core.Durability) {
+	if store, ok := r.Database.(durable); ok {
+		store.SetDurability(durability)
+	}
+	if store, ok := r.Refs.(durable); ok {
+		store.SetDurability(durability)
+	}
+	r.Index.SetDurability(durability)
+}
+
+// ObserveFileOps sets a function to be told about each change the index, and
+// any stores that write to disk, make to files that need to survive a crash.
+// Passing nil removes it.
+func (r *Repository) ObserveFileOps(observer func(core.FileOp)) {
+	if store, ok := r.Database.(observable); ok {
+		store.ObserveFileOps(observer)
+	}
+	if store, ok := r.Refs.(observable); ok {
+		store.ObserveFileOps(observer)
+	}
+	r.Index.ObserveFileOps(observer)
+}
+
+// Open creates a repository and applies the settings from its config file.
+func Open(path string) (*Repository, error) {
+	return configure(path, New(path))
+}
+
+// OpenWithStorage is Open for a repository using the given stores.
+func OpenWithStorage(path string, objects database.ObjectStore, refs core.RefStore) (*Repository, error) {
+	return configure(path, NewWithStorage(path, objects, refs))
+}
+
+// SparseCheckoutFile returns the path of the file holding the patterns of a
+// sparse checkout, given the git directory.
+func SparseCheckoutFile(path string) string {
+	return filepath.Join(path, "info", "sparse-checkout")
+}
+
+// SetSparse limits the working tree to the files in a cone, or lets it hold
+// every file if cone is nil.
+func (r *Repository) SetSparse(cone *sparse.Cone) {
+	r.Sparse = cone
+	if cone == nil {
+		r.Workspace.SetSparse(nil)
+		return
+	}
+	r.Workspace.SetSparse(cone)
+}
+
+// loadSparse reads the cone of a sparse checkout when core.sparseCheckout is
+// set. Patterns that are not in cone mode's form are not understood, and
+// leave the working tree unlimited until they are replaced.
+func (r *Repository) loadSparse(path string) error {
+	enabled, err := r.Config.GetBool("core.sparseCheckout", false)
+	if err != nil || !enabled {
+		return err
+	}
+	data, err := ioutil.ReadFile(SparseCheckoutFile(path))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if cone, err := sparse.Parse(data); err == nil {
+		r.SetSparse(cone)
+	}
+	return nil
+}
+
+func configure(path string, repo *Repository) (*Repository, error) {
+	if err := repo.Config.Open(); err != nil {
+		return nil, err
+	}
+
+	timeout, err := repo.Config.GetInt("core.lockTimeout", 0)
+	if err != nil {
+		return nil, err
+	}
+	if refs, ok := repo.Refs.(lockable); ok {
+		refs.SetLockTimeout(time.Duration(timeout) * time.Millisecond)
+	}
+	repo.Index.SetLockTimeout(time.Duration(timeout) * time.Millisecond)
+
+	mode, exists := repo.Config.Get("core.durability")
+	if !exists {
+		mode = "objects"
+	}
+	durability, err := core.ParseDurability(mode)
+	if err != nil {
+		return nil, err
+	}
+	repo.SetDurability(durability)
+
+	if err := repo.loadSparse(path); err != nil {
+		return nil, err
 	}
+	return repo, nil
 }
@@ -0,0 +1,190 @@
+package repository
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/tpbowden/jit/core"
+	"github.com/tpbowden/jit/database"
+)
+
+var (
+	hexPattern      = regexp.MustCompile(`^[0-9a-f]{4,40}$`)
+	pseudoPattern   = regexp.MustCompile(`^[A-Z_]+$`)
+	reflogPattern   = regexp.MustCompile(`^(.*)@\{([0-9]+)\}$`)
+	operatorPattern = regexp.MustCompile(`^(\^\{\w*\}|\^[0-9]*|~[0-9]*)`)
+)
+
+// expandRef finds the full name of a ref given its short name, e.g. "master"
+// for "refs/heads/master".
+func (r *Repository) expandRef(name string) (string, string, error) {
+	if name == "HEAD" || name == "@" || name == "" {
+		oid, err := r.Refs.ReadHead()
+		return "HEAD", oid, err
+	}
+
+	candidates := []string{
+		name,
+		"refs/" + name,
+		"refs/tags/" + name,
+		"refs/heads/" + name,
+		"refs/remotes/" + name,
+	}
+	for _, candidate := range candidates {
+		if !strings.HasPrefix(candidate, "refs/") && !pseudoPattern.MatchString(candidate) {
+			continue
+		}
+		if !core.ValidRefName(candidate) {
+			continue
+		}
+		oid, err := r.Refs.ReadRef(candidate)
+		if err != nil {
+			return "", "", err
+		}
+		if oid != "" {
+			return candidate, oid, nil
+		}
+	}
+	return "", "", nil
+}
+
+func (r *Repository) readRef(revision, name string) (string, error) {
+	match := reflogPattern.FindStringSubmatch(name)
+	if match == nil {
+		_, oid, err := r.expandRef(name)
+		return oid, err
+	}
+
+	ref, _, err := r.expandRef(match[1])
+	if err != nil || ref == "" {
+		return "", err
+	}
+	entries, err := r.Refs.ReadReflog(ref)
+	if err != nil {
+		return "", err
+	}
+
+	n, _ := strconv.Atoi(match[2])
+	if n >= len(entries) {
+		return "", invalidRevision(revision, "Log for '"+match[1]+"' only has "+strconv.Itoa(len(entries))+" entries")
+	}
+	return entries[len(entries)-1-n].NewOID, nil
+}
+
+func (r *Repository) resolveBase(revision, name string) (string, error) {
+	oid, err := r.readRef(revision, name)
+	if err != nil {
+		return "", err
+	}
+	if oid != "" {
+		return oid, nil
+	}
+
+	if !hexPattern.MatchString(name) {
+		return "", invalidRevision(revision, "Not a valid object name")
+	}
+
+	matches, err := r.Database.PrefixMatch(name)
+	if err != nil {
+		return "", err
+	}
+	switch len(matches) {
+	case 0:
+		return "", invalidRevision(revision, "Not a valid object name")
+	case 1:
+		return matches[0], nil
+	}
+	return "", invalidRevision(revision, "Short object ID is ambiguous")
+}
+
+// PeelToCommit follows annotated tags until it reaches a commit.
+func (r *Repository) PeelToCommit(revision, oid string) (string, error) {
+	for {
+		object, err := r.Database.Load(oid)
+		if err != nil {
+			return "", err
+		}
+
+		switch o := object.(type) {
+		case database.Commit:
+			return oid, nil
+		case database.Tag:
+			oid = o.Object
+		default:
+			return "", invalidRevision(revision, "Object is a "+object.Type()+", not a commit")
+		}
+	}
+}
+
+func (r *Repository) parent(revision, oid string, n int) (string, error) {
+	if n == 0 {
+		return oid, nil
+	}
+	object, err := r.Database.Load(oid)
+	if err != nil {
+		return "", err
+	}
+	commit := object.(database.Commit)
+	if n > len(commit.Parents) {
+		return "", invalidRevision(revision, "Revision has no such parent")
+	}
+	return commit.Parents[n-1], nil
+}
+
+// ResolveRevision resolves expressions such as "HEAD~2", "v1.0^" or an
+// abbreviated object ID to the ID of a commit.
+func (r *Repository) ResolveRevision(revision string) (string, error) {
+	if revision == "" {
+		return "", invalidRevision(revision, "Not a valid object name")
+	}
+
+	end := strings.IndexAny(revision, "^~")
+	if end == -1 {
+		end = len(revision)
+	}
+
+	oid, err := r.resolveBase(revision, revision[:end])
+	if err != nil {
+		return "", err
+	}
+	if oid, err = r.PeelToCommit(revision, oid); err != nil {
+		return "", err
+	}
+
+	rest := revision[end:]
+	for rest != "" {
+		operator := operatorPattern.FindString(rest)
+		if operator == "" {
+			return "", invalidRevision(revision, "Not a valid object name")
+		}
+		rest = rest[len(operator):]
+
+		switch {
+		case strings.HasPrefix(operator, "^{"):
+			if operator != "^{}" && operator != "^{commit}" {
+				return "", invalidRevision(revision, "Not a valid object name")
+			}
+		case strings.HasPrefix(operator, "^"):
+			n := 1
+			if len(operator) > 1 {
+				n, _ = strconv.Atoi(operator[1:])
+			}
+			if oid, err = r.parent(revision, oid, n); err != nil {
+				return "", err
+			}
+		default:
+			n := 1
+			if len(operator) > 1 {
+				n, _ = strconv.Atoi(operator[1:])
+			}
+			for ; n > 0; n-- {
+				if oid, err = r.parent(revision, oid, 1); err != nil {
+					return "", err
+				}
+			}
+		}
+	}
+
+	return oid, nil
+}
@@ -0,0 +1,129 @@
+// Package sparse reads and writes the cone-mode patterns kept in
+// .git/info/sparse-checkout, which choose the directories a sparse checkout
+// keeps in the working tree.
+//
+// A cone is a list of directories. Files in them are included at any depth,
+// as are the files directly inside the top of the working tree and inside
+// each directory leading down to one of them. Everything else is left out.
+package sparse
+
+import (
+	"path"
+	"sort"
+	"strings"
+)
+
+// Cone is the set of files a cone-mode sparse checkout includes.
+type Cone struct {
+	dirs []string
+}
+
+// NewCone creates a cone including the given slash-separated directories,
+// relative to the top of the working tree. Directories inside others in the
+// list are dropped.
+func NewCone(dirs []string) (*Cone, error) {
+	cleaned := []string{}
+	for _, dir := range dirs {
+		clean := path.Clean("/" + strings.Trim(dir, "/"))[1:]
+		if clean == "" || strings.ContainsAny(clean, "*?[\\") {
+			return nil, &InvalidDirectory{Dir: dir}
+		}
+		cleaned = append(cleaned, clean)
+	}
+	sort.Strings(cleaned)
+
+	cone := &Cone{dirs: []string{}}
+	for _, dir := range cleaned {
+		if !cone.covers(dir) {
+			cone.dirs = append(cone.dirs, dir)
+		}
+	}
+	return cone, nil
+}
+
+// covers reports whether a directory is, or is inside, one already in the
+// cone.
+func (c *Cone) covers(dir string) bool {
+	for _, included := range c.dirs {
+		if dir == included || strings.HasPrefix(dir, included+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse reads the patterns in a sparse-checkout file. It returns an
+// InvalidPattern error for any line that cone mode does not write.
+func Parse(data []byte) (*Cone, error) {
+	included, parents := []string{}, map[string]bool{}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "", strings.HasPrefix(line, "#"), line == "/*", line == "!/*/":
+		case strings.HasPrefix(line, "!/") && strings.HasSuffix(line, "/*/") && len(line) > 5:
+			parents[line[2:len(line)-3]] = true
+		case strings.HasPrefix(line, "/") && strings.HasSuffix(line, "/") && len(line) > 2 && !strings.HasPrefix(line, "!"):
+			included = append(included, line[1:len(line)-1])
+		default:
+			return nil, &InvalidPattern{Pattern: line}
+		}
+	}
+	dirs := []string{}
+	for _, dir := range included {
+		if !parents[dir] {
+			dirs = append(dirs, dir)
+		}
+	}
+	return NewCone(dirs)
+}
+
+// Dirs returns the directories the cone includes in full, sorted.
+func (c *Cone) Dirs() []string {
+	return append([]string{}, c.dirs...)
+}
+
+// Add returns a cone including the directories of this one and more.
+func (c *Cone) Add(dirs ...string) (*Cone, error) {
+	return NewCone(append(c.Dirs(), dirs...))
+}
+
+// Includes reports whether a file, given as a slash-separated path relative
+// to the top of the working tree, is in the cone.
+func (c *Cone) Includes(file string) bool {
+	parent := path.Dir(file)
+	if parent == "." {
+		return true
+	}
+	for _, dir := range c.dirs {
+		if strings.HasPrefix(file, dir+"/") || strings.HasPrefix(dir, parent+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Encode returns the patterns to write to the sparse-checkout file, in the
+// form git writes them in cone mode.
+func (c *Cone) Encode() []byte {
+	parents := map[string]bool{}
+	for _, dir := range c.dirs {
+		for parent := path.Dir(dir); parent != "."; parent = path.Dir(parent) {
+			parents[parent] = true
+		}
+	}
+	all := append([]string{}, c.dirs...)
+	for parent := range parents {
+		all = append(all, parent)
+	}
+	sort.Strings(all)
+
+	var b strings.Builder
+	b.WriteString("/*\n!/*/\n")
+	for _, dir := range all {
+		b.WriteString("/" + dir + "/\n")
+		if parents[dir] {
+			b.WriteString("!/" + dir + "/*/\n")
+		}
+	}
+	return []byte(b.String())
+}
@@ -0,0 +1,63 @@
+package sparse_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/tpbowden/jit/sparse"
+)
+
+func TestConeIncludesDirectoriesAndTheirParents(t *testing.T) {
+	cone, err := sparse.NewCone([]string{"a/b/", "/c", "a/b/deeper", "c-d"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dirs := cone.Dirs(); !reflect.DeepEqual(dirs, []string{"a/b", "c", "c-d"}) {
+		t.Fatalf("Unexpected dirs %v", dirs)
+	}
+	cases := map[string]bool{
+		"top.txt":     true,
+		"a/x.txt":     true,
+		"a/b/y.txt":   true,
+		"a/b/c/z.txt": true,
+		"a/d/w.txt":   false,
+		"c/v.txt":     true,
+		"cd/v.txt":    false,
+		"e/f/g.txt":   false,
+	}
+	for path, want := range cases {
+		if got := cone.Includes(path); got != want {
+			t.Fatalf("Expected Includes(%q) to be %v", path, want)
+		}
+	}
+
+	if _, err := sparse.NewCone([]string{"."}); err == nil {
+		t.Fatal("Expected an error")
+	} else if _, ok := err.(*sparse.InvalidDirectory); !ok {
+		t.Fatalf("Expected InvalidDirectory, got %v", err)
+	}
+}
+
+func TestConePatternsRoundTrip(t *testing.T) {
+	cone, err := sparse.NewCone([]string{"a/b/c", "d"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "/*\n!/*/\n/a/\n!/a/*/\n/a/b/\n!/a/b/*/\n/a/b/c/\n/d/\n"
+	if patterns := string(cone.Encode()); patterns != expected {
+		t.Fatalf("Unexpected patterns %q", patterns)
+	}
+	parsed, err := sparse.Parse(cone.Encode())
+	if err != nil || !reflect.DeepEqual(parsed.Dirs(), cone.Dirs()) {
+		t.Fatalf("Unexpected cone %v, %v", parsed, err)
+	}
+	if added, err := parsed.Add("a/e"); err != nil || !reflect.DeepEqual(added.Dirs(), []string{"a/b/c", "a/e", "d"}) {
+		t.Fatalf("Unexpected cone %v, %v", added, err)
+	}
+
+	if _, err := sparse.Parse([]byte("*.txt\n")); err == nil {
+		t.Fatal("Expected an error")
+	} else if _, ok := err.(*sparse.InvalidPattern); !ok {
+		t.Fatalf("Expected InvalidPattern, got %v", err)
+	}
+}
@@ -0,0 +1,23 @@
+package sparse
+
+import "fmt"
+
+// InvalidDirectory is returned for a directory that cannot be part of a
+// cone, such as the top of the working tree or a path with wildcards.
+type InvalidDirectory struct {
+	Dir string
+}
+
+func (e *InvalidDirectory) Error() string {
+	return fmt.Sprintf("'%s' is not a directory that can be added to a sparse-checkout cone", e.Dir)
+}
+
+// InvalidPattern is returned when a sparse-checkout file holds a pattern
+// that is not in cone mode's form.
+type InvalidPattern struct {
+	Pattern string
+}
+
+func (e *InvalidPattern) Error() string {
+	return fmt.Sprintf("unrecognized pattern in sparse-checkout file: '%s'", e.Pattern)
+}
@@ -0,0 +1,450 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/tpbowden/jit/database"
+)
+
+// Ref is a ref advertised by a server. Symref is the ref it points to, for
+// HEAD, and Peeled is the object an annotated tag points to.
+type Ref struct {
+	Name   string
+	OID    string
+	Symref string
+	Peeled string
+}
+
+// exchanger sends a complete request to a server and returns its response.
+type exchanger interface {
+	exchange(ctx context.Context, request []byte) (io.Reader, error)
+	Close() error
+}
+
+// pipeExchanger talks to a server over a pair of streams, such as the stdin
+// and stdout of a process, where every response follows its request on the
+// same stream.
+type pipeExchanger struct {
+	r io.Reader
+	w io.Writer
+}
+
+func (p *pipeExchanger) exchange(ctx context.Context, request []byte) (io.Reader, error) {
+	_, err := p.w.Write(request)
+	return p.r, err
+}
+
+func (p *pipeExchanger) Close() error {
+	return nil
+}
+
+// FetchClient talks to upload-pack using protocol v2.
+type FetchClient struct {
+	conn         exchanger
+	in           *Reader
+	capabilities map[string]bool
+}
+
+// NewFetchClient reads the server's capabilities from r, failing if it does
+// not speak protocol v2, and sends requests to w.
+func NewFetchClient(r io.Reader, w io.Writer) (*FetchClient, error) {
+	return newFetchClient(&pipeExchanger{r, w}, r)
+}
+
+// newFetchClient reads the capability advertisement from r, which may be
+// preceded by the "# service" header that smart HTTP servers send.
+func newFetchClient(conn exchanger, r io.Reader) (*FetchClient, error) {
+	c := &FetchClient{conn: conn, capabilities: map[string]bool{}}
+	in := NewReader(r)
+	kind, line, err := in.ReadLine()
+	if err == nil && strings.HasPrefix(line, "# service=") {
+		if kind, _, err = in.ReadLine(); err == nil && kind != Flush {
+			return nil, protocolError("expected a flush after the service header")
+		}
+		kind, line, err = in.ReadLine()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if kind != Data || line != "version 2" {
+		return nil, protocolError("server does not support protocol v2")
+	}
+	for {
+		kind, line, err := in.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+		if kind == Flush {
+			return c, nil
+		}
+		c.capabilities[strings.SplitN(line, "=", 2)[0]] = true
+	}
+}
+
+func (c *FetchClient) writeRequest(ctx context.Context, command string, args []string) error {
+	var request bytes.Buffer
+	out := NewWriter(&request)
+	lines := []string{"command=" + command, agent}
+	if c.capabilities["object-format"] {
+		lines = append(lines, "object-format=sha1")
+	}
+	for _, line := range lines {
+		out.WriteLine("%s\n", line)
+	}
+	out.Delim()
+	for _, arg := range args {
+		if err := out.WriteLine("%s\n", arg); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+
+	response, err := c.conn.exchange(ctx, request.Bytes())
+	if err != nil {
+		return err
+	}
+	c.in = NewReader(response)
+	return nil
+}
+
+func (c *FetchClient) Close() error {
+	return c.conn.Close()
+}
+
+// LsRefs lists the server's refs that start with any of prefixes, or all of
+// them if there are none.
+func (c *FetchClient) LsRefs(ctx context.Context, prefixes []string) ([]Ref, error) {
+	args := []string{"symrefs", "peel"}
+	for _, prefix := range prefixes {
+		args = append(args, "ref-prefix "+prefix)
+	}
+	if err := c.writeRequest(ctx, "ls-refs", args); err != nil {
+		return nil, err
+	}
+
+	refs := []Ref{}
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		kind, line, err := c.in.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+		if kind == Flush {
+			return refs, nil
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return nil, protocolError("bad ref %q", line)
+		}
+		ref := Ref{OID: fields[0], Name: fields[1]}
+		for _, attribute := range fields[2:] {
+			switch {
+			case strings.HasPrefix(attribute, "symref-target:"):
+				ref.Symref = strings.TrimPrefix(attribute, "symref-target:")
+			case strings.HasPrefix(attribute, "peeled:"):
+				ref.Peeled = strings.TrimPrefix(attribute, "peeled:")
+			}
+		}
+		refs = append(refs, ref)
+	}
+}
+
+// Fetch asks for the objects reachable from wants and stores the pack the
+// server sends in store. The commits in haves, and then their ancestors in
+// store, are offered in rounds of growing size so that the server can leave
+// out what is already present, until it is ready to send the pack or there
+// are no more to offer. Progress messages are copied to progress if it is
+// not nil. It returns the IDs of the objects received.
+func (c *FetchClient) Fetch(ctx context.Context, wants, haves []string, store database.ObjectStore, progress io.Writer) ([]string, error) {
+	request := []string{"ofs-delta"}
+	if progress == nil {
+		request = append(request, "no-progress")
+	}
+	for _, oid := range wants {
+		request = append(request, "want "+oid)
+	}
+
+	// Each request stands alone, so the haves the server has acknowledged
+	// are repeated in every round.
+	walker, common := newHaveWalker(store, haves), []string{}
+	for batch := firstHaveBatch; ; batch *= 2 {
+		if batch > maxHaveBatch {
+			batch = maxHaveBatch
+		}
+		offered := walker.next(batch)
+		done := walker.done()
+		args := append([]string{}, request...)
+		for _, oid := range common {
+			args = append(args, "have "+oid)
+		}
+		for _, oid := range offered {
+			args = append(args, "have "+oid)
+		}
+		if done {
+			args = append(args, "done")
+		}
+		if err := c.writeRequest(ctx, "fetch", args); err != nil {
+			return nil, err
+		}
+		if done {
+			break
+		}
+
+		acknowledged, ready, err := c.readAcknowledgments()
+		if err != nil {
+			return nil, err
+		}
+		for _, oid := range acknowledged {
+			if !walker.common[oid] {
+				walker.acknowledge(oid)
+				common = append(common, oid)
+			}
+		}
+		if ready {
+			break
+		}
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		kind, section, err := c.in.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+		if kind != Data {
+			return nil, protocolError("expected a section header")
+		}
+		if section == "packfile" {
+			break
+		}
+		if err := c.skipSection(); err != nil {
+			return nil, err
+		}
+	}
+
+	data := &sidebandReader{packets: c.in, progress: progress}
+	oids, err := ReadPack(data, store)
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.Copy(ioutil.Discard, data)
+	return oids, err
+}
+
+// readAcknowledgments reads the acknowledgments section a fetch response
+// starts with before the client has said it is done. It returns the haves
+// the server acknowledged, and whether it is ready to send the pack, which
+// then follows in the same response.
+func (c *FetchClient) readAcknowledgments() ([]string, bool, error) {
+	kind, line, err := c.in.ReadLine()
+	if err != nil {
+		return nil, false, err
+	}
+	if kind != Data || line != "acknowledgments" {
+		return nil, false, protocolError("expected acknowledgments")
+	}
+	acknowledged, ready := []string{}, false
+	for {
+		kind, line, err := c.in.ReadLine()
+		if err != nil {
+			return nil, false, err
+		}
+		switch {
+		case kind == Flush && !ready:
+			return acknowledged, false, nil
+		case kind == Delim && ready:
+			return acknowledged, true, nil
+		case kind != Data:
+			return nil, false, protocolError("unexpected end of acknowledgments")
+		case strings.HasPrefix(line, "ACK "):
+			acknowledged = append(acknowledged, strings.TrimPrefix(line, "ACK "))
+		case line == "ready":
+			ready = true
+		case line != "NAK":
+			return nil, false, protocolError("unexpected acknowledgment %q", line)
+		}
+	}
+}
+
+// skipSection reads past a response section that the client has no use for.
+func (c *FetchClient) skipSection() error {
+	for {
+		kind, _, err := c.in.ReadLine()
+		if err != nil {
+			return err
+		}
+		if kind == Delim {
+			return nil
+		}
+		if kind != Data {
+			return protocolError("response ended without a packfile")
+		}
+	}
+}
+
+// PushClient talks to receive-pack.
+type PushClient struct {
+	conn         exchanger
+	refs         []Ref
+	capabilities map[string]bool
+}
+
+// NewPushClient reads the refs and capabilities that receive-pack
+// advertises on r, and sends commands to w.
+func NewPushClient(r io.Reader, w io.Writer) (*PushClient, error) {
+	return newPushClient(&pipeExchanger{r, w}, r)
+}
+
+func newPushClient(conn exchanger, r io.Reader) (*PushClient, error) {
+	c := &PushClient{conn: conn, capabilities: map[string]bool{}}
+	in := NewReader(r)
+	for {
+		kind, line, err := in.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+		if kind == Flush {
+			return c, nil
+		}
+		if line == "version 1" {
+			continue
+		}
+		if len(c.refs) == 0 && strings.Contains(line, "\x00") {
+			line, c.capabilities = parseCapabilities(line)
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, protocolError("bad ref %q", line)
+		}
+		if fields[1] != "capabilities^{}" {
+			c.refs = append(c.refs, Ref{OID: fields[0], Name: fields[1]})
+		}
+	}
+}
+
+// Refs returns the refs the server advertised.
+func (c *PushClient) Refs() []Ref {
+	return c.refs
+}
+
+func (c *PushClient) Close() error {
+	return c.conn.Close()
+}
+
+// Push sends commands and a pack of the objects they need from store. It
+// returns the reason each command was refused, or an empty string for
+// those that were applied.
+func (c *PushClient) Push(ctx context.Context, store database.ObjectStore, commands []Command, progress io.Writer) ([]string, error) {
+	capabilities := []string{}
+	for _, capability := range []string{"report-status", "side-band-64k"} {
+		if c.capabilities[capability] {
+			capabilities = append(capabilities, capability)
+		}
+	}
+	capabilities = append(capabilities, agent)
+
+	var request bytes.Buffer
+	out := NewWriter(&request)
+	tips := []string{}
+	for i, command := range commands {
+		if command.New == "" && !c.capabilities["delete-refs"] {
+			return nil, protocolError("server does not support deleting refs")
+		}
+		line := orZero(command.Old) + " " + orZero(command.New) + " " + command.Name
+		if i == 0 {
+			line += "\x00" + strings.Join(capabilities, " ")
+		}
+		out.WriteLine("%s\n", line)
+		if command.New != "" {
+			tips = append(tips, command.New)
+		}
+	}
+	out.Flush()
+
+	if len(tips) > 0 {
+		haves := []string{}
+		for _, ref := range c.refs {
+			haves = append(haves, ref.OID)
+		}
+		oids, err := objectsToSend(ctx, store, tips, haves)
+		if err != nil {
+			return nil, err
+		}
+		if err := WritePack(&request, store, oids); err != nil {
+			return nil, err
+		}
+	}
+
+	response, err := c.conn.exchange(ctx, request.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	results := make([]string, len(commands))
+	if !c.capabilities["report-status"] {
+		return results, nil
+	}
+	for i := range results {
+		results[i] = "remote did not report status"
+	}
+	return results, c.readReport(NewReader(response), commands, results, progress)
+}
+
+func (c *PushClient) readReport(in *Reader, commands []Command, results []string, progress io.Writer) error {
+	report := in
+	if c.capabilities["side-band-64k"] {
+		report = NewReader(&sidebandReader{packets: in, progress: progress})
+	}
+
+	kind, line, err := report.ReadLine()
+	if err != nil {
+		return err
+	}
+	if kind != Data || !strings.HasPrefix(line, "unpack ") {
+		return protocolError("expected an unpack status, got %q", line)
+	}
+	if status := strings.TrimPrefix(line, "unpack "); status != "ok" {
+		return remoteError("unpack failed: " + status)
+	}
+
+	for {
+		kind, line, err := report.ReadLine()
+		if err != nil {
+			return err
+		}
+		if kind == Flush {
+			break
+		}
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) < 2 {
+			return protocolError("bad status %q", line)
+		}
+		for i, command := range commands {
+			if command.Name != fields[1] {
+				continue
+			}
+			switch {
+			case fields[0] == "ok":
+				results[i] = ""
+			case fields[0] == "ng" && len(fields) == 3:
+				results[i] = fields[2]
+			default:
+				return protocolError("bad status %q", line)
+			}
+		}
+	}
+
+	if c.capabilities["side-band-64k"] {
+		_, err := io.Copy(ioutil.Discard, report.r)
+		return err
+	}
+	return nil
+}
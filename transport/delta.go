@@ -0,0 +1,85 @@
+package transport
+
+// deltaSize reads one of the variable length sizes at the start of a delta.
+func deltaSize(delta []byte) (int, []byte, error) {
+	size, shift := 0, uint(0)
+	for i, b := range delta {
+		if shift > 56 {
+			return 0, nil, corruptPack("delta size too large")
+		}
+		size |= int(b&0x7f) << shift
+		shift += 7
+		if b&0x80 == 0 {
+			return size, delta[i+1:], nil
+		}
+	}
+	return 0, nil, corruptPack("truncated delta header")
+}
+
+// applyDelta rebuilds an object from its base and a delta, which is a list
+// of instructions that either copy a range of the base or insert new bytes.
+func applyDelta(base, delta []byte) ([]byte, error) {
+	baseSize, delta, err := deltaSize(delta)
+	if err != nil {
+		return nil, err
+	}
+	if baseSize != len(base) {
+		return nil, corruptPack("delta base is %d bytes, expected %d", len(base), baseSize)
+	}
+	resultSize, delta, err := deltaSize(delta)
+	if err != nil {
+		return nil, err
+	}
+
+	// The result size comes from the peer, so it only bounds how far the
+	// result may grow; room is reserved for no more than the inputs.
+	reserve := len(base) + len(delta)
+	if resultSize < reserve {
+		reserve = resultSize
+	}
+	result := make([]byte, 0, reserve)
+	for len(delta) > 0 {
+		if len(result) > resultSize {
+			return nil, corruptPack("delta produced more than %d bytes", resultSize)
+		}
+		op := delta[0]
+		delta = delta[1:]
+
+		if op&0x80 == 0 {
+			if op == 0 || int(op) > len(delta) {
+				return nil, corruptPack("bad delta insert")
+			}
+			result = append(result, delta[:op]...)
+			delta = delta[op:]
+			continue
+		}
+
+		offset, size := 0, 0
+		for i := uint(0); i < 7; i++ {
+			if op&(1<<i) == 0 {
+				continue
+			}
+			if len(delta) == 0 {
+				return nil, corruptPack("truncated delta copy")
+			}
+			if i < 4 {
+				offset |= int(delta[0]) << (8 * i)
+			} else {
+				size |= int(delta[0]) << (8 * (i - 4))
+			}
+			delta = delta[1:]
+		}
+		if size == 0 {
+			size = 0x10000
+		}
+		if offset+size > len(base) {
+			return nil, corruptPack("delta copies past the end of its base")
+		}
+		result = append(result, base[offset:offset+size]...)
+	}
+
+	if len(result) != resultSize {
+		return nil, corruptPack("delta produced %d bytes, expected %d", len(result), resultSize)
+	}
+	return result, nil
+}
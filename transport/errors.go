@@ -0,0 +1,72 @@
+package transport
+
+import "fmt"
+
+// ProtocolError is returned when the other side sends something that does
+// not follow the protocol.
+type ProtocolError struct {
+	message string
+}
+
+func (e *ProtocolError) Error() string {
+	return "protocol error: " + e.message
+}
+
+func protocolError(format string, args ...interface{}) error {
+	return &ProtocolError{fmt.Sprintf(format, args...)}
+}
+
+// RemoteError is an error reported by the other side, either in an "ERR"
+// packet or on the error sideband.
+type RemoteError struct {
+	message string
+}
+
+func (e *RemoteError) Error() string {
+	return "remote error: " + e.message
+}
+
+func remoteError(message string) error {
+	return &RemoteError{message}
+}
+
+// CorruptPack is returned when a packfile cannot be read.
+type CorruptPack struct {
+	reason string
+}
+
+func (e *CorruptPack) Error() string {
+	return "corrupt pack: " + e.reason
+}
+
+func corruptPack(format string, args ...interface{}) error {
+	return &CorruptPack{fmt.Sprintf(format, args...)}
+}
+
+// HTTPError is an unexpected response from a smart HTTP server.
+type HTTPError struct {
+	url    string
+	status int
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("unable to access '%s': the server returned %d", e.url, e.status)
+}
+
+func httpError(url string, status int) error {
+	return &HTTPError{url, status}
+}
+
+// AuthenticationFailed is returned when a smart HTTP server refuses the
+// credentials it was given, or asks for credentials that are not available.
+type AuthenticationFailed struct {
+	url string
+}
+
+func (e *AuthenticationFailed) Error() string {
+	return fmt.Sprintf("Authentication failed for '%s'", e.url)
+}
+
+func authenticationFailed(url string) error {
+	return &AuthenticationFailed{url}
+}
@@ -0,0 +1,149 @@
+package transport
+
+import (
+	"compress/gzip"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+const (
+	uploadPack  = "git-upload-pack"
+	receivePack = "git-receive-pack"
+)
+
+// DefaultMaxRequestSize is the largest request body a Handler accepts, before
+// and after decompression, unless told otherwise.
+const DefaultMaxRequestSize = 1 << 30
+
+// Handler serves a repository over git's smart HTTP protocol. Paths are
+// taken relative to the repository's URL, so a handler serving more than
+// one repository should strip its prefix with http.StripPrefix.
+type Handler struct {
+	server *Server
+
+	// Authenticate decides whether to allow a request, given the basic auth
+	// credentials it carried, which are empty if there were none, and
+	// whether it is part of a push. Refused requests are answered with 401
+	// so that clients can ask for credentials. Without it, fetches are
+	// allowed and pushes are refused.
+	Authenticate func(username, password string, push bool) bool
+
+	// MaxRequestSize limits the size of request bodies, both as sent and
+	// once decompressed. Zero means DefaultMaxRequestSize.
+	MaxRequestSize int64
+
+	// ErrorLog records why requests failed, which the client is also told
+	// in an "ERR" packet. If nil, errors go to the log package's standard
+	// logger.
+	ErrorLog *log.Logger
+}
+
+func NewHandler(server *Server) *Handler {
+	return &Handler{server: server}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	service := ""
+	switch {
+	case r.Method == http.MethodGet && path == "info/refs":
+		service = r.URL.Query().Get("service")
+		if service != uploadPack && service != receivePack {
+			http.Error(w, "only the smart protocol is supported", http.StatusForbidden)
+			return
+		}
+	case r.Method == http.MethodPost && (path == uploadPack || path == receivePack):
+		service = path
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	if !h.authorized(w, r, service == receivePack) {
+		return
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+
+	if r.Method == http.MethodGet {
+		h.advertise(w, r, service)
+		return
+	}
+
+	if r.Header.Get("Content-Type") != "application/x-"+service+"-request" {
+		http.Error(w, "unexpected content type", http.StatusUnsupportedMediaType)
+		return
+	}
+	limit := h.MaxRequestSize
+	if limit <= 0 {
+		limit = DefaultMaxRequestSize
+	}
+	var body io.Reader = http.MaxBytesReader(w, r.Body, limit)
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer gz.Close()
+		body = http.MaxBytesReader(w, gz, limit)
+	}
+
+	w.Header().Set("Content-Type", "application/x-"+service+"-result")
+	var err error
+	if service == uploadPack {
+		err = h.server.serveRequests(r.Context(), NewReader(body), NewWriter(w))
+	} else {
+		err = h.server.receive(r.Context(), body, w)
+	}
+	if err != nil {
+		h.fail(w, r, service, err)
+	}
+}
+
+// fail reports an error that ended a request, both in the error log and to
+// the client as an "ERR" packet, unless the client has already gone away.
+func (h *Handler) fail(w http.ResponseWriter, r *http.Request, service string, err error) {
+	if r.Context().Err() != nil {
+		return
+	}
+	logf := log.Printf
+	if h.ErrorLog != nil {
+		logf = h.ErrorLog.Printf
+	}
+	logf("%s %s: %v", service, r.URL.Path, err)
+	NewWriter(w).WriteLine("ERR %s\n", err.Error())
+}
+
+func (h *Handler) authorized(w http.ResponseWriter, r *http.Request, push bool) bool {
+	if h.Authenticate == nil {
+		if push {
+			http.Error(w, "pushes are not enabled", http.StatusForbidden)
+		}
+		return !push
+	}
+
+	username, password, _ := r.BasicAuth()
+	if !h.Authenticate(username, password, push) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="jit"`)
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// advertise answers the first request a client makes. Upload-pack only
+// speaks protocol v2, whose capability advertisement has no service
+// header.
+func (h *Handler) advertise(w http.ResponseWriter, r *http.Request, service string) {
+	w.Header().Set("Content-Type", "application/x-"+service+"-advertisement")
+	out := NewWriter(w)
+	if service == uploadPack {
+		advertiseCapabilities(out)
+		return
+	}
+	out.WriteLine("# service=%s\n", service)
+	out.Flush()
+	h.server.advertiseRefs(out)
+}
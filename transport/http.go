@@ -0,0 +1,158 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"strings"
+)
+
+// HTTPOptions configures smart HTTP connections.
+type HTTPOptions struct {
+	// Client makes the requests, http.DefaultClient if nil.
+	Client *http.Client
+	// Credentials is called once if the server asks for a username and
+	// password, and returns the ones to retry with. Credentials in the URL
+	// are tried first.
+	Credentials func(url string) (username, password string, err error)
+}
+
+// httpExchanger sends each request as a POST to a service's URL. Protocol v2
+// is stateless over HTTP, so every request stands alone.
+type httpExchanger struct {
+	url      string
+	service  string
+	options  HTTPOptions
+	username string
+	password string
+	auth     bool
+	response io.ReadCloser
+}
+
+func (h *httpExchanger) do(ctx context.Context, method, url string, body []byte) (*http.Response, error) {
+	client := h.options.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	for asked := false; ; asked = true {
+		req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("User-Agent", strings.TrimPrefix(agent, "agent="))
+		if h.service == uploadPack {
+			req.Header.Set("Git-Protocol", "version=2")
+		}
+		if method == http.MethodPost {
+			req.Header.Set("Content-Type", "application/x-"+h.service+"-request")
+			req.Header.Set("Accept", "application/x-"+h.service+"-result")
+		}
+		if h.auth {
+			req.SetBasicAuth(h.username, h.password)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusOK {
+			return resp, nil
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusUnauthorized {
+			return nil, httpError(h.url, resp.StatusCode)
+		}
+		if asked || h.options.Credentials == nil {
+			return nil, authenticationFailed(h.url)
+		}
+		if h.username, h.password, err = h.options.Credentials(h.url); err != nil {
+			return nil, err
+		}
+		h.auth = true
+	}
+}
+
+func (h *httpExchanger) exchange(ctx context.Context, request []byte) (io.Reader, error) {
+	h.Close()
+	resp, err := h.do(ctx, http.MethodPost, h.url+"/"+h.service, request)
+	if err != nil {
+		return nil, err
+	}
+	h.response = resp.Body
+	if resp.Header.Get("Content-Type") != "application/x-"+h.service+"-result" {
+		return nil, protocolError("unexpected content type %q", resp.Header.Get("Content-Type"))
+	}
+	return resp.Body, nil
+}
+
+func (h *httpExchanger) Close() error {
+	if h.response == nil {
+		return nil
+	}
+	err := h.response.Close()
+	h.response = nil
+	return err
+}
+
+// dialHTTP fetches a service's advertisement, taking any credentials out of
+// the URL.
+func dialHTTP(ctx context.Context, url, service string, options HTTPOptions) (*httpExchanger, io.ReadCloser, error) {
+	parsed, err := neturl.Parse(url)
+	if err != nil {
+		return nil, nil, err
+	}
+	h := &httpExchanger{service: service, options: options}
+	if parsed.User != nil {
+		h.username = parsed.User.Username()
+		h.password, _ = parsed.User.Password()
+		h.auth = true
+		parsed.User = nil
+	}
+	h.url = strings.TrimSuffix(parsed.String(), "/")
+
+	resp, err := h.do(ctx, http.MethodGet, h.url+"/info/refs?service="+service, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.Header.Get("Content-Type") != "application/x-"+service+"-advertisement" {
+		resp.Body.Close()
+		return nil, nil, protocolError("'%s' is not a smart HTTP server", h.url)
+	}
+	return h, resp.Body, nil
+}
+
+// NewHTTPFetchClient connects to upload-pack at a smart HTTP URL.
+func NewHTTPFetchClient(ctx context.Context, url string, options HTTPOptions) (*FetchClient, error) {
+	h, advertisement, err := dialHTTP(ctx, url, uploadPack, options)
+	if err != nil {
+		return nil, err
+	}
+	defer advertisement.Close()
+	return newFetchClient(h, advertisement)
+}
+
+// NewHTTPPushClient connects to receive-pack at a smart HTTP URL.
+func NewHTTPPushClient(ctx context.Context, url string, options HTTPOptions) (*PushClient, error) {
+	h, advertisement, err := dialHTTP(ctx, url, receivePack, options)
+	if err != nil {
+		return nil, err
+	}
+	defer advertisement.Close()
+
+	in := NewReader(advertisement)
+	if _, line, err := in.ReadLine(); err != nil {
+		return nil, err
+	} else if line != "# service="+receivePack {
+		return nil, protocolError("unexpected service header %q", line)
+	}
+	if kind, _, err := in.ReadLine(); err != nil {
+		return nil, err
+	} else if kind != Flush {
+		return nil, protocolError("expected a flush after the service header")
+	}
+	return newPushClient(h, advertisement)
+}
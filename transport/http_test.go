@@ -0,0 +1,150 @@
+package transport_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/tpbowden/jit/database"
+	"github.com/tpbowden/jit/transport"
+)
+
+func TestFetchOverHTTP(t *testing.T) {
+	repo, internal, cleanup := setup(t)
+	defer cleanup()
+	ctx := context.Background()
+	tip := commit(t, repo, "a.txt", "one\n")
+
+	handler := transport.NewHandler(transport.NewServer(internal, false))
+	server := httptest.NewServer(http.StripPrefix("/repo", handler))
+	defer server.Close()
+
+	client, err := transport.NewHTTPFetchClient(ctx, server.URL+"/repo", transport.HTTPOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	refs, err := client.LsRefs(ctx, []string{"refs/heads/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refs) != 1 || refs[0].Name != "refs/heads/master" || refs[0].OID != tip {
+		t.Fatalf("Unexpected refs %#v", refs)
+	}
+
+	store := database.NewMemory()
+	if _, err := client.Fetch(ctx, []string{tip}, nil, store, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !store.Exists(tip) {
+		t.Fatal("Expected the commit to be fetched")
+	}
+
+	resp, err := http.Get(server.URL + "/repo/info/refs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("Expected the dumb protocol to be refused, got %d", resp.StatusCode)
+	}
+}
+
+func TestPushOverHTTPNeedsCredentials(t *testing.T) {
+	repo, internal, cleanup := setup(t)
+	defer cleanup()
+	remote, remoteInternal, cleanupRemote := setup(t)
+	defer cleanupRemote()
+	ctx := context.Background()
+	commit(t, remote, "a.txt", "one\n")
+	tip := commit(t, repo, "b.txt", "two\n")
+
+	handler := transport.NewHandler(transport.NewServer(remoteInternal, false))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	if _, err := transport.NewHTTPPushClient(ctx, server.URL, transport.HTTPOptions{}); err == nil {
+		t.Fatal("Expected pushes to be disabled")
+	} else if _, ok := err.(*transport.HTTPError); !ok {
+		t.Fatalf("Expected an HTTPError, got %v", err)
+	}
+
+	handler.Authenticate = func(username, password string, push bool) bool {
+		return !push || (username == "me" && password == "secret")
+	}
+	if _, err := transport.NewHTTPPushClient(ctx, server.URL, transport.HTTPOptions{}); err == nil {
+		t.Fatal("Expected credentials to be required")
+	} else if _, ok := err.(*transport.AuthenticationFailed); !ok {
+		t.Fatalf("Expected AuthenticationFailed, got %v", err)
+	}
+
+	asked := 0
+	options := transport.HTTPOptions{Credentials: func(url string) (string, string, error) {
+		asked++
+		return "me", "secret", nil
+	}}
+	client, err := transport.NewHTTPPushClient(ctx, server.URL, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	results, err := client.Push(ctx, internal.Database, []transport.Command{{Name: "refs/heads/topic", New: tip}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0] != "" || asked != 1 {
+		t.Fatalf("Unexpected results %q after asking %d times", results, asked)
+	}
+	if oid, _ := remoteInternal.Refs.ReadRef("refs/heads/topic"); oid != tip {
+		t.Fatalf("Expected topic at %s, got %q", tip, oid)
+	}
+
+	url := strings.Replace(server.URL, "http://", "http://me:wrong@", 1)
+	if _, err := transport.NewHTTPPushClient(ctx, url, transport.HTTPOptions{}); err == nil {
+		t.Fatal("Expected the wrong password to be refused")
+	}
+}
+
+func TestHTTPErrorsAreReportedAndLogged(t *testing.T) {
+	_, internal, cleanup := setup(t)
+	defer cleanup()
+
+	var logged bytes.Buffer
+	handler := transport.NewHandler(transport.NewServer(internal, false))
+	handler.ErrorLog = log.New(&logged, "", 0)
+	handler.MaxRequestSize = 32
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	var request bytes.Buffer
+	out := transport.NewWriter(&request)
+	out.WriteLine("command=fetch\n")
+	out.Delim()
+	for i := 0; i < 10; i++ {
+		out.WriteLine("want %040d\n", i)
+	}
+	out.Flush()
+
+	resp, err := http.Post(server.URL+"/git-upload-pack", "application/x-git-upload-pack-request", &request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(body), "ERR ") || !strings.Contains(string(body), "too large") {
+		t.Errorf("Expected the client to be told the request was too large, got %q", body)
+	}
+	if !strings.Contains(logged.String(), "git-upload-pack") {
+		t.Errorf("Expected the error to be logged, got %q", logged.String())
+	}
+}
@@ -0,0 +1,105 @@
+package transport
+
+import (
+	"sort"
+	"time"
+
+	"github.com/tpbowden/jit/database"
+)
+
+const (
+	// firstHaveBatch is how many haves the first round of negotiation
+	// offers. Each round after that offers twice as many as the last, up to
+	// maxHaveBatch.
+	firstHaveBatch = 16
+	maxHaveBatch   = 256
+)
+
+type queuedHave struct {
+	oid     string
+	when    time.Time
+	parents []string
+}
+
+// haveWalker lists the commits a client can offer as haves: the tips it was
+// given and then their ancestors, newest first. Once the server acknowledges
+// a commit, its ancestors are known to be common and are no longer offered.
+type haveWalker struct {
+	store   database.ObjectStore
+	queue   []queuedHave
+	seen    map[string]bool
+	parents map[string][]string
+	common  map[string]bool
+}
+
+func newHaveWalker(store database.ObjectStore, tips []string) *haveWalker {
+	w := &haveWalker{
+		store:   store,
+		seen:    map[string]bool{},
+		parents: map[string][]string{},
+		common:  map[string]bool{},
+	}
+	for _, oid := range tips {
+		w.push(oid)
+	}
+	return w
+}
+
+// push queues an object by the time it was committed. Objects that are not
+// commits have no ancestors to walk, and ones missing from the store are
+// skipped.
+func (w *haveWalker) push(oid string) {
+	if w.seen[oid] {
+		return
+	}
+	w.seen[oid] = true
+	object, err := w.store.Load(oid)
+	if err != nil {
+		return
+	}
+	have := queuedHave{oid: oid}
+	if commit, ok := object.(database.Commit); ok {
+		have.when, have.parents = commit.CommitTime, commit.Parents
+	}
+	w.parents[oid] = have.parents
+
+	i := sort.Search(len(w.queue), func(i int) bool {
+		return w.queue[i].when.Before(have.when)
+	})
+	w.queue = append(w.queue, queuedHave{})
+	copy(w.queue[i+1:], w.queue[i:])
+	w.queue[i] = have
+}
+
+// next returns up to n more haves to offer.
+func (w *haveWalker) next(n int) []string {
+	haves := []string{}
+	for len(haves) < n && len(w.queue) > 0 {
+		have := w.queue[0]
+		w.queue = w.queue[1:]
+		if w.common[have.oid] {
+			for _, parent := range have.parents {
+				w.common[parent] = true
+			}
+			continue
+		}
+		haves = append(haves, have.oid)
+		for _, parent := range have.parents {
+			w.push(parent)
+		}
+	}
+	return haves
+}
+
+// done reports whether there is nothing left to offer.
+func (w *haveWalker) done() bool {
+	return len(w.queue) == 0
+}
+
+// acknowledge records that the server has a commit, and so its ancestors.
+func (w *haveWalker) acknowledge(oid string) {
+	w.common[oid] = true
+	for _, parent := range w.parents[oid] {
+		w.common[parent] = true
+	}
+}
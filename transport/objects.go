@@ -0,0 +1,62 @@
+package transport
+
+import (
+	"context"
+
+	"github.com/tpbowden/jit/database"
+)
+
+// walkObjects calls visit for each object reachable from tips that is not in
+// seen, adding it to seen. Objects are visited before the objects they refer
+// to, so commits come first as git expects.
+func walkObjects(ctx context.Context, store database.ObjectStore, tips []string, seen map[string]bool, visit func(string)) error {
+	stack := append([]string{}, tips...)
+	for len(stack) > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		oid := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if oid == "" || seen[oid] {
+			continue
+		}
+		seen[oid] = true
+
+		objectType, data, err := store.ReadObject(oid)
+		if err != nil {
+			return err
+		}
+		visit(oid)
+
+		references, err := database.References(objectType, data)
+		if err != nil {
+			return err
+		}
+		for i := len(references) - 1; i >= 0; i-- {
+			stack = append(stack, references[i])
+		}
+	}
+	return nil
+}
+
+// objectsToSend lists the objects reachable from wants but not from haves,
+// which the other side is known to have. Haves missing from store are
+// ignored.
+func objectsToSend(ctx context.Context, store database.ObjectStore, wants, haves []string) ([]string, error) {
+	seen := map[string]bool{}
+	common := []string{}
+	for _, oid := range haves {
+		if store.Exists(oid) {
+			common = append(common, oid)
+		}
+	}
+	if err := walkObjects(ctx, store, common, seen, func(string) {}); err != nil {
+		return nil, err
+	}
+
+	oids := []string{}
+	err := walkObjects(ctx, store, wants, seen, func(oid string) {
+		oids = append(oids, oid)
+	})
+	return oids, err
+}
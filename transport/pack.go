@@ -0,0 +1,296 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"hash"
+	"io"
+	"io/ioutil"
+
+	"github.com/tpbowden/jit/database"
+)
+
+const (
+	packCommit   = 1
+	packTree     = 2
+	packBlob     = 3
+	packTag      = 4
+	packOfsDelta = 6
+	packRefDelta = 7
+)
+
+var packTypes = map[string]int{
+	"commit": packCommit,
+	"tree":   packTree,
+	"blob":   packBlob,
+	"tag":    packTag,
+}
+
+var packTypeNames = map[int]string{
+	packCommit: "commit",
+	packTree:   "tree",
+	packBlob:   "blob",
+	packTag:    "tag",
+}
+
+// WritePack writes the given objects from store to w as a version 2
+// packfile. Objects are written whole rather than as deltas.
+func WritePack(w io.Writer, store database.ObjectStore, oids []string) error {
+	checksum := sha1.New()
+	out := io.MultiWriter(w, checksum)
+
+	header := make([]byte, 12)
+	copy(header, "PACK")
+	binary.BigEndian.PutUint32(header[4:], 2)
+	binary.BigEndian.PutUint32(header[8:], uint32(len(oids)))
+	if _, err := out.Write(header); err != nil {
+		return err
+	}
+
+	for _, oid := range oids {
+		objectType, data, err := store.ReadObject(oid)
+		if err != nil {
+			return err
+		}
+		if err := writeEntry(out, packTypes[objectType], data); err != nil {
+			return err
+		}
+	}
+
+	_, err := w.Write(checksum.Sum(nil))
+	return err
+}
+
+func writeEntry(w io.Writer, objectType int, data []byte) error {
+	size := len(data)
+	header := []byte{byte(objectType<<4) | byte(size&0x0f)}
+	for size >>= 4; size > 0; size >>= 7 {
+		header[len(header)-1] |= 0x80
+		header = append(header, byte(size&0x7f))
+	}
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	if _, err := zw.Write(data); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	_, err := w.Write(compressed.Bytes())
+	return err
+}
+
+// packReader tracks the offset and checksum of everything read from a pack.
+// It reads a byte at a time where it can, so that zlib stops exactly at the
+// end of each compressed entry.
+type packReader struct {
+	r        *bufio.Reader
+	checksum hash.Hash
+	offset   int64
+}
+
+func (p *packReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.checksum.Write(b[:n])
+	p.offset += int64(n)
+	return n, err
+}
+
+func (p *packReader) ReadByte() (byte, error) {
+	b, err := p.r.ReadByte()
+	if err == nil {
+		p.checksum.Write([]byte{b})
+		p.offset++
+	}
+	return b, err
+}
+
+// packEntry is an object read from a pack, whose data is a delta if it has
+// a base.
+type packEntry struct {
+	objectType int
+	data       []byte
+	baseOffset int64
+	baseOID    string
+}
+
+func (p *packReader) readEntry() (packEntry, error) {
+	entry := packEntry{}
+	start := p.offset
+
+	b, err := p.ReadByte()
+	if err != nil {
+		return entry, err
+	}
+	entry.objectType = int(b>>4) & 0x07
+	size, shift := int(b&0x0f), uint(4)
+	for b&0x80 != 0 {
+		if b, err = p.ReadByte(); err != nil {
+			return entry, err
+		}
+		if shift > 56 {
+			return entry, corruptPack("entry size too large")
+		}
+		size |= int(b&0x7f) << shift
+		shift += 7
+	}
+
+	switch entry.objectType {
+	case packOfsDelta:
+		if b, err = p.ReadByte(); err != nil {
+			return entry, err
+		}
+		distance := int64(b & 0x7f)
+		for b&0x80 != 0 {
+			if b, err = p.ReadByte(); err != nil {
+				return entry, err
+			}
+			distance = (distance+1)<<7 | int64(b&0x7f)
+		}
+		if distance <= 0 || distance > start {
+			return entry, corruptPack("delta base offset out of range")
+		}
+		entry.baseOffset = start - distance
+	case packRefDelta:
+		oid := make([]byte, 20)
+		if _, err := io.ReadFull(p, oid); err != nil {
+			return entry, err
+		}
+		entry.baseOID = hex.EncodeToString(oid)
+	case packCommit, packTree, packBlob, packTag:
+	default:
+		return entry, corruptPack("unknown object type %d", entry.objectType)
+	}
+
+	zr, err := zlib.NewReader(p)
+	if err != nil {
+		return entry, corruptPack("%v", err)
+	}
+	// Reading one byte past the declared size is enough to tell that the
+	// entry is too long, without inflating the rest of it.
+	if entry.data, err = ioutil.ReadAll(io.LimitReader(zr, int64(size)+1)); err != nil {
+		return entry, corruptPack("%v", err)
+	}
+	if len(entry.data) != size {
+		return entry, corruptPack("entry is %d bytes, expected %d", len(entry.data), size)
+	}
+	return entry, nil
+}
+
+// ReadPack reads a packfile from r and stores its objects in store,
+// returning their IDs in the order they appear in the pack. Deltas may be
+// based on any object in the pack, or on an object already in store.
+func ReadPack(r io.Reader, store database.ObjectStore) ([]string, error) {
+	p := &packReader{r: bufio.NewReader(r), checksum: sha1.New()}
+
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(p, header); err != nil {
+		return nil, err
+	}
+	if string(header[:4]) != "PACK" {
+		return nil, corruptPack("bad signature")
+	}
+	if version := binary.BigEndian.Uint32(header[4:]); version != 2 && version != 3 {
+		return nil, corruptPack("unsupported version %d", version)
+	}
+	count := int(binary.BigEndian.Uint32(header[8:]))
+
+	// The count comes from the peer, so nothing is allocated for entries
+	// until they have actually been read.
+	offsets := []int64{}
+	entries := map[int64]packEntry{}
+	for i := 0; i < count; i++ {
+		offset := p.offset
+		entry, err := p.readEntry()
+		if err != nil {
+			return nil, err
+		}
+		offsets = append(offsets, offset)
+		entries[offset] = entry
+	}
+
+	expected := p.checksum.Sum(nil)
+	trailer := make([]byte, 20)
+	if _, err := io.ReadFull(p.r, trailer); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(expected, trailer) {
+		return nil, corruptPack("checksum mismatch")
+	}
+
+	objects, err := resolveEntries(offsets, entries, store)
+	if err != nil {
+		return nil, err
+	}
+	oids := make([]string, 0, len(offsets))
+	for _, offset := range offsets {
+		object := objects[offset]
+		if err := store.Store(object); err != nil {
+			return nil, err
+		}
+		oids = append(oids, database.ObjectID(object))
+	}
+	return oids, nil
+}
+
+// resolveEntries turns every entry into a whole object. Deltas are resolved
+// repeatedly until none are left, since a delta's base may itself be a
+// delta that appears later in the pack.
+func resolveEntries(offsets []int64, entries map[int64]packEntry, store database.ObjectStore) (map[int64]database.Raw, error) {
+	objects := map[int64]database.Raw{}
+	byOID := map[string]database.Raw{}
+	resolved := func(offset int64, object database.Raw) {
+		objects[offset] = object
+		byOID[database.ObjectID(object)] = object
+	}
+
+	pending := []int64{}
+	for _, offset := range offsets {
+		entry := entries[offset]
+		if name, ok := packTypeNames[entry.objectType]; ok {
+			resolved(offset, database.NewRaw(name, entry.data))
+		} else {
+			pending = append(pending, offset)
+		}
+	}
+
+	for len(pending) > 0 {
+		remaining := pending[:0]
+		for _, offset := range pending {
+			entry := entries[offset]
+			base, found := objects[entry.baseOffset]
+			if entry.objectType == packRefDelta {
+				if base, found = byOID[entry.baseOID]; !found && store.Exists(entry.baseOID) {
+					objectType, data, err := store.ReadObject(entry.baseOID)
+					if err != nil {
+						return nil, err
+					}
+					base, found = database.NewRaw(objectType, data), true
+				}
+			}
+			if !found {
+				remaining = append(remaining, offset)
+				continue
+			}
+
+			data, err := applyDelta(base.Data(), entry.data)
+			if err != nil {
+				return nil, err
+			}
+			resolved(offset, database.NewRaw(base.Type(), data))
+		}
+		if len(remaining) == len(pending) {
+			return nil, corruptPack("%d deltas have no base", len(remaining))
+		}
+		pending = remaining
+	}
+	return objects, nil
+}
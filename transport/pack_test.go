@@ -0,0 +1,117 @@
+package transport_test
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/hex"
+	"testing"
+
+	"github.com/tpbowden/jit/database"
+	"github.com/tpbowden/jit/transport"
+)
+
+// entry encodes a pack entry header followed by its compressed data.
+func entry(objectType int, size int, extra []byte, data []byte) []byte {
+	header := []byte{byte(objectType<<4) | byte(size&0x0f)}
+	for size >>= 4; size > 0; size >>= 7 {
+		header[len(header)-1] |= 0x80
+		header = append(header, byte(size&0x7f))
+	}
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	zw.Write(data)
+	zw.Close()
+	return append(append(header, extra...), compressed.Bytes()...)
+}
+
+func pack(entries ...[]byte) []byte {
+	data := []byte{'P', 'A', 'C', 'K', 0, 0, 0, 2, 0, 0, 0, byte(len(entries))}
+	for _, e := range entries {
+		data = append(data, e...)
+	}
+	sum := sha1.Sum(data)
+	return append(data, sum[:]...)
+}
+
+func TestPackRoundTrip(t *testing.T) {
+	source := database.NewMemory()
+	blobs := []database.Blob{database.NewBlob([]byte("hello\n")), database.NewBlob(bytes.Repeat([]byte("x"), 70000))}
+	oids := []string{}
+	for _, blob := range blobs {
+		source.Store(blob)
+		oids = append(oids, database.ObjectID(blob))
+	}
+
+	var buf bytes.Buffer
+	if err := transport.WritePack(&buf, source, oids); err != nil {
+		t.Fatal(err)
+	}
+	target := database.NewMemory()
+	read, err := transport.ReadPack(&buf, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read) != 2 || read[0] != oids[0] || read[1] != oids[1] {
+		t.Fatalf("Unexpected objects %v", read)
+	}
+	if _, data, _ := target.ReadObject(oids[1]); len(data) != 70000 {
+		t.Fatalf("Unexpected blob of %d bytes", len(data))
+	}
+}
+
+func TestPackDeltas(t *testing.T) {
+	base := []byte("the quick brown fox\n")
+	// Copy "the quick " from the base, insert "red", then copy " fox\n".
+	delta := []byte{20, 18, 0x90, 10, 3, 'r', 'e', 'd', 0x91, 15, 5}
+	// The same result again, as a delta of the base by object ID.
+	baseID, _ := hex.DecodeString(database.ObjectID(database.NewBlob(base)))
+
+	firstDelta := 12 + len(entry(3, len(base), nil, base))
+	data := pack(
+		entry(3, len(base), nil, base),
+		entry(6, len(delta), []byte{byte(firstDelta - 12)}, delta),
+		entry(7, len(delta), baseID, delta),
+	)
+
+	store := database.NewMemory()
+	oids, err := transport.ReadPack(bytes.NewReader(data), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := database.ObjectID(database.NewBlob([]byte("the quick red fox\n")))
+	if len(oids) != 3 || oids[1] != expected || oids[2] != expected {
+		t.Fatalf("Unexpected objects %v, expected %s", oids, expected)
+	}
+
+	data[len(data)-1] ^= 0xff
+	if _, err := transport.ReadPack(bytes.NewReader(data), database.NewMemory()); err == nil {
+		t.Fatal("Expected a checksum error")
+	}
+}
+
+func TestPackSizesFromThePeerAreNotTrusted(t *testing.T) {
+	header := []byte{'P', 'A', 'C', 'K', 0, 0, 0, 2, 0xff, 0xff, 0xff, 0xff}
+	if _, err := transport.ReadPack(bytes.NewReader(header), database.NewMemory()); err == nil {
+		t.Fatal("Expected a truncated pack to fail")
+	}
+
+	base := []byte("the quick brown fox\n")
+	// Claims a result of 2^35 bytes but only copies the base once.
+	delta := []byte{20, 0x80, 0x80, 0x80, 0x80, 0x80, 0x01, 0x90, 20}
+	data := pack(
+		entry(3, len(base), nil, base),
+		entry(6, len(delta), []byte{byte(len(entry(3, len(base), nil, base)))}, delta),
+	)
+	if _, err := transport.ReadPack(bytes.NewReader(data), database.NewMemory()); err == nil {
+		t.Fatal("Expected a delta with the wrong size to fail")
+	} else if _, ok := err.(*transport.CorruptPack); !ok {
+		t.Fatalf("Expected CorruptPack, got %v", err)
+	}
+
+	// An entry whose data inflates past its declared size.
+	data = pack(entry(3, 4, nil, bytes.Repeat([]byte("x"), 100000)))
+	if _, err := transport.ReadPack(bytes.NewReader(data), database.NewMemory()); err == nil {
+		t.Fatal("Expected an oversized entry to fail")
+	}
+}
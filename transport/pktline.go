@@ -0,0 +1,114 @@
+// Package transport implements git's wire protocol: pkt-line framing,
+// packfiles, and the upload-pack and receive-pack services that fetch and
+// push use, over pipes or smart HTTP.
+package transport
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// maxPacket is the largest pkt-line, including its four byte length.
+const maxPacket = 65520
+
+type PacketType int
+
+const (
+	Data PacketType = iota
+	// Flush ends a message.
+	Flush
+	// Delim separates sections of a protocol v2 message.
+	Delim
+	// ResponseEnd ends a stateless protocol v2 response.
+	ResponseEnd
+)
+
+// Writer writes pkt-lines, each prefixed with its length as four hex digits.
+type Writer struct {
+	w io.Writer
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w}
+}
+
+func (w *Writer) WritePacket(data []byte) error {
+	if len(data)+4 > maxPacket {
+		return protocolError("packet of %d bytes is too long", len(data))
+	}
+	if _, err := fmt.Fprintf(w.w, "%04x", len(data)+4); err != nil {
+		return err
+	}
+	_, err := w.w.Write(data)
+	return err
+}
+
+// WriteLine writes a formatted packet, which by convention ends in a newline.
+func (w *Writer) WriteLine(format string, args ...interface{}) error {
+	return w.WritePacket([]byte(fmt.Sprintf(format, args...)))
+}
+
+func (w *Writer) Flush() error {
+	_, err := io.WriteString(w.w, "0000")
+	return err
+}
+
+func (w *Writer) Delim() error {
+	_, err := io.WriteString(w.w, "0001")
+	return err
+}
+
+// Reader reads pkt-lines. It never reads past the end of the packet it
+// returns, so whatever follows the packets, such as a packfile, can be read
+// from the underlying reader.
+type Reader struct {
+	r io.Reader
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r}
+}
+
+// ReadPacket returns the next packet. An "ERR" packet is returned as a
+// RemoteError.
+func (r *Reader) ReadPacket() (PacketType, []byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r.r, header[:]); err != nil {
+		return Data, nil, err
+	}
+	length, err := strconv.ParseUint(string(header[:]), 16, 16)
+	if err != nil {
+		return Data, nil, protocolError("bad packet length %q", header[:])
+	}
+
+	switch length {
+	case 0:
+		return Flush, nil, nil
+	case 1:
+		return Delim, nil, nil
+	case 2:
+		return ResponseEnd, nil, nil
+	case 3:
+		return Data, nil, protocolError("bad packet length %q", header[:])
+	}
+
+	data := make([]byte, length-4)
+	if _, err := io.ReadFull(r.r, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return Data, nil, err
+	}
+	if strings.HasPrefix(string(data), "ERR ") {
+		return Data, nil, remoteError(strings.TrimSpace(string(data[4:])))
+	}
+	return Data, data, nil
+}
+
+// ReadLine is ReadPacket for text packets, with any trailing newline removed.
+func (r *Reader) ReadLine() (PacketType, string, error) {
+	kind, data, err := r.ReadPacket()
+	return kind, strings.TrimSuffix(string(data), "\n"), err
+}
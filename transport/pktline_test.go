@@ -0,0 +1,44 @@
+package transport_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/tpbowden/jit/transport"
+)
+
+func TestPacketRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	w := transport.NewWriter(&buf)
+	w.WriteLine("command=%s\n", "ls-refs")
+	w.Delim()
+	w.WritePacket([]byte{})
+	w.Flush()
+
+	if buf.String() != "0014command=ls-refs\n000100040000" {
+		t.Fatalf("Unexpected encoding %q", buf.String())
+	}
+
+	r := transport.NewReader(&buf)
+	expected := []transport.PacketType{transport.Data, transport.Delim, transport.Data, transport.Flush}
+	for i, kind := range expected {
+		got, line, err := r.ReadLine()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != kind {
+			t.Fatalf("Packet %d: expected type %v, got %v", i, kind, got)
+		}
+		if i == 0 && line != "command=ls-refs" {
+			t.Fatalf("Unexpected line %q", line)
+		}
+	}
+}
+
+func TestErrorPacket(t *testing.T) {
+	r := transport.NewReader(bytes.NewBufferString("0013ERR no such ref"))
+	_, _, err := r.ReadPacket()
+	if _, ok := err.(*transport.RemoteError); !ok {
+		t.Fatalf("Expected a RemoteError, got %v", err)
+	}
+}
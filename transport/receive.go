@@ -0,0 +1,207 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+
+	"github.com/tpbowden/jit/core"
+	"github.com/tpbowden/jit/database"
+)
+
+// zeroID stands for a missing ref in receive-pack commands.
+const zeroID = "0000000000000000000000000000000000000000"
+
+var receiveCapabilities = []string{"report-status", "delete-refs", "side-band-64k", "ofs-delta", agent}
+
+// Command asks receive-pack to move a ref from Old to New. An empty Old
+// creates the ref and an empty New deletes it.
+type Command struct {
+	Name string
+	Old  string
+	New  string
+}
+
+func orZero(oid string) string {
+	if oid == "" {
+		return zeroID
+	}
+	return oid
+}
+
+func fromZero(oid string) string {
+	if oid == zeroID {
+		return ""
+	}
+	return oid
+}
+
+func parseCapabilities(line string) (string, map[string]bool) {
+	capabilities := map[string]bool{}
+	parts := strings.SplitN(line, "\x00", 2)
+	if len(parts) == 2 {
+		for _, capability := range strings.Fields(parts[1]) {
+			capabilities[capability] = true
+		}
+	}
+	return parts[0], capabilities
+}
+
+// ReceivePack accepts a push using the original protocol, since protocol v2
+// does not cover pushes. It advertises the repository's refs, reads the
+// client's commands and packfile, and reports the outcome of each command.
+func (s *Server) ReceivePack(ctx context.Context, r io.Reader, w io.Writer) error {
+	if err := s.advertiseRefs(NewWriter(w)); err != nil {
+		return err
+	}
+	return s.receive(ctx, r, w)
+}
+
+// receive reads commands and a packfile from r and writes the report to w.
+func (s *Server) receive(ctx context.Context, r io.Reader, w io.Writer) error {
+	in, out := NewReader(r), NewWriter(w)
+	commands := []Command{}
+	capabilities := map[string]bool{}
+	for {
+		kind, line, err := in.ReadLine()
+		if err == io.EOF && len(commands) == 0 {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if kind == Flush {
+			break
+		}
+		if len(commands) == 0 {
+			line, capabilities = parseCapabilities(line)
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return protocolError("bad command %q", line)
+		}
+		commands = append(commands, Command{Name: fields[2], Old: fromZero(fields[0]), New: fromZero(fields[1])})
+	}
+	if len(commands) == 0 {
+		return nil
+	}
+
+	unpackErr := s.unpack(ctx, r, commands)
+	var report bytes.Buffer
+	status := NewWriter(&report)
+	if unpackErr != nil {
+		status.WriteLine("unpack %s\n", unpackErr.Error())
+	} else {
+		status.WriteLine("unpack ok\n")
+	}
+	for _, command := range commands {
+		reason := "unpacker error"
+		if unpackErr == nil {
+			var err error
+			if reason, err = s.updateRef(command); err != nil {
+				return err
+			}
+		}
+		if reason == "" {
+			status.WriteLine("ok %s\n", command.Name)
+		} else {
+			status.WriteLine("ng %s %s\n", command.Name, reason)
+		}
+	}
+	status.Flush()
+
+	if !capabilities["report-status"] {
+		return nil
+	}
+	if capabilities["side-band-64k"] {
+		if _, err := (&sidebandWriter{out, bandData}).Write(report.Bytes()); err != nil {
+			return err
+		}
+		return out.Flush()
+	}
+	_, err := w.Write(report.Bytes())
+	return err
+}
+
+func (s *Server) advertiseRefs(out *Writer) error {
+	names, err := s.repo.Refs.ListRefs("refs/")
+	if err != nil {
+		return err
+	}
+	capabilities := strings.Join(receiveCapabilities, " ")
+	first := true
+	for _, name := range names {
+		oid, err := s.repo.Refs.ReadRef(name)
+		if err != nil {
+			return err
+		}
+		if first {
+			err = out.WriteLine("%s %s\x00%s\n", oid, name, capabilities)
+		} else {
+			err = out.WriteLine("%s %s\n", oid, name)
+		}
+		if err != nil {
+			return err
+		}
+		first = false
+	}
+	if first {
+		if err := out.WriteLine("%s capabilities^{}\x00%s\n", zeroID, capabilities); err != nil {
+			return err
+		}
+	}
+	return out.Flush()
+}
+
+// unpack reads the packfile that follows the commands, unless they only
+// delete refs. Objects are held in memory until the pack has been checked,
+// and are then copied so that nothing is stored before the objects it
+// refers to.
+func (s *Server) unpack(ctx context.Context, r io.Reader, commands []Command) error {
+	tips := []string{}
+	for _, command := range commands {
+		if command.New != "" {
+			tips = append(tips, command.New)
+		}
+	}
+	if len(tips) == 0 {
+		return nil
+	}
+
+	received := database.NewOverlay(database.NewMemory(), s.repo.Database)
+	if _, err := ReadPack(r, received); err != nil {
+		return err
+	}
+	_, err := database.CopyObjects(ctx, received, s.repo.Database, tips)
+	return err
+}
+
+// updateRef applies a command, returning why it was refused, if it was.
+// Only well-formed names under refs/ can be changed, so a client can neither
+// touch files such as ORIG_HEAD nor climb out of the repository.
+func (s *Server) updateRef(command Command) (string, error) {
+	if !strings.HasPrefix(command.Name, "refs/") || !core.ValidRefName(command.Name) {
+		return "funny refname", nil
+	}
+	current, err := s.repo.Refs.ReadRef(command.Name)
+	if err != nil {
+		return "", err
+	}
+	head, err := s.repo.Refs.CurrentRef()
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case current != command.Old:
+		return "stale info", nil
+	case !s.bare && command.Name == head:
+		return "branch is currently checked out", nil
+	}
+
+	if command.New == "" {
+		err = s.repo.Refs.DeleteRef(command.Name)
+	} else {
+		err = s.repo.Refs.UpdateRef(command.Name, command.New)
+	}
+	return "", err
+}
@@ -0,0 +1,79 @@
+package transport
+
+import (
+	"io"
+	"strings"
+)
+
+const (
+	bandData     = 1
+	bandProgress = 2
+	bandError    = 3
+)
+
+// sidebandWriter multiplexes a stream onto one band of pkt-lines.
+type sidebandWriter struct {
+	packets *Writer
+	band    byte
+}
+
+func (s *sidebandWriter) Write(data []byte) (int, error) {
+	written := 0
+	for len(data) > 0 {
+		n := len(data)
+		if n > maxPacket-5 {
+			n = maxPacket - 5
+		}
+		if err := s.packets.WritePacket(append([]byte{s.band}, data[:n]...)); err != nil {
+			return written, err
+		}
+		written += n
+		data = data[n:]
+	}
+	return written, nil
+}
+
+// sidebandReader reads the data band of a multiplexed stream until a flush
+// packet, copying progress messages to progress if it is not nil.
+type sidebandReader struct {
+	packets  *Reader
+	progress io.Writer
+	pending  []byte
+	done     bool
+}
+
+func (s *sidebandReader) Read(p []byte) (int, error) {
+	for len(s.pending) == 0 {
+		if s.done {
+			return 0, io.EOF
+		}
+		kind, data, err := s.packets.ReadPacket()
+		if err != nil {
+			return 0, err
+		}
+		if kind != Data {
+			s.done = true
+			continue
+		}
+		if len(data) == 0 {
+			return 0, protocolError("empty sideband packet")
+		}
+
+		switch data[0] {
+		case bandData:
+			s.pending = data[1:]
+		case bandProgress:
+			if s.progress != nil {
+				s.progress.Write(data[1:])
+			}
+		case bandError:
+			return 0, remoteError(strings.TrimSpace(string(data[1:])))
+		default:
+			return 0, protocolError("unknown sideband %d", data[0])
+		}
+	}
+
+	n := copy(p, s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
@@ -0,0 +1,306 @@
+package transport_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tpbowden/jit/database"
+	"github.com/tpbowden/jit/jit"
+	"github.com/tpbowden/jit/repository"
+	"github.com/tpbowden/jit/transport"
+)
+
+func setup(t *testing.T) (*jit.Repository, *repository.Repository, func()) {
+	dir, err := ioutil.TempDir("", "jit_transport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := jit.Init(context.Background(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo.SetIdentity(jit.Signature{Name: "A. U. Thor", Email: "author@example.com"})
+	internal, err := repository.Open(filepath.Join(dir, ".git"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repo, internal, func() { os.RemoveAll(dir) }
+}
+
+func commit(t *testing.T, repo *jit.Repository, name, contents string) string {
+	if err := ioutil.WriteFile(filepath.Join(repo.Dir(), name), []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Add(context.Background(), name); err != nil {
+		t.Fatal(err)
+	}
+	result, err := repo.Commit(context.Background(), jit.CommitOptions{Message: name + "\n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result.OID
+}
+
+// serve connects a client to one of server's services through a pair of
+// pipes, returning the client's ends and a channel the service's result is
+// sent on once the client closes its end.
+func serve(service func(context.Context, io.Reader, io.Writer) error) (io.Reader, io.WriteCloser, chan error) {
+	requests, requestWriter := io.Pipe()
+	responseReader, responses := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := service(context.Background(), requests, responses)
+		responses.CloseWithError(err)
+		done <- err
+	}()
+	return responseReader, requestWriter, done
+}
+
+func TestFetchOverPipes(t *testing.T) {
+	repo, internal, cleanup := setup(t)
+	defer cleanup()
+	ctx := context.Background()
+	first := commit(t, repo, "a.txt", "one\n")
+	second := commit(t, repo, "b.txt", "two\n")
+
+	server := transport.NewServer(internal, false)
+	r, w, done := serve(server.UploadPack)
+	client, err := transport.NewFetchClient(r, w)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refs, err := client.LsRefs(ctx, []string{"HEAD"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refs) != 1 || refs[0].OID != second || refs[0].Symref != "refs/heads/master" {
+		t.Fatalf("Unexpected refs %#v", refs)
+	}
+
+	store := database.NewMemory()
+	var progress bytes.Buffer
+	oids, err := client.Fetch(ctx, []string{first}, nil, store, &progress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(oids) != 3 || !store.Exists(first) {
+		t.Fatalf("Expected a commit, tree and blob, got %v", oids)
+	}
+	if !strings.Contains(progress.String(), "Enumerating objects: 3, done.") {
+		t.Fatalf("Unexpected progress %q", progress.String())
+	}
+
+	oids, err = client.Fetch(ctx, []string{second}, []string{first}, store, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(oids) != 3 {
+		t.Fatalf("Expected only the new commit, tree and blob, got %v", oids)
+	}
+
+	w.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// requestLog records the requests a client writes.
+type requestLog struct {
+	io.WriteCloser
+	requests []string
+}
+
+func (l *requestLog) Write(data []byte) (int, error) {
+	l.requests = append(l.requests, string(data))
+	return l.WriteCloser.Write(data)
+}
+
+func TestFetchNegotiatesCommonHistory(t *testing.T) {
+	repo, internal, cleanup := setup(t)
+	defer cleanup()
+	ctx := context.Background()
+	shared := []string{}
+	for i := 0; i < 30; i++ {
+		shared = append(shared, commit(t, repo, "a.txt", fmt.Sprintf("%d\n", i)))
+	}
+	tip := shared[len(shared)-1]
+
+	server := transport.NewServer(internal, false)
+	r, w, done := serve(server.UploadPack)
+	requests := &requestLog{WriteCloser: w}
+	client, err := transport.NewFetchClient(r, requests)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := database.NewMemory()
+	if _, err := client.Fetch(ctx, []string{tip}, nil, store, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// The client has commits of its own on top of the shared history, and
+	// the server a new one.
+	local, author := tip, database.NewAuthor("A. U. Thor", "author@example.com")
+	for i := 0; i < 30; i++ {
+		object := database.NewCommit(author, treeOf(t, internal, tip), local, "local\n", time.Now().Add(time.Duration(i+1)*time.Minute))
+		if err := store.Store(object); err != nil {
+			t.Fatal(err)
+		}
+		local = database.ObjectID(object)
+	}
+	latest := commit(t, repo, "b.txt", "new\n")
+
+	requests.requests = nil
+	oids, err := client.Fetch(ctx, []string{latest}, []string{local}, store, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(oids) != 3 {
+		t.Fatalf("Expected only the new commit, tree and blob, got %v", oids)
+	}
+	haves := strings.Count(strings.Join(requests.requests, ""), "have ")
+	if len(requests.requests) != 2 || haves >= 60 {
+		t.Errorf("Expected two rounds offering part of the history, got %d with %d haves", len(requests.requests), haves)
+	}
+	if strings.Contains(strings.Join(requests.requests, ""), "done") {
+		t.Error("Expected the server to be ready before the haves ran out")
+	}
+
+	requests.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func treeOf(t *testing.T, repo *repository.Repository, oid string) string {
+	object, err := repo.Database.Load(oid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return object.(database.Commit).TreeID
+}
+
+func TestPushOverPipes(t *testing.T) {
+	repo, internal, cleanup := setup(t)
+	defer cleanup()
+	remote, remoteInternal, cleanupRemote := setup(t)
+	defer cleanupRemote()
+	ctx := context.Background()
+
+	base := commit(t, remote, "a.txt", "one\n")
+	commit(t, repo, "a.txt", "one\n")
+	tip := commit(t, repo, "b.txt", "two\n")
+
+	push := func(commands ...transport.Command) []string {
+		r, w, done := serve(transport.NewServer(remoteInternal, false).ReceivePack)
+		client, err := transport.NewPushClient(r, w)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if refs := client.Refs(); len(refs) == 0 || refs[0].Name != "refs/heads/master" {
+			t.Fatalf("Unexpected refs %#v", refs)
+		}
+		results, err := client.Push(ctx, internal.Database, commands, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Close()
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+		return results
+	}
+
+	results := push(
+		transport.Command{Name: "refs/heads/topic", New: tip},
+		transport.Command{Name: "refs/heads/master", Old: base, New: tip},
+		transport.Command{Name: "refs/heads/other", Old: base, New: tip},
+	)
+	expected := []string{"", "branch is currently checked out", "stale info"}
+	for i := range expected {
+		if results[i] != expected[i] {
+			t.Fatalf("Unexpected results %q", results)
+		}
+	}
+	if oid, _ := remoteInternal.Refs.ReadRef("refs/heads/topic"); oid != tip {
+		t.Fatalf("Expected topic at %s, got %q", tip, oid)
+	}
+	if entries, err := remoteInternal.Database.ReadTreeRecursive(treeOf(t, remoteInternal, tip)); err != nil || len(entries) != 2 {
+		t.Fatalf("Expected the pushed tree, got %v, %v", entries, err)
+	}
+
+	results = push(transport.Command{Name: "refs/heads/topic", Old: tip})
+	if results[0] != "" {
+		t.Fatalf("Unexpected results %q", results)
+	}
+	if oid, _ := remoteInternal.Refs.ReadRef("refs/heads/topic"); oid != "" {
+		t.Fatal("Expected topic to be deleted")
+	}
+}
+
+func TestReceivePackRefusesFunnyRefnames(t *testing.T) {
+	repo, internal, cleanup := setup(t)
+	defer cleanup()
+	tip := commit(t, repo, "a.txt", "one\n")
+	victim := filepath.Join(repo.Dir(), "..", "victim")
+	if err := ioutil.WriteFile(victim, []byte(tip+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(victim)
+	if err := internal.Refs.UpdateRef("ORIG_HEAD", tip); err != nil {
+		t.Fatal(err)
+	}
+
+	var request, response bytes.Buffer
+	commands := transport.NewWriter(&request)
+	commands.WriteLine("%s %s ../../victim\x00report-status\n", tip, strings.Repeat("0", 40))
+	commands.WriteLine("%s %s ORIG_HEAD\n", tip, strings.Repeat("0", 40))
+	commands.Flush()
+	if err := transport.NewServer(internal, false).ReceivePack(context.Background(), &request, &response); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{"ng ../../victim funny refname\n", "ng ORIG_HEAD funny refname\n"} {
+		if !strings.Contains(response.String(), expected) {
+			t.Fatalf("Expected %q in %q", expected, response.String())
+		}
+	}
+	if _, err := os.Stat(victim); err != nil {
+		t.Fatalf("Expected the file outside the repository to survive, got %v", err)
+	}
+	if oid, _ := internal.Refs.ReadRef("ORIG_HEAD"); oid != tip {
+		t.Fatalf("Expected ORIG_HEAD to be left alone, got %q", oid)
+	}
+}
+
+func TestUploadPackOnlyServesReachableObjects(t *testing.T) {
+	repo, internal, cleanup := setup(t)
+	defer cleanup()
+	ctx := context.Background()
+	first := commit(t, repo, "a.txt", "one\n")
+	second := commit(t, repo, "b.txt", "two\n")
+	if err := internal.Refs.UpdateRef("refs/heads/master", first); err != nil {
+		t.Fatal(err)
+	}
+
+	r, w, done := serve(transport.NewServer(internal, false).UploadPack)
+	client, err := transport.NewFetchClient(r, w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Fetch(ctx, []string{second}, nil, database.NewMemory(), nil); err == nil {
+		t.Fatal("Expected an unreachable want to be refused")
+	}
+	w.Close()
+	if err := <-done; err == nil || !strings.Contains(err.Error(), "not our ref "+second) {
+		t.Fatalf("Expected not our ref, got %v", err)
+	}
+}
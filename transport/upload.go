@@ -0,0 +1,312 @@
+package transport
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/tpbowden/jit/database"
+	"github.com/tpbowden/jit/repository"
+)
+
+const agent = "agent=jit"
+
+// Server answers fetches and pushes for a repository.
+type Server struct {
+	repo *repository.Repository
+	bare bool
+}
+
+// NewServer serves repo. Pushes to the branch checked out in a repository
+// that is not bare are refused, since they would leave its working tree out
+// of step with HEAD.
+func NewServer(repo *repository.Repository, bare bool) *Server {
+	return &Server{repo: repo, bare: bare}
+}
+
+// request is a protocol v2 command with its capabilities and arguments.
+type request struct {
+	command      string
+	capabilities []string
+	args         []string
+}
+
+// readRequest returns nil once the client has closed the connection.
+func readRequest(packets *Reader) (*request, error) {
+	kind, line, err := packets.ReadLine()
+	if err == io.EOF || (err == nil && kind == Flush) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if kind != Data || !strings.HasPrefix(line, "command=") {
+		return nil, protocolError("expected a command, got %q", line)
+	}
+
+	req := &request{command: strings.TrimPrefix(line, "command=")}
+	inArgs := false
+	for {
+		kind, line, err := packets.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case kind == Flush:
+			return req, nil
+		case kind == Delim:
+			inArgs = true
+		case inArgs:
+			req.args = append(req.args, line)
+		default:
+			req.capabilities = append(req.capabilities, line)
+		}
+	}
+}
+
+// UploadPack serves fetches using protocol v2, reading requests from r and
+// writing responses to w until r is closed.
+func (s *Server) UploadPack(ctx context.Context, r io.Reader, w io.Writer) error {
+	out := NewWriter(w)
+	if err := advertiseCapabilities(out); err != nil {
+		return err
+	}
+	return s.serveRequests(ctx, NewReader(r), out)
+}
+
+func advertiseCapabilities(out *Writer) error {
+	for _, line := range []string{"version 2", agent, "ls-refs", "fetch", "object-format=sha1"} {
+		if err := out.WriteLine("%s\n", line); err != nil {
+			return err
+		}
+	}
+	return out.Flush()
+}
+
+// serveRequests answers protocol v2 requests until the client stops sending
+// them.
+func (s *Server) serveRequests(ctx context.Context, in *Reader, out *Writer) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		req, err := readRequest(in)
+		if err != nil || req == nil {
+			return err
+		}
+
+		switch req.command {
+		case "ls-refs":
+			err = s.lsRefs(out, req.args)
+		case "fetch":
+			err = s.fetch(ctx, out, req.args)
+		default:
+			out.WriteLine("ERR unknown command '%s'\n", req.command)
+			err = protocolError("unknown command '%s'", req.command)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// peel follows annotated tags to the object they point at.
+func peel(store database.ObjectStore, oid string) (string, error) {
+	for {
+		object, err := store.Load(oid)
+		if err != nil {
+			return "", err
+		}
+		tag, ok := object.(database.Tag)
+		if !ok {
+			return oid, nil
+		}
+		oid = tag.Object
+	}
+}
+
+func (s *Server) lsRefs(out *Writer, args []string) error {
+	symrefs, peeled := false, false
+	prefixes := []string{}
+	for _, arg := range args {
+		switch {
+		case arg == "symrefs":
+			symrefs = true
+		case arg == "peel":
+			peeled = true
+		case strings.HasPrefix(arg, "ref-prefix "):
+			prefixes = append(prefixes, strings.TrimPrefix(arg, "ref-prefix "))
+		}
+	}
+	wanted := func(name string) bool {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		}
+		return len(prefixes) == 0
+	}
+
+	names, err := s.repo.Refs.ListRefs("refs/")
+	if err != nil {
+		return err
+	}
+	for _, name := range append([]string{"HEAD"}, names...) {
+		if !wanted(name) {
+			continue
+		}
+		var oid string
+		if name == "HEAD" {
+			oid, err = s.repo.Refs.ReadHead()
+		} else {
+			oid, err = s.repo.Refs.ReadRef(name)
+		}
+		if err != nil {
+			return err
+		}
+		if oid == "" {
+			continue
+		}
+
+		line := oid + " " + name
+		if name == "HEAD" && symrefs {
+			if target, err := s.repo.Refs.CurrentRef(); err != nil {
+				return err
+			} else if target != "HEAD" {
+				line += " symref-target:" + target
+			}
+		}
+		if peeled && strings.HasPrefix(name, "refs/tags/") {
+			target, err := peel(s.repo.Database, oid)
+			if err != nil {
+				return err
+			}
+			if target != oid {
+				line += " peeled:" + target
+			}
+		}
+		if err := out.WriteLine("%s\n", line); err != nil {
+			return err
+		}
+	}
+	return out.Flush()
+}
+
+// unreachableWant returns the first want that cannot be reached from HEAD or
+// any ref, or "" if there is none, so that objects left behind by deleted
+// branches are never served. The refs are only walked when some want is not
+// the tip of one.
+func (s *Server) unreachableWant(ctx context.Context, wants []string) (string, error) {
+	head, err := s.repo.Refs.ReadHead()
+	if err != nil {
+		return "", err
+	}
+	names, err := s.repo.Refs.ListRefs("refs/")
+	if err != nil {
+		return "", err
+	}
+	tips, isTip := []string{head}, map[string]bool{head: true}
+	for _, name := range names {
+		oid, err := s.repo.Refs.ReadRef(name)
+		if err != nil {
+			return "", err
+		}
+		tips = append(tips, oid)
+		isTip[oid] = true
+	}
+
+	others := []string{}
+	for _, oid := range wants {
+		if !isTip[oid] || oid == "" {
+			others = append(others, oid)
+		}
+	}
+	if len(others) == 0 {
+		return "", nil
+	}
+	reachable := map[string]bool{}
+	if err := walkObjects(ctx, s.repo.Database, tips, reachable, func(string) {}); err != nil {
+		return "", err
+	}
+	for _, oid := range others {
+		if !reachable[oid] {
+			return oid, nil
+		}
+	}
+	return "", nil
+}
+
+func (s *Server) fetch(ctx context.Context, out *Writer, args []string) error {
+	wants, haves := []string{}, []string{}
+	done, progress := false, true
+	for _, arg := range args {
+		switch {
+		case strings.HasPrefix(arg, "want "):
+			wants = append(wants, strings.TrimPrefix(arg, "want "))
+		case strings.HasPrefix(arg, "have "):
+			haves = append(haves, strings.TrimPrefix(arg, "have "))
+		case arg == "done":
+			done = true
+		case arg == "no-progress":
+			progress = false
+		}
+	}
+	if oid, err := s.unreachableWant(ctx, wants); err != nil {
+		return err
+	} else if oid != "" {
+		out.WriteLine("ERR upload-pack: not our ref %s\n", oid)
+		return protocolError("not our ref %s", oid)
+	}
+
+	common := []string{}
+	for _, oid := range haves {
+		if s.repo.Database.Exists(oid) {
+			common = append(common, oid)
+		}
+	}
+	if !done {
+		if err := out.WriteLine("acknowledgments\n"); err != nil {
+			return err
+		}
+		if len(common) == 0 {
+			if err := out.WriteLine("NAK\n"); err != nil {
+				return err
+			}
+			return out.Flush()
+		}
+		for _, oid := range common {
+			if err := out.WriteLine("ACK %s\n", oid); err != nil {
+				return err
+			}
+		}
+		if err := out.WriteLine("ready\n"); err != nil {
+			return err
+		}
+		if err := out.Delim(); err != nil {
+			return err
+		}
+	}
+
+	oids, err := objectsToSend(ctx, s.repo.Database, wants, common)
+	if err != nil {
+		return err
+	}
+	if err := out.WriteLine("packfile\n"); err != nil {
+		return err
+	}
+	if progress {
+		message := fmt.Sprintf("Enumerating objects: %d, done.\n", len(oids))
+		if _, err := (&sidebandWriter{out, bandProgress}).Write([]byte(message)); err != nil {
+			return err
+		}
+	}
+	data := bufio.NewWriterSize(&sidebandWriter{out, bandData}, maxPacket-5)
+	if err := WritePack(data, s.repo.Database, oids); err != nil {
+		return err
+	}
+	if err := data.Flush(); err != nil {
+		return err
+	}
+	return out.Flush()
+}